@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+)
+
+// migrateLayout moves the stored videos into the configured storage layout and prints the report as JSON
+func migrateLayout() {
+	pgConn := initDB()
+	filesService := initFilesService(pgConn)
+
+	report, err := filesService.MigrateLayout(context.Background())
+	printJSON(report)
+	if err != nil {
+		log.Fatalf("failed to migrate storage layout, err: %v", err)
+	}
+}
+
+// resyncReplicas restores the missing and mismatched replicas of the stored videos and prints the report as JSON
+func resyncReplicas() {
+	pgConn := initDB()
+	filesService := initFilesService(pgConn)
+
+	report, err := filesService.ResyncReplicas(context.Background())
+	printJSON(report)
+	if err != nil {
+		log.Fatalf("failed to resync replicas, err: %v", err)
+	}
+}
+
+// rotateKey rewraps the data keys of the stored videos with the master key of ENCRYPTION_KEY_FILE, renaming the videos
+// stored under a name given by the previous master key, and prints the report as JSON.
+// The previous master key has to be listed in ENCRYPTION_OLD_KEY_FILES until the rotation is completed.
+func rotateKey() {
+	pgConn := initDB()
+	filesService := initFilesService(pgConn)
+
+	report, err := filesService.RotateEncryptionKey(context.Background())
+	printJSON(report)
+	if err != nil {
+		log.Fatalf("failed to rotate encryption key, err: %v", err)
+	}
+}
+
+// setQuota sets the quota of an owner from the arguments: [owner] max_bytes max_files.
+// Without an owner the quota of the whole storage is set, a zero limit means unlimited.
+func setQuota(args []string) {
+	owner := ""
+	if len(args) == 3 {
+		owner, args = args[0], args[1:]
+	}
+	if len(args) != 2 {
+		log.Fatalf("usage: %s [owner] max_bytes max_files", commandSetQuota)
+	}
+	maxBytes, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		log.Fatalf("invalid max_bytes: %s, err: %v", args[0], err)
+	}
+	maxFiles, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		log.Fatalf("invalid max_files: %s, err: %v", args[1], err)
+	}
+
+	pgConn := initDB()
+	filesService := initFilesService(pgConn)
+
+	ctx := context.Background()
+	if err := filesService.SetQuota(ctx, owner, maxBytes, maxFiles); err != nil {
+		log.Fatalf("failed to set quota, err: %v", err)
+	}
+	report, err := filesService.GetUsage(ctx, owner)
+	if err != nil {
+		log.Fatalf("failed to get usage, err: %v", err)
+	}
+	printJSON(report)
+}
+
+// fsck reconciles the stored videos with the DB and prints the report as JSON, with -repair the inconsistencies are repaired.
+// It exits with status 1 when inconsistencies were found and not repaired.
+func fsck(args []string) {
+	flags := flag.NewFlagSet(commandFsck, flag.ExitOnError)
+	repair := flags.Bool("repair", false, "quarantine the orphan blobs and mark the files with missing or damaged blobs as broken")
+	_ = flags.Parse(args)
+
+	pgConn := initDB()
+	filesService := initFilesService(pgConn)
+
+	report, err := filesService.Fsck(context.Background(), *repair)
+	printJSON(report)
+	if err != nil {
+		log.Fatalf("failed to check storage consistency, err: %v", err)
+	}
+	if (!report.Clean() && !*repair) || len(report.FailedRepairs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// collectGarbage removes the abandoned temporary files and the orphan blobs older than the grace period and prints the report as JSON,
+// with -dry-run the garbage is only reported
+func collectGarbage(args []string) {
+	flags := flag.NewFlagSet(commandGC, flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report the garbage without removing it")
+	gracePeriod := flags.Duration("grace-period", filesSvc.DefaultGCGracePeriod, "minimum age of the removed temporary files and orphan blobs")
+	_ = flags.Parse(args)
+
+	pgConn := initDB()
+	filesService := initFilesService(pgConn)
+
+	report, err := filesService.CollectGarbage(context.Background(), *gracePeriod, *dryRun)
+	printJSON(report)
+	if err != nil {
+		log.Fatalf("failed to collect garbage, err: %v", err)
+	}
+	if len(report.FailedBlobs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// runReplicaResync periodically restores the replicas in the background, it returns immediately when the storage keeps a single copy
+func runReplicaResync(filesService filesSvc.Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.ResyncReplicas(context.Background())
+		if errors.Is(err, filesSvc.ErrorReplicationUnsupported) {
+			return
+		}
+		if err != nil {
+			log.Printf("failed to resync replicas, err: %v", err)
+			continue
+		}
+		if report.RestoredReplicas > 0 || len(report.FailedFiles) > 0 {
+			log.Printf("replicas resync restored: %d, failed files: %v", report.RestoredReplicas, report.FailedFiles)
+		}
+	}
+}
+
+// runTiering periodically moves the files which were not accessed within coldAfter to the cold tier,
+// it returns immediately when the storage has a single tier
+func runTiering(filesService filesSvc.Service, interval, coldAfter time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.DemoteColdFiles(context.Background(), coldAfter)
+		if errors.Is(err, filesSvc.ErrorTieringUnsupported) {
+			return
+		}
+		if err != nil {
+			log.Printf("failed to demote cold files, err: %v", err)
+			continue
+		}
+		if report.DemotedBlobs > 0 || len(report.FailedFiles) > 0 {
+			log.Printf("tiering demoted: %d, failed files: %v", report.DemotedBlobs, report.FailedFiles)
+		}
+	}
+}
+
+// runRecovery periodically finishes the uploads and deletions left pending or deleting for longer than gracePeriod
+func runRecovery(filesService filesSvc.Service, interval, gracePeriod time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.Recover(context.Background(), gracePeriod)
+		if err != nil {
+			log.Printf("failed to recover files, err: %v", err)
+			continue
+		}
+		logRecovery(report)
+	}
+}
+
+// runGC periodically removes the abandoned temporary files and the orphan blobs older than gracePeriod,
+// with dryRun the garbage is only logged
+func runGC(filesService filesSvc.Service, interval, gracePeriod time.Duration, dryRun bool) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.CollectGarbage(context.Background(), gracePeriod, dryRun)
+		if err != nil {
+			log.Printf("failed to collect garbage, err: %v", err)
+			continue
+		}
+		if len(report.RemovedTempFiles) > 0 || len(report.RemovedOrphanBlobs) > 0 || len(report.FailedBlobs) > 0 {
+			log.Printf("gc dry run: %v, temp files: %d, orphan blobs: %d, reclaimed bytes: %d, failed blobs: %v",
+				report.DryRun, len(report.RemovedTempFiles), len(report.RemovedOrphanBlobs), report.ReclaimedBytes, report.FailedBlobs)
+		}
+	}
+}
+
+// runExpiryReaper periodically deletes the expired files permanently and logs them
+func runExpiryReaper(filesService filesSvc.Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.ReapExpiredFiles(context.Background())
+		if err != nil {
+			log.Printf("failed to delete expired files, err: %v", err)
+			continue
+		}
+		if len(report.DeletedFiles) > 0 || len(report.FailedFiles) > 0 {
+			log.Printf("expired files deleted: %v, failed files: %v", report.DeletedFiles, report.FailedFiles)
+		}
+	}
+}
+
+// runTrashPurge periodically deletes the files kept in the trash longer than retention
+func runTrashPurge(filesService filesSvc.Service, interval, retention time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.PurgeTrash(context.Background(), retention)
+		if err != nil {
+			log.Printf("failed to purge the trash, err: %v", err)
+			continue
+		}
+		if report.PurgedFiles > 0 || len(report.FailedFiles) > 0 {
+			log.Printf("trash purged: %d, failed files: %v", report.PurgedFiles, report.FailedFiles)
+		}
+	}
+}
+
+// runUploadCleanup periodically aborts the resumable uploads which received no chunk before their expiry
+func runUploadCleanup(filesService filesSvc.Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.AbortExpiredUploads(context.Background())
+		if err != nil {
+			log.Printf("failed to clean up resumable uploads, err: %v", err)
+			continue
+		}
+		if report.AbortedUploads > 0 || len(report.FailedUploads) > 0 {
+			log.Printf("expired resumable uploads aborted: %d, failed uploads: %v", report.AbortedUploads, report.FailedUploads)
+		}
+	}
+}
+
+// runMultipartCleanup periodically aborts the multipart uploads started longer than expiry ago
+func runMultipartCleanup(filesService filesSvc.Service, interval, expiry time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := filesService.AbortAbandonedMultipartUploads(context.Background(), expiry)
+		if err != nil {
+			log.Printf("failed to clean up multipart uploads, err: %v", err)
+			continue
+		}
+		if report.AbortedUploads > 0 || len(report.FailedUploads) > 0 {
+			log.Printf("abandoned multipart uploads aborted: %d, failed uploads: %v", report.AbortedUploads, report.FailedUploads)
+		}
+	}
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("failed to print report, err: %v", err)
+	}
+}
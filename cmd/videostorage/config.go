@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnvInt returns the integer value of the environment variable or defaultValue when it is not set
+func getEnvInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid value of %s: %s, err: %v", name, value, err)
+	}
+	return result
+}
+
+// getEnvInt64 returns the 64-bit integer value of the environment variable or defaultValue when it is not set
+func getEnvInt64(name string, defaultValue int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("invalid value of %s: %s, err: %v", name, value, err)
+	}
+	return result
+}
+
+// getEnvDuration returns the duration value of the environment variable or defaultValue when it is not set
+func getEnvDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid value of %s: %s, err: %v", name, value, err)
+	}
+	return result
+}
+
+// getEnvBool returns the boolean value of the environment variable or defaultValue when it is not set
+func getEnvBool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid value of %s: %s, err: %v", name, value, err)
+	}
+	return result
+}
+
+// getEnvList returns the non-empty comma separated values of the environment variable
+func getEnvList(name string) []string {
+	result := make([]string, 0)
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -1,43 +1,105 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
 	"mime"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/cityos-dev/Cornelius-David-Herianto/goose/migration_script"
 	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/postgresql"
+	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/s3"
 	filesHandler "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/handler"
 	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	filesCryptoStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/cryptostore"
+	filesErasureStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/erasurestore"
+	filesLocalStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	filesMirrorStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mirrorstore"
+	filesPGBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/pgblobstore"
+	filesS3Store "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/s3store"
+	filesTierStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/tierstore"
 	filesPGStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/pgstore"
 	healthHandler "github.com/cityos-dev/Cornelius-David-Herianto/internal/health/handler"
 	healthSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/health/service"
 )
 
+const (
+	commandServe          = "serve"
+	commandMigrateLayout  = "migrate-layout"
+	commandResyncReplicas = "resync-replicas"
+	commandRotateKey      = "rotate-key"
+	commandSetQuota       = "set-quota"
+	commandFsck           = "fsck"
+	commandGC             = "gc"
+
+	storageBackendLocal   = "local"
+	storageBackendMirror  = "mirror"
+	storageBackendErasure = "erasure"
+	storageBackendS3      = "s3"
+	storageBackendPG      = "postgres"
+)
+
 func main() {
+	command := commandServe
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case commandServe:
+		serve()
+	case commandMigrateLayout:
+		migrateLayout()
+	case commandResyncReplicas:
+		resyncReplicas()
+	case commandRotateKey:
+		rotateKey()
+	case commandSetQuota:
+		setQuota(os.Args[2:])
+	case commandFsck:
+		fsck(os.Args[2:])
+	case commandGC:
+		collectGarbage(os.Args[2:])
+	default:
+		log.Fatalf("unknown command: %s, available commands: %s, %s, %s, %s, %s, %s, %s", command, commandServe, commandMigrateLayout, commandResyncReplicas, commandRotateKey, commandSetQuota, commandFsck, commandGC)
+	}
+}
+
+// serve runs the HTTP server
+func serve() {
 	// initialize echo
 	e := echo.New()
 	e.HideBanner = true
 	e.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
-		Skipper: middleware.DefaultSkipper,
+		// uploads are streamed and may take longer than the timeout for large videos,
+		// so do the chunks of the resumable uploads, the parts of the multipart uploads and their completion, and the admin tasks
+		Skipper: func(ctx echo.Context) bool {
+			return (ctx.Request().Method == http.MethodPost && ctx.Path() == "/v1/files") ||
+				(ctx.Request().Method == http.MethodPut && ctx.Path() == "/v1/files/:fileID") ||
+				(ctx.Request().Method == http.MethodPatch && ctx.Path() == "/v1/uploads/:uploadID") ||
+				(ctx.Request().Method == http.MethodPut && ctx.Path() == "/v1/multipart-uploads/:uploadID/parts/:partNumber") ||
+				(ctx.Request().Method == http.MethodPost && ctx.Path() == "/v1/multipart-uploads/:uploadID/complete") ||
+				strings.HasPrefix(ctx.Path(), "/v1/admin/")
+		},
 		Timeout: 30 * time.Second,
 	}))
 
-	// database connection initialization
-	pgConn, err := postgresql.NewPostgresSQLConnection(os.Getenv("POSTGRES_HOST"))
-	if err != nil {
-		log.Fatalf("failed to connect to DB, err: %v", err)
-	}
-
-	// setup DB
-	err = migration_script.MigrateUp(pgConn.DB)
-	if err != nil {
-		log.Fatalf("failed to do DB migration, err: %v", err)
-	}
+	pgConn := initDB()
 
 	// initialize mime type mapping
 	mime.AddExtensionType(".mp4", "video/mp4")
@@ -45,14 +107,24 @@ func main() {
 	mime.AddExtensionType(".mpeg", "video/mpeg")
 
 	// -- services initialization --
-	// health service
-	healthService := healthSvc.New(pgConn)
-	healthHTTPHandler := healthHandler.New(healthService)
-
 	// files service
-	filesPostgresStore := filesPGStore.NewPostgresStore(pgConn)
-	filesService := filesSvc.New(filesPostgresStore)
+	filesService := initFilesService(pgConn)
 	filesHTTPHandler := filesHandler.New(filesService)
+	initGlobalQuota(filesService)
+	recoveryGracePeriod := getEnvDuration("STORAGE_RECOVERY_GRACE_PERIOD", filesSvc.DefaultRecoveryGracePeriod)
+	recoverFiles(filesService, recoveryGracePeriod)
+	go runRecovery(filesService, getEnvDuration("STORAGE_RECOVERY_INTERVAL", time.Hour), recoveryGracePeriod)
+	go runReplicaResync(filesService, getEnvDuration("STORAGE_RESYNC_INTERVAL", time.Hour))
+	go runTiering(filesService, getEnvDuration("STORAGE_TIERING_INTERVAL", time.Hour), getEnvDuration("STORAGE_COLD_AFTER", 7*24*time.Hour))
+	go runGC(filesService, getEnvDuration("STORAGE_GC_INTERVAL", time.Hour), getEnvDuration("STORAGE_GC_GRACE_PERIOD", filesSvc.DefaultGCGracePeriod), getEnvBool("STORAGE_GC_DRY_RUN", false))
+	go runExpiryReaper(filesService, getEnvDuration("STORAGE_EXPIRY_INTERVAL", time.Minute))
+	go runTrashPurge(filesService, getEnvDuration("STORAGE_TRASH_PURGE_INTERVAL", time.Hour), getEnvDuration("STORAGE_TRASH_RETENTION", filesSvc.DefaultTrashRetention))
+	go runUploadCleanup(filesService, getEnvDuration("STORAGE_UPLOAD_CLEANUP_INTERVAL", time.Hour))
+	go runMultipartCleanup(filesService, getEnvDuration("STORAGE_MULTIPART_CLEANUP_INTERVAL", time.Hour), getEnvDuration("STORAGE_MULTIPART_EXPIRY", filesSvc.DefaultMultipartExpiry))
+
+	// health service, the storage of the files is checked as well
+	healthService := healthSvc.New(pgConn, filesService)
+	healthHTTPHandler := healthHandler.New(healthService)
 
 	// routes definition
 	g := e.Group("/v1")
@@ -60,8 +132,251 @@ func main() {
 
 	g.POST("/files", filesHTTPHandler.UploadFile)
 	g.GET("/files/:fileID", filesHTTPHandler.GetFileByID)
+	g.PUT("/files/:fileID", filesHTTPHandler.PutFile)
 	g.GET("/files", filesHTTPHandler.GetAllFiles)
 	g.DELETE("/files/:fileID", filesHTTPHandler.DeleteFileByID)
+	g.PATCH("/files/:fileID", filesHTTPHandler.SetFileExpiry)
+	g.POST("/files/:fileID/restore", filesHTTPHandler.RestoreFile)
+	g.GET("/trash", filesHTTPHandler.GetTrash)
+	g.GET("/files/:fileID/versions", filesHTTPHandler.GetFileVersions)
+	g.GET("/files/:fileID/versions/:version", filesHTTPHandler.GetFileVersion)
+	g.DELETE("/files/:fileID/versions/:version", filesHTTPHandler.DeleteFileVersion)
+	g.GET("/usage", filesHTTPHandler.GetUsage)
+
+	// resumable uploads, following the tus protocol
+	g.OPTIONS("/uploads", filesHTTPHandler.GetUploadOptions)
+	g.POST("/uploads", filesHTTPHandler.CreateUpload)
+	g.HEAD("/uploads/:uploadID", filesHTTPHandler.GetUploadOffset)
+	g.PATCH("/uploads/:uploadID", filesHTTPHandler.PatchUpload)
+	g.DELETE("/uploads/:uploadID", filesHTTPHandler.DeleteUpload)
+
+	// multipart uploads, the parts can be uploaded in parallel before the upload is completed
+	g.POST("/multipart-uploads", filesHTTPHandler.CreateMultipartUpload)
+	g.PUT("/multipart-uploads/:uploadID/parts/:partNumber", filesHTTPHandler.UploadPart)
+	g.POST("/multipart-uploads/:uploadID/complete", filesHTTPHandler.CompleteMultipartUpload)
+	g.DELETE("/multipart-uploads/:uploadID", filesHTTPHandler.AbortMultipartUpload)
+
+	// admin routes are only served when ADMIN_TOKEN is set, the token has to be sent as bearer token
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		admin := g.Group("/admin", middleware.KeyAuth(func(key string, _ echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(adminToken)) == 1, nil
+		}))
+		admin.POST("/fsck", filesHTTPHandler.Fsck)
+		admin.POST("/gc", filesHTTPHandler.CollectGarbage)
+		admin.GET("/metrics", echo.WrapHandler(expvar.Handler()))
+	}
+
+	go func() {
+		if err := e.Start(":8080"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// on SIGINT or SIGTERM, the requests in progress are finished and so is the background work of the blob storage they started
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.Printf("failed to stop the server gracefully, err: %v", err)
+	}
+	if err := filesService.Shutdown(ctx); err != nil {
+		log.Printf("failed to wait for the blob storage, err: %v", err)
+	}
+}
+
+// initDB connects to the database and migrates it to the most recent version
+func initDB() *sqlx.DB {
+	// database connection initialization
+	pgConn, err := postgresql.NewPostgresSQLConnection(os.Getenv("POSTGRES_HOST"))
+	if err != nil {
+		log.Fatalf("failed to connect to DB, err: %v", err)
+	}
 
-	e.Logger.Fatal(e.Start(":8080"))
+	// setup DB
+	err = migration_script.MigrateUp(pgConn.DB)
+	if err != nil {
+		log.Fatalf("failed to do DB migration, err: %v", err)
+	}
+	return pgConn
+}
+
+// initFilesService initializes the files service with the configured stores,
+// uploads are refused while a local disk of the storage has less than STORAGE_MIN_FREE_BYTES free.
+// The content received by the resumable uploads is kept under STORAGE_UPLOADS_PATH, a hidden directory of the storage root by default,
+// until they receive no chunk for STORAGE_UPLOAD_EXPIRY, and so are the parts received by the multipart uploads under STORAGE_MULTIPART_PATH.
+func initFilesService(pgConn *sqlx.DB) filesSvc.Service {
+	filesPostgresStore := filesPGStore.NewPostgresStore(pgConn)
+	filesBlobStore, err := initBlobStore(pgConn)
+	if err != nil {
+		log.Fatalf("failed to initialize blob storage, err: %v", err)
+	}
+	filesBlobStore, err = initEncryption(filesBlobStore)
+	if err != nil {
+		log.Fatalf("failed to initialize blob encryption, err: %v", err)
+	}
+	filesBlobStore, err = initTiering(filesBlobStore)
+	if err != nil {
+		log.Fatalf("failed to initialize blob tiering, err: %v", err)
+	}
+	minFreeBytes := getEnvInt64("STORAGE_MIN_FREE_BYTES", 0)
+	if minFreeBytes < 0 {
+		log.Fatalf("invalid STORAGE_MIN_FREE_BYTES: %d", minFreeBytes)
+	}
+	storagePath := os.Getenv("STORAGE_PATH")
+	if storagePath == "" {
+		storagePath = filesLocalStore.DefaultRootPath
+	}
+	uploadsPath := os.Getenv("STORAGE_UPLOADS_PATH")
+	if uploadsPath == "" {
+		uploadsPath = filepath.Join(storagePath, ".tus")
+	}
+	multipartPath := os.Getenv("STORAGE_MULTIPART_PATH")
+	if multipartPath == "" {
+		multipartPath = filepath.Join(storagePath, ".multipart")
+	}
+	opts := []filesSvc.Option{
+		filesSvc.WithMinFreeBytes(uint64(minFreeBytes)),
+		filesSvc.WithResumableUploads(uploadsPath),
+		filesSvc.WithUploadExpiry(getEnvDuration("STORAGE_UPLOAD_EXPIRY", filesSvc.DefaultUploadExpiry)),
+		filesSvc.WithMultipartUploads(multipartPath),
+	}
+	if getEnvBool("STORAGE_VERSIONING", false) {
+		opts = append(opts, filesSvc.WithVersioning())
+	}
+	return filesSvc.New(filesPostgresStore, filesBlobStore, opts...)
+}
+
+// initGlobalQuota applies the quota of the whole storage from QUOTA_MAX_BYTES and QUOTA_MAX_FILES when any of them is set,
+// otherwise the quota stored in the DB is kept. A zero limit means unlimited.
+func initGlobalQuota(filesService filesSvc.Service) {
+	if os.Getenv("QUOTA_MAX_BYTES") == "" && os.Getenv("QUOTA_MAX_FILES") == "" {
+		return
+	}
+	maxBytes, maxFiles := getEnvInt64("QUOTA_MAX_BYTES", 0), getEnvInt64("QUOTA_MAX_FILES", 0)
+	if err := filesService.SetQuota(context.Background(), "", maxBytes, maxFiles); err != nil {
+		log.Fatalf("failed to set storage quota, err: %v", err)
+	}
+}
+
+// recoverFiles finishes the uploads and deletions interrupted by a previous crash, before any request is served.
+// The operations interrupted within gracePeriod are left to runRecovery, they may still be in progress on another instance.
+func recoverFiles(filesService filesSvc.Service, gracePeriod time.Duration) {
+	report, err := filesService.Recover(context.Background(), gracePeriod)
+	if err != nil {
+		log.Fatalf("failed to recover files, err: %v", err)
+	}
+	logRecovery(report)
+}
+
+// logRecovery logs the files recovered, when there are any
+func logRecovery(report filesSvc.RecoveryReport) {
+	if report.ActivatedFiles+report.RolledBackFiles+report.DeletedFiles+len(report.FailedFiles) > 0 {
+		log.Printf("recovered files, activated: %d, rolled back: %d, deleted: %d, failed: %v",
+			report.ActivatedFiles, report.RolledBackFiles, report.DeletedFiles, report.FailedFiles)
+	}
+}
+
+// initBlobStore initializes the blob store selected by STORAGE_BACKEND, the local disk is used by default
+func initBlobStore(pgConn *sqlx.DB) (blobstore.BlobStore, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", storageBackendLocal:
+		return filesLocalStore.NewLocalStore(os.Getenv("STORAGE_PATH"), getEnvInt("STORAGE_FANOUT_LEVELS", 2))
+	case storageBackendMirror:
+		rootPaths := getEnvList("STORAGE_MIRROR_PATHS")
+		localStores, err := initLocalStores(rootPaths)
+		if err != nil {
+			return nil, err
+		}
+		replicas := make([]filesMirrorStore.Replica, 0, len(localStores))
+		for i, localStore := range localStores {
+			replicas = append(replicas, filesMirrorStore.Replica{Name: rootPaths[i], Store: localStore})
+		}
+		return filesMirrorStore.NewMirrorStore(replicas)
+	case storageBackendErasure:
+		rootPaths := getEnvList("STORAGE_ERASURE_PATHS")
+		localStores, err := initLocalStores(rootPaths)
+		if err != nil {
+			return nil, err
+		}
+		shards := make([]filesErasureStore.Shard, 0, len(localStores))
+		for i, localStore := range localStores {
+			shards = append(shards, filesErasureStore.Shard{Name: rootPaths[i], Store: localStore})
+		}
+		return filesErasureStore.NewErasureStore(shards, getEnvInt("STORAGE_ERASURE_DATA_SHARDS", 0), filesErasureStore.DefaultBlockSize)
+	case storageBackendS3:
+		client, err := s3.NewClient(s3.Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return filesS3Store.NewS3Store(client, filesS3Store.Options{
+			Prefix:   os.Getenv("S3_PREFIX"),
+			SpoolDir: os.Getenv("STORAGE_PATH"),
+			PartSize: int64(getEnvInt("S3_PART_SIZE", filesS3Store.DefaultPartSize)),
+		})
+	case storageBackendPG:
+		return filesPGBlobStore.NewPGBlobStore(pgConn, getEnvInt("STORAGE_PG_CHUNK_SIZE", filesPGBlobStore.DefaultChunkSize))
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s, available backends: %s, %s, %s, %s, %s", backend, storageBackendLocal, storageBackendMirror, storageBackendErasure, storageBackendS3, storageBackendPG)
+	}
+}
+
+// initEncryption wraps the blob store with encryption at rest when ENCRYPTION_KEY_FILE is set.
+// The keys listed in ENCRYPTION_OLD_KEY_FILES are kept to read the data keys until they are rotated.
+func initEncryption(blobStore blobstore.BlobStore) (blobstore.BlobStore, error) {
+	keyFile := os.Getenv("ENCRYPTION_KEY_FILE")
+	if keyFile == "" {
+		return blobStore, nil
+	}
+	activeKey, err := filesCryptoStore.LoadMasterKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	oldKeys := make([]filesCryptoStore.MasterKey, 0)
+	for _, oldKeyFile := range getEnvList("ENCRYPTION_OLD_KEY_FILES") {
+		oldKey, err := filesCryptoStore.LoadMasterKey(oldKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		oldKeys = append(oldKeys, oldKey)
+	}
+	return filesCryptoStore.NewCryptoStore(blobStore, activeKey, oldKeys...)
+}
+
+// initTiering adds a cold tier on the local disk of STORAGE_COLD_PATH when it is set,
+// the cold tier is encrypted with the same keys as the hot one
+func initTiering(hotStore blobstore.BlobStore) (blobstore.BlobStore, error) {
+	coldPath := os.Getenv("STORAGE_COLD_PATH")
+	if coldPath == "" {
+		return hotStore, nil
+	}
+	coldStore, err := filesLocalStore.NewLocalStore(coldPath, getEnvInt("STORAGE_FANOUT_LEVELS", 2))
+	if err != nil {
+		return nil, err
+	}
+	encryptedColdStore, err := initEncryption(coldStore)
+	if err != nil {
+		return nil, err
+	}
+	return filesTierStore.NewTierStore(hotStore, encryptedColdStore), nil
+}
+
+// initLocalStores initializes a local blob store for every root path, e.g. one per disk
+func initLocalStores(rootPaths []string) ([]blobstore.BlobStore, error) {
+	localStores := make([]blobstore.BlobStore, 0, len(rootPaths))
+	for _, rootPath := range rootPaths {
+		localStore, err := filesLocalStore.NewLocalStore(rootPath, getEnvInt("STORAGE_FANOUT_LEVELS", 2))
+		if err != nil {
+			return nil, err
+		}
+		localStores = append(localStores, localStore)
+	}
+	return localStores, nil
 }
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS blobs(
+    digest      VARCHAR,
+    size        BIGINT,
+    ref_count   INTEGER         NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT blobs_pk PRIMARY KEY (digest)
+);
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS digest VARCHAR REFERENCES blobs(digest);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS digest;
+
+DROP TABLE IF EXISTS blobs;
+-- +goose StatementEnd
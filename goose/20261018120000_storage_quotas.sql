@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN IF NOT EXISTS owner VARCHAR NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS quotas(
+    owner       VARCHAR,
+    max_bytes   BIGINT          NOT NULL DEFAULT 0,
+    max_files   BIGINT          NOT NULL DEFAULT 0,
+    CONSTRAINT quotas_pk PRIMARY KEY (owner)
+);
+
+CREATE TABLE IF NOT EXISTS usages(
+    owner       VARCHAR,
+    used_bytes  BIGINT          NOT NULL DEFAULT 0,
+    used_files  BIGINT          NOT NULL DEFAULT 0,
+    CONSTRAINT usages_pk PRIMARY KEY (owner)
+);
+
+-- the usage of the whole storage is kept under the '*' owner
+INSERT INTO usages (owner, used_bytes, used_files)
+SELECT owner, SUM(size), COUNT(*) FROM files GROUP BY owner
+UNION ALL
+SELECT '*', COALESCE(SUM(size), 0), COUNT(*) FROM files;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS usages;
+
+DROP TABLE IF EXISTS quotas;
+
+ALTER TABLE files DROP COLUMN IF EXISTS owner;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'active'
+    CONSTRAINT files_status_check CHECK (status IN ('pending', 'active', 'deleting'));
+
+CREATE INDEX IF NOT EXISTS files_status_idx ON files (status) WHERE status <> 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS files_status_idx;
+
+ALTER TABLE files DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS blob_contents(
+    id          BIGSERIAL,
+    size        BIGINT          NOT NULL DEFAULT 0,
+    chunk_size  INTEGER         NOT NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT blob_contents_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS blob_chunks(
+    content_id  BIGINT          REFERENCES blob_contents(id) ON DELETE CASCADE,
+    seq         INTEGER,
+    data        BYTEA           NOT NULL,
+    CONSTRAINT blob_chunks_pk PRIMARY KEY (content_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS blob_keys(
+    key         VARCHAR,
+    content_id  BIGINT          NOT NULL REFERENCES blob_contents(id),
+    mod_time    TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT blob_keys_pk PRIMARY KEY (key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS blob_keys;
+
+DROP TABLE IF EXISTS blob_chunks;
+
+DROP TABLE IF EXISTS blob_contents;
+-- +goose StatementEnd
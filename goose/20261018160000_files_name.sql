@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN IF NOT EXISTS name VARCHAR;
+
+-- the files uploaded before the ids were generated are named after their id
+UPDATE files SET name = id WHERE name IS NULL;
+
+ALTER TABLE files ALTER COLUMN name SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS name;
+-- +goose StatementEnd
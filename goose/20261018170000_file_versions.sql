@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN IF NOT EXISTS file_id VARCHAR;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- every record is a version of a file, the files stored so far are the first version of themselves
+UPDATE files SET file_id = id WHERE file_id IS NULL;
+
+ALTER TABLE files ALTER COLUMN file_id SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS files_file_id_version_idx ON files (file_id, version);
+CREATE INDEX IF NOT EXISTS files_name_idx ON files (name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS files_name_idx;
+DROP INDEX IF EXISTS files_file_id_version_idx;
+
+ALTER TABLE files DROP COLUMN IF EXISTS version;
+ALTER TABLE files DROP COLUMN IF EXISTS file_id;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files DROP CONSTRAINT IF EXISTS files_status_check;
+ALTER TABLE files ADD CONSTRAINT files_status_check CHECK (status IN ('pending', 'active', 'deleting', 'trashed'));
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS trashed_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the trashed files are restored, since the trash is gone
+UPDATE files SET status = 'active' WHERE status = 'trashed';
+
+ALTER TABLE files DROP COLUMN IF EXISTS trashed_at;
+
+ALTER TABLE files DROP CONSTRAINT IF EXISTS files_status_check;
+ALTER TABLE files ADD CONSTRAINT files_status_check CHECK (status IN ('pending', 'active', 'deleting'));
+-- +goose StatementEnd
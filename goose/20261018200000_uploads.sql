@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the resumable uploads in progress, their content is kept on the storage until they are complete
+CREATE TABLE IF NOT EXISTS uploads(
+    id              VARCHAR,
+    name            VARCHAR         NOT NULL,
+    owner           VARCHAR         NOT NULL DEFAULT '',
+    upload_length   BIGINT          NOT NULL,
+    upload_offset   BIGINT          NOT NULL DEFAULT 0,
+    metadata        VARCHAR         NOT NULL DEFAULT '',
+    created_at      TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uploads_pk PRIMARY KEY (id),
+    CONSTRAINT uploads_offset_check CHECK (upload_offset BETWEEN 0 AND upload_length)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS uploads;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the multipart upload sessions, their parts are kept on the storage until the session is completed or aborted
+CREATE TABLE IF NOT EXISTS multipart_uploads(
+    id          VARCHAR,
+    name        VARCHAR         NOT NULL,
+    owner       VARCHAR         NOT NULL DEFAULT '',
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT multipart_uploads_pk PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS multipart_uploads_created_at_idx ON multipart_uploads (created_at);
+
+CREATE TABLE IF NOT EXISTS multipart_parts(
+    upload_id   VARCHAR,
+    part_number INTEGER,
+    size        BIGINT          NOT NULL,
+    checksum    VARCHAR         NOT NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT multipart_parts_pk PRIMARY KEY (upload_id, part_number),
+    CONSTRAINT multipart_parts_upload_fk FOREIGN KEY (upload_id) REFERENCES multipart_uploads (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS multipart_parts;
+
+DROP TABLE IF EXISTS multipart_uploads;
+-- +goose StatementEnd
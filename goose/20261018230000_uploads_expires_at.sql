@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the uploads in progress before the expiry was introduced get a day from now to be finished
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP + INTERVAL '1 day';
+
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx ON uploads (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS uploads_expires_at_idx;
+
+ALTER TABLE uploads DROP COLUMN IF EXISTS expires_at;
+-- +goose StatementEnd
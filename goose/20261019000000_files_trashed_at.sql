@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS files_trashed_at_idx ON files (trashed_at) WHERE status = 'trashed';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS files_trashed_at_idx;
+-- +goose StatementEnd
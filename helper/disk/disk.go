@@ -0,0 +1,39 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrorUnsupported is returned when the usage of a disk cannot be read on the current platform
+var ErrorUnsupported = errors.New("disk usage is not supported on this platform")
+
+// Usage represents the space and the inodes of the filesystem holding a path
+type Usage struct {
+	FreeBytes   uint64
+	TotalBytes  uint64
+	FreeInodes  uint64
+	TotalInodes uint64
+}
+
+// CheckWritable verifies a file can be created and written under the directory,
+// the probe file is named with prefix so it can be told apart from the other files of the directory
+func CheckWritable(dir, prefix string) error {
+	probe, err := os.CreateTemp(dir, prefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create file on: %s, err: %v", dir, err)
+	}
+	defer func() {
+		_ = os.Remove(probe.Name())
+	}()
+
+	_, err = probe.Write([]byte("ok"))
+	if closeErr := probe.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file on: %s, err: %v", dir, err)
+	}
+	return nil
+}
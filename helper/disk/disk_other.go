@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package disk
+
+// GetUsage is not supported on this platform
+func GetUsage(_ string) (Usage, error) {
+	return Usage{}, ErrorUnsupported
+}
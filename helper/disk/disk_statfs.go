@@ -0,0 +1,23 @@
+//go:build linux || darwin
+
+package disk
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// GetUsage returns the usage of the filesystem holding the path, the free space is the one available to unprivileged users
+func GetUsage(path string) (Usage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Usage{}, fmt.Errorf("failed to stat filesystem of: %s, err: %v", path, err)
+	}
+	blockSize := uint64(stat.Bsize)
+	return Usage{
+		FreeBytes:   uint64(stat.Bavail) * blockSize,
+		TotalBytes:  uint64(stat.Blocks) * blockSize,
+		FreeInodes:  uint64(stat.Ffree),
+		TotalInodes: uint64(stat.Files),
+	}, nil
+}
@@ -0,0 +1,295 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors represent custom error that will be verified by the caller
+var (
+	ErrorNotFound = errors.New("object not found")
+)
+
+// Config represents the configuration of an S3-compatible object storage (AWS S3, MinIO, Ceph RGW)
+type Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// ObjectInfo represents the detail of an object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// CompletedPart represents an uploaded part of a multipart upload
+type CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// Client is a minimal S3 client using path-style requests signed with Signature Version 4
+type Client struct {
+	config     Config
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+// NewClient returns new Client for the configured bucket
+func NewClient(config Config, httpClient *http.Client) (*Client, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("endpoint and bucket are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %s, err: %v", config.Endpoint, err)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		config:     config,
+		endpoint:   endpoint,
+		httpClient: httpClient,
+	}, nil
+}
+
+// PutObject uploads the object in a single request, size must be the exact length of body
+func (c *Client) PutObject(ctx context.Context, key string, body io.Reader, size int64) error {
+	res, err := c.do(ctx, http.MethodPut, key, nil, nil, body, size)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// GetObject returns the object content, a non-negative length limits the content to the given byte range
+func (c *Client) GetObject(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	headers := http.Header{}
+	if offset > 0 || length >= 0 {
+		rangeValue := fmt.Sprintf("bytes=%d-", offset)
+		if length >= 0 {
+			rangeValue += strconv.FormatInt(offset+length-1, 10)
+		}
+		headers.Set("Range", rangeValue)
+	}
+	res, err := c.do(ctx, http.MethodGet, key, nil, headers, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// HeadObject returns the detail of the object
+func (c *Client) HeadObject(ctx context.Context, key string) (ObjectInfo, error) {
+	res, err := c.do(ctx, http.MethodHead, key, nil, nil, nil, 0)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	_ = res.Body.Close()
+
+	lastModified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return ObjectInfo{
+		Key:          key,
+		Size:         res.ContentLength,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: lastModified,
+	}, nil
+}
+
+// DeleteObject removes the object, removing a non-existing object is not an error
+func (c *Client) DeleteObject(ctx context.Context, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// ListObjects returns all objects which key starts with prefix
+func (c *Client) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	type listBucketResult struct {
+		Contents []struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			ETag         string    `xml:"ETag"`
+			LastModified time.Time `xml:"LastModified"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	result := make([]ObjectInfo, 0)
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		var page listBucketResult
+		if err := c.doXML(ctx, http.MethodGet, "", query, nil, &page); err != nil {
+			return result, err
+		}
+		for _, content := range page.Contents {
+			result = append(result, ObjectInfo{
+				Key:          content.Key,
+				Size:         content.Size,
+				ETag:         content.ETag,
+				LastModified: content.LastModified,
+			})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return result, nil
+		}
+		continuationToken = page.NextContinuationToken
+	}
+}
+
+// CreateMultipartUpload initiates a multipart upload and returns its upload id
+func (c *Client) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	query := url.Values{}
+	query.Set("uploads", "")
+	if err := c.doXML(ctx, http.MethodPost, key, query, nil, &result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+// UploadPart uploads a part of a multipart upload and returns its ETag
+func (c *Client) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64) (string, error) {
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("uploadId", uploadID)
+	res, err := c.do(ctx, http.MethodPut, key, query, nil, body, size)
+	if err != nil {
+		return "", err
+	}
+	_ = res.Body.Close()
+	return res.Header.Get("ETag"), nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the object
+func (c *Client) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	type completeMultipartUpload struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []CompletedPart `xml:"Part"`
+	}
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	// the response may be an error even with 200 status code, so it is always decoded
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := c.doXML(ctx, http.MethodPost, key, query, body, &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("failed to complete multipart upload, code: %s, message: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its uploaded parts
+func (c *Client) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	res, err := c.do(ctx, http.MethodDelete, key, query, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *Client) doXML(ctx context.Context, method, key string, query url.Values, body []byte, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	res, err := c.do(ctx, method, key, query, nil, reader, int64(len(body)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if err := xml.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response, err: %v", err)
+	}
+	return nil
+}
+
+// do sends the signed request and returns the response if it succeeded, the response body must be closed by the caller
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, headers http.Header, body io.Reader, size int64) (*http.Response, error) {
+	reqURL := *c.endpoint
+	reqURL.Path = strings.TrimSuffix(c.endpoint.Path, "/") + "/" + c.config.Bucket + "/" + key
+	reqURL.RawPath = strings.TrimSuffix(c.endpoint.EscapedPath(), "/") + "/" + uriEncode(c.config.Bucket) + "/" + encodeKey(key)
+	reqURL.RawQuery = canonicalQuery(&url.URL{RawQuery: query.Encode()})
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	signRequest(req, c.config.AccessKey, c.config.SecretKey, c.config.Region, UnsignedPayload, time.Now())
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices {
+		return res, nil
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrorNotFound, key)
+	}
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return nil, fmt.Errorf("unexpected response status: %s, body: %s", res.Status, string(message))
+}
+
+// encodeKey encodes every segment of the object key while keeping the separators
+func encodeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,155 @@
+package s3_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/s3"
+	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/s3/s3test"
+)
+
+func newTestClient(t *testing.T) (*s3.Client, *s3test.Server) {
+	server := s3test.NewServer("videos")
+	t.Cleanup(server.Close)
+
+	client, err := s3.NewClient(s3.Config{
+		Endpoint:  server.URL,
+		Bucket:    "videos",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := s3.NewClient(s3.Config{Endpoint: "http://localhost:9000"}, nil); err == nil {
+		t.Errorf("NewClient() expected error without bucket")
+	}
+}
+
+func TestClient_Object(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestClient(t)
+
+	key := "prefix/a file+name.mp4"
+	if err := client.PutObject(ctx, key, strings.NewReader("0123456789"), 10); err != nil {
+		t.Fatalf("PutObject() error = %v", err)
+	}
+
+	info, err := client.HeadObject(ctx, key)
+	if err != nil {
+		t.Fatalf("HeadObject() error = %v", err)
+	}
+	if info.Size != 10 || info.ETag == "" {
+		t.Errorf("HeadObject() got = %+v", info)
+	}
+
+	tests := []struct {
+		name      string
+		offset    int64
+		length    int64
+		want      string
+		wantRange string
+	}{
+		{name: "whole object", offset: 0, length: -1, want: "0123456789", wantRange: ""},
+		{name: "range", offset: 2, length: 3, want: "234", wantRange: "bytes=2-4"},
+		{name: "open range", offset: 7, length: -1, want: "789", wantRange: "bytes=7-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := client.GetObject(ctx, key, tt.offset, tt.length)
+			if err != nil {
+				t.Fatalf("GetObject() error = %v", err)
+			}
+			got, _ := io.ReadAll(body)
+			_ = body.Close()
+			if string(got) != tt.want {
+				t.Errorf("GetObject() got = %s, want %s", got, tt.want)
+			}
+			requests := server.Requests()
+			if gotRange := requests[len(requests)-1].Range; gotRange != tt.wantRange {
+				t.Errorf("GetObject() range got = %s, want %s", gotRange, tt.wantRange)
+			}
+		})
+	}
+
+	if err := client.DeleteObject(ctx, key); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if _, err := client.HeadObject(ctx, key); !errors.Is(err, s3.ErrorNotFound) {
+		t.Errorf("HeadObject() error = %v, want %v", err, s3.ErrorNotFound)
+	}
+	if _, err := client.GetObject(ctx, key, 0, -1); !errors.Is(err, s3.ErrorNotFound) {
+		t.Errorf("GetObject() error = %v, want %v", err, s3.ErrorNotFound)
+	}
+}
+
+func TestClient_ListObjects(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestClient(t)
+	server.MaxKeys = 2
+
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1"} {
+		if err := client.PutObject(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := client.ListObjects(ctx, "a/")
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	got := make([]string, 0, len(objects))
+	for _, object := range objects {
+		got = append(got, object.Key)
+	}
+	if want := []string{"a/1", "a/2", "a/3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListObjects() got = %v, want %v", got, want)
+	}
+}
+
+func TestClient_MultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestClient(t)
+
+	uploadID, err := client.CreateMultipartUpload(ctx, "big")
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload() error = %v", err)
+	}
+	parts := make([]s3.CompletedPart, 0)
+	for i, data := range []string{"first-", "second-", "third"} {
+		etag, err := client.UploadPart(ctx, "big", uploadID, i+1, strings.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("UploadPart() error = %v", err)
+		}
+		parts = append(parts, s3.CompletedPart{PartNumber: i + 1, ETag: etag})
+	}
+
+	if err := client.CompleteMultipartUpload(ctx, "big", uploadID, []s3.CompletedPart{{PartNumber: 1, ETag: `"wrong"`}}); err == nil {
+		t.Errorf("CompleteMultipartUpload() expected error for invalid part")
+	}
+	if err := client.CompleteMultipartUpload(ctx, "big", uploadID, parts); err != nil {
+		t.Fatalf("CompleteMultipartUpload() error = %v", err)
+	}
+	if got, _ := server.Object("big"); string(got) != "first-second-third" {
+		t.Errorf("CompleteMultipartUpload() object got = %s", got)
+	}
+
+	uploadID, err = client.CreateMultipartUpload(ctx, "aborted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AbortMultipartUpload(ctx, "aborted", uploadID); err != nil {
+		t.Fatalf("AbortMultipartUpload() error = %v", err)
+	}
+	if got := server.PendingUploads(); got != 0 {
+		t.Errorf("PendingUploads() got = %d, want 0", got)
+	}
+}
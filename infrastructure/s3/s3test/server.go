@@ -0,0 +1,336 @@
+// Package s3test provides an in-process fake of an S3-compatible object storage for testing purpose.
+// It understands the path-style requests sent by the s3 package for a single bucket.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request represents a request received by the server
+type Request struct {
+	Method string
+	Key    string
+	Query  string
+	Range  string
+}
+
+type object struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+type multipartUpload struct {
+	key   string
+	parts map[int]object
+}
+
+// Server is a fake S3 server keeping the objects of a single bucket in memory
+type Server struct {
+	*httptest.Server
+
+	// Bucket is the only bucket served
+	Bucket string
+	// MaxKeys limits the number of objects returned per listing page
+	MaxKeys int
+
+	mu       sync.Mutex
+	objects  map[string]object
+	uploads  map[string]*multipartUpload
+	requests []Request
+	nextID   int
+}
+
+// NewServer starts new fake S3 server serving the specified bucket, it should be closed by the caller
+func NewServer(bucket string) *Server {
+	s := &Server{
+		Bucket:  bucket,
+		MaxKeys: 1000,
+		objects: make(map[string]object),
+		uploads: make(map[string]*multipartUpload),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Object returns the content of the object with specified key
+func (s *Server) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj.data, ok
+}
+
+// Keys returns the sorted keys of all stored objects
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedKeys("")
+}
+
+// PendingUploads returns the number of multipart uploads which are neither completed nor aborted
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// Requests returns all requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "missing signature")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Key:    key,
+		Query:  r.URL.RawQuery,
+		Range:  r.Header.Get("Range"),
+	})
+	s.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.listObjects(w, r)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createMultipartUpload(w, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeMultipartUpload(w, r, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.abortMultipartUpload(w, r)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	obj := newObject(data)
+
+	s.mu.Lock()
+	s.objects[key] = obj
+	s.mu.Unlock()
+	w.Header().Set("ETag", obj.etag)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	obj, ok := s.objects[key]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+	w.Header().Set("ETag", obj.etag)
+	http.ServeContent(w, r, "", obj.modTime, bytes.NewReader(obj.data))
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
+	type content struct {
+		Key          string    `xml:"Key"`
+		Size         int       `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	}
+	type listBucketResult struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}
+
+	query := r.URL.Query()
+	token := query.Get("continuation-token")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result listBucketResult
+	for _, key := range s.sortedKeys(query.Get("prefix")) {
+		if key <= token {
+			continue
+		}
+		if len(result.Contents) == s.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+			break
+		}
+		obj := s.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			Size:         len(obj.data),
+			ETag:         obj.etag,
+			LastModified: obj.modTime,
+		})
+	}
+	writeXML(w, result)
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, key string) {
+	s.mu.Lock()
+	s.nextID++
+	uploadID := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[uploadID] = &multipartUpload{
+		key:   key,
+		parts: make(map[int]object),
+	}
+	s.mu.Unlock()
+
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Key: key, UploadID: uploadID})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, key string) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	part := newObject(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[r.URL.Query().Get("uploadId")]
+	if !ok || upload.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", key)
+		return
+	}
+	upload.parts[partNumber] = part
+	w.Header().Set("ETag", part.etag)
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	var request struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploadID := r.URL.Query().Get("uploadId")
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", key)
+		return
+	}
+
+	var data []byte
+	for i, requested := range request.Parts {
+		part, ok := upload.parts[requested.PartNumber]
+		if !ok || part.etag != requested.ETag || (i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber) {
+			// real servers report this kind of failure with 200 status code
+			writeXML(w, struct {
+				XMLName xml.Name `xml:"Error"`
+				Code    string   `xml:"Code"`
+				Message string   `xml:"Message"`
+			}{Code: "InvalidPart", Message: fmt.Sprintf("invalid part: %d", requested.PartNumber)})
+			return
+		}
+		data = append(data, part.data...)
+	}
+	s.objects[key] = newObject(data)
+	delete(s.uploads, uploadID)
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string   `xml:"Key"`
+	}{Key: key})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delete(s.uploads, r.URL.Query().Get("uploadId"))
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) sortedKeys(prefix string) []string {
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newObject(data []byte) object {
+	hash := md5.Sum(data)
+	return object{
+		data:    data,
+		etag:    `"` + hex.EncodeToString(hash[:]) + `"`,
+		modTime: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,56 @@
+package fileid
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrorInvalid is returned when a file id is not safe to be used
+var ErrorInvalid = fmt.Errorf("invalid file id")
+
+// MaxLength is the maximum length of a file id in bytes, the usual limit of a file name
+const MaxLength = 255
+
+// unsafeChars are rejected since they separate paths, are decoded again by a path or URL parser, or end the path of a URL
+const unsafeChars = `/\%?#`
+
+// ID is the id of a file. The ids of new files are generated on upload, the files uploaded before are still addressed
+// by the name they were uploaded with, and the names of uploaded files follow the same rules.
+// The files are addressed by their id on the DB, on the blob storage and in URLs, so an ID must only be created
+// from untrusted input with Parse: it is then a single path element that can not escape its directory.
+type ID string
+
+// Parse validates the raw id, it returns ErrorInvalid when the id is empty, longer than MaxLength, not valid UTF-8,
+// a dot-prefixed name such as "..", or contains a path separator, a percent-encoded sequence, a control character or a NUL byte.
+// Leading and trailing spaces are trimmed, any other unsafe id is rejected instead of being rewritten.
+func Parse(raw string) (ID, error) {
+	id := strings.TrimSpace(raw)
+	switch {
+	case id == "":
+		return "", fmt.Errorf("%w: empty", ErrorInvalid)
+	case len(id) > MaxLength:
+		return "", fmt.Errorf("%w: longer than %d bytes", ErrorInvalid, MaxLength)
+	case !utf8.ValidString(id):
+		return "", fmt.Errorf("%w: not valid UTF-8: %q", ErrorInvalid, id)
+	case strings.HasPrefix(id, "."):
+		// covers "." and "..", and keeps the ids apart from the hidden temporary files of the blob storages
+		return "", fmt.Errorf("%w: starts with a dot: %q", ErrorInvalid, id)
+	case strings.ContainsAny(id, unsafeChars):
+		return "", fmt.Errorf("%w: contains one of %q: %q", ErrorInvalid, unsafeChars, id)
+	case strings.IndexFunc(id, isUnsafeRune) >= 0:
+		return "", fmt.Errorf("%w: contains a control character: %q", ErrorInvalid, id)
+	}
+	return ID(id), nil
+}
+
+// String returns the id as string
+func (id ID) String() string {
+	return string(id)
+}
+
+// isUnsafeRune reports the control characters, NUL included, and the invisible format characters such as the bidi overrides
+func isUnsafeRune(r rune) bool {
+	return unicode.IsControl(r) || unicode.Is(unicode.Cf, r)
+}
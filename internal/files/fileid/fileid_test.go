@@ -0,0 +1,151 @@
+package fileid
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// hostileNames are file names crafted to escape the storage directory, break the URLs or the DB, or spoof the extension
+var hostileNames = []string{
+	"",
+	" ",
+	".",
+	"..",
+	"../sample.mp4",
+	"../../etc/passwd",
+	"/etc/passwd",
+	"videos/../../sample.mp4",
+	`..\sample.mp4`,
+	`C:\Windows\win.ini`,
+	"..%2fsample.mp4",
+	"..%2Fsample.mp4",
+	"%2e%2e%2fsample.mp4",
+	"..%252fsample.mp4",
+	"..%5csample.mp4",
+	"sample.mp4%00.txt",
+	"sample.mp4\x00.txt",
+	"\x00",
+	"sample\n.mp4",
+	"sample\r\nLocation: evil.mp4",
+	"sample\t.mp4",
+	"sample\x7f.mp4",
+	"sample\u0085.mp4",
+	"sample\u202emp4.exe",
+	"sample\u200b.mp4",
+	"sample\ufeff.mp4",
+	"\xc0\xae\xc0\xae/sample.mp4",
+	"\xff\xfe.mp4",
+	".upload-123",
+	".s3-upload-123",
+	".hidden.mp4",
+	"sample.mp4?download=1",
+	"sample.mp4#fragment",
+	strings.Repeat("a", MaxLength) + ".mp4",
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    ID
+		wantErr bool
+	}{
+		{
+			name:    "plain name",
+			raw:     "sample.mp4",
+			want:    "sample.mp4",
+			wantErr: false,
+		},
+		{
+			name:    "name with spaces and unicode",
+			raw:     "my holiday vidéo 日本.mp4",
+			want:    "my holiday vidéo 日本.mp4",
+			wantErr: false,
+		},
+		{
+			name:    "dots inside the name",
+			raw:     "sample..final.mp4",
+			want:    "sample..final.mp4",
+			wantErr: false,
+		},
+		{
+			name:    "surrounding spaces are trimmed",
+			raw:     "  sample.mp4 ",
+			want:    "sample.mp4",
+			wantErr: false,
+		},
+		{
+			name:    "longest name",
+			raw:     strings.Repeat("a", MaxLength-4) + ".mp4",
+			want:    ID(strings.Repeat("a", MaxLength-4) + ".mp4"),
+			wantErr: false,
+		},
+	}
+	for _, name := range hostileNames {
+		tests = append(tests, struct {
+			name    string
+			raw     string
+			want    ID
+			wantErr bool
+		}{
+			name:    "hostile name " + strings.ToValidUTF8(name, "?"),
+			raw:     name,
+			want:    "",
+			wantErr: true,
+		})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrorInvalid) {
+				t.Errorf("Parse() error = %v, want %v", err, ErrorInvalid)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("sample.mp4")
+	for _, name := range hostileNames {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		id, err := Parse(raw)
+		if err != nil {
+			if !errors.Is(err, ErrorInvalid) || id != "" {
+				t.Fatalf("Parse(%q) got = %q, error = %v", raw, id, err)
+			}
+			return
+		}
+
+		name := id.String()
+		if name == "" || len(name) > MaxLength || !utf8.ValidString(name) || strings.ContainsRune(name, 0) {
+			t.Fatalf("Parse(%q) got invalid id %q", raw, name)
+		}
+		// the id is a single path element that stays within its directory
+		root := filepath.Join("storage", "videos")
+		if filepath.Base(name) != name || filepath.Dir(filepath.Join(root, name)) != root {
+			t.Fatalf("Parse(%q) got id %q escaping the directory", raw, name)
+		}
+		// the id is a single URL path segment that is decoded back to itself
+		unescaped, err := url.PathUnescape(url.PathEscape(name))
+		if err != nil || unescaped != name {
+			t.Fatalf("Parse(%q) got id %q not surviving the URL round trip: %q, err: %v", raw, name, unescaped, err)
+		}
+		// parsing is idempotent
+		if again, err := Parse(name); err != nil || again != id {
+			t.Fatalf("Parse(%q) got = %q, error = %v, want %q", name, again, err, id)
+		}
+	})
+}
@@ -2,18 +2,110 @@ package handler
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
 	httpHelper "github.com/cityos-dev/Cornelius-David-Herianto/helper/http"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
 	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
 )
 
+// HeaderOwner is the request header naming the owner the uploaded files are accounted to
+const HeaderOwner = "X-Owner"
+
+// invalidExpiryMessage is the response to an expiry which can not be parsed or is not in the future
+const invalidExpiryMessage = "invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future"
+
+// expiryRequest is the body of a request setting the expiry of a file, only one of the fields can be set
+type expiryRequest struct {
+	ExpiresAt string `json:"expires_at"`
+	TTL       string `json:"ttl"`
+}
+
+// Results of a file uploaded along with other files in the same multipart form
+const (
+	uploadResultCreated         = "created"
+	uploadResultConflict        = "conflict"
+	uploadResultUnsupportedType = "unsupported_type"
+	uploadResultError           = "error"
+)
+
+// fileUploadResult is the result of a file uploaded along with other files in the same multipart form
+type fileUploadResult struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Result string `json:"result"`
+	// Location is only set when the file is created
+	Location string `json:"location,omitempty"`
+	// Error is only set when the file failed to be uploaded
+	Error interface{} `json:"error,omitempty"`
+
+	httpErr *echo.HTTPError
+}
+
+// newFileUploadResult returns the result of the file with specified name, either created at location or failed with httpErr
+func newFileUploadResult(name, location string, httpErr *echo.HTTPError) fileUploadResult {
+	if httpErr == nil {
+		return fileUploadResult{
+			Name:     name,
+			Status:   http.StatusCreated,
+			Result:   uploadResultCreated,
+			Location: location,
+		}
+	}
+	result := fileUploadResult{
+		Name:    name,
+		Status:  httpErr.Code,
+		Result:  uploadResultError,
+		Error:   httpErr.Message,
+		httpErr: httpErr,
+	}
+	switch httpErr.Code {
+	case http.StatusConflict:
+		result.Result = uploadResultConflict
+	case http.StatusUnsupportedMediaType:
+		result.Result = uploadResultUnsupportedType
+	}
+	return result
+}
+
+// uploadError returns the response to an upload failed with err, the errors any upload may fail with are mapped to their status
+// and the rest is answered with 500 and fallbackMsg. The errors specific to an upload are checked by its handler beforehand.
+func uploadError(err error, fallbackMsg string) *echo.HTTPError {
+	switch {
+	case errors.Is(err, filesSvc.ErrorUnsupportedFileTypes):
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, httpHelper.NewErrorMessage("invalid content type, only video/mp4 and video/mpeg allowed", err))
+	case errors.Is(err, filesSvc.ErrorDuplicateKey):
+		return echo.NewHTTPError(http.StatusConflict, httpHelper.NewErrorMessage("the file is being uploaded by another request, try again later", err))
+	case errors.Is(err, filesSvc.ErrorUploadLocked):
+		return echo.NewHTTPError(http.StatusLocked, httpHelper.NewErrorMessage("the upload is being written by another request, try again later", err))
+	case errors.Is(err, filesSvc.ErrorQuotaExceeded):
+		return echo.NewHTTPError(http.StatusInsufficientStorage, httpHelper.NewErrorMessage("storage quota exceeded, delete some files or ask for a larger quota", err))
+	case errors.Is(err, filesSvc.ErrorInsufficientStorage):
+		return echo.NewHTTPError(http.StatusInsufficientStorage, httpHelper.NewErrorMessage("storage is running out of space, try again later", err))
+	case errors.Is(err, filesSvc.ErrorInvalidOwner):
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header", HeaderOwner), err))
+	case errors.Is(err, filesSvc.ErrorInvalidExpiry):
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(invalidExpiryMessage, err))
+	case errors.Is(err, filesSvc.ErrorResumableUploadsDisabled):
+		return echo.NewHTTPError(http.StatusNotImplemented, httpHelper.NewErrorMessage("resumable uploads are disabled", err))
+	case errors.Is(err, filesSvc.ErrorMultipartUploadsDisabled):
+		return echo.NewHTTPError(http.StatusNotImplemented, httpHelper.NewErrorMessage("multipart uploads are disabled", err))
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fallbackMsg, err))
+}
+
 type filesHTTPHandler struct {
 	service filesSvc.Service
 }
@@ -24,39 +116,146 @@ func New(service filesSvc.Service) filesHTTPHandler {
 	}
 }
 
+// UploadFile stores the files sent in the data fields of the multipart form, one after another as they are streamed.
+// A single file is answered with 201, its location and the body OK, or with the error it failed with, as before forms
+// could hold several files. Several files are answered with 207 Multi-Status and the result of every file, whatever
+// their outcome, the files failing do not stop the others and the files stored are kept whatever happens to the rest of the form.
 func (h filesHTTPHandler) UploadFile(ctx echo.Context) error {
-	multipartFileHeader, err := ctx.FormFile("data")
+	// the expiry is read from the query, since the form is streamed after it
+	expiresAt, err := parseExpiry(ctx.QueryParam("expires_at"), ctx.QueryParam("ttl"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("failed to process uploaded file", err))
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(invalidExpiryMessage, err))
 	}
-	multipartFile, err := multipartFileHeader.Open()
+	multipartReader, err := ctx.Request().MultipartReader()
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("failed to process uploaded file", err))
 	}
-	defer func() {
-		_ = multipartFile.Close()
-	}()
 
-	location, err := h.service.UploadFile(ctx.Request().Context(), multipartFile, ctx.Request().Host, multipartFileHeader.Filename, multipartFileHeader.Size)
+	results := make([]fileUploadResult, 0)
+	for {
+		part, err := nextFilePart(multipartReader, "data")
+		if err == io.EOF {
+			if len(results) == 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("failed to process uploaded file", fmt.Errorf("no file found in form field: data")))
+			}
+			break
+		}
+		if err != nil {
+			if len(results) == 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("failed to process uploaded file", err))
+			}
+			// the files stored so far are still reported, the rest of the form can not be read
+			results = append(results, newFileUploadResult("", "", echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("failed to process uploaded file", err))))
+			break
+		}
+		location, httpErr := h.uploadFilePart(ctx, part, expiresAt)
+		_ = part.Close()
+		results = append(results, newFileUploadResult(part.FileName(), location, httpErr))
+	}
+
+	if len(results) == 1 {
+		if results[0].httpErr != nil {
+			return results[0].httpErr
+		}
+		ctx.Response().Header().Set("Location", results[0].Location)
+		return ctx.String(http.StatusCreated, "OK")
+	}
+	return ctx.JSON(http.StatusMultiStatus, results)
+}
+
+// uploadFilePart stores the file of the form part and returns its location, the returned error is the response to the failed upload
+func (h filesHTTPHandler) uploadFilePart(ctx echo.Context, part *multipart.Part, expiresAt time.Time) (string, *echo.HTTPError) {
+	// part.FileName already drops the directories some clients send along with the name, what is left must be a safe name
+	fileName, err := fileid.Parse(part.FileName())
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file name", err))
+	}
+
+	location, err := h.service.UploadFile(ctx.Request().Context(), part, ctx.Request().Host, fileName, ctx.Request().Header.Get(HeaderOwner), expiresAt)
+	if err != nil {
+		return "", uploadError(err, "failed to upload the file, please try again later")
+	}
+	return location, nil
+}
+
+// PutFile stores the request body as the file with the id from the path, for the clients which can not send a multipart form.
+// An existing file is replaced, unless If-None-Match: * is sent to only create the file.
+func (h filesHTTPHandler) PutFile(ctx echo.Context) error {
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
+	expiresAt, err := parseExpiry(ctx.QueryParam("expires_at"), ctx.QueryParam("ttl"))
 	if err != nil {
-		if err == filesSvc.ErrorUnsupportedFileTypes {
-			return echo.NewHTTPError(http.StatusUnsupportedMediaType, httpHelper.NewErrorMessage("invalid content type, only video/mp4 and video/mpeg allowed", err))
-		} else if err == filesSvc.ErrorDuplicateKey {
-			return echo.NewHTTPError(http.StatusConflict, httpHelper.NewErrorMessage(fmt.Sprintf("file with id: %s is already exist", multipartFileHeader.Filename), err))
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(invalidExpiryMessage, err))
+	}
+	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "video/mp4" && mediaType != "video/mpeg") {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, httpHelper.NewErrorMessage("invalid content type, only video/mp4 and video/mpeg allowed", fmt.Errorf("unsupported content type: %q", contentType)))
+	}
+	// the files have no entity tags, so only the wildcard can be matched
+	ifNoneMatch := ctx.Request().Header.Get("If-None-Match")
+	if ifNoneMatch != "" && ifNoneMatch != "*" {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid If-None-Match header, only * is supported", fmt.Errorf("unsupported If-None-Match: %q", ifNoneMatch)))
+	}
+
+	location, err := h.service.PutFile(ctx.Request().Context(), ctx.Request().Body, ctx.Request().Host, fileID, mediaType, ctx.Request().Header.Get(HeaderOwner), expiresAt, ifNoneMatch == "*")
+	if err != nil {
+		if errors.Is(err, filesSvc.ErrorFileExists) {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, httpHelper.NewErrorMessage(fmt.Sprintf("file with id: %s is already exist", fileID), err))
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage("failed to upload the file, please try again later", err))
+		return uploadError(err, "failed to upload the file, please try again later")
 	}
 
 	ctx.Response().Header().Set("Location", location)
 	return ctx.String(http.StatusCreated, "OK")
 }
 
+// nextFilePart skips the multipart parts until it finds the file part with specified form name,
+// so the file content can be streamed from the request body without being buffered. io.EOF is returned once the form has no more file.
+func nextFilePart(multipartReader *multipart.Reader, formName string) (*multipart.Part, error) {
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == formName && part.FileName() != "" {
+			return part, nil
+		}
+		_ = part.Close()
+	}
+}
+
 func (h filesHTTPHandler) GetFileByID(ctx echo.Context) error {
-	fileID := ctx.Param("fileID")
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
 
-	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("form-data; name='data'; filename=%s", fileID))
-	ctx.Response().Header().Set(echo.HeaderContentType, mime.TypeByExtension(filepath.Ext(fileID)))
-	return ctx.File("storage/videos/" + fileID)
+	fileInfo, content, err := h.service.GetFileByID(ctx.Request().Context(), fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, filesBlobStore.ErrorNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested file is not exists", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to get file with id: %s", fileID), err))
+	}
+	return serveFile(ctx, fileInfo, content)
+}
+
+// serveFile writes the content of the file with its original name, and closes the content
+func serveFile(ctx echo.Context, fileInfo filesSvc.FileInfo, content io.ReadSeekCloser) error {
+	defer func() {
+		_ = content.Close()
+	}()
+
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("form-data; name='data'; filename=%s", fileInfo.Name))
+	ctx.Response().Header().Set(echo.HeaderContentType, mime.TypeByExtension(filepath.Ext(fileInfo.Name)))
+	http.ServeContent(ctx.Response(), ctx.Request(), fileInfo.Name, fileInfo.CreatedAt, content)
+	return nil
 }
 
 func (h filesHTTPHandler) GetAllFiles(ctx echo.Context) error {
@@ -68,12 +267,203 @@ func (h filesHTTPHandler) GetAllFiles(ctx echo.Context) error {
 }
 
 func (h filesHTTPHandler) DeleteFileByID(ctx echo.Context) error {
-	err := h.service.DeleteFileByID(ctx.Request().Context(), ctx.Param("fileID"))
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
+	permanent, err := strconv.ParseBool(ctx.QueryParam("permanent"))
+	if err != nil && ctx.QueryParam("permanent") != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid permanent parameter, it must be true or false", err))
+	}
+
+	err = h.service.DeleteFileByID(ctx.Request().Context(), fileID, permanent)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("deleted file is not exists", err))
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to delete file with id: %s", ctx.Param("fileID")), err))
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to delete file with id: %s", fileID), err))
 	}
 	return ctx.String(http.StatusNoContent, "OK")
 }
+
+func (h filesHTTPHandler) SetFileExpiry(ctx echo.Context) error {
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
+	var request expiryRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid request body, it must be a JSON object", err))
+	}
+	expiresAt, err := parseExpiry(request.ExpiresAt, request.TTL)
+	if err == nil && expiresAt.IsZero() {
+		err = fmt.Errorf("neither expires_at nor ttl is set")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(invalidExpiryMessage, err))
+	}
+
+	err = h.service.SetFileExpiry(ctx.Request().Context(), fileID, expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested file is not exists", err))
+		} else if errors.Is(err, filesSvc.ErrorInvalidExpiry) {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(invalidExpiryMessage, err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to set expiry of file with id: %s", fileID), err))
+	}
+	return ctx.String(http.StatusNoContent, "OK")
+}
+
+// parseExpiry returns the expiry set either as an absolute RFC 3339 time or as a ttl from now, zero when none is set
+func parseExpiry(expiresAt, ttl string) (time.Time, error) {
+	switch {
+	case expiresAt != "" && ttl != "":
+		return time.Time{}, fmt.Errorf("both expires_at and ttl are set")
+	case expiresAt != "":
+		return time.Parse(time.RFC3339, expiresAt)
+	case ttl != "":
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if duration <= 0 {
+			return time.Time{}, fmt.Errorf("ttl must be positive: %s", ttl)
+		}
+		return time.Now().Add(duration), nil
+	}
+	return time.Time{}, nil
+}
+
+func (h filesHTTPHandler) RestoreFile(ctx echo.Context) error {
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
+
+	err = h.service.RestoreFile(ctx.Request().Context(), fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("restored file is not in the trash", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to restore file with id: %s", fileID), err))
+	}
+	return ctx.String(http.StatusNoContent, "OK")
+}
+
+func (h filesHTTPHandler) GetTrash(ctx echo.Context) error {
+	files, err := h.service.GetTrash(ctx.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage("failed to get trashed files from DB", err))
+	}
+	return ctx.JSON(http.StatusOK, files)
+}
+
+func (h filesHTTPHandler) GetFileVersions(ctx echo.Context) error {
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
+
+	versions, err := h.service.GetFileVersions(ctx.Request().Context(), fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested file is not exists", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to get versions of file with id: %s", fileID), err))
+	}
+	return ctx.JSON(http.StatusOK, versions)
+}
+
+func (h filesHTTPHandler) GetFileVersion(ctx echo.Context) error {
+	fileID, version, err := parseFileVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fileInfo, content, err := h.service.GetFileVersion(ctx.Request().Context(), fileID, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, filesBlobStore.ErrorNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested file version is not exists", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to get version %d of file with id: %s", version, fileID), err))
+	}
+	return serveFile(ctx, fileInfo, content)
+}
+
+func (h filesHTTPHandler) DeleteFileVersion(ctx echo.Context) error {
+	fileID, version, err := parseFileVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.DeleteFileVersion(ctx.Request().Context(), fileID, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("deleted file version is not exists", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to delete version %d of file with id: %s", version, fileID), err))
+	}
+	return ctx.String(http.StatusNoContent, "OK")
+}
+
+// parseFileVersion returns the file id and the version from the path, the returned error is the response to a bad request
+func parseFileVersion(ctx echo.Context) (fileid.ID, int, error) {
+	fileID, err := fileid.Parse(ctx.Param("fileID"))
+	if err != nil {
+		return "", 0, echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file id", err))
+	}
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err == nil && version < 1 {
+		err = fmt.Errorf("version must be positive: %d", version)
+	}
+	if err != nil {
+		return "", 0, echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid version, it must be a positive number", err))
+	}
+	return fileID, version, nil
+}
+
+func (h filesHTTPHandler) GetUsage(ctx echo.Context) error {
+	usage, err := h.service.GetUsage(ctx.Request().Context(), ctx.Request().Header.Get(HeaderOwner))
+	if err != nil {
+		if errors.Is(err, filesSvc.ErrorInvalidOwner) {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header", HeaderOwner), err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage("failed to get storage usage", err))
+	}
+	return ctx.JSON(http.StatusOK, usage)
+}
+
+func (h filesHTTPHandler) Fsck(ctx echo.Context) error {
+	repair, err := strconv.ParseBool(ctx.QueryParam("repair"))
+	if err != nil && ctx.QueryParam("repair") != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid repair parameter, it must be true or false", err))
+	}
+	report, err := h.service.Fsck(ctx.Request().Context(), repair)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage("failed to check the storage consistency", err))
+	}
+	return ctx.JSON(http.StatusOK, report)
+}
+
+func (h filesHTTPHandler) CollectGarbage(ctx echo.Context) error {
+	dryRun, err := strconv.ParseBool(ctx.QueryParam("dry_run"))
+	if err != nil && ctx.QueryParam("dry_run") != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid dry_run parameter, it must be true or false", err))
+	}
+	gracePeriod := filesSvc.DefaultGCGracePeriod
+	if value := ctx.QueryParam("grace_period"); value != "" {
+		gracePeriod, err = time.ParseDuration(value)
+		if err == nil && gracePeriod < 0 {
+			err = fmt.Errorf("negative duration: %s", value)
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid grace_period parameter, it must be a duration such as 24h", err))
+		}
+	}
+	report, err := h.service.CollectGarbage(ctx.Request().Context(), gracePeriod, dryRun)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage("failed to collect the garbage", err))
+	}
+	return ctx.JSON(http.StatusOK, report)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -18,6 +19,8 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 
+	httpHelper "github.com/cityos-dev/Cornelius-David-Herianto/helper/http"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
 	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
 	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
 	filesSvcMock "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service/mocks"
@@ -75,7 +78,7 @@ func Test_filesHTTPHandler_DeleteFileByID(t *testing.T) {
 				url:    "http://localhost/v1/files/test.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().DeleteFileByID(gomock.Any(), "test.mp4").Return(nil)
+				mockService.EXPECT().DeleteFileByID(gomock.Any(), fileid.ID("test.mp4"), false).Return(nil)
 			},
 			want: want{
 				body:        `OK`,
@@ -84,6 +87,36 @@ func Test_filesHTTPHandler_DeleteFileByID(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "successfully delete a file permanently",
+			args: args{
+				method: http.MethodDelete,
+				url:    "http://localhost/v1/files/test.mp4?permanent=true",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteFileByID(gomock.Any(), fileid.ID("test.mp4"), true).Return(nil)
+			},
+			want: want{
+				body:        `OK`,
+				code:        http.StatusNoContent,
+				contentType: "text/plain; charset=UTF-8",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid permanent parameter",
+			args: args{
+				method: http.MethodDelete,
+				url:    "http://localhost/v1/files/test.mp4?permanent=yes",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid permanent parameter, it must be true or false","dev_message":"strconv.ParseBool: parsing \"yes\": invalid syntax"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
 		{
 			name: "deleted id not found",
 			args: args{
@@ -91,7 +124,7 @@ func Test_filesHTTPHandler_DeleteFileByID(t *testing.T) {
 				url:    "http://localhost/v1/files/test.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().DeleteFileByID(gomock.Any(), "test.mp4").Return(sql.ErrNoRows)
+				mockService.EXPECT().DeleteFileByID(gomock.Any(), fileid.ID("test.mp4"), false).Return(sql.ErrNoRows)
 			},
 			want: want{
 				body: `{"message":"deleted file is not exists","dev_message":"sql: no rows in result set"}`,
@@ -106,7 +139,7 @@ func Test_filesHTTPHandler_DeleteFileByID(t *testing.T) {
 				url:    "http://localhost/v1/files/test.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().DeleteFileByID(gomock.Any(), "test.mp4").Return(fmt.Errorf("some-err"))
+				mockService.EXPECT().DeleteFileByID(gomock.Any(), fileid.ID("test.mp4"), false).Return(fmt.Errorf("some-err"))
 			},
 			want: want{
 				body: `{"message":"failed to delete file with id: test.mp4","dev_message":"some-err"}`,
@@ -114,6 +147,20 @@ func Test_filesHTTPHandler_DeleteFileByID(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid file id",
+			args: args{
+				method: http.MethodDelete,
+				url:    "http://localhost/v1/files/..%2fgo.mod",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid file id","dev_message":"invalid file id: starts with a dot: \"..%2fgo.mod\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -126,7 +173,7 @@ func Test_filesHTTPHandler_DeleteFileByID(t *testing.T) {
 			ctx := echo.New().NewContext(r, w)
 			ctx.SetPath("v1/files/:fileID")
 			ctx.SetParamNames("fileID")
-			urlPaths := strings.Split(tt.args.url, "/")
+			urlPaths := strings.Split(r.URL.EscapedPath(), "/")
 			ctx.SetParamValues(urlPaths[len(urlPaths)-1])
 
 			h := filesHTTPHandler{
@@ -212,18 +259,21 @@ func Test_filesHTTPHandler_GetAllFiles(t *testing.T) {
 				mockService.EXPECT().GetAllFiles(gomock.Any()).Return([]filesSvc.FileInfo{
 					{
 						FileID:    "file-1.mp4",
+						Version:   1,
 						Name:      "file-1.mp4",
 						Size:      111,
 						CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
 					},
 					{
 						FileID:    "file-2.mp4",
+						Version:   1,
 						Name:      "file-2.mp4",
 						Size:      222,
 						CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
 					},
 					{
 						FileID:    "file-3.mp4",
+						Version:   2,
 						Name:      "file-3.mp4",
 						Size:      333,
 						CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -231,7 +281,7 @@ func Test_filesHTTPHandler_GetAllFiles(t *testing.T) {
 				}, nil)
 			},
 			want: want{
-				body:        `[{"fileid":"file-1.mp4","name":"file-1.mp4","size":111,"created_at":"2023-01-01T00:00:00Z"},{"fileid":"file-2.mp4","name":"file-2.mp4","size":222,"created_at":"2023-01-01T00:00:00Z"},{"fileid":"file-3.mp4","name":"file-3.mp4","size":333,"created_at":"2023-01-01T00:00:00Z"}]`,
+				body:        `[{"fileid":"file-1.mp4","version":1,"name":"file-1.mp4","size":111,"created_at":"2023-01-01T00:00:00Z"},{"fileid":"file-2.mp4","version":1,"name":"file-2.mp4","size":222,"created_at":"2023-01-01T00:00:00Z"},{"fileid":"file-3.mp4","version":2,"name":"file-3.mp4","size":333,"created_at":"2023-01-01T00:00:00Z"}]`,
 				code:        http.StatusOK,
 				contentType: "application/json; charset=UTF-8",
 			},
@@ -329,15 +379,64 @@ func Test_filesHTTPHandler_GetFileByID(t *testing.T) {
 				url:    "http://localhost/v1/files/sample.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-
+				mockService.EXPECT().GetFileByID(gomock.Any(), fileid.ID("sample.mp4")).Return(filesSvc.FileInfo{
+					FileID: "sample.mp4",
+					Name:   "sample.mp4",
+					Size:   13,
+				}, readSeekNopCloser{strings.NewReader("sample string")}, nil)
 			},
 			want: want{
+				body:               "sample string",
 				code:               http.StatusOK,
 				contentType:        "video/mp4",
 				contentDisposition: "form-data; name='data'; filename=sample.mp4",
 			},
 			wantErr: false,
 		},
+		{
+			name: "requested file not found",
+			args: args{
+				method: http.MethodGet,
+				url:    "http://localhost/v1/files/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetFileByID(gomock.Any(), fileid.ID("sample.mp4")).Return(filesSvc.FileInfo{}, nil, sql.ErrNoRows)
+			},
+			want: want{
+				body: `{"message":"requested file is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to get the requested file (other error)",
+			args: args{
+				method: http.MethodGet,
+				url:    "http://localhost/v1/files/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetFileByID(gomock.Any(), fileid.ID("sample.mp4")).Return(filesSvc.FileInfo{}, nil, fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to get file with id: sample.mp4","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid file id",
+			args: args{
+				method: http.MethodGet,
+				url:    "http://localhost/v1/files/%2e%2e%2fgo.mod",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid file id","dev_message":"invalid file id: contains one of \"/\\\\%?#\": \"%2e%2e%2fgo.mod\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -383,15 +482,34 @@ func Test_filesHTTPHandler_GetFileByID(t *testing.T) {
 			if res.Header.Get(echo.HeaderContentDisposition) != tt.want.contentDisposition {
 				t.Errorf("GetFileByID() content-disposition got = %s, want %s\n", res.Header.Get(echo.HeaderContentDisposition), tt.want.contentDisposition)
 			}
+
+			resBody, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Errorf("WriteResponse GetFileByID() read from body err = %v\n", err)
+			}
+
+			if string(resBody) != tt.want.body {
+				t.Errorf("GetFileByID() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
 		})
 	}
 }
 
+type readSeekNopCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
+
 func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 	type args struct {
 		method   string
 		url      string
+		formName string
 		filepath string
+		owner    string
 	}
 	type want struct {
 		body        string
@@ -411,10 +529,30 @@ func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 			args: args{
 				method:   http.MethodPost,
 				url:      "http://localhost/v1/files",
+				formName: "data",
+				filepath: "test/post_1/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Time{}).Return("localhost/v1/files/sample.mpg", nil)
+			},
+			want: want{
+				body:        `OK`,
+				code:        http.StatusCreated,
+				contentType: "text/plain; charset=UTF-8",
+				location:    "localhost/v1/files/sample.mpg",
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully uploaded a file with an expiry",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files?expires_at=2030-01-02T03:04:05Z",
+				formName: "data",
 				filepath: "test/post_1/sample.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", "sample.mp4", int64(2848208)).Return("localhost/v1/files/sample.mpg", nil)
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)).Return("localhost/v1/files/sample.mpg", nil)
 			},
 			want: want{
 				body:        `OK`,
@@ -424,15 +562,49 @@ func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid ttl",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files?ttl=-1h",
+				formName: "data",
+				filepath: "test/post_1/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future","dev_message":"ttl must be positive: -1h"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "expiry in the past",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files?expires_at=2020-01-02T03:04:05Z",
+				formName: "data",
+				filepath: "test/post_1/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)).Return("", filesSvc.ErrorInvalidExpiry)
+			},
+			want: want{
+				body: `{"message":"invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future","dev_message":"expiry must be in the future"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
 		{
 			name: "upload unsupported file type",
 			args: args{
 				method:   http.MethodPost,
 				url:      "http://localhost/v1/files",
+				formName: "data",
 				filepath: "test/post_4/test.txt",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", "test.txt", int64(19)).Return("", filesSvc.ErrorUnsupportedFileTypes)
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("test.txt"), "", time.Time{}).Return("", filesSvc.ErrorUnsupportedFileTypes)
 			},
 			want: want{
 				body: `{"message":"invalid content type, only video/mp4 and video/mpeg allowed","dev_message":"unsupported file types"}`,
@@ -445,26 +617,97 @@ func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 			args: args{
 				method:   http.MethodPost,
 				url:      "http://localhost/v1/files",
+				formName: "data",
 				filepath: "test/post_1/sample.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", "sample.mp4", int64(2848208)).Return("", filesSvc.ErrorDuplicateKey)
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Time{}).Return("", filesSvc.ErrorDuplicateKey)
 			},
 			want: want{
-				body: `{"message":"file with id: sample.mp4 is already exist","dev_message":"duplicate key value"}`,
+				body: `{"message":"the file is being uploaded by another request, try again later","dev_message":"duplicate key value"}`,
 				code: http.StatusConflict,
 			},
 			wantErr: true,
 		},
+		{
+			name: "storage quota exceeded",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files",
+				formName: "data",
+				filepath: "test/post_1/sample.mp4",
+				owner:    "camera-1",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "camera-1", time.Time{}).Return("", filesSvc.ErrorQuotaExceeded)
+			},
+			want: want{
+				body: `{"message":"storage quota exceeded, delete some files or ask for a larger quota","dev_message":"storage quota exceeded"}`,
+				code: http.StatusInsufficientStorage,
+			},
+			wantErr: true,
+		},
+		{
+			name: "storage below the free space watermark",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files",
+				formName: "data",
+				filepath: "test/post_1/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Time{}).Return("", filesSvc.ErrorInsufficientStorage)
+			},
+			want: want{
+				body: `{"message":"storage is running out of space, try again later","dev_message":"insufficient free space on storage"}`,
+				code: http.StatusInsufficientStorage,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid owner",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files",
+				formName: "data",
+				filepath: "test/post_1/sample.mp4",
+				owner:    "*",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "*", time.Time{}).Return("", fmt.Errorf("%w: *", filesSvc.ErrorInvalidOwner))
+			},
+			want: want{
+				body: `{"message":"invalid X-Owner header","dev_message":"invalid owner: *"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "no file in data form field",
+			args: args{
+				method:   http.MethodPost,
+				url:      "http://localhost/v1/files",
+				formName: "other",
+				filepath: "test/post_1/sample.mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"failed to process uploaded file","dev_message":"no file found in form field: data"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
 		{
 			name: "failed to upload file (other error)",
 			args: args{
 				method:   http.MethodPost,
 				url:      "http://localhost/v1/files",
+				formName: "data",
 				filepath: "test/post_1/sample.mp4",
 			},
 			mockFunc: func(mockService *filesSvcMock.MockService) {
-				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", "sample.mp4", int64(2848208)).Return("", fmt.Errorf("some-err"))
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Time{}).Return("", fmt.Errorf("some-err"))
 			},
 			want: want{
 				body: `{"message":"failed to upload the file, please try again later","dev_message":"some-err"}`,
@@ -487,7 +730,7 @@ func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			writer, err := mw.CreateFormFile("data", filePath)
+			writer, err := mw.CreateFormFile(tt.args.formName, filePath)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -498,6 +741,9 @@ func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 
 			r := httptest.NewRequest(tt.args.method, tt.args.url, body)
 			r.Header.Add(echo.HeaderContentType, mw.FormDataContentType())
+			if tt.args.owner != "" {
+				r.Header.Set(HeaderOwner, tt.args.owner)
+			}
 			w := httptest.NewRecorder()
 			ctx := echo.New().NewContext(r, w)
 
@@ -544,3 +790,1450 @@ func Test_filesHTTPHandler_UploadFile(t *testing.T) {
 		})
 	}
 }
+
+func Test_filesHTTPHandler_GetUsage(t *testing.T) {
+	type want struct {
+		body        string
+		code        int
+		contentType string
+	}
+	tests := []struct {
+		name     string
+		owner    string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name:  "successfully get the usage",
+			owner: "camera-1",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetUsage(gomock.Any(), "camera-1").Return(filesSvc.UsageReport{
+					Owner:  "camera-1",
+					Usage:  filesSvc.QuotaUsage{UsedBytes: 50, UsedFiles: 1, MaxBytes: 100},
+					Global: filesSvc.QuotaUsage{UsedBytes: 90, UsedFiles: 2},
+				}, nil)
+			},
+			want: want{
+				body:        `{"owner":"camera-1","usage":{"used_bytes":50,"used_files":1,"max_bytes":100,"max_files":0},"global":{"used_bytes":90,"used_files":2,"max_bytes":0,"max_files":0}}`,
+				code:        http.StatusOK,
+				contentType: "application/json; charset=UTF-8",
+			},
+			wantErr: false,
+		},
+		{
+			name:  "failed to get the usage",
+			owner: "",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetUsage(gomock.Any(), "").Return(filesSvc.UsageReport{}, fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to get storage usage","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/v1/usage", nil)
+			if tt.owner != "" {
+				r.Header.Set(HeaderOwner, tt.owner)
+			}
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.GetUsage(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("GetUsage() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("GetUsage() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.want.code {
+				t.Errorf("GetUsage() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if res.Header.Get(echo.HeaderContentType) != tt.want.contentType {
+				t.Errorf("GetUsage() content-type got = %s, want %s\n", res.Header.Get(echo.HeaderContentType), tt.want.contentType)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("GetUsage() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_Fsck(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		url      string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name: "successfully check the storage",
+			url:  "http://localhost/v1/admin/fsck",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().Fsck(gomock.Any(), false).Return(filesSvc.FsckReport{
+					CheckedFiles:   1,
+					CheckedBlobs:   2,
+					OrphanBlobs:    []string{"orphan.mp4"},
+					MissingFiles:   []string{},
+					SizeMismatches: []filesSvc.SizeMismatch{},
+					FailedRepairs:  []string{},
+				}, nil)
+			},
+			want: want{
+				body: `{"checked_files":1,"checked_blobs":2,"orphan_blobs":["orphan.mp4"],"missing_files":[],"size_mismatches":[],"repaired":false,"quarantined_blobs":0,"broken_files":0,"restored_files":0,"failed_repairs":[]}`,
+				code: http.StatusOK,
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully repair the storage",
+			url:  "http://localhost/v1/admin/fsck?repair=true",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().Fsck(gomock.Any(), true).Return(filesSvc.FsckReport{Repaired: true}, nil)
+			},
+			want: want{
+				body: `{"checked_files":0,"checked_blobs":0,"orphan_blobs":null,"missing_files":null,"size_mismatches":null,"repaired":true,"quarantined_blobs":0,"broken_files":0,"restored_files":0,"failed_repairs":null}`,
+				code: http.StatusOK,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid repair parameter",
+			url:  "http://localhost/v1/admin/fsck?repair=maybe",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid repair parameter, it must be true or false","dev_message":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to check the storage",
+			url:  "http://localhost/v1/admin/fsck",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().Fsck(gomock.Any(), false).Return(filesSvc.FsckReport{}, fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to check the storage consistency","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.Fsck(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("Fsck() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("Fsck() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.want.code {
+				t.Errorf("Fsck() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("Fsck() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_CollectGarbage(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		url      string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name: "successfully collect the garbage",
+			url:  "http://localhost/v1/admin/gc",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CollectGarbage(gomock.Any(), filesSvc.DefaultGCGracePeriod, false).Return(filesSvc.GCReport{
+					RemovedTempFiles:   []string{"storage/videos/.upload-123"},
+					RemovedOrphanBlobs: []string{"orphan.mp4"},
+					ReclaimedBytes:     42,
+					FailedBlobs:        []string{},
+				}, nil)
+			},
+			want: want{
+				body: `{"dry_run":false,"removed_temp_files":["storage/videos/.upload-123"],"removed_orphan_blobs":["orphan.mp4"],"reclaimed_bytes":42,"failed_blobs":[]}`,
+				code: http.StatusOK,
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully report the garbage on dry run",
+			url:  "http://localhost/v1/admin/gc?dry_run=true&grace_period=2h",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CollectGarbage(gomock.Any(), 2*time.Hour, true).Return(filesSvc.GCReport{DryRun: true}, nil)
+			},
+			want: want{
+				body: `{"dry_run":true,"removed_temp_files":null,"removed_orphan_blobs":null,"reclaimed_bytes":0,"failed_blobs":null}`,
+				code: http.StatusOK,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid dry_run parameter",
+			url:  "http://localhost/v1/admin/gc?dry_run=maybe",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid dry_run parameter, it must be true or false","dev_message":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid grace_period parameter",
+			url:  "http://localhost/v1/admin/gc?grace_period=-1h",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid grace_period parameter, it must be a duration such as 24h","dev_message":"negative duration: -1h"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to collect the garbage",
+			url:  "http://localhost/v1/admin/gc",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CollectGarbage(gomock.Any(), filesSvc.DefaultGCGracePeriod, false).Return(filesSvc.GCReport{}, fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to collect the garbage","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.CollectGarbage(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("CollectGarbage() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("CollectGarbage() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.want.code {
+				t.Errorf("CollectGarbage() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("CollectGarbage() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_UploadFile_multipleFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+	gomock.InOrder(
+		mockFilesSvc.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("a.mp4"), "camera-1", time.Time{}).Return("localhost/v1/files/a-id", nil),
+		mockFilesSvc.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("b.mp4"), "camera-1", time.Time{}).Return("", filesSvc.ErrorDuplicateKey),
+		mockFilesSvc.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("c.txt"), "camera-1", time.Time{}).Return("", filesSvc.ErrorUnsupportedFileTypes),
+		mockFilesSvc.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("d.mp4"), "camera-1", time.Time{}).Return("", fmt.Errorf("some-err")),
+	)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	for _, field := range []struct {
+		formName string
+		fileName string
+	}{
+		{formName: "data", fileName: "a.mp4"},
+		{formName: "other", fileName: "skipped.mp4"},
+		{formName: "data", fileName: "b.mp4"},
+		{formName: "data", fileName: "c.txt"},
+		{formName: "data", fileName: ".hidden.mp4"},
+		{formName: "data", fileName: "d.mp4"},
+	} {
+		writer, err := mw.CreateFormFile(field.formName, field.fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = writer.Write([]byte("sample string"))
+	}
+	_ = mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/files", body)
+	r.Header.Add(echo.HeaderContentType, mw.FormDataContentType())
+	r.Header.Set(HeaderOwner, "camera-1")
+	w := httptest.NewRecorder()
+	ctx := echo.New().NewContext(r, w)
+
+	h := filesHTTPHandler{
+		service: mockFilesSvc,
+	}
+	if err := h.UploadFile(ctx); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("UploadFile() status code got = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+	if location := w.Header().Get("Location"); location != "" {
+		t.Errorf("UploadFile() location got = %s, want none", location)
+	}
+	want := `[` +
+		`{"name":"a.mp4","status":201,"result":"created","location":"localhost/v1/files/a-id"},` +
+		`{"name":"b.mp4","status":409,"result":"conflict","error":{"message":"the file is being uploaded by another request, try again later","dev_message":"duplicate key value"}},` +
+		`{"name":"c.txt","status":415,"result":"unsupported_type","error":{"message":"invalid content type, only video/mp4 and video/mpeg allowed","dev_message":"unsupported file types"}},` +
+		`{"name":".hidden.mp4","status":400,"result":"error","error":{"message":"invalid file name","dev_message":"invalid file id: starts with a dot: \".hidden.mp4\""}},` +
+		`{"name":"d.mp4","status":500,"result":"error","error":{"message":"failed to upload the file, please try again later","dev_message":"some-err"}}` +
+		`]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("UploadFile() body got = %s, want %s", got, want)
+	}
+}
+
+func Test_filesHTTPHandler_UploadFile_partialSuccess(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         []string
+		wantLocations []string
+		wantStatuses  []int
+	}{
+		{
+			name:          "file stored before a rejected file",
+			files:         []string{"good.mp4", "rejected.mp4"},
+			wantLocations: []string{"localhost/v1/files/good-id", ""},
+			wantStatuses:  []int{http.StatusCreated, http.StatusInsufficientStorage},
+		},
+		{
+			name:          "file stored after a rejected file",
+			files:         []string{"rejected.mp4", "good.mp4"},
+			wantLocations: []string{"", "localhost/v1/files/good-id"},
+			wantStatuses:  []int{http.StatusInsufficientStorage, http.StatusCreated},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			mockFilesSvc.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("good.mp4"), "", time.Time{}).Return("localhost/v1/files/good-id", nil)
+			mockFilesSvc.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("rejected.mp4"), "", time.Time{}).Return("", fmt.Errorf("failed to stage file, err: %w", filesSvc.ErrorQuotaExceeded))
+
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			for _, file := range tt.files {
+				writer, err := mw.CreateFormFile("data", file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = writer.Write([]byte("sample string"))
+			}
+			_ = mw.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/files", body)
+			r.Header.Add(echo.HeaderContentType, mw.FormDataContentType())
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			if err := h.UploadFile(ctx); err != nil {
+				t.Fatalf("UploadFile() error = %v", err)
+			}
+
+			if w.Code != http.StatusMultiStatus {
+				t.Errorf("UploadFile() status code got = %d, want %d", w.Code, http.StatusMultiStatus)
+			}
+			if location := w.Header().Get("Location"); location != "" {
+				t.Errorf("UploadFile() location got = %s, want none", location)
+			}
+			var results []fileUploadResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("UploadFile() body = %s, err = %v", w.Body.String(), err)
+			}
+			if len(results) != len(tt.files) {
+				t.Fatalf("UploadFile() results got = %+v, want %d", results, len(tt.files))
+			}
+			for i, result := range results {
+				if result.Name != tt.files[i] || result.Location != tt.wantLocations[i] || result.Status != tt.wantStatuses[i] {
+					t.Errorf("UploadFile() result %d got = %+v, want name %s, location %q and status %d", i, result, tt.files[i], tt.wantLocations[i], tt.wantStatuses[i])
+				}
+				if (result.Error == nil) != (tt.wantStatuses[i] == http.StatusCreated) {
+					t.Errorf("UploadFile() result %d error got = %v", i, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_UploadFile_hostileNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		wantCode int
+	}{
+		{
+			name:     "directories are dropped from the name",
+			filename: "../../sample.mp4",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "", time.Time{}).Return("localhost/v1/files/sample.mp4", nil)
+			},
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "parent directory",
+			filename: "..",
+			mockFunc: func(mockService *filesSvcMock.MockService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "backslash separators",
+			filename: `..\\..\\sample.mp4`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "encoded separators",
+			filename: "..%2f..%2fsample.mp4",
+			mockFunc: func(mockService *filesSvcMock.MockService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "NUL byte",
+			filename: "sample.mp4\x00.txt",
+			mockFunc: func(mockService *filesSvcMock.MockService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "temporary file of the blob storage",
+			filename: ".upload-123",
+			mockFunc: func(mockService *filesSvcMock.MockService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			writer, err := mw.CreateFormFile("data", tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = writer.Write([]byte("sample string"))
+			_ = mw.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/files", body)
+			r.Header.Add(echo.HeaderContentType, mw.FormDataContentType())
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err = h.UploadFile(ctx)
+			code := w.Code
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				code = httpErr.Code
+			}
+			if code != tt.wantCode {
+				t.Errorf("UploadFile() status code got = %d, want %d, err = %v", code, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_GetFileVersions(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		fileID   string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name:   "successfully get the versions",
+			fileID: "file-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetFileVersions(gomock.Any(), fileid.ID("file-id")).Return([]filesSvc.FileInfo{
+					{
+						FileID:    "file-id",
+						Version:   1,
+						Name:      "sample.mp4",
+						Size:      13,
+						CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+					},
+					{
+						FileID:    "file-id",
+						Version:   2,
+						Name:      "sample.mp4",
+						Size:      15,
+						CreatedAt: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+					},
+				}, nil)
+			},
+			want: want{
+				body: `[{"fileid":"file-id","version":1,"name":"sample.mp4","size":13,"created_at":"2023-01-01T00:00:00Z"},{"fileid":"file-id","version":2,"name":"sample.mp4","size":15,"created_at":"2023-01-02T00:00:00Z"}]`,
+				code: http.StatusOK,
+			},
+			wantErr: false,
+		},
+		{
+			name:   "file not found",
+			fileID: "file-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetFileVersions(gomock.Any(), fileid.ID("file-id")).Return([]filesSvc.FileInfo{}, sql.ErrNoRows)
+			},
+			want: want{
+				body: `{"message":"requested file is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "invalid file id",
+			fileID: "..",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid file id","dev_message":"invalid file id: starts with a dot: \"..\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/v1/files/"+tt.fileID+"/versions", nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/files/:fileID/versions")
+			ctx.SetParamNames("fileID")
+			ctx.SetParamValues(tt.fileID)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.GetFileVersions(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("GetFileVersions() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("GetFileVersions() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.want.code {
+				t.Errorf("GetFileVersions() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("GetFileVersions() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_GetFileVersion(t *testing.T) {
+	type want struct {
+		body               string
+		code               int
+		contentDisposition string
+	}
+	tests := []struct {
+		name     string
+		version  string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name:    "successfully get the requested version",
+			version: "2",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetFileVersion(gomock.Any(), fileid.ID("file-id"), 2).Return(filesSvc.FileInfo{
+					FileID:  "file-id",
+					Version: 2,
+					Name:    "sample.mp4",
+					Size:    13,
+				}, readSeekNopCloser{strings.NewReader("sample string")}, nil)
+			},
+			want: want{
+				body:               "sample string",
+				code:               http.StatusOK,
+				contentDisposition: "form-data; name='data'; filename=sample.mp4",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "requested version not found",
+			version: "2",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetFileVersion(gomock.Any(), fileid.ID("file-id"), 2).Return(filesSvc.FileInfo{}, nil, sql.ErrNoRows)
+			},
+			want: want{
+				body: `{"message":"requested file version is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			version: "0",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid version, it must be a positive number","dev_message":"version must be positive: 0"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "version is not a number",
+			version: "latest",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid version, it must be a positive number","dev_message":"strconv.Atoi: parsing \"latest\": invalid syntax"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/v1/files/file-id/versions/"+tt.version, nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/files/:fileID/versions/:version")
+			ctx.SetParamNames("fileID", "version")
+			ctx.SetParamValues("file-id", tt.version)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.GetFileVersion(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("GetFileVersion() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("GetFileVersion() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			if res.StatusCode != tt.want.code {
+				t.Errorf("GetFileVersion() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if res.Header.Get(echo.HeaderContentDisposition) != tt.want.contentDisposition {
+				t.Errorf("GetFileVersion() content-disposition got = %s, want %s\n", res.Header.Get(echo.HeaderContentDisposition), tt.want.contentDisposition)
+			}
+			resBody, _ := io.ReadAll(res.Body)
+			if string(resBody) != tt.want.body {
+				t.Errorf("GetFileVersion() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_DeleteFileVersion(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name: "successfully delete the version",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteFileVersion(gomock.Any(), fileid.ID("file-id"), 2).Return(nil)
+			},
+			want: want{
+				body: "OK",
+				code: http.StatusNoContent,
+			},
+			wantErr: false,
+		},
+		{
+			name: "deleted version not found",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteFileVersion(gomock.Any(), fileid.ID("file-id"), 2).Return(sql.ErrNoRows)
+			},
+			want: want{
+				body: `{"message":"deleted file version is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to delete the version",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteFileVersion(gomock.Any(), fileid.ID("file-id"), 2).Return(fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to delete version 2 of file with id: file-id","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodDelete, "http://localhost/v1/files/file-id/versions/2", nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/files/:fileID/versions/:version")
+			ctx.SetParamNames("fileID", "version")
+			ctx.SetParamValues("file-id", "2")
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.DeleteFileVersion(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("DeleteFileVersion() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("DeleteFileVersion() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			if res.StatusCode != tt.want.code {
+				t.Errorf("DeleteFileVersion() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_RestoreFile(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		fileID   string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name:   "successfully restore a file",
+			fileID: "file-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().RestoreFile(gomock.Any(), fileid.ID("file-id")).Return(nil)
+			},
+			want: want{
+				body: `OK`,
+				code: http.StatusNoContent,
+			},
+			wantErr: false,
+		},
+		{
+			name:   "file not in the trash",
+			fileID: "file-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().RestoreFile(gomock.Any(), fileid.ID("file-id")).Return(sql.ErrNoRows)
+			},
+			want: want{
+				body: `{"message":"restored file is not in the trash","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "failed to restore a file",
+			fileID: "file-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().RestoreFile(gomock.Any(), fileid.ID("file-id")).Return(fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to restore file with id: file-id","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "invalid file id",
+			fileID: "..",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid file id","dev_message":"invalid file id: starts with a dot: \"..\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/files/"+tt.fileID+"/restore", nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/files/:fileID/restore")
+			ctx.SetParamNames("fileID")
+			ctx.SetParamValues(tt.fileID)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.RestoreFile(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("RestoreFile() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("RestoreFile() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.want.code {
+				t.Errorf("RestoreFile() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("RestoreFile() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_GetTrash(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name: "successfully list the trash",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetTrash(gomock.Any()).Return([]filesSvc.TrashedFileInfo{
+					{
+						FileInfo: filesSvc.FileInfo{
+							FileID:    "file-id",
+							Version:   2,
+							Name:      "sample.mp4",
+							Size:      13,
+							CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+						},
+						TrashedAt: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+					},
+				}, nil)
+			},
+			want: want{
+				body: `[{"fileid":"file-id","version":2,"name":"sample.mp4","size":13,"created_at":"2023-01-01T00:00:00Z","trashed_at":"2023-01-02T00:00:00Z"}]`,
+				code: http.StatusOK,
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to list the trash",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetTrash(gomock.Any()).Return([]filesSvc.TrashedFileInfo{}, fmt.Errorf("some-err"))
+			},
+			want: want{
+				body: `{"message":"failed to get trashed files from DB","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/v1/trash", nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.GetTrash(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("GetTrash() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("GetTrash() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.want.code {
+				t.Errorf("GetTrash() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("GetTrash() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_SetFileExpiry(t *testing.T) {
+	type want struct {
+		body string
+		code int
+	}
+	tests := []struct {
+		name     string
+		fileID   string
+		body     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     want
+		wantErr  bool
+	}{
+		{
+			name:   "successfully set the expiry of a file",
+			fileID: "file-id",
+			body:   `{"expires_at":"2030-01-02T03:04:05Z"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().SetFileExpiry(gomock.Any(), fileid.ID("file-id"), time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)).Return(nil)
+			},
+			want: want{
+				body: `OK`,
+				code: http.StatusNoContent,
+			},
+			wantErr: false,
+		},
+		{
+			name:   "successfully extend a file by a ttl",
+			fileID: "file-id",
+			body:   `{"ttl":"720h"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().SetFileExpiry(gomock.Any(), fileid.ID("file-id"), gomock.Any()).DoAndReturn(func(_ context.Context, _ fileid.ID, expiresAt time.Time) error {
+					if until := time.Until(expiresAt); until <= 719*time.Hour || until > 720*time.Hour {
+						t.Errorf("SetFileExpiry() expiresAt got = %v, want 720h from now", expiresAt)
+					}
+					return nil
+				})
+			},
+			want: want{
+				body: `OK`,
+				code: http.StatusNoContent,
+			},
+			wantErr: false,
+		},
+		{
+			name:   "neither expires_at nor ttl is set",
+			fileID: "file-id",
+			body:   `{}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future","dev_message":"neither expires_at nor ttl is set"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "both expires_at and ttl are set",
+			fileID: "file-id",
+			body:   `{"expires_at":"2030-01-02T03:04:05Z","ttl":"720h"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future","dev_message":"both expires_at and ttl are set"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "invalid body",
+			fileID: "file-id",
+			body:   `720h`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid request body, it must be a JSON object","dev_message":"json: cannot unmarshal number into Go value of type handler.expiryRequest"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "file not found",
+			fileID: "file-id",
+			body:   `{"expires_at":"2030-01-02T03:04:05Z"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().SetFileExpiry(gomock.Any(), fileid.ID("file-id"), time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)).Return(sql.ErrNoRows)
+			},
+			want: want{
+				body: `{"message":"requested file is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "expiry in the past",
+			fileID: "file-id",
+			body:   `{"expires_at":"2020-01-02T03:04:05Z"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().SetFileExpiry(gomock.Any(), fileid.ID("file-id"), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)).Return(filesSvc.ErrorInvalidExpiry)
+			},
+			want: want{
+				body: `{"message":"invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future","dev_message":"expiry must be in the future"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:   "invalid file id",
+			fileID: "..",
+			body:   `{"ttl":"720h"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: want{
+				body: `{"message":"invalid file id","dev_message":"invalid file id: starts with a dot: \"..\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPatch, "http://localhost/v1/files/"+tt.fileID, strings.NewReader(tt.body))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/files/:fileID")
+			ctx.SetParamNames("fileID")
+			ctx.SetParamValues(tt.fileID)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+
+			err := h.SetFileExpiry(ctx)
+			if tt.wantErr {
+				httpErr := err.(*echo.HTTPError)
+				if httpErr.Code != tt.want.code {
+					t.Errorf("SetFileExpiry() status code got = %d, want %d\n", httpErr.Code, tt.want.code)
+				}
+				errMsgByte, _ := json.Marshal(httpErr.Message)
+				if strings.TrimSpace(string(errMsgByte)) != tt.want.body {
+					t.Errorf("SetFileExpiry() body got = %s, want %s\n", string(errMsgByte), tt.want.body)
+				}
+				return
+			}
+
+			res := w.Result()
+			defer res.Body.Close()
+			resBody, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.want.code {
+				t.Errorf("SetFileExpiry() status code got = %d, want %d\n", res.StatusCode, tt.want.code)
+			}
+			if strings.TrimSpace(string(resBody)) != tt.want.body {
+				t.Errorf("SetFileExpiry() body got = %s, want %s\n", string(resBody), tt.want.body)
+			}
+		})
+	}
+}
+
+func Test_filesHTTPHandler_PutFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		headers  map[string]string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully put a file",
+			url:  "http://localhost/v1/files/sample.mp4",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mp4",
+				HeaderOwner:            "owner",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().PutFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "video/mp4", "owner", time.Time{}, false).Return("localhost/v1/files/sample.mp4", nil)
+			},
+			want: wantResponse{
+				code: http.StatusCreated,
+				headers: map[string]string{
+					"Location": "localhost/v1/files/sample.mp4",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully create a file with an expiry",
+			url:  "http://localhost/v1/files/sample.mpg?expires_at=2030-01-02T03:04:05Z",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mpeg",
+				"If-None-Match":        "*",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().PutFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mpg"), "video/mpeg", "", time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), true).Return("localhost/v1/files/sample.mpg", nil)
+			},
+			want: wantResponse{
+				code: http.StatusCreated,
+				headers: map[string]string{
+					"Location": "localhost/v1/files/sample.mpg",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully put a file with media type parameters under a generated id",
+			url:  "http://localhost/v1/files/6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b",
+			headers: map[string]string{
+				echo.HeaderContentType: `video/mp4; codecs="avc1.64001f"`,
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().PutFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b"), "video/mp4", "", time.Time{}, false).Return("localhost/v1/files/6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b", nil)
+			},
+			want: wantResponse{
+				code: http.StatusCreated,
+				headers: map[string]string{
+					"Location": "localhost/v1/files/6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported content type",
+			url:  "http://localhost/v1/files/sample.mp4",
+			headers: map[string]string{
+				echo.HeaderContentType: "application/octet-stream",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid content type, only video/mp4 and video/mpeg allowed","dev_message":"unsupported content type: \"application/octet-stream\""}`,
+				code: http.StatusUnsupportedMediaType,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported If-None-Match",
+			url:  "http://localhost/v1/files/sample.mp4",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mp4",
+				"If-None-Match":        `"some-etag"`,
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid If-None-Match header, only * is supported","dev_message":"unsupported If-None-Match: \"\\\"some-etag\\\"\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid ttl",
+			url:  "http://localhost/v1/files/sample.mp4?ttl=-1h",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid expiry, set either ttl as a duration such as 720h or expires_at as an RFC 3339 time in the future","dev_message":"ttl must be positive: -1h"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "create an existing file",
+			url:  "http://localhost/v1/files/sample.mp4",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mp4",
+				"If-None-Match":        "*",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().PutFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "video/mp4", "", time.Time{}, true).Return("", filesSvc.ErrorFileExists)
+			},
+			want: wantResponse{
+				body: `{"message":"file with id: sample.mp4 is already exist","dev_message":"file already exists"}`,
+				code: http.StatusPreconditionFailed,
+			},
+			wantErr: true,
+		},
+		{
+			name: "file type not matching the content type",
+			url:  "http://localhost/v1/files/sample.mpg",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().PutFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mpg"), "video/mp4", "", time.Time{}, false).Return("", filesSvc.ErrorUnsupportedFileTypes)
+			},
+			want: wantResponse{
+				body: `{"message":"invalid content type, only video/mp4 and video/mpeg allowed","dev_message":"unsupported file types"}`,
+				code: http.StatusUnsupportedMediaType,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to put a file",
+			url:  "http://localhost/v1/files/sample.mp4",
+			headers: map[string]string{
+				echo.HeaderContentType: "video/mp4",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().PutFile(gomock.Any(), gomock.Any(), "localhost", fileid.ID("sample.mp4"), "video/mp4", "", time.Time{}, false).Return("", fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to upload the file, please try again later","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPut, tt.url, strings.NewReader("sample string"))
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/files/:fileID")
+			ctx.SetParamNames("fileID")
+			ctx.SetParamValues(strings.TrimPrefix(r.URL.Path, "/v1/files/"))
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.PutFile(ctx)
+			checkResponse(t, "PutFile", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_uploadError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    int
+		wantMessage string
+	}{
+		{
+			name:        "unsupported file type",
+			err:         filesSvc.ErrorUnsupportedFileTypes,
+			wantCode:    http.StatusUnsupportedMediaType,
+			wantMessage: "invalid content type, only video/mp4 and video/mpeg allowed",
+		},
+		{
+			name:        "file uploaded concurrently",
+			err:         filesSvc.ErrorDuplicateKey,
+			wantCode:    http.StatusConflict,
+			wantMessage: "the file is being uploaded by another request, try again later",
+		},
+		{
+			name:        "upload written concurrently",
+			err:         filesSvc.ErrorUploadLocked,
+			wantCode:    http.StatusLocked,
+			wantMessage: "the upload is being written by another request, try again later",
+		},
+		{
+			name:        "wrapped quota exceeded",
+			err:         fmt.Errorf("failed to store part, err: %w", filesSvc.ErrorQuotaExceeded),
+			wantCode:    http.StatusInsufficientStorage,
+			wantMessage: "storage quota exceeded, delete some files or ask for a larger quota",
+		},
+		{
+			name:        "wrapped insufficient storage",
+			err:         fmt.Errorf("failed to store part, err: %w", filesSvc.ErrorInsufficientStorage),
+			wantCode:    http.StatusInsufficientStorage,
+			wantMessage: "storage is running out of space, try again later",
+		},
+		{
+			name:        "invalid owner",
+			err:         fmt.Errorf("%w: too long", filesSvc.ErrorInvalidOwner),
+			wantCode:    http.StatusBadRequest,
+			wantMessage: "invalid X-Owner header",
+		},
+		{
+			name:        "invalid expiry",
+			err:         fmt.Errorf("%w: in the past", filesSvc.ErrorInvalidExpiry),
+			wantCode:    http.StatusBadRequest,
+			wantMessage: invalidExpiryMessage,
+		},
+		{
+			name:        "resumable uploads disabled",
+			err:         filesSvc.ErrorResumableUploadsDisabled,
+			wantCode:    http.StatusNotImplemented,
+			wantMessage: "resumable uploads are disabled",
+		},
+		{
+			name:        "multipart uploads disabled",
+			err:         filesSvc.ErrorMultipartUploadsDisabled,
+			wantCode:    http.StatusNotImplemented,
+			wantMessage: "multipart uploads are disabled",
+		},
+		{
+			name:        "unexpected error",
+			err:         fmt.Errorf("some-err"),
+			wantCode:    http.StatusInternalServerError,
+			wantMessage: "failed to upload",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uploadError(tt.err, "failed to upload")
+			if got.Code != tt.wantCode {
+				t.Errorf("uploadError() code got = %d, want %d", got.Code, tt.wantCode)
+			}
+			message, _ := json.Marshal(got.Message)
+			wantMessage, _ := json.Marshal(httpHelper.NewErrorMessage(tt.wantMessage, tt.err))
+			if string(message) != string(wantMessage) {
+				t.Errorf("uploadError() message got = %s, want %s", message, wantMessage)
+			}
+		})
+	}
+}
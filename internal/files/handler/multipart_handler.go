@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	httpHelper "github.com/cityos-dev/Cornelius-David-Herianto/helper/http"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+)
+
+// createMultipartUploadRequest is the body of a request starting a multipart upload
+type createMultipartUploadRequest struct {
+	Name string `json:"name"`
+}
+
+// completeMultipartUploadRequest is the body of a request completing a multipart upload
+type completeMultipartUploadRequest struct {
+	Parts []filesSvc.CompletedPart `json:"parts"`
+}
+
+// CreateMultipartUpload starts a multipart upload of the file named in the request body
+func (h filesHTTPHandler) CreateMultipartUpload(ctx echo.Context) error {
+	var request createMultipartUploadRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid request body, it must be a JSON object", err))
+	}
+	// as for the multipart form uploads, the directories some clients send along with the name are dropped
+	fileName, err := fileid.Parse(filepath.Base(request.Name))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file name", err))
+	}
+
+	upload, err := h.service.CreateMultipartUpload(ctx.Request().Context(), fileName, ctx.Request().Header.Get(HeaderOwner))
+	if err != nil {
+		return uploadError(err, "failed to create the multipart upload, please try again later")
+	}
+
+	// the location is relative, so the clients resolve it against the URL they reached the server with
+	ctx.Response().Header().Set("Location", "/v1/multipart-uploads/"+upload.UploadID)
+	return ctx.JSON(http.StatusCreated, upload)
+}
+
+// UploadPart stores the request body as the numbered part of the multipart upload, the checksum of the part is returned as its ETag
+func (h filesHTTPHandler) UploadPart(ctx echo.Context) error {
+	uploadID, err := fileid.Parse(ctx.Param("uploadID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid upload id", err))
+	}
+	partNumber, err := strconv.Atoi(ctx.Param("partNumber"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid part number, it must be between 1 and %d", filesSvc.MaxPartNumber), err))
+	}
+
+	part, err := h.service.UploadPart(ctx.Request().Context(), uploadID, partNumber, ctx.Request().Body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested multipart upload is not exists", err))
+		} else if errors.Is(err, filesSvc.ErrorInvalidPartNumber) {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid part number, it must be between 1 and %d", filesSvc.MaxPartNumber), err))
+		}
+		return uploadError(err, fmt.Sprintf("failed to upload part %d of multipart upload with id: %s", partNumber, uploadID))
+	}
+
+	ctx.Response().Header().Set("ETag", strconv.Quote(part.Checksum))
+	return ctx.JSON(http.StatusOK, part)
+}
+
+// CompleteMultipartUpload stores the parts listed in the request body as a new file, the location of the file is returned
+func (h filesHTTPHandler) CompleteMultipartUpload(ctx echo.Context) error {
+	uploadID, err := fileid.Parse(ctx.Param("uploadID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid upload id", err))
+	}
+	var request completeMultipartUploadRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid request body, it must be a JSON object", err))
+	}
+
+	location, err := h.service.CompleteMultipartUpload(ctx.Request().Context(), uploadID, ctx.Request().Host, request.Parts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested multipart upload is not exists", err))
+		} else if errors.Is(err, filesSvc.ErrorInvalidPart) {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid parts, list every part with the checksum returned when it was uploaded", err))
+		} else if errors.Is(err, filesSvc.ErrorInvalidPartOrder) {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid parts, list them in ascending order of their part numbers", err))
+		}
+		return uploadError(err, fmt.Sprintf("failed to complete multipart upload with id: %s", uploadID))
+	}
+
+	ctx.Response().Header().Set("Location", location)
+	return ctx.String(http.StatusCreated, "OK")
+}
+
+// AbortMultipartUpload stops the multipart upload and removes the parts it received
+func (h filesHTTPHandler) AbortMultipartUpload(ctx echo.Context) error {
+	uploadID, err := fileid.Parse(ctx.Param("uploadID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid upload id", err))
+	}
+
+	err = h.service.AbortMultipartUpload(ctx.Request().Context(), uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("aborted multipart upload is not exists", err))
+		}
+		return uploadError(err, fmt.Sprintf("failed to abort multipart upload with id: %s", uploadID))
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,423 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+	filesSvcMock "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service/mocks"
+)
+
+func Test_filesHTTPHandler_CreateMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully create a multipart upload",
+			body: `{"name":"test.mp4"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateMultipartUpload(gomock.Any(), fileid.ID("test.mp4"), "owner").Return(filesSvc.MultipartUploadInfo{
+					UploadID: "upload-id",
+					Name:     "test.mp4",
+				}, nil)
+			},
+			want: wantResponse{
+				code: http.StatusCreated,
+				headers: map[string]string{
+					"Location": "/v1/multipart-uploads/upload-id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid request body",
+			body: `{"name":`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid request body, it must be a JSON object","dev_message":"unexpected EOF"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid file name",
+			body: `{"name":""}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid file name","dev_message":"invalid file id: starts with a dot: \".\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "multipart uploads are disabled",
+			body: `{"name":"test.mp4"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateMultipartUpload(gomock.Any(), fileid.ID("test.mp4"), "owner").Return(filesSvc.MultipartUploadInfo{}, filesSvc.ErrorMultipartUploadsDisabled)
+			},
+			want: wantResponse{
+				body: `{"message":"multipart uploads are disabled","dev_message":"multipart uploads are disabled"}`,
+				code: http.StatusNotImplemented,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported file type",
+			body: `{"name":"test.txt"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateMultipartUpload(gomock.Any(), fileid.ID("test.txt"), "owner").Return(filesSvc.MultipartUploadInfo{}, filesSvc.ErrorUnsupportedFileTypes)
+			},
+			want: wantResponse{
+				body: `{"message":"invalid content type, only video/mp4 and video/mpeg allowed","dev_message":"unsupported file types"}`,
+				code: http.StatusUnsupportedMediaType,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to create a multipart upload",
+			body: `{"name":"test.mp4"}`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateMultipartUpload(gomock.Any(), fileid.ID("test.mp4"), "owner").Return(filesSvc.MultipartUploadInfo{}, fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to create the multipart upload, please try again later","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/multipart-uploads", strings.NewReader(tt.body))
+			r.Header.Set(HeaderOwner, "owner")
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.CreateMultipartUpload(ctx)
+			checkResponse(t, "CreateMultipartUpload", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_filesHTTPHandler_UploadPart(t *testing.T) {
+	tests := []struct {
+		name       string
+		partNumber string
+		mockFunc   func(mockService *filesSvcMock.MockService)
+		want       wantResponse
+		wantErr    bool
+	}{
+		{
+			name:       "successfully upload a part",
+			partNumber: "2",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadPart(gomock.Any(), fileid.ID("upload-id"), 2, gomock.Any()).Return(filesSvc.PartInfo{
+					PartNumber: 2,
+					Size:       6,
+					Checksum:   "sample-checksum",
+				}, nil)
+			},
+			want: wantResponse{
+				code: http.StatusOK,
+				headers: map[string]string{
+					"ETag": `"sample-checksum"`,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:       "part number is not a number",
+			partNumber: "two",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid part number, it must be between 1 and 10000","dev_message":"strconv.Atoi: parsing \"two\": invalid syntax"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:       "part number out of range",
+			partNumber: "0",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadPart(gomock.Any(), fileid.ID("upload-id"), 0, gomock.Any()).Return(filesSvc.PartInfo{}, fmt.Errorf("%w: 0", filesSvc.ErrorInvalidPartNumber))
+			},
+			want: wantResponse{
+				body: `{"message":"invalid part number, it must be between 1 and 10000","dev_message":"invalid part number: 0"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name:       "multipart upload not found",
+			partNumber: "2",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadPart(gomock.Any(), fileid.ID("upload-id"), 2, gomock.Any()).Return(filesSvc.PartInfo{}, fmt.Errorf("failed to get multipart upload from DB, err: %w", sql.ErrNoRows))
+			},
+			want: wantResponse{
+				body: `{"message":"requested multipart upload is not exists","dev_message":"failed to get multipart upload from DB, err: sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:       "part being written",
+			partNumber: "2",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadPart(gomock.Any(), fileid.ID("upload-id"), 2, gomock.Any()).Return(filesSvc.PartInfo{}, filesSvc.ErrorUploadLocked)
+			},
+			want: wantResponse{
+				body: `{"message":"the upload is being written by another request, try again later","dev_message":"upload is being written"}`,
+				code: http.StatusLocked,
+			},
+			wantErr: true,
+		},
+		{
+			name:       "quota exceeded",
+			partNumber: "2",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().UploadPart(gomock.Any(), fileid.ID("upload-id"), 2, gomock.Any()).Return(filesSvc.PartInfo{}, filesSvc.ErrorQuotaExceeded)
+			},
+			want: wantResponse{
+				body: `{"message":"storage quota exceeded, delete some files or ask for a larger quota","dev_message":"storage quota exceeded"}`,
+				code: http.StatusInsufficientStorage,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPut, "http://localhost/v1/multipart-uploads/upload-id/parts/"+tt.partNumber, strings.NewReader("string"))
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/multipart-uploads/:uploadID/parts/:partNumber")
+			ctx.SetParamNames("uploadID", "partNumber")
+			ctx.SetParamValues("upload-id", tt.partNumber)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.UploadPart(ctx)
+			checkResponse(t, "UploadPart", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_filesHTTPHandler_CompleteMultipartUpload(t *testing.T) {
+	parts := []filesSvc.CompletedPart{
+		{PartNumber: 1, Checksum: "sample-checksum-1"},
+		{PartNumber: 2, Checksum: "sample-checksum-2"},
+	}
+	body := `{"parts":[{"part_number":1,"checksum":"sample-checksum-1"},{"part_number":2,"checksum":"sample-checksum-2"}]}`
+	tests := []struct {
+		name     string
+		body     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully complete a multipart upload",
+			body: body,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CompleteMultipartUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", parts).Return("localhost/v1/files/file-id", nil)
+			},
+			want: wantResponse{
+				code: http.StatusCreated,
+				headers: map[string]string{
+					"Location": "localhost/v1/files/file-id",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid request body",
+			body: `{"parts":`,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid request body, it must be a JSON object","dev_message":"unexpected EOF"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "multipart upload not found",
+			body: body,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CompleteMultipartUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", parts).Return("", fmt.Errorf("failed to get multipart upload from DB, err: %w", sql.ErrNoRows))
+			},
+			want: wantResponse{
+				body: `{"message":"requested multipart upload is not exists","dev_message":"failed to get multipart upload from DB, err: sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "part not matching its checksum",
+			body: body,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CompleteMultipartUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", parts).Return("", fmt.Errorf("%w: checksum of part 2 does not match", filesSvc.ErrorInvalidPart))
+			},
+			want: wantResponse{
+				body: `{"message":"invalid parts, list every part with the checksum returned when it was uploaded","dev_message":"invalid part: checksum of part 2 does not match"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "parts not in ascending order",
+			body: body,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CompleteMultipartUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", parts).Return("", filesSvc.ErrorInvalidPartOrder)
+			},
+			want: wantResponse{
+				body: `{"message":"invalid parts, list them in ascending order of their part numbers","dev_message":"parts are not in ascending order"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "multipart upload being completed",
+			body: body,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CompleteMultipartUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", parts).Return("", filesSvc.ErrorUploadLocked)
+			},
+			want: wantResponse{
+				body: `{"message":"the upload is being written by another request, try again later","dev_message":"upload is being written"}`,
+				code: http.StatusLocked,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to complete a multipart upload",
+			body: body,
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CompleteMultipartUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", parts).Return("", fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to complete multipart upload with id: upload-id","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/multipart-uploads/upload-id/complete", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/multipart-uploads/:uploadID/complete")
+			ctx.SetParamNames("uploadID")
+			ctx.SetParamValues("upload-id")
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.CompleteMultipartUpload(ctx)
+			checkResponse(t, "CompleteMultipartUpload", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_filesHTTPHandler_AbortMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully abort a multipart upload",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().AbortMultipartUpload(gomock.Any(), fileid.ID("upload-id")).Return(nil)
+			},
+			want: wantResponse{
+				code: http.StatusNoContent,
+			},
+			wantErr: false,
+		},
+		{
+			name: "multipart upload not found",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().AbortMultipartUpload(gomock.Any(), fileid.ID("upload-id")).Return(fmt.Errorf("failed to abort multipart upload, err: %w", sql.ErrNoRows))
+			},
+			want: wantResponse{
+				body: `{"message":"aborted multipart upload is not exists","dev_message":"failed to abort multipart upload, err: sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "multipart upload being completed",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().AbortMultipartUpload(gomock.Any(), fileid.ID("upload-id")).Return(filesSvc.ErrorUploadLocked)
+			},
+			want: wantResponse{
+				body: `{"message":"the upload is being written by another request, try again later","dev_message":"upload is being written"}`,
+				code: http.StatusLocked,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to abort a multipart upload",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().AbortMultipartUpload(gomock.Any(), fileid.ID("upload-id")).Return(fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to abort multipart upload with id: upload-id","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodDelete, "http://localhost/v1/multipart-uploads/upload-id", nil)
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/multipart-uploads/:uploadID")
+			ctx.SetParamNames("uploadID")
+			ctx.SetParamValues("upload-id")
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.AbortMultipartUpload(ctx)
+			checkResponse(t, "AbortMultipartUpload", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
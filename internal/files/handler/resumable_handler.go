@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	httpHelper "github.com/cityos-dev/Cornelius-David-Herianto/helper/http"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+)
+
+// The resumable uploads implement the core of the tus protocol 1.0.0, along with its creation, termination, checksum and expiration extensions,
+// see https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum,expiration"
+
+	headerTusResumable           = "Tus-Resumable"
+	headerTusVersion             = "Tus-Version"
+	headerTusExtension           = "Tus-Extension"
+	headerTusChecksumAlgorithm   = "Tus-Checksum-Algorithm"
+	headerUploadOffset           = "Upload-Offset"
+	headerUploadLength           = "Upload-Length"
+	headerUploadMetadata         = "Upload-Metadata"
+	headerUploadChecksum         = "Upload-Checksum"
+	headerUploadExpires          = "Upload-Expires"
+	contentTypeOffsetOctetStream = "application/offset+octet-stream"
+
+	// statusChecksumMismatch is the tus status of a chunk which does not match its checksum
+	statusChecksumMismatch = 460
+)
+
+// GetUploadOptions describes the tus protocol supported by the resumable uploads
+func (h filesHTTPHandler) GetUploadOptions(ctx echo.Context) error {
+	ctx.Response().Header().Set(headerTusResumable, tusVersion)
+	ctx.Response().Header().Set(headerTusVersion, tusVersion)
+	ctx.Response().Header().Set(headerTusExtension, tusExtensions)
+	ctx.Response().Header().Set(headerTusChecksumAlgorithm, strings.Join(filesSvc.ChecksumAlgorithms(), ","))
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// CreateUpload starts a resumable upload, the file name is read from the filename key of the upload metadata
+func (h filesHTTPHandler) CreateUpload(ctx echo.Context) error {
+	if err := checkTusResumable(ctx); err != nil {
+		return err
+	}
+	length, err := strconv.ParseInt(ctx.Request().Header.Get(headerUploadLength), 10, 64)
+	if err != nil || length <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header, it must be the size of the file in bytes", headerUploadLength), fmt.Errorf("invalid upload length: %q", ctx.Request().Header.Get(headerUploadLength))))
+	}
+	rawMetadata := ctx.Request().Header.Get(headerUploadMetadata)
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header", headerUploadMetadata), err))
+	}
+	// as for the multipart uploads, the directories some clients send along with the name are dropped
+	fileName, err := fileid.Parse(filepath.Base(metadata["filename"]))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid file name, it must be set as filename in the upload metadata", err))
+	}
+
+	upload, err := h.service.CreateUpload(ctx.Request().Context(), fileName, ctx.Request().Header.Get(HeaderOwner), length, rawMetadata)
+	if err != nil {
+		return uploadError(err, "failed to create the upload, please try again later")
+	}
+
+	// the location is relative, so the clients resolve it against the URL they reached the server with
+	ctx.Response().Header().Set("Location", "/v1/uploads/"+upload.ID)
+	setUploadExpires(ctx, upload)
+	return ctx.NoContent(http.StatusCreated)
+}
+
+// GetUploadOffset returns the offset the next chunk of the resumable upload must start at
+func (h filesHTTPHandler) GetUploadOffset(ctx echo.Context) error {
+	if err := checkTusResumable(ctx); err != nil {
+		return err
+	}
+	uploadID, err := fileid.Parse(ctx.Param("uploadID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid upload id", err))
+	}
+
+	upload, err := h.service.GetUpload(ctx.Request().Context(), uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested upload is not exists", err))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage(fmt.Sprintf("failed to get upload with id: %s", uploadID), err))
+	}
+
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	ctx.Response().Header().Set(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	ctx.Response().Header().Set(headerUploadLength, strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		ctx.Response().Header().Set(headerUploadMetadata, upload.Metadata)
+	}
+	setUploadExpires(ctx, upload)
+	return ctx.NoContent(http.StatusOK)
+}
+
+// PatchUpload appends the request body to the resumable upload, once the upload is complete the location of the file is returned
+func (h filesHTTPHandler) PatchUpload(ctx echo.Context) error {
+	if err := checkTusResumable(ctx); err != nil {
+		return err
+	}
+	uploadID, err := fileid.Parse(ctx.Param("uploadID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid upload id", err))
+	}
+	if contentType := ctx.Request().Header.Get(echo.HeaderContentType); contentType != contentTypeOffsetOctetStream {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, httpHelper.NewErrorMessage(fmt.Sprintf("invalid content type, it must be %s", contentTypeOffsetOctetStream), fmt.Errorf("unsupported content type: %q", contentType)))
+	}
+	offset, err := strconv.ParseInt(ctx.Request().Header.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header, it must be the offset of the chunk in bytes", headerUploadOffset), fmt.Errorf("invalid upload offset: %q", ctx.Request().Header.Get(headerUploadOffset))))
+	}
+	checksum, err := parseUploadChecksum(ctx.Request().Header.Get(headerUploadChecksum))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header", headerUploadChecksum), err))
+	}
+
+	upload, err := h.service.WriteUpload(ctx.Request().Context(), uploadID, ctx.Request().Host, offset, ctx.Request().Body, checksum)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("requested upload is not exists", err))
+		} else if errors.Is(err, filesSvc.ErrorUploadExpired) {
+			return echo.NewHTTPError(http.StatusGone, httpHelper.NewErrorMessage("the upload expired, start a new one", err))
+		} else if errors.Is(err, filesSvc.ErrorUploadOffsetMismatch) {
+			return echo.NewHTTPError(http.StatusConflict, httpHelper.NewErrorMessage(fmt.Sprintf("invalid %s header, the upload is at offset %d", headerUploadOffset, upload.Offset), err))
+		} else if errors.Is(err, filesSvc.ErrorChecksumMismatch) {
+			return echo.NewHTTPError(statusChecksumMismatch, httpHelper.NewErrorMessage("the chunk does not match its checksum, send it again", err))
+		} else if errors.Is(err, filesSvc.ErrorUnsupportedChecksum) {
+			return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage(fmt.Sprintf("unsupported checksum algorithm, supported algorithms: %s", strings.Join(filesSvc.ChecksumAlgorithms(), ", ")), err))
+		} else if errors.Is(err, filesSvc.ErrorUploadLengthExceeded) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, httpHelper.NewErrorMessage(fmt.Sprintf("the chunk goes past the %s of the upload", headerUploadLength), err))
+		}
+		return uploadError(err, fmt.Sprintf("failed to write upload with id: %s", uploadID))
+	}
+
+	ctx.Response().Header().Set(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	if upload.Location != "" {
+		ctx.Response().Header().Set("Location", upload.Location)
+	} else {
+		setUploadExpires(ctx, upload)
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// DeleteUpload stops the resumable upload and removes the content it received
+func (h filesHTTPHandler) DeleteUpload(ctx echo.Context) error {
+	if err := checkTusResumable(ctx); err != nil {
+		return err
+	}
+	uploadID, err := fileid.Parse(ctx.Param("uploadID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, httpHelper.NewErrorMessage("invalid upload id", err))
+	}
+
+	err = h.service.DeleteUpload(ctx.Request().Context(), uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, httpHelper.NewErrorMessage("deleted upload is not exists", err))
+		}
+		return uploadError(err, fmt.Sprintf("failed to delete upload with id: %s", uploadID))
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// checkTusResumable sets the tus version on the response and rejects the requests made with another version of the protocol
+func checkTusResumable(ctx echo.Context) error {
+	ctx.Response().Header().Set(headerTusResumable, tusVersion)
+	if version := ctx.Request().Header.Get(headerTusResumable); version != tusVersion {
+		ctx.Response().Header().Set(headerTusVersion, tusVersion)
+		return echo.NewHTTPError(http.StatusPreconditionFailed, httpHelper.NewErrorMessage(fmt.Sprintf("unsupported tus version, only %s is supported", tusVersion), fmt.Errorf("unsupported %s: %q", headerTusResumable, version)))
+	}
+	return nil
+}
+
+// setUploadExpires tells the client until when the upload is kept without receiving another chunk
+func setUploadExpires(ctx echo.Context, upload filesSvc.UploadInfo) {
+	if !upload.ExpiresAt.IsZero() {
+		ctx.Response().Header().Set(headerUploadExpires, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata decodes the upload metadata, a comma separated list of keys each followed by its base64 encoded value
+func parseUploadMetadata(raw string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("duplicate metadata key: %s", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of metadata key: %s, err: %v", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseUploadChecksum parses the checksum of a chunk, the name of its algorithm followed by the base64 encoded sum
+func parseUploadChecksum(raw string) (filesSvc.Checksum, error) {
+	if raw == "" {
+		return filesSvc.Checksum{}, nil
+	}
+	algorithm, encoded, ok := strings.Cut(raw, " ")
+	if !ok || algorithm == "" {
+		return filesSvc.Checksum{}, fmt.Errorf("checksum must be an algorithm followed by the base64 encoded sum: %q", raw)
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return filesSvc.Checksum{}, fmt.Errorf("invalid checksum sum, err: %v", err)
+	}
+	return filesSvc.Checksum{
+		Algorithm: algorithm,
+		Sum:       sum,
+	}, nil
+}
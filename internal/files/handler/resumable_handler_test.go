@@ -0,0 +1,697 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+	filesSvcMock "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service/mocks"
+)
+
+// wantResponse is the expected response of a request, the body is only checked for the errors
+type wantResponse struct {
+	body    string
+	code    int
+	headers map[string]string
+}
+
+// checkResponse verifies the error or the response returned by a handler
+func checkResponse(t *testing.T, handlerName string, err error, w *httptest.ResponseRecorder, wantErr bool, want wantResponse) {
+	t.Helper()
+	if wantErr {
+		httpErr := err.(*echo.HTTPError)
+		if httpErr.Code != want.code {
+			t.Errorf("%s() status code got = %d, want %d\n", handlerName, httpErr.Code, want.code)
+		}
+		errMsgByte, _ := json.Marshal(httpErr.Message)
+		if strings.TrimSpace(string(errMsgByte)) != want.body {
+			t.Errorf("%s() body got = %s, want %s\n", handlerName, string(errMsgByte), want.body)
+		}
+	} else {
+		if err != nil {
+			t.Errorf("%s() error = %v\n", handlerName, err)
+			return
+		}
+		if w.Code != want.code {
+			t.Errorf("%s() status code got = %d, want %d\n", handlerName, w.Code, want.code)
+		}
+	}
+	for name, value := range want.headers {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s() header %s got = %s, want %s\n", handlerName, name, got, value)
+		}
+	}
+}
+
+func Test_filesHTTPHandler_GetUploadOptions(t *testing.T) {
+	r := httptest.NewRequest(http.MethodOptions, "http://localhost/v1/uploads", nil)
+	w := httptest.NewRecorder()
+	ctx := echo.New().NewContext(r, w)
+
+	h := filesHTTPHandler{}
+	err := h.GetUploadOptions(ctx)
+	checkResponse(t, "GetUploadOptions", err, w, false, wantResponse{
+		code: http.StatusNoContent,
+		headers: map[string]string{
+			"Tus-Resumable":          "1.0.0",
+			"Tus-Version":            "1.0.0",
+			"Tus-Extension":          "creation,termination,checksum,expiration",
+			"Tus-Checksum-Algorithm": "md5,sha1,sha256,sha512",
+		},
+	})
+}
+
+func Test_filesHTTPHandler_CreateUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully create an upload",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "13",
+				"Upload-Metadata": "filename dGVzdC5tcDQ=,filetype dmlkZW8vbXA0",
+				HeaderOwner:       "owner",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateUpload(gomock.Any(), fileid.ID("test.mp4"), "owner", int64(13), "filename dGVzdC5tcDQ=,filetype dmlkZW8vbXA0").Return(filesSvc.UploadInfo{
+					ID:        "upload-id",
+					Length:    13,
+					ExpiresAt: time.Date(2026, 10, 19, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+				}, nil)
+			},
+			want: wantResponse{
+				code: http.StatusCreated,
+				headers: map[string]string{
+					"Tus-Resumable":  "1.0.0",
+					"Location":       "/v1/uploads/upload-id",
+					"Upload-Expires": "Mon, 19 Oct 2026 12:00:00 GMT",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported tus version",
+			headers: map[string]string{
+				"Tus-Resumable": "0.2.2",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"unsupported tus version, only 1.0.0 is supported","dev_message":"unsupported Tus-Resumable: \"0.2.2\""}`,
+				code: http.StatusPreconditionFailed,
+				headers: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Tus-Version":   "1.0.0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing upload length",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Metadata": "filename dGVzdC5tcDQ=",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid Upload-Length header, it must be the size of the file in bytes","dev_message":"invalid upload length: \"\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid upload metadata",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "13",
+				"Upload-Metadata": "filename !!!",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid Upload-Metadata header","dev_message":"invalid value of metadata key: filename, err: illegal base64 data at input byte 0"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing file name",
+			headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "13",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid file name, it must be set as filename in the upload metadata","dev_message":"invalid file id: starts with a dot: \".\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported file type",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "13",
+				"Upload-Metadata": "filename dGVzdC50eHQ=",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateUpload(gomock.Any(), fileid.ID("test.txt"), "", int64(13), "filename dGVzdC50eHQ=").Return(filesSvc.UploadInfo{}, filesSvc.ErrorUnsupportedFileTypes)
+			},
+			want: wantResponse{
+				body: `{"message":"invalid content type, only video/mp4 and video/mpeg allowed","dev_message":"unsupported file types"}`,
+				code: http.StatusUnsupportedMediaType,
+			},
+			wantErr: true,
+		},
+		{
+			name: "upload larger than the quota",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "13",
+				"Upload-Metadata": "filename dGVzdC5tcDQ=",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateUpload(gomock.Any(), fileid.ID("test.mp4"), "", int64(13), "filename dGVzdC5tcDQ=").Return(filesSvc.UploadInfo{}, filesSvc.ErrorQuotaExceeded)
+			},
+			want: wantResponse{
+				body: `{"message":"storage quota exceeded, delete some files or ask for a larger quota","dev_message":"storage quota exceeded"}`,
+				code: http.StatusInsufficientStorage,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to create an upload",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "13",
+				"Upload-Metadata": "filename dGVzdC5tcDQ=",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().CreateUpload(gomock.Any(), fileid.ID("test.mp4"), "", int64(13), "filename dGVzdC5tcDQ=").Return(filesSvc.UploadInfo{}, fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to create the upload, please try again later","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/v1/uploads", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.CreateUpload(ctx)
+			checkResponse(t, "CreateUpload", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_filesHTTPHandler_GetUploadOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		uploadID string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name:     "successfully get the offset of an upload",
+			uploadID: "upload-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetUpload(gomock.Any(), fileid.ID("upload-id")).Return(filesSvc.UploadInfo{
+					ID:        "upload-id",
+					Length:    13,
+					Offset:    7,
+					Metadata:  "filename dGVzdC5tcDQ=",
+					ExpiresAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+				}, nil)
+			},
+			want: wantResponse{
+				code: http.StatusOK,
+				headers: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Cache-Control":   "no-store",
+					"Upload-Offset":   "7",
+					"Upload-Length":   "13",
+					"Upload-Metadata": "filename dGVzdC5tcDQ=",
+					"Upload-Expires":  "Mon, 19 Oct 2026 12:00:00 GMT",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:     "upload not found",
+			uploadID: "upload-id",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().GetUpload(gomock.Any(), fileid.ID("upload-id")).Return(filesSvc.UploadInfo{}, sql.ErrNoRows)
+			},
+			want: wantResponse{
+				body: `{"message":"requested upload is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:     "invalid upload id",
+			uploadID: "..",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid upload id","dev_message":"invalid file id: starts with a dot: \"..\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodHead, "http://localhost/v1/uploads/"+tt.uploadID, nil)
+			r.Header.Set("Tus-Resumable", "1.0.0")
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/uploads/:uploadID")
+			ctx.SetParamNames("uploadID")
+			ctx.SetParamValues(tt.uploadID)
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.GetUploadOffset(ctx)
+			checkResponse(t, "GetUploadOffset", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_filesHTTPHandler_PatchUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully write a chunk",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{
+					ID:        "upload-id",
+					Length:    20,
+					Offset:    13,
+					ExpiresAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+				}, nil)
+			},
+			want: wantResponse{
+				code: http.StatusNoContent,
+				headers: map[string]string{
+					"Tus-Resumable":  "1.0.0",
+					"Upload-Offset":  "13",
+					"Location":       "",
+					"Upload-Expires": "Mon, 19 Oct 2026 12:00:00 GMT",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully write the last chunk with a checksum",
+			headers: map[string]string{
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "7",
+				"Upload-Checksum": "sha1 c2FtcGxl",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{
+					Algorithm: "sha1",
+					Sum:       []byte("sample"),
+				}).Return(filesSvc.UploadInfo{
+					ID:        "upload-id",
+					Length:    13,
+					Offset:    13,
+					Location:  "localhost/v1/files/file-id",
+					ExpiresAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+				}, nil)
+			},
+			want: wantResponse{
+				code: http.StatusNoContent,
+				headers: map[string]string{
+					"Upload-Offset":  "13",
+					"Location":       "localhost/v1/files/file-id",
+					"Upload-Expires": "",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid content type",
+			headers: map[string]string{
+				"Content-Type":  "application/octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid content type, it must be application/offset+octet-stream","dev_message":"unsupported content type: \"application/octet-stream\""}`,
+				code: http.StatusUnsupportedMediaType,
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing upload offset",
+			headers: map[string]string{
+				"Content-Type": "application/offset+octet-stream",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid Upload-Offset header, it must be the offset of the chunk in bytes","dev_message":"invalid upload offset: \"\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid checksum",
+			headers: map[string]string{
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "7",
+				"Upload-Checksum": "sha1",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+			},
+			want: wantResponse{
+				body: `{"message":"invalid Upload-Checksum header","dev_message":"checksum must be an algorithm followed by the base64 encoded sum: \"sha1\""}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "chunk not starting at the offset of the upload",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "3",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(3), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{
+					ID:     "upload-id",
+					Length: 13,
+					Offset: 7,
+				}, fmt.Errorf("%w: got 3, the upload is at 7", filesSvc.ErrorUploadOffsetMismatch))
+			},
+			want: wantResponse{
+				body: `{"message":"invalid Upload-Offset header, the upload is at offset 7","dev_message":"upload offset mismatch: got 3, the upload is at 7"}`,
+				code: http.StatusConflict,
+			},
+			wantErr: true,
+		},
+		{
+			name: "chunk not matching its checksum",
+			headers: map[string]string{
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "7",
+				"Upload-Checksum": "sha1 c2FtcGxl",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), gomock.Any()).Return(filesSvc.UploadInfo{}, filesSvc.ErrorChecksumMismatch)
+			},
+			want: wantResponse{
+				body: `{"message":"the chunk does not match its checksum, send it again","dev_message":"checksum mismatch"}`,
+				code: 460,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported checksum algorithm",
+			headers: map[string]string{
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "7",
+				"Upload-Checksum": "crc32 c2FtcGxl",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), gomock.Any()).Return(filesSvc.UploadInfo{}, fmt.Errorf("%w: crc32", filesSvc.ErrorUnsupportedChecksum))
+			},
+			want: wantResponse{
+				body: `{"message":"unsupported checksum algorithm, supported algorithms: md5, sha1, sha256, sha512","dev_message":"unsupported checksum algorithm: crc32"}`,
+				code: http.StatusBadRequest,
+			},
+			wantErr: true,
+		},
+		{
+			name: "chunk going past the length of the upload",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{}, filesSvc.ErrorUploadLengthExceeded)
+			},
+			want: wantResponse{
+				body: `{"message":"the chunk goes past the Upload-Length of the upload","dev_message":"upload length exceeded"}`,
+				code: http.StatusRequestEntityTooLarge,
+			},
+			wantErr: true,
+		},
+		{
+			name: "upload written concurrently",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{}, filesSvc.ErrorUploadLocked)
+			},
+			want: wantResponse{
+				body: `{"message":"the upload is being written by another request, try again later","dev_message":"upload is being written"}`,
+				code: http.StatusLocked,
+			},
+			wantErr: true,
+		},
+		{
+			name: "upload not found",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{}, sql.ErrNoRows)
+			},
+			want: wantResponse{
+				body: `{"message":"requested upload is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired upload",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{}, filesSvc.ErrorUploadExpired)
+			},
+			want: wantResponse{
+				body: `{"message":"the upload expired, start a new one","dev_message":"upload expired"}`,
+				code: http.StatusGone,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to write a chunk",
+			headers: map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "7",
+			},
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().WriteUpload(gomock.Any(), fileid.ID("upload-id"), "localhost", int64(7), gomock.Any(), filesSvc.Checksum{}).Return(filesSvc.UploadInfo{}, fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to write upload with id: upload-id","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodPatch, "http://localhost/v1/uploads/upload-id", strings.NewReader("string"))
+			r.Header.Set("Tus-Resumable", "1.0.0")
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/uploads/:uploadID")
+			ctx.SetParamNames("uploadID")
+			ctx.SetParamValues("upload-id")
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.PatchUpload(ctx)
+			checkResponse(t, "PatchUpload", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_filesHTTPHandler_DeleteUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(mockService *filesSvcMock.MockService)
+		want     wantResponse
+		wantErr  bool
+	}{
+		{
+			name: "successfully delete an upload",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteUpload(gomock.Any(), fileid.ID("upload-id")).Return(nil)
+			},
+			want: wantResponse{
+				code: http.StatusNoContent,
+				headers: map[string]string{
+					"Tus-Resumable": "1.0.0",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "upload not found",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteUpload(gomock.Any(), fileid.ID("upload-id")).Return(sql.ErrNoRows)
+			},
+			want: wantResponse{
+				body: `{"message":"deleted upload is not exists","dev_message":"sql: no rows in result set"}`,
+				code: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "upload being written",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteUpload(gomock.Any(), fileid.ID("upload-id")).Return(filesSvc.ErrorUploadLocked)
+			},
+			want: wantResponse{
+				body: `{"message":"the upload is being written by another request, try again later","dev_message":"upload is being written"}`,
+				code: http.StatusLocked,
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to delete an upload",
+			mockFunc: func(mockService *filesSvcMock.MockService) {
+				mockService.EXPECT().DeleteUpload(gomock.Any(), fileid.ID("upload-id")).Return(fmt.Errorf("some-err"))
+			},
+			want: wantResponse{
+				body: `{"message":"failed to delete upload with id: upload-id","dev_message":"some-err"}`,
+				code: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(mockFilesSvc)
+
+			r := httptest.NewRequest(http.MethodDelete, "http://localhost/v1/uploads/upload-id", nil)
+			r.Header.Set("Tus-Resumable", "1.0.0")
+			w := httptest.NewRecorder()
+			ctx := echo.New().NewContext(r, w)
+			ctx.SetPath("v1/uploads/:uploadID")
+			ctx.SetParamNames("uploadID")
+			ctx.SetParamValues("upload-id")
+
+			h := filesHTTPHandler{
+				service: mockFilesSvc,
+			}
+			err := h.DeleteUpload(ctx)
+			checkResponse(t, "DeleteUpload", err, w, tt.wantErr, tt.want)
+		})
+	}
+}
+
+func Test_parseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "successfully parse the metadata",
+			raw:     "filename dGVzdC5tcDQ=, filetype dmlkZW8vbXA0,is_confidential",
+			want:    map[string]string{"filename": "test.mp4", "filetype": "video/mp4", "is_confidential": ""},
+			wantErr: false,
+		},
+		{
+			name:    "empty metadata",
+			raw:     "",
+			want:    map[string]string{},
+			wantErr: false,
+		},
+		{
+			name:    "duplicate key",
+			raw:     "filename dGVzdC5tcDQ=,filename dGVzdC5tcDQ=",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			raw:     "filename dGVzdC5tcDQ=,",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseUploadMetadata() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUploadMetadata() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/helper/disk"
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// ErrorInsufficientStorage is returned when an upload is refused because the storage is running out of space
+var ErrorInsufficientStorage = errors.New("insufficient free space on storage")
+
+// StorageReport represents the state of the local disks keeping the files
+type StorageReport struct {
+	Disks []DiskReport `json:"disks"`
+	// AcceptingUploads is unset when a disk has less free space than the upload watermark
+	AcceptingUploads bool `json:"accepting_uploads"`
+}
+
+// DiskReport represents the free space of a local disk keeping the files
+type DiskReport struct {
+	Path        string `json:"path"`
+	FreeBytes   uint64 `json:"free_bytes"`
+	TotalBytes  uint64 `json:"total_bytes"`
+	FreeInodes  uint64 `json:"free_inodes"`
+	TotalInodes uint64 `json:"total_inodes"`
+}
+
+// CheckStorage verifies the local disks keeping the files are writable and reports their free space.
+// The report is empty when the blob storage keeps no file on a local disk.
+func (s service) CheckStorage(ctx context.Context) (StorageReport, error) {
+	report := StorageReport{
+		Disks:            make([]DiskReport, 0),
+		AcceptingUploads: true,
+	}
+	diskUser, ok := s.blobStore.(filesBlobStore.DiskUser)
+	if !ok {
+		return report, nil
+	}
+
+	usages, err := diskUser.DiskUsages(ctx, true)
+	if err != nil {
+		return report, fmt.Errorf("failed to check storage disks, err: %w", err)
+	}
+	for _, usage := range usages {
+		report.Disks = append(report.Disks, DiskReport{
+			Path:        usage.Path,
+			FreeBytes:   usage.FreeBytes,
+			TotalBytes:  usage.TotalBytes,
+			FreeInodes:  usage.FreeInodes,
+			TotalInodes: usage.TotalInodes,
+		})
+	}
+	report.AcceptingUploads = s.hasFreeSpace(usages)
+	return report, nil
+}
+
+// checkFreeSpace returns ErrorInsufficientStorage when a local disk keeping the files is below the upload watermark.
+// Failing to read the disk usage does not refuse the upload, a full disk still fails the write itself.
+func (s service) checkFreeSpace(ctx context.Context) error {
+	if s.minFreeBytes == 0 {
+		return nil
+	}
+	diskUser, ok := s.blobStore.(filesBlobStore.DiskUser)
+	if !ok {
+		return nil
+	}
+
+	usages, err := diskUser.DiskUsages(ctx, false)
+	if err != nil {
+		if !errors.Is(err, disk.ErrorUnsupported) {
+			log.Printf("failed to check free space of storage, err: %v", err)
+		}
+		return nil
+	}
+	if !s.hasFreeSpace(usages) {
+		return ErrorInsufficientStorage
+	}
+	return nil
+}
+
+// hasFreeSpace reports whether every disk has at least the free bytes of the watermark and some free inodes left.
+// Filesystems without a fixed number of inodes report no inodes at all, so only the exhaustion of a fixed number is checked.
+func (s service) hasFreeSpace(usages []filesBlobStore.DiskUsage) bool {
+	for _, usage := range usages {
+		if usage.FreeBytes < s.minFreeBytes {
+			return false
+		}
+		if usage.TotalInodes > 0 && usage.FreeInodes == 0 {
+			return false
+		}
+	}
+	return true
+}
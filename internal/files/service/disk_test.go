@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+// diskBlobStore is an in-memory blob store reporting fixed disk usages
+type diskBlobStore struct {
+	blobstore.BlobStore
+	usages []blobstore.DiskUsage
+	err    error
+}
+
+func (ds diskBlobStore) DiskUsages(_ context.Context, _ bool) ([]blobstore.DiskUsage, error) {
+	return ds.usages, ds.err
+}
+
+func Test_service_CheckStorage(t *testing.T) {
+	healthyDisk := blobstore.DiskUsage{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 10, TotalInodes: 100}
+	tests := []struct {
+		name      string
+		blobStore blobstore.BlobStore
+		want      StorageReport
+		wantErr   bool
+	}{
+		{
+			name: "successfully report the disks",
+			blobStore: diskBlobStore{
+				BlobStore: memstore.NewMemoryStore(),
+				usages:    []blobstore.DiskUsage{healthyDisk},
+			},
+			want: StorageReport{
+				Disks:            []DiskReport{{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 10, TotalInodes: 100}},
+				AcceptingUploads: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "disk below the upload watermark",
+			blobStore: diskBlobStore{
+				BlobStore: memstore.NewMemoryStore(),
+				usages:    []blobstore.DiskUsage{healthyDisk, {Path: "storage/cold", FreeBytes: 512, TotalBytes: 4096}},
+			},
+			want: StorageReport{
+				Disks: []DiskReport{
+					{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 10, TotalInodes: 100},
+					{Path: "storage/cold", FreeBytes: 512, TotalBytes: 4096},
+				},
+				AcceptingUploads: false,
+			},
+			wantErr: false,
+		},
+		{
+			name: "disk without free inodes",
+			blobStore: diskBlobStore{
+				BlobStore: memstore.NewMemoryStore(),
+				usages:    []blobstore.DiskUsage{{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 0, TotalInodes: 100}},
+			},
+			want: StorageReport{
+				Disks:            []DiskReport{{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 0, TotalInodes: 100}},
+				AcceptingUploads: false,
+			},
+			wantErr: false,
+		},
+		{
+			name:      "blob storage without local disks",
+			blobStore: memstore.NewMemoryStore(),
+			want: StorageReport{
+				Disks:            []DiskReport{},
+				AcceptingUploads: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "disk is not writable",
+			blobStore: diskBlobStore{
+				BlobStore: memstore.NewMemoryStore(),
+				err:       errors.New("some-error"),
+			},
+			want: StorageReport{
+				Disks:            []DiskReport{},
+				AcceptingUploads: true,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := service{
+				blobStore:    tt.blobStore,
+				minFreeBytes: 1024,
+			}
+			got, err := s.CheckStorage(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckStorage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckStorage() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_UploadFile_freeSpace(t *testing.T) {
+	tests := []struct {
+		name         string
+		minFreeBytes uint64
+		usages       []blobstore.DiskUsage
+		err          error
+		wantErr      error
+	}{
+		{
+			name:         "disk below the watermark refuses the upload",
+			minFreeBytes: 1024,
+			usages:       []blobstore.DiskUsage{{Path: "storage/videos", FreeBytes: 512}},
+			wantErr:      ErrorInsufficientStorage,
+		},
+		{
+			name:         "failing to read the disk usage does not refuse the upload",
+			minFreeBytes: 1024,
+			err:          errors.New("some-error"),
+			wantErr:      nil,
+		},
+		{
+			name:         "disabled watermark",
+			minFreeBytes: 0,
+			usages:       []blobstore.DiskUsage{{Path: "storage/videos", FreeBytes: 512}},
+			wantErr:      nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			if tt.wantErr == nil {
+				newFakeFilesTable(mockDBStore)
+			}
+
+			s := New(mockDBStore, diskBlobStore{
+				BlobStore: memstore.NewMemoryStore(),
+				usages:    tt.usages,
+				err:       tt.err,
+			}, WithMinFreeBytes(tt.minFreeBytes))
+			_, err := s.UploadFile(context.Background(), strings.NewReader("sample string"), "localhost", "test.mp4", "", time.Time{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// Errors represent custom error that will be verified by the caller
+var (
+	ErrorEncryptionUnsupported = fmt.Errorf("blob storage is not encrypted")
+)
+
+// KeyRotationReport represents the result of rewrapping the data keys with the active master key
+type KeyRotationReport struct {
+	RotatedKeys int `json:"rotated_keys"`
+}
+
+// RotateEncryptionKey rewraps the data keys of every blob with the active master key without re-encrypting the blobs,
+// the blobs named with the previous master key are moved to the name given by the active one.
+// Running it again after an interrupted run continues with the keys not rotated yet.
+func (s service) RotateEncryptionKey(ctx context.Context) (KeyRotationReport, error) {
+	rotator, ok := s.blobStore.(filesBlobStore.KeyRotator)
+	if !ok {
+		return KeyRotationReport{}, ErrorEncryptionUnsupported
+	}
+	rotated, err := rotator.RotateKeys(ctx)
+	if err != nil {
+		return KeyRotationReport{RotatedKeys: rotated}, fmt.Errorf("failed to rotate keys, err: %v", err)
+	}
+	return KeyRotationReport{RotatedKeys: rotated}, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/cryptostore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+)
+
+func Test_service_RotateEncryptionKey(t *testing.T) {
+	ctx := context.Background()
+	oldSeed, newSeed := sha256.Sum256([]byte("old")), sha256.Sum256([]byte("new"))
+	oldKey, _ := cryptostore.NewMasterKey(oldSeed[:])
+	newKey, _ := cryptostore.NewMasterKey(newSeed[:])
+
+	inner := memstore.NewMemoryStore()
+	oldStore, _ := cryptostore.NewCryptoStore(inner, oldKey)
+	_, _ = oldStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	rotatingStore, _ := cryptostore.NewCryptoStore(inner, newKey, oldKey)
+
+	tests := []struct {
+		name      string
+		blobStore blobstore.BlobStore
+		want      KeyRotationReport
+		wantErr   bool
+	}{
+		{
+			name:      "successfully rotate the encryption key",
+			blobStore: rotatingStore,
+			want:      KeyRotationReport{RotatedKeys: 1},
+			wantErr:   false,
+		},
+		{
+			name:      "blob storage is not encrypted",
+			blobStore: memstore.NewMemoryStore(),
+			want:      KeyRotationReport{},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := service{
+				blobStore: tt.blobStore,
+			}
+			got, err := s.RotateEncryptionKey(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RotateEncryptionKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RotateEncryptionKey() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
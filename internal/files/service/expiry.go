@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// ErrorInvalidExpiry is returned when the expiry of a file is not in the future
+var ErrorInvalidExpiry = errors.New("expiry must be in the future")
+
+// ReapReport represents the result of deleting the expired files
+type ReapReport struct {
+	// DeletedFiles lists the files which expired versions were deleted permanently
+	DeletedFiles []string `json:"deleted_files"`
+	FailedFiles  []string `json:"failed_files"`
+}
+
+// SetFileExpiry sets the time after which the file is deleted together with all its versions
+func (s service) SetFileExpiry(ctx context.Context, id fileid.ID, expiresAt time.Time) error {
+	if err := validateExpiry(expiresAt); err != nil {
+		return err
+	}
+	if err := s.dbStore.SetFileExpiry(ctx, id.String(), expiresAt); err != nil {
+		return fmt.Errorf("failed to set expiry of file, err: %w", err)
+	}
+	return nil
+}
+
+// ReapExpiredFiles permanently deletes the active versions of the files which latest version expired,
+// and the trashed versions which expired, so expired content cannot be restored from the trash.
+// The trashed versions which did not expire are kept until they are restored or purged.
+// A file deleted or given a new version without expiry meanwhile is left alone
+func (s service) ReapExpiredFiles(ctx context.Context) (ReapReport, error) {
+	report := ReapReport{
+		DeletedFiles: make([]string, 0),
+		FailedFiles:  make([]string, 0),
+	}
+
+	now := time.Now()
+	files, err := s.dbStore.GetExpiredFiles(ctx, now)
+	if err != nil {
+		return report, fmt.Errorf("failed to get expired files from DB, err: %v", err)
+	}
+	for _, file := range files {
+		err := s.deleteExpiredVersions(ctx, file.FileID, now)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			report.FailedFiles = append(report.FailedFiles, file.FileID)
+			continue
+		}
+		report.DeletedFiles = append(report.DeletedFiles, file.FileID)
+	}
+
+	trashedFiles, err := s.dbStore.GetExpiredTrashedFiles(ctx, now)
+	if err != nil {
+		return report, fmt.Errorf("failed to get expired trashed files from DB, err: %v", err)
+	}
+	for _, file := range trashedFiles {
+		err := s.deleteFile(ctx, file.ID, filesDBStore.FileStatusTrashed)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			if !slices.Contains(report.FailedFiles, file.FileID) {
+				report.FailedFiles = append(report.FailedFiles, file.FileID)
+			}
+			continue
+		}
+		if !slices.Contains(report.DeletedFiles, file.FileID) {
+			report.DeletedFiles = append(report.DeletedFiles, file.FileID)
+		}
+	}
+	return report, nil
+}
+
+// deleteExpiredVersions permanently deletes the active versions of the file when its latest version expired before,
+// sql.ErrNoRows is returned when the file has no active version or its latest version no longer expires before
+func (s service) deleteExpiredVersions(ctx context.Context, fileID string, before time.Time) error {
+	versions, err := s.dbStore.GetFileVersions(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to get versions of file from DB, err: %w", err)
+	}
+	if len(versions) == 0 {
+		return sql.ErrNoRows
+	}
+	latest := versions[len(versions)-1]
+	if latest.ExpiresAt.IsZero() || !latest.ExpiresAt.Before(before) {
+		return sql.ErrNoRows
+	}
+	for _, version := range versions {
+		if err := s.deleteFile(ctx, version.ID, filesDBStore.FileStatusActive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateExpiry returns ErrorInvalidExpiry when expiresAt is set but not in the future
+func validateExpiry(expiresAt time.Time) error {
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: %s", ErrorInvalidExpiry, expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	blobStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mocks"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_UploadFile_expiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		mockFunc  func(mockDBStore *dbStoreMocks.MockDBStore)
+		want      string
+		wantErr   error
+	}{
+		{
+			name:      "successfully upload a file expiring in the future",
+			expiresAt: expiresAt,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:        generatedID,
+					FileID:    generatedID,
+					Version:   1,
+					Name:      "test.mp4",
+					Size:      13,
+					Path:      sampleDigest,
+					Digest:    sampleDigest,
+					Status:    dbstore.FileStatusPending,
+					ExpiresAt: expiresAt,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			want:    "localhost/v1/files/" + generatedID,
+			wantErr: nil,
+		},
+		{
+			name:      "expiry in the past",
+			expiresAt: time.Now().Add(-time.Hour),
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:    "",
+			wantErr: ErrorInvalidExpiry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: memstore.NewMemoryStore(),
+				uploads:   newReservations(),
+				newID:     fixedID,
+			}
+			got, err := s.UploadFile(context.Background(), strings.NewReader("sample string"), "localhost", "test.mp4", "", tt.expiresAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("UploadFile() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_SetFileExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		mockFunc  func(mockDBStore *dbStoreMocks.MockDBStore)
+		wantErr   error
+	}{
+		{
+			name:      "successfully extend the expiry of a file",
+			expiresAt: expiresAt,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().SetFileExpiry(context.Background(), "file-id", expiresAt).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name:      "file not found",
+			expiresAt: expiresAt,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().SetFileExpiry(context.Background(), "file-id", expiresAt).Return(sql.ErrNoRows)
+			},
+			wantErr: sql.ErrNoRows,
+		},
+		{
+			name:      "expiry in the past",
+			expiresAt: time.Now().Add(-time.Hour),
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			wantErr: ErrorInvalidExpiry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore: mockDBStore,
+			}
+			err := s.SetFileExpiry(context.Background(), "file-id", tt.expiresAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetFileExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_service_ReapExpiredFiles(t *testing.T) {
+	expiredAt := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore)
+		want     ReapReport
+		wantErr  bool
+	}{
+		{
+			name: "successfully delete the expired files permanently",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetExpiredFiles(context.Background(), gomock.Any()).Return([]dbstore.FileDetail{
+					{ID: "expired-version-id", FileID: "expired-id", Version: 2, ExpiresAt: expiredAt},
+					{ID: "extended-id", FileID: "extended-id", Version: 1, ExpiresAt: expiredAt},
+					{ID: "deleted-id", FileID: "deleted-id", Version: 1, ExpiresAt: expiredAt},
+					{ID: "failing-id", FileID: "failing-id", Version: 1, ExpiresAt: expiredAt},
+				}, nil)
+				// every active version is deleted with the latest one, the versions in the trash are left to their own expiry
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "expired-id").Return([]dbstore.FileDetail{
+					{ID: "expired-id", FileID: "expired-id", Version: 1, Digest: sampleDigest},
+					{ID: "expired-version-id", FileID: "expired-id", Version: 2, Digest: "other-digest", ExpiresAt: expiredAt},
+				}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "expired-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "expired-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{ID: "expired-id", Digest: sampleDigest}, 1))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "expired-version-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "expired-version-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{ID: "expired-version-id", Digest: "other-digest"}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), "other-digest").Return(nil)
+				// a version without expiry was uploaded after the expired files were listed
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "extended-id").Return([]dbstore.FileDetail{
+					{ID: "extended-id", FileID: "extended-id", Version: 1, ExpiresAt: expiredAt},
+					{ID: "extended-version-id", FileID: "extended-id", Version: 2},
+				}, nil)
+				// the file got deleted after the expired files were listed
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "deleted-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "failing-id").Return(nil, fmt.Errorf("some-error"))
+				// the trashed versions which expired cannot be restored anymore
+				mockDBStore.EXPECT().GetExpiredTrashedFiles(context.Background(), gomock.Any()).Return([]dbstore.FileDetail{
+					{ID: "trashed-id", FileID: "trashed-id", Version: 1, Digest: sampleDigest, ExpiresAt: expiredAt},
+					{ID: "restored-id", FileID: "restored-id", Version: 1, ExpiresAt: expiredAt},
+				}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "trashed-id", dbstore.FileStatusTrashed, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "trashed-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{ID: "trashed-id", Digest: sampleDigest}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(nil)
+				// the file got restored after the expired trashed files were listed
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "restored-id", dbstore.FileStatusTrashed, dbstore.FileStatusDeleting).Return(sql.ErrNoRows)
+			},
+			want: ReapReport{
+				DeletedFiles: []string{"expired-id", "trashed-id"},
+				FailedFiles:  []string{"failing-id"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to get the expired files from DB",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetExpiredFiles(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some-error"))
+			},
+			want: ReapReport{
+				DeletedFiles: []string{},
+				FailedFiles:  []string{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to get the expired trashed files from DB",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetExpiredFiles(context.Background(), gomock.Any()).Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().GetExpiredTrashedFiles(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some-error"))
+			},
+			want: ReapReport{
+				DeletedFiles: []string{},
+				FailedFiles:  []string{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
+
+			tt.mockFunc(mockDBStore, mockBlobStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: mockBlobStore,
+			}
+			got, err := s.ReapExpiredFiles(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReapExpiredFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReapExpiredFiles() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mapFileDetailsToFileInfo_expiry(t *testing.T) {
+	expiresAt := time.Date(2026, 11, 18, 0, 0, 0, 0, time.UTC)
+	got := mapFileDetailsToFileInfo(dbstore.FileDetail{FileID: "file-id", Version: 1, ExpiresAt: expiresAt})
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("mapFileDetailsToFileInfo() ExpiresAt got = %v, want %v", got.ExpiresAt, expiresAt)
+	}
+	if got := mapFileDetailsToFileInfo(dbstore.FileDetail{FileID: "file-id", Version: 1}); got.ExpiresAt != nil {
+		t.Errorf("mapFileDetailsToFileInfo() ExpiresAt got = %v, want nil", got.ExpiresAt)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// QuarantinePrefix is prepended to the key of an orphan blob when it is quarantined
+const QuarantinePrefix = "quarantine-"
+
+// orphanGracePeriod is the age below which an unreferenced blob is not reported as orphan,
+// since an upload commits its blob shortly before its file record becomes visible
+const orphanGracePeriod = time.Hour
+
+// SizeMismatch represents a file which blob size differs from the size recorded on the DB
+type SizeMismatch struct {
+	FileID     string `json:"fileid"`
+	Size       int64  `json:"size"`
+	StoredSize int64  `json:"stored_size"`
+}
+
+// FsckReport represents the inconsistencies found between the DB and the blob storage and the repairs done
+type FsckReport struct {
+	CheckedFiles     int            `json:"checked_files"`
+	CheckedBlobs     int            `json:"checked_blobs"`
+	OrphanBlobs      []string       `json:"orphan_blobs"`
+	MissingFiles     []string       `json:"missing_files"`
+	SizeMismatches   []SizeMismatch `json:"size_mismatches"`
+	Repaired         bool           `json:"repaired"`
+	QuarantinedBlobs int            `json:"quarantined_blobs"`
+	BrokenFiles      int            `json:"broken_files"`
+	RestoredFiles    int            `json:"restored_files"`
+	FailedRepairs    []string       `json:"failed_repairs"`
+}
+
+// Clean returns true when no inconsistency was found
+func (r FsckReport) Clean() bool {
+	return len(r.OrphanBlobs) == 0 && len(r.MissingFiles) == 0 && len(r.SizeMismatches) == 0
+}
+
+// Fsck reconciles the files listed on the DB with the blobs kept on the blob storage.
+// It reports the blobs not referenced by any file, the files which blob is missing and the files which blob size differs.
+// With repair, the orphan blobs are quarantined under QuarantinePrefix and the files with a missing or damaged blob are marked broken,
+// files marked broken before which blob is healthy again are unmarked.
+func (s service) Fsck(ctx context.Context, repair bool) (FsckReport, error) {
+	report := FsckReport{
+		OrphanBlobs:    make([]string, 0),
+		MissingFiles:   make([]string, 0),
+		SizeMismatches: make([]SizeMismatch, 0),
+		Repaired:       repair,
+		FailedRepairs:  make([]string, 0),
+	}
+
+	// the blobs are listed before the files, so a blob committed meanwhile is found referenced
+	blobs, err := s.blobStore.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list blobs, err: %v", err)
+	}
+	files, err := s.dbStore.GetAllFiles(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get all files from DB, err: %v", err)
+	}
+	// only the active files are checked, but the blobs of the files in any other status are kept
+	referenced, err := s.referencedBlobs(ctx, files)
+	if err != nil {
+		return report, err
+	}
+
+	for _, file := range files {
+		report.CheckedFiles++
+		key := blobKey(file)
+
+		broken := false
+		info, err := s.blobStore.Stat(ctx, key)
+		switch {
+		case errors.Is(err, filesBlobStore.ErrorNotFound):
+			report.MissingFiles = append(report.MissingFiles, file.ID)
+			broken = true
+		case err != nil:
+			return report, fmt.Errorf("failed to check blob of file: %s, err: %v", file.ID, err)
+		case info.Size != file.Size:
+			report.SizeMismatches = append(report.SizeMismatches, SizeMismatch{
+				FileID:     file.ID,
+				Size:       file.Size,
+				StoredSize: info.Size,
+			})
+			broken = true
+		}
+
+		if !repair || broken == file.Broken {
+			continue
+		}
+		if err := s.dbStore.SetFileBroken(ctx, file.ID, broken); err != nil {
+			report.FailedRepairs = append(report.FailedRepairs, file.ID)
+			continue
+		}
+		if broken {
+			report.BrokenFiles++
+		} else {
+			report.RestoredFiles++
+		}
+	}
+
+	for _, blob := range blobs {
+		if strings.HasPrefix(blob.Key, QuarantinePrefix) {
+			continue
+		}
+		report.CheckedBlobs++
+		if referenced[blob.Key] || time.Since(blob.ModTime) < orphanGracePeriod {
+			continue
+		}
+		report.OrphanBlobs = append(report.OrphanBlobs, blob.Key)
+
+		if !repair {
+			continue
+		}
+		if err := s.quarantineBlob(ctx, blob.Key); err != nil {
+			report.FailedRepairs = append(report.FailedRepairs, blob.Key)
+			continue
+		}
+		report.QuarantinedBlobs++
+	}
+	return report, nil
+}
+
+// quarantineBlob moves the blob under QuarantinePrefix, so it is kept for inspection but no longer found by its key
+func (s service) quarantineBlob(ctx context.Context, key string) error {
+	content, err := s.blobStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = s.blobStore.Put(ctx, QuarantinePrefix+key, content)
+	_ = content.Close()
+	if err != nil {
+		return err
+	}
+	return s.blobStore.Delete(ctx, key)
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+// newTestFsckStore returns a local store holding a healthy, a truncated, an orphan and a freshly uploaded orphan blob
+func newTestFsckStore(t *testing.T) blobstore.BlobStore {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	store, err := localstore.NewLocalStore(rootPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = store.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	_, _ = store.Put(ctx, "truncated.mp4", strings.NewReader("trunc"))
+	_, _ = store.Put(ctx, "orphan.mp4", strings.NewReader("orphan"))
+	_, _ = store.Put(ctx, "uploading.mp4", strings.NewReader("uploading"))
+
+	old := time.Now().Add(-2 * orphanGracePeriod)
+	for _, key := range []string{sampleDigest, "truncated.mp4", "orphan.mp4"} {
+		if err := os.Chtimes(filepath.Join(rootPath, key), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func Test_service_Fsck(t *testing.T) {
+	ctx := context.Background()
+	expectOtherStatuses := func(mockDBStore *dbStoreMocks.MockDBStore, trashed ...dbstore.FileDetail) {
+		mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return([]dbstore.FileDetail{}, nil)
+		mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusDeleting).Return([]dbstore.FileDetail{}, nil)
+		mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusTrashed).Return(trashed, nil)
+	}
+	files := []dbstore.FileDetail{
+		{ID: "sample.mp4", Size: 13, Digest: sampleDigest},
+		{ID: "copy.mp4", Size: 13, Digest: sampleDigest, Broken: true},
+		{ID: "truncated.mp4", Size: 13},
+		{ID: "missing.mp4", Size: 13},
+	}
+
+	tests := []struct {
+		name        string
+		repair      bool
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		want        FsckReport
+		wantErr     bool
+		wantBlobs   []string
+		wantMissing []string
+	}{
+		{
+			name:   "successfully report the inconsistencies",
+			repair: false,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(files, nil)
+				expectOtherStatuses(mockDBStore)
+			},
+			want: FsckReport{
+				CheckedFiles: 4,
+				CheckedBlobs: 4,
+				OrphanBlobs:  []string{"orphan.mp4"},
+				MissingFiles: []string{"missing.mp4"},
+				SizeMismatches: []SizeMismatch{
+					{FileID: "truncated.mp4", Size: 13, StoredSize: 5},
+				},
+				Repaired:      false,
+				FailedRepairs: []string{},
+			},
+			wantErr:   false,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "orphan.mp4", "uploading.mp4"},
+		},
+		{
+			name:   "successfully repair the inconsistencies",
+			repair: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(files, nil)
+				expectOtherStatuses(mockDBStore)
+				mockDBStore.EXPECT().SetFileBroken(ctx, "copy.mp4", false).Return(nil)
+				mockDBStore.EXPECT().SetFileBroken(ctx, "truncated.mp4", true).Return(nil)
+				mockDBStore.EXPECT().SetFileBroken(ctx, "missing.mp4", true).Return(errors.New("some-error"))
+			},
+			want: FsckReport{
+				CheckedFiles: 4,
+				CheckedBlobs: 4,
+				OrphanBlobs:  []string{"orphan.mp4"},
+				MissingFiles: []string{"missing.mp4"},
+				SizeMismatches: []SizeMismatch{
+					{FileID: "truncated.mp4", Size: 13, StoredSize: 5},
+				},
+				Repaired:         true,
+				QuarantinedBlobs: 1,
+				BrokenFiles:      1,
+				RestoredFiles:    1,
+				FailedRepairs:    []string{"missing.mp4"},
+			},
+			wantErr:     false,
+			wantBlobs:   []string{sampleDigest, "truncated.mp4", QuarantinePrefix + "orphan.mp4", "uploading.mp4"},
+			wantMissing: []string{"orphan.mp4"},
+		},
+		{
+			name:   "blobs of the trashed files are not orphan",
+			repair: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(files[:1], nil)
+				expectOtherStatuses(mockDBStore,
+					dbstore.FileDetail{ID: "truncated.mp4", Size: 13},
+					dbstore.FileDetail{ID: "orphan.mp4", Size: 6},
+				)
+			},
+			want: FsckReport{
+				CheckedFiles:   1,
+				CheckedBlobs:   4,
+				OrphanBlobs:    []string{},
+				MissingFiles:   []string{},
+				SizeMismatches: []SizeMismatch{},
+				Repaired:       true,
+				FailedRepairs:  []string{},
+			},
+			wantErr:   false,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "orphan.mp4", "uploading.mp4"},
+		},
+		{
+			name:   "blobs of the files being uploaded or deleted are not orphan",
+			repair: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(files[:1], nil)
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return([]dbstore.FileDetail{{ID: "truncated.mp4", Size: 13}}, nil)
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusDeleting).Return([]dbstore.FileDetail{{ID: "orphan.mp4", Size: 6}}, nil)
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusTrashed).Return([]dbstore.FileDetail{}, nil)
+			},
+			want: FsckReport{
+				CheckedFiles:   1,
+				CheckedBlobs:   4,
+				OrphanBlobs:    []string{},
+				MissingFiles:   []string{},
+				SizeMismatches: []SizeMismatch{},
+				Repaired:       true,
+				FailedRepairs:  []string{},
+			},
+			wantErr:   false,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "orphan.mp4", "uploading.mp4"},
+		},
+		{
+			name:   "failed to get the files in another status from DB",
+			repair: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(files, nil)
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return(nil, errors.New("some-error"))
+			},
+			want: FsckReport{
+				OrphanBlobs:    []string{},
+				MissingFiles:   []string{},
+				SizeMismatches: []SizeMismatch{},
+				Repaired:       true,
+				FailedRepairs:  []string{},
+			},
+			wantErr:   true,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "orphan.mp4", "uploading.mp4"},
+		},
+		{
+			name:   "failed to get the files from DB",
+			repair: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(nil, errors.New("some-error"))
+			},
+			want: FsckReport{
+				OrphanBlobs:    []string{},
+				MissingFiles:   []string{},
+				SizeMismatches: []SizeMismatch{},
+				Repaired:       true,
+				FailedRepairs:  []string{},
+			},
+			wantErr:   true,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "orphan.mp4", "uploading.mp4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore := newTestFsckStore(t)
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: blobStore,
+			}
+			got, err := s.Fsck(ctx, tt.repair)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Fsck() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fsck() got = %+v, want %+v", got, tt.want)
+			}
+			for _, key := range tt.wantBlobs {
+				if _, err := blobStore.Stat(ctx, key); err != nil {
+					t.Errorf("Fsck() blob %s err = %v", key, err)
+				}
+			}
+			for _, key := range tt.wantMissing {
+				if _, err := blobStore.Stat(ctx, key); !errors.Is(err, blobstore.ErrorNotFound) {
+					t.Errorf("Fsck() blob %s err = %v, want %v", key, err, blobstore.ErrorNotFound)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_Fsck_quarantinedBlobsAreSkipped(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{}, nil).Times(2)
+	mockDBStore.EXPECT().GetFilesByStatus(ctx, gomock.Any()).Return([]dbstore.FileDetail{}, nil).Times(6)
+	mockDBStore.EXPECT().SetFileBroken(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	s := service{
+		dbStore:   mockDBStore,
+		blobStore: newTestFsckStore(t),
+	}
+	first, err := s.Fsck(ctx, true)
+	if err != nil || first.QuarantinedBlobs != 3 {
+		t.Fatalf("Fsck() got = %+v, err = %v", first, err)
+	}
+	second, err := s.Fsck(ctx, true)
+	if err != nil || !second.Clean() || second.CheckedBlobs != 1 {
+		t.Errorf("Fsck() second run got = %+v, err = %v", second, err)
+	}
+}
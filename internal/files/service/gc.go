@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// DefaultGCGracePeriod is the age below which temporary content and unreferenced blobs are left to the in-progress uploads
+const DefaultGCGracePeriod = 24 * time.Hour
+
+// gcMetrics exposes the totals of the garbage collections run since the process started, dry runs only count as runs
+var gcMetrics = expvar.NewMap("gc")
+
+// GCReport represents the garbage removed by a garbage collection, or found removable on a dry run
+type GCReport struct {
+	DryRun             bool     `json:"dry_run"`
+	RemovedTempFiles   []string `json:"removed_temp_files"`
+	RemovedOrphanBlobs []string `json:"removed_orphan_blobs"`
+	ReclaimedBytes     int64    `json:"reclaimed_bytes"`
+	FailedBlobs        []string `json:"failed_blobs"`
+}
+
+// CollectGarbage removes the temporary content of interrupted uploads and the blobs no longer referenced by any file,
+// both only once they are older than gracePeriod so that in-progress uploads are left alone.
+// An orphan blob is only removed while its blob record is locked on the DB, so an upload referencing it meanwhile keeps it.
+// Quarantined blobs are kept for inspection. With dryRun nothing is removed, the garbage is only reported.
+func (s service) CollectGarbage(ctx context.Context, gracePeriod time.Duration, dryRun bool) (GCReport, error) {
+	report := GCReport{
+		DryRun:             dryRun,
+		RemovedTempFiles:   make([]string, 0),
+		RemovedOrphanBlobs: make([]string, 0),
+		FailedBlobs:        make([]string, 0),
+	}
+	gcMetrics.Add("runs", 1)
+	defer func() {
+		if dryRun {
+			return
+		}
+		gcMetrics.Add("removed_temp_files", int64(len(report.RemovedTempFiles)))
+		gcMetrics.Add("removed_orphan_blobs", int64(len(report.RemovedOrphanBlobs)))
+		gcMetrics.Add("reclaimed_bytes", report.ReclaimedBytes)
+	}()
+
+	before := time.Now().Add(-gracePeriod)
+	if cleaner, ok := s.blobStore.(filesBlobStore.TempCleaner); ok {
+		removed, err := cleaner.CleanTemp(ctx, before, dryRun)
+		for _, tempFile := range removed {
+			report.RemovedTempFiles = append(report.RemovedTempFiles, tempFile.Path)
+			report.ReclaimedBytes += tempFile.Size
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to clean temporary files, err: %v", err)
+		}
+	}
+
+	// the blobs are listed before the files, so a blob committed meanwhile is found referenced
+	blobs, err := s.blobStore.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list blobs, err: %v", err)
+	}
+	files, err := s.dbStore.GetAllFiles(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get all files from DB, err: %v", err)
+	}
+	referenced, err := s.referencedBlobs(ctx, files)
+	if err != nil {
+		return report, err
+	}
+
+	for _, blob := range blobs {
+		if strings.HasPrefix(blob.Key, QuarantinePrefix) || referenced[blob.Key] || !blob.ModTime.Before(before) {
+			continue
+		}
+		if !dryRun {
+			deleted, err := s.dbStore.DeleteUnreferencedBlob(ctx, blob.Key, func(ctx context.Context, _ filesDBStore.FileDetail, _ int64) error {
+				err := s.blobStore.Delete(ctx, blob.Key)
+				if errors.Is(err, filesBlobStore.ErrorNotFound) {
+					return nil
+				}
+				return err
+			})
+			if err != nil {
+				report.FailedBlobs = append(report.FailedBlobs, blob.Key)
+				continue
+			}
+			if !deleted {
+				continue
+			}
+		}
+		report.RemovedOrphanBlobs = append(report.RemovedOrphanBlobs, blob.Key)
+		report.ReclaimedBytes += blob.Size
+	}
+	return report, nil
+}
+
+// referencedBlobs returns the keys of the blobs referenced by the active files and by the files in any other status,
+// the blobs of the files being uploaded, deleted or kept in the trash must not be taken for orphans
+func (s service) referencedBlobs(ctx context.Context, activeFiles []filesDBStore.FileDetail) (map[string]bool, error) {
+	files := append([]filesDBStore.FileDetail{}, activeFiles...)
+	for _, status := range []string{filesDBStore.FileStatusPending, filesDBStore.FileStatusDeleting, filesDBStore.FileStatusTrashed} {
+		statusFiles, err := s.dbStore.GetFilesByStatus(ctx, status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s files from DB, err: %v", status, err)
+		}
+		files = append(files, statusFiles...)
+	}
+
+	referenced := make(map[string]bool, len(files))
+	for _, file := range files {
+		referenced[blobKey(file)] = true
+	}
+	return referenced, nil
+}
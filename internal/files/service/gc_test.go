@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+const gcGracePeriod = time.Hour
+
+// newTestGCStore returns a local store holding referenced, orphan, quarantined and freshly uploaded blobs,
+// an abandoned upload and an in-progress one, together with the path of the abandoned upload
+func newTestGCStore(t *testing.T) (blobstore.BlobStore, string) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	store, err := localstore.NewLocalStore(rootPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * gcGracePeriod)
+	for key, content := range map[string]string{
+		sampleDigest:                    "sample string",
+		"pending.mp4":                   "pending",
+		"orphan.mp4":                    "orphan",
+		"reused.mp4":                    "reused",
+		"trashed.mp4":                   "trashed",
+		"failing.mp4":                   "failing",
+		QuarantinePrefix + "broken.mp4": "broken",
+	} {
+		if _, err := store.Put(ctx, key, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(rootPath, key), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Put(ctx, "uploading.mp4", strings.NewReader("uploading")); err != nil {
+		t.Fatal(err)
+	}
+
+	abandonedPath := filepath.Join(rootPath, localstore.TempFilePrefix+"abandoned")
+	if err := os.WriteFile(abandonedPath, []byte("abandoned"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(abandonedPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootPath, localstore.TempFilePrefix+"in-progress"), []byte("in progress"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return store, abandonedPath
+}
+
+// deleteUnreferencedWithBlobFunc returns gomock action that calls the given dbstore.BlobFunc of an unreferenced blob
+func deleteUnreferencedWithBlobFunc(ctx context.Context, key string, blobFunc dbstore.BlobFunc) (bool, error) {
+	if err := blobFunc(ctx, dbstore.FileDetail{Digest: key}, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func Test_service_CollectGarbage(t *testing.T) {
+	ctx := context.Background()
+	expectReferences := func(mockDBStore *dbStoreMocks.MockDBStore) {
+		mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{{ID: "sample.mp4", Size: 13, Digest: sampleDigest}}, nil)
+		mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return([]dbstore.FileDetail{{ID: "pending.mp4", Size: 7}}, nil)
+		mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusDeleting).Return([]dbstore.FileDetail{}, nil)
+		mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusTrashed).Return([]dbstore.FileDetail{{ID: "trashed.mp4", Size: 7}}, nil)
+	}
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		want        GCReport
+		wantErr     bool
+		wantBlobs   []string
+		wantMissing []string
+	}{
+		{
+			name:   "only report the garbage on dry run",
+			dryRun: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectReferences(mockDBStore)
+			},
+			want: GCReport{
+				DryRun:             true,
+				RemovedOrphanBlobs: []string{"failing.mp4", "orphan.mp4", "reused.mp4"},
+				ReclaimedBytes:     int64(len("abandoned") + len("failing") + len("orphan") + len("reused")),
+				FailedBlobs:        []string{},
+			},
+			wantErr:   false,
+			wantBlobs: []string{sampleDigest, "pending.mp4", "trashed.mp4", "orphan.mp4", "reused.mp4", "failing.mp4", "uploading.mp4"},
+		},
+		{
+			name:   "successfully collect the garbage",
+			dryRun: false,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectReferences(mockDBStore)
+				mockDBStore.EXPECT().DeleteUnreferencedBlob(ctx, "orphan.mp4", gomock.Any()).DoAndReturn(deleteUnreferencedWithBlobFunc)
+				// the blob got referenced by an upload after the files were listed
+				mockDBStore.EXPECT().DeleteUnreferencedBlob(ctx, "reused.mp4", gomock.Any()).Return(false, nil)
+				mockDBStore.EXPECT().DeleteUnreferencedBlob(ctx, "failing.mp4", gomock.Any()).Return(false, errors.New("some-error"))
+			},
+			want: GCReport{
+				DryRun:             false,
+				RemovedOrphanBlobs: []string{"orphan.mp4"},
+				ReclaimedBytes:     int64(len("abandoned") + len("orphan")),
+				FailedBlobs:        []string{"failing.mp4"},
+			},
+			wantErr:     false,
+			wantBlobs:   []string{sampleDigest, "pending.mp4", "trashed.mp4", "reused.mp4", "failing.mp4", "uploading.mp4", QuarantinePrefix + "broken.mp4"},
+			wantMissing: []string{"orphan.mp4"},
+		},
+		{
+			name:   "failed to get the files from DB",
+			dryRun: false,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return(nil, errors.New("some-error"))
+			},
+			want: GCReport{
+				DryRun:             false,
+				RemovedOrphanBlobs: []string{},
+				ReclaimedBytes:     int64(len("abandoned")),
+				FailedBlobs:        []string{},
+			},
+			wantErr:   true,
+			wantBlobs: []string{sampleDigest, "pending.mp4", "orphan.mp4", "reused.mp4", "failing.mp4", "uploading.mp4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore, abandonedPath := newTestGCStore(t)
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: blobStore,
+			}
+			got, err := s.CollectGarbage(ctx, gcGracePeriod, tt.dryRun)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CollectGarbage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			tt.want.RemovedTempFiles = []string{abandonedPath}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CollectGarbage() got = %+v, want %+v", got, tt.want)
+			}
+			if _, err := os.Stat(abandonedPath); tt.dryRun == errors.Is(err, os.ErrNotExist) {
+				t.Errorf("CollectGarbage() abandoned upload err = %v, dryRun %v", err, tt.dryRun)
+			}
+			for _, key := range tt.wantBlobs {
+				if _, err := blobStore.Stat(ctx, key); err != nil {
+					t.Errorf("CollectGarbage() blob %s err = %v", key, err)
+				}
+			}
+			for _, key := range tt.wantMissing {
+				if _, err := blobStore.Stat(ctx, key); !errors.Is(err, blobstore.ErrorNotFound) {
+					t.Errorf("CollectGarbage() blob %s err = %v, want %v", key, err, blobstore.ErrorNotFound)
+				}
+			}
+		})
+	}
+}
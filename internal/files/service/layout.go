@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// Errors represent custom error that will be verified by the caller
+var (
+	ErrorLayoutMigrationUnsupported = fmt.Errorf("blob storage does not support layout migration")
+)
+
+// LayoutMigrationReport represents the result of moving the blobs into the configured storage layout
+type LayoutMigrationReport struct {
+	MovedBlobs   int      `json:"moved_blobs"`
+	UpdatedFiles int      `json:"updated_files"`
+	MissingFiles []string `json:"missing_files"`
+}
+
+// MigrateLayout moves the stored blobs into the configured layout and updates the path of the files accordingly.
+// Running it again after a successful or interrupted run is safe.
+func (s service) MigrateLayout(ctx context.Context) (LayoutMigrationReport, error) {
+	report := LayoutMigrationReport{
+		MissingFiles: make([]string, 0),
+	}
+
+	migrator, ok := s.blobStore.(filesBlobStore.LayoutMigrator)
+	if !ok {
+		return report, ErrorLayoutMigrationUnsupported
+	}
+	moved, err := migrator.MigrateLayout(ctx)
+	report.MovedBlobs = len(moved)
+	if err != nil {
+		return report, fmt.Errorf("failed to move blobs, err: %v", err)
+	}
+
+	files, err := s.dbStore.GetAllFiles(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get all files from DB, err: %v", err)
+	}
+	for _, file := range files {
+		blobInfo, err := s.blobStore.Stat(ctx, blobKey(file))
+		if errors.Is(err, filesBlobStore.ErrorNotFound) {
+			report.MissingFiles = append(report.MissingFiles, file.ID)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to get blob of file: %s, err: %v", file.ID, err)
+		}
+		if blobInfo.Path == file.Path {
+			continue
+		}
+		if err := s.dbStore.UpdateFilePath(ctx, file.ID, blobInfo.Path); err != nil {
+			return report, fmt.Errorf("failed to update path of file: %s, err: %v", file.ID, err)
+		}
+		report.UpdatedFiles++
+	}
+	return report, nil
+}
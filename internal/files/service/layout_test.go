@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_MigrateLayout(t *testing.T) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	flatStore, _ := localstore.NewLocalStore(rootPath, 0)
+	_, _ = flatStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	_, _ = flatStore.Put(ctx, "legacy.mp4", strings.NewReader("legacy"))
+	shardedStore, _ := localstore.NewLocalStore(rootPath, 2)
+
+	tests := []struct {
+		name      string
+		blobStore blobstore.BlobStore
+		mockFunc  func(mockDBStore *dbStoreMocks.MockDBStore)
+		want      LayoutMigrationReport
+		wantErr   bool
+	}{
+		{
+			name:      "successfully migrate the layout",
+			blobStore: shardedStore,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{
+					{ID: "sample.mp4", Path: "localhost/v1/files/sample.mp4", Digest: sampleDigest},
+					{ID: "legacy.mp4", Path: "localhost/v1/files/legacy.mp4"},
+					{ID: "missing.mp4", Path: "missing.mp4"},
+				}, nil)
+				mockDBStore.EXPECT().UpdateFilePath(ctx, "sample.mp4", shardedStore.Path(sampleDigest)).Return(nil)
+				mockDBStore.EXPECT().UpdateFilePath(ctx, "legacy.mp4", shardedStore.Path("legacy.mp4")).Return(nil)
+			},
+			want: LayoutMigrationReport{
+				MovedBlobs:   2,
+				UpdatedFiles: 2,
+				MissingFiles: []string{"missing.mp4"},
+			},
+			wantErr: false,
+		},
+		{
+			name:      "running the migration again changes nothing",
+			blobStore: shardedStore,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{
+					{ID: "sample.mp4", Path: shardedStore.Path(sampleDigest), Digest: sampleDigest},
+					{ID: "legacy.mp4", Path: shardedStore.Path("legacy.mp4")},
+				}, nil)
+			},
+			want: LayoutMigrationReport{
+				MovedBlobs:   0,
+				UpdatedFiles: 0,
+				MissingFiles: []string{},
+			},
+			wantErr: false,
+		},
+		{
+			name:      "blob storage does not support layout migration",
+			blobStore: memstore.NewMemoryStore(),
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want: LayoutMigrationReport{
+				MissingFiles: []string{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: tt.blobStore,
+			}
+			got, err := s.MigrateLayout(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MigrateLayout() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MigrateLayout() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
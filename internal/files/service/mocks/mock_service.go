@@ -6,9 +6,11 @@ package mock_service
 
 import (
 	context "context"
-	multipart "mime/multipart"
+	io "io"
 	reflect "reflect"
+	time "time"
 
+	fileid "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
 	service "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -36,18 +38,195 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 	return m.recorder
 }
 
+// AbortAbandonedMultipartUploads mocks base method.
+func (m *MockService) AbortAbandonedMultipartUploads(arg0 context.Context, arg1 time.Duration) (service.MultipartCleanupReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbortAbandonedMultipartUploads", arg0, arg1)
+	ret0, _ := ret[0].(service.MultipartCleanupReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AbortAbandonedMultipartUploads indicates an expected call of AbortAbandonedMultipartUploads.
+func (mr *MockServiceMockRecorder) AbortAbandonedMultipartUploads(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbortAbandonedMultipartUploads", reflect.TypeOf((*MockService)(nil).AbortAbandonedMultipartUploads), arg0, arg1)
+}
+
+// AbortExpiredUploads mocks base method.
+func (m *MockService) AbortExpiredUploads(arg0 context.Context) (service.UploadCleanupReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbortExpiredUploads", arg0)
+	ret0, _ := ret[0].(service.UploadCleanupReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AbortExpiredUploads indicates an expected call of AbortExpiredUploads.
+func (mr *MockServiceMockRecorder) AbortExpiredUploads(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbortExpiredUploads", reflect.TypeOf((*MockService)(nil).AbortExpiredUploads), arg0)
+}
+
+// AbortMultipartUpload mocks base method.
+func (m *MockService) AbortMultipartUpload(arg0 context.Context, arg1 fileid.ID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbortMultipartUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AbortMultipartUpload indicates an expected call of AbortMultipartUpload.
+func (mr *MockServiceMockRecorder) AbortMultipartUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbortMultipartUpload", reflect.TypeOf((*MockService)(nil).AbortMultipartUpload), arg0, arg1)
+}
+
+// CheckStorage mocks base method.
+func (m *MockService) CheckStorage(arg0 context.Context) (service.StorageReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckStorage", arg0)
+	ret0, _ := ret[0].(service.StorageReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckStorage indicates an expected call of CheckStorage.
+func (mr *MockServiceMockRecorder) CheckStorage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckStorage", reflect.TypeOf((*MockService)(nil).CheckStorage), arg0)
+}
+
+// CollectGarbage mocks base method.
+func (m *MockService) CollectGarbage(arg0 context.Context, arg1 time.Duration, arg2 bool) (service.GCReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CollectGarbage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(service.GCReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CollectGarbage indicates an expected call of CollectGarbage.
+func (mr *MockServiceMockRecorder) CollectGarbage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGarbage", reflect.TypeOf((*MockService)(nil).CollectGarbage), arg0, arg1, arg2)
+}
+
+// CompleteMultipartUpload mocks base method.
+func (m *MockService) CompleteMultipartUpload(arg0 context.Context, arg1 fileid.ID, arg2 string, arg3 []service.CompletedPart) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteMultipartUpload", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteMultipartUpload indicates an expected call of CompleteMultipartUpload.
+func (mr *MockServiceMockRecorder) CompleteMultipartUpload(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteMultipartUpload", reflect.TypeOf((*MockService)(nil).CompleteMultipartUpload), arg0, arg1, arg2, arg3)
+}
+
+// CreateMultipartUpload mocks base method.
+func (m *MockService) CreateMultipartUpload(arg0 context.Context, arg1 fileid.ID, arg2 string) (service.MultipartUploadInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMultipartUpload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(service.MultipartUploadInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMultipartUpload indicates an expected call of CreateMultipartUpload.
+func (mr *MockServiceMockRecorder) CreateMultipartUpload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMultipartUpload", reflect.TypeOf((*MockService)(nil).CreateMultipartUpload), arg0, arg1, arg2)
+}
+
+// CreateUpload mocks base method.
+func (m *MockService) CreateUpload(arg0 context.Context, arg1 fileid.ID, arg2 string, arg3 int64, arg4 string) (service.UploadInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUpload", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(service.UploadInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUpload indicates an expected call of CreateUpload.
+func (mr *MockServiceMockRecorder) CreateUpload(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUpload", reflect.TypeOf((*MockService)(nil).CreateUpload), arg0, arg1, arg2, arg3, arg4)
+}
+
 // DeleteFileByID mocks base method.
-func (m *MockService) DeleteFileByID(arg0 context.Context, arg1 string) error {
+func (m *MockService) DeleteFileByID(arg0 context.Context, arg1 fileid.ID, arg2 bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteFileByID", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeleteFileByID", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteFileByID indicates an expected call of DeleteFileByID.
-func (mr *MockServiceMockRecorder) DeleteFileByID(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) DeleteFileByID(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileByID", reflect.TypeOf((*MockService)(nil).DeleteFileByID), arg0, arg1, arg2)
+}
+
+// DeleteFileVersion mocks base method.
+func (m *MockService) DeleteFileVersion(arg0 context.Context, arg1 fileid.ID, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFileVersion", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFileVersion indicates an expected call of DeleteFileVersion.
+func (mr *MockServiceMockRecorder) DeleteFileVersion(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileVersion", reflect.TypeOf((*MockService)(nil).DeleteFileVersion), arg0, arg1, arg2)
+}
+
+// DeleteUpload mocks base method.
+func (m *MockService) DeleteUpload(arg0 context.Context, arg1 fileid.ID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUpload indicates an expected call of DeleteUpload.
+func (mr *MockServiceMockRecorder) DeleteUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUpload", reflect.TypeOf((*MockService)(nil).DeleteUpload), arg0, arg1)
+}
+
+// DemoteColdFiles mocks base method.
+func (m *MockService) DemoteColdFiles(arg0 context.Context, arg1 time.Duration) (service.TieringReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DemoteColdFiles", arg0, arg1)
+	ret0, _ := ret[0].(service.TieringReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DemoteColdFiles indicates an expected call of DemoteColdFiles.
+func (mr *MockServiceMockRecorder) DemoteColdFiles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DemoteColdFiles", reflect.TypeOf((*MockService)(nil).DemoteColdFiles), arg0, arg1)
+}
+
+// Fsck mocks base method.
+func (m *MockService) Fsck(arg0 context.Context, arg1 bool) (service.FsckReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fsck", arg0, arg1)
+	ret0, _ := ret[0].(service.FsckReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fsck indicates an expected call of Fsck.
+func (mr *MockServiceMockRecorder) Fsck(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileByID", reflect.TypeOf((*MockService)(nil).DeleteFileByID), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fsck", reflect.TypeOf((*MockService)(nil).Fsck), arg0, arg1)
 }
 
 // GetAllFiles mocks base method.
@@ -65,17 +244,300 @@ func (mr *MockServiceMockRecorder) GetAllFiles(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllFiles", reflect.TypeOf((*MockService)(nil).GetAllFiles), arg0)
 }
 
+// GetFileByID mocks base method.
+func (m *MockService) GetFileByID(arg0 context.Context, arg1 fileid.ID) (service.FileInfo, io.ReadSeekCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileByID", arg0, arg1)
+	ret0, _ := ret[0].(service.FileInfo)
+	ret1, _ := ret[1].(io.ReadSeekCloser)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetFileByID indicates an expected call of GetFileByID.
+func (mr *MockServiceMockRecorder) GetFileByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileByID", reflect.TypeOf((*MockService)(nil).GetFileByID), arg0, arg1)
+}
+
+// GetFileVersion mocks base method.
+func (m *MockService) GetFileVersion(arg0 context.Context, arg1 fileid.ID, arg2 int) (service.FileInfo, io.ReadSeekCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileVersion", arg0, arg1, arg2)
+	ret0, _ := ret[0].(service.FileInfo)
+	ret1, _ := ret[1].(io.ReadSeekCloser)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetFileVersion indicates an expected call of GetFileVersion.
+func (mr *MockServiceMockRecorder) GetFileVersion(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileVersion", reflect.TypeOf((*MockService)(nil).GetFileVersion), arg0, arg1, arg2)
+}
+
+// GetFileVersions mocks base method.
+func (m *MockService) GetFileVersions(arg0 context.Context, arg1 fileid.ID) ([]service.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileVersions", arg0, arg1)
+	ret0, _ := ret[0].([]service.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileVersions indicates an expected call of GetFileVersions.
+func (mr *MockServiceMockRecorder) GetFileVersions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileVersions", reflect.TypeOf((*MockService)(nil).GetFileVersions), arg0, arg1)
+}
+
+// GetTrash mocks base method.
+func (m *MockService) GetTrash(arg0 context.Context) ([]service.TrashedFileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrash", arg0)
+	ret0, _ := ret[0].([]service.TrashedFileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrash indicates an expected call of GetTrash.
+func (mr *MockServiceMockRecorder) GetTrash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrash", reflect.TypeOf((*MockService)(nil).GetTrash), arg0)
+}
+
+// GetUpload mocks base method.
+func (m *MockService) GetUpload(arg0 context.Context, arg1 fileid.ID) (service.UploadInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUpload", arg0, arg1)
+	ret0, _ := ret[0].(service.UploadInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUpload indicates an expected call of GetUpload.
+func (mr *MockServiceMockRecorder) GetUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpload", reflect.TypeOf((*MockService)(nil).GetUpload), arg0, arg1)
+}
+
+// GetUsage mocks base method.
+func (m *MockService) GetUsage(arg0 context.Context, arg1 string) (service.UsageReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsage", arg0, arg1)
+	ret0, _ := ret[0].(service.UsageReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsage indicates an expected call of GetUsage.
+func (mr *MockServiceMockRecorder) GetUsage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsage", reflect.TypeOf((*MockService)(nil).GetUsage), arg0, arg1)
+}
+
+// MigrateLayout mocks base method.
+func (m *MockService) MigrateLayout(arg0 context.Context) (service.LayoutMigrationReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MigrateLayout", arg0)
+	ret0, _ := ret[0].(service.LayoutMigrationReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MigrateLayout indicates an expected call of MigrateLayout.
+func (mr *MockServiceMockRecorder) MigrateLayout(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateLayout", reflect.TypeOf((*MockService)(nil).MigrateLayout), arg0)
+}
+
+// PurgeTrash mocks base method.
+func (m *MockService) PurgeTrash(arg0 context.Context, arg1 time.Duration) (service.PurgeReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTrash", arg0, arg1)
+	ret0, _ := ret[0].(service.PurgeReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeTrash indicates an expected call of PurgeTrash.
+func (mr *MockServiceMockRecorder) PurgeTrash(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTrash", reflect.TypeOf((*MockService)(nil).PurgeTrash), arg0, arg1)
+}
+
+// PutFile mocks base method.
+func (m *MockService) PutFile(arg0 context.Context, arg1 io.Reader, arg2 string, arg3 fileid.ID, arg4, arg5 string, arg6 time.Time, arg7 bool) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutFile", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutFile indicates an expected call of PutFile.
+func (mr *MockServiceMockRecorder) PutFile(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutFile", reflect.TypeOf((*MockService)(nil).PutFile), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
+}
+
+// ReapExpiredFiles mocks base method.
+func (m *MockService) ReapExpiredFiles(arg0 context.Context) (service.ReapReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReapExpiredFiles", arg0)
+	ret0, _ := ret[0].(service.ReapReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReapExpiredFiles indicates an expected call of ReapExpiredFiles.
+func (mr *MockServiceMockRecorder) ReapExpiredFiles(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReapExpiredFiles", reflect.TypeOf((*MockService)(nil).ReapExpiredFiles), arg0)
+}
+
+// Recover mocks base method.
+func (m *MockService) Recover(arg0 context.Context, arg1 time.Duration) (service.RecoveryReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Recover", arg0, arg1)
+	ret0, _ := ret[0].(service.RecoveryReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Recover indicates an expected call of Recover.
+func (mr *MockServiceMockRecorder) Recover(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Recover", reflect.TypeOf((*MockService)(nil).Recover), arg0, arg1)
+}
+
+// RestoreFile mocks base method.
+func (m *MockService) RestoreFile(arg0 context.Context, arg1 fileid.ID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreFile", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreFile indicates an expected call of RestoreFile.
+func (mr *MockServiceMockRecorder) RestoreFile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreFile", reflect.TypeOf((*MockService)(nil).RestoreFile), arg0, arg1)
+}
+
+// ResyncReplicas mocks base method.
+func (m *MockService) ResyncReplicas(arg0 context.Context) (service.ResyncReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResyncReplicas", arg0)
+	ret0, _ := ret[0].(service.ResyncReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResyncReplicas indicates an expected call of ResyncReplicas.
+func (mr *MockServiceMockRecorder) ResyncReplicas(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResyncReplicas", reflect.TypeOf((*MockService)(nil).ResyncReplicas), arg0)
+}
+
+// RotateEncryptionKey mocks base method.
+func (m *MockService) RotateEncryptionKey(arg0 context.Context) (service.KeyRotationReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateEncryptionKey", arg0)
+	ret0, _ := ret[0].(service.KeyRotationReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateEncryptionKey indicates an expected call of RotateEncryptionKey.
+func (mr *MockServiceMockRecorder) RotateEncryptionKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateEncryptionKey", reflect.TypeOf((*MockService)(nil).RotateEncryptionKey), arg0)
+}
+
+// SetFileExpiry mocks base method.
+func (m *MockService) SetFileExpiry(arg0 context.Context, arg1 fileid.ID, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFileExpiry", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFileExpiry indicates an expected call of SetFileExpiry.
+func (mr *MockServiceMockRecorder) SetFileExpiry(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFileExpiry", reflect.TypeOf((*MockService)(nil).SetFileExpiry), arg0, arg1, arg2)
+}
+
+// SetQuota mocks base method.
+func (m *MockService) SetQuota(arg0 context.Context, arg1 string, arg2, arg3 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetQuota", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuota indicates an expected call of SetQuota.
+func (mr *MockServiceMockRecorder) SetQuota(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuota", reflect.TypeOf((*MockService)(nil).SetQuota), arg0, arg1, arg2, arg3)
+}
+
+// Shutdown mocks base method.
+func (m *MockService) Shutdown(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shutdown", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockServiceMockRecorder) Shutdown(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockService)(nil).Shutdown), arg0)
+}
+
 // UploadFile mocks base method.
-func (m *MockService) UploadFile(arg0 context.Context, arg1 multipart.File, arg2, arg3 string, arg4 int64) (string, error) {
+func (m *MockService) UploadFile(arg0 context.Context, arg1 io.Reader, arg2 string, arg3 fileid.ID, arg4 string, arg5 time.Time) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadFile", arg0, arg1, arg2, arg3, arg4)
+	ret := m.ctrl.Call(m, "UploadFile", arg0, arg1, arg2, arg3, arg4, arg5)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UploadFile indicates an expected call of UploadFile.
-func (mr *MockServiceMockRecorder) UploadFile(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) UploadFile(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockService)(nil).UploadFile), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// UploadPart mocks base method.
+func (m *MockService) UploadPart(arg0 context.Context, arg1 fileid.ID, arg2 int, arg3 io.Reader) (service.PartInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadPart", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(service.PartInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UploadPart indicates an expected call of UploadPart.
+func (mr *MockServiceMockRecorder) UploadPart(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadPart", reflect.TypeOf((*MockService)(nil).UploadPart), arg0, arg1, arg2, arg3)
+}
+
+// WriteUpload mocks base method.
+func (m *MockService) WriteUpload(arg0 context.Context, arg1 fileid.ID, arg2 string, arg3 int64, arg4 io.Reader, arg5 service.Checksum) (service.UploadInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteUpload", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(service.UploadInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteUpload indicates an expected call of WriteUpload.
+func (mr *MockServiceMockRecorder) WriteUpload(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFile", reflect.TypeOf((*MockService)(nil).UploadFile), arg0, arg1, arg2, arg3, arg4)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteUpload", reflect.TypeOf((*MockService)(nil).WriteUpload), arg0, arg1, arg2, arg3, arg4, arg5)
 }
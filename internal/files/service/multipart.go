@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// Errors represent custom error that will be verified by the handler layer
+var (
+	ErrorMultipartUploadsDisabled = errors.New("multipart uploads are disabled")
+	ErrorInvalidPartNumber        = errors.New("invalid part number")
+	ErrorInvalidPart              = errors.New("invalid part")
+	ErrorInvalidPartOrder         = errors.New("parts are not in ascending order")
+)
+
+const (
+	// MaxPartNumber is the highest part number of a multipart upload, the parts are numbered from 1
+	MaxPartNumber = 10000
+	// DefaultMultipartExpiry is how long a multipart upload is kept before it is aborted as abandoned
+	DefaultMultipartExpiry = 7 * 24 * time.Hour
+)
+
+// MultipartUploadInfo represents a multipart upload waiting for its parts
+type MultipartUploadInfo struct {
+	UploadID string `json:"upload_id"`
+	Name     string `json:"name"`
+}
+
+// PartInfo represents a part received by a multipart upload, its checksum is the hex encoded SHA-256 of its content
+type PartInfo struct {
+	PartNumber int    `json:"part_number"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"`
+}
+
+// CompletedPart represents a part listed to complete a multipart upload, the checksum must be the one returned when the part was uploaded
+type CompletedPart struct {
+	PartNumber int    `json:"part_number"`
+	Checksum   string `json:"checksum"`
+}
+
+// MultipartCleanupReport represents the result of aborting the abandoned multipart uploads
+type MultipartCleanupReport struct {
+	AbortedUploads int      `json:"aborted_uploads"`
+	FailedUploads  []string `json:"failed_uploads"`
+}
+
+// WithMultipartUploads enables the multipart uploads, the parts they received so far are kept under dir
+func WithMultipartUploads(dir string) Option {
+	return func(s *service) {
+		s.multipartDir = dir
+	}
+}
+
+// CreateMultipartUpload starts a multipart upload of a file with specified name, its parts are then sent with UploadPart.
+// The upload is refused right away when the owner has no quota or the storage no space left.
+func (s service) CreateMultipartUpload(ctx context.Context, name fileid.ID, owner string) (MultipartUploadInfo, error) {
+	if s.multipartDir == "" {
+		return MultipartUploadInfo{}, ErrorMultipartUploadsDisabled
+	}
+	if !slices.Contains(allowedExtensions, filepath.Ext(name.String())) {
+		return MultipartUploadInfo{}, ErrorUnsupportedFileTypes
+	}
+	if err := s.checkFreeSpace(ctx); err != nil {
+		return MultipartUploadInfo{}, err
+	}
+	if _, err := s.remainingQuota(ctx, owner); err != nil {
+		return MultipartUploadInfo{}, err
+	}
+
+	upload := filesDBStore.MultipartUpload{
+		ID:    s.newID(),
+		Name:  name.String(),
+		Owner: owner,
+	}
+	if err := s.dbStore.InsertMultipartUpload(ctx, upload); err != nil {
+		return MultipartUploadInfo{}, fmt.Errorf("failed to insert multipart upload to DB, err: %v", err)
+	}
+	return MultipartUploadInfo{
+		UploadID: upload.ID,
+		Name:     upload.Name,
+	}, nil
+}
+
+// UploadPart stores the part of the multipart upload, a part uploaded again replaces the previous one.
+// The parts are written to their own files, so they can be uploaded in parallel,
+// but not while the multipart upload is being completed or aborted.
+func (s service) UploadPart(ctx context.Context, uploadID fileid.ID, partNumber int, reader io.Reader) (PartInfo, error) {
+	if partNumber < 1 || partNumber > MaxPartNumber {
+		return PartInfo{}, fmt.Errorf("%w: %d, it must be between 1 and %d", ErrorInvalidPartNumber, partNumber, MaxPartNumber)
+	}
+
+	// the upload is shared by its parts, so it is neither completed nor aborted while one of them is written
+	releaseUpload, ok := s.writes.share(uploadID.String())
+	if !ok {
+		return PartInfo{}, ErrorUploadLocked
+	}
+	defer releaseUpload()
+	// the same part is written one at a time, so its content always matches the checksum recorded for it
+	release, ok := s.writes.reserve(partKey(uploadID.String(), partNumber))
+	if !ok {
+		return PartInfo{}, ErrorUploadLocked
+	}
+	defer release()
+
+	upload, err := s.dbStore.GetMultipartUpload(ctx, uploadID.String())
+	if err != nil {
+		return PartInfo{}, fmt.Errorf("failed to get multipart upload from DB, err: %w", err)
+	}
+	if err := s.checkFreeSpace(ctx); err != nil {
+		return PartInfo{}, err
+	}
+	remaining, err := s.remainingQuota(ctx, upload.Owner)
+	if err != nil {
+		return PartInfo{}, err
+	}
+	if remaining >= 0 {
+		reader = &quotaReader{reader: reader, remaining: remaining}
+	}
+
+	dir := s.multipartPath(upload.ID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return PartInfo{}, fmt.Errorf("failed to create directory: %s, err: %v", dir, err)
+	}
+	part, err := os.CreateTemp(dir, ".part-*")
+	if err != nil {
+		return PartInfo{}, fmt.Errorf("failed to create part, err: %v", err)
+	}
+	defer func() {
+		// the temp file is already renamed once the part is stored
+		_ = part.Close()
+		_ = os.Remove(part.Name())
+	}()
+
+	digest := sha256.New()
+	size, err := io.Copy(part, io.TeeReader(reader, digest))
+	if err != nil {
+		if limited, ok := reader.(*quotaReader); ok && limited.exceeded {
+			return PartInfo{}, ErrorQuotaExceeded
+		}
+		return PartInfo{}, fmt.Errorf("failed to write part, err: %v", err)
+	}
+	if err := part.Sync(); err != nil {
+		return PartInfo{}, fmt.Errorf("failed to write part, err: %v", err)
+	}
+	if err := os.Rename(part.Name(), filepath.Join(dir, strconv.Itoa(partNumber))); err != nil {
+		return PartInfo{}, fmt.Errorf("failed to store part, err: %v", err)
+	}
+
+	partInfo := PartInfo{
+		PartNumber: partNumber,
+		Size:       size,
+		Checksum:   hex.EncodeToString(digest.Sum(nil)),
+	}
+	err = s.dbStore.PutMultipartPart(ctx, filesDBStore.MultipartPart{
+		UploadID:   upload.ID,
+		PartNumber: partInfo.PartNumber,
+		Size:       partInfo.Size,
+		Checksum:   partInfo.Checksum,
+	})
+	if err != nil {
+		return PartInfo{}, fmt.Errorf("failed to insert part to DB, err: %v", err)
+	}
+	return partInfo, nil
+}
+
+// CompleteMultipartUpload stores the listed parts, in their order, as a new file and removes the multipart upload.
+// The parts must be listed in ascending order with the checksums returned when they were uploaded, the parts left out are dropped.
+// The parts are streamed one after another to the blob storage, so the file is never held in memory.
+func (s service) CompleteMultipartUpload(ctx context.Context, uploadID fileid.ID, host string, parts []CompletedPart) (string, error) {
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: at least one part must be listed", ErrorInvalidPart)
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i].PartNumber <= parts[i-1].PartNumber {
+			return "", fmt.Errorf("%w: part %d is listed after part %d", ErrorInvalidPartOrder, parts[i].PartNumber, parts[i-1].PartNumber)
+		}
+	}
+
+	release, ok := s.writes.reserve(uploadID.String())
+	if !ok {
+		return "", ErrorUploadLocked
+	}
+	defer release()
+
+	upload, err := s.dbStore.GetMultipartUpload(ctx, uploadID.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to get multipart upload from DB, err: %w", err)
+	}
+	uploadedParts, err := s.dbStore.GetMultipartParts(ctx, upload.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get parts from DB, err: %v", err)
+	}
+	checksums := make(map[int]string, len(uploadedParts))
+	for _, part := range uploadedParts {
+		checksums[part.PartNumber] = part.Checksum
+	}
+	for _, part := range parts {
+		checksum, ok := checksums[part.PartNumber]
+		if !ok {
+			return "", fmt.Errorf("%w: part %d was not uploaded", ErrorInvalidPart, part.PartNumber)
+		}
+		if checksum != part.Checksum {
+			return "", fmt.Errorf("%w: checksum of part %d does not match", ErrorInvalidPart, part.PartNumber)
+		}
+	}
+
+	record, release, err := s.newFileRecord(ctx, fileid.ID(upload.Name), upload.Owner, time.Time{})
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	content := &partsReader{dir: s.multipartPath(upload.ID), parts: parts}
+	defer content.Close()
+	location, err := s.uploadFile(ctx, content, host, record)
+	if err != nil {
+		return "", err
+	}
+	if err := s.removeMultipartUpload(ctx, upload.ID); err != nil {
+		log.Printf("failed to remove completed multipart upload: %s, err: %v", upload.ID, err)
+	}
+	return location, nil
+}
+
+// AbortMultipartUpload stops the multipart upload and removes the parts it received
+func (s service) AbortMultipartUpload(ctx context.Context, uploadID fileid.ID) error {
+	release, ok := s.writes.reserve(uploadID.String())
+	if !ok {
+		return ErrorUploadLocked
+	}
+	defer release()
+
+	if err := s.removeMultipartUpload(ctx, uploadID.String()); err != nil {
+		return fmt.Errorf("failed to abort multipart upload, err: %w", err)
+	}
+	return nil
+}
+
+// AbortAbandonedMultipartUploads aborts the multipart uploads started more than olderThan ago, which are left unfinished by their clients
+func (s service) AbortAbandonedMultipartUploads(ctx context.Context, olderThan time.Duration) (MultipartCleanupReport, error) {
+	report := MultipartCleanupReport{
+		FailedUploads: make([]string, 0),
+	}
+
+	uploads, err := s.dbStore.GetMultipartUploadsBefore(ctx, time.Now().Add(-olderThan))
+	if err != nil {
+		return report, fmt.Errorf("failed to get multipart uploads from DB, err: %v", err)
+	}
+	for _, upload := range uploads {
+		// the uploads being completed are left for the next run
+		release, ok := s.writes.reserve(upload.ID)
+		if !ok {
+			continue
+		}
+		err := s.removeMultipartUpload(ctx, upload.ID)
+		release()
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			report.FailedUploads = append(report.FailedUploads, upload.ID)
+			continue
+		}
+		report.AbortedUploads++
+	}
+	return report, nil
+}
+
+// removeMultipartUpload removes the multipart upload record, its parts records are removed along with it, and then the parts content
+func (s service) removeMultipartUpload(ctx context.Context, id string) error {
+	if err := s.dbStore.DeleteMultipartUpload(ctx, id); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.multipartPath(id))
+}
+
+// multipartPath returns the path of the directory keeping the parts received by the multipart upload
+func (s service) multipartPath(id string) string {
+	return filepath.Join(s.multipartDir, id)
+}
+
+// partKey returns the key reserving a part of a multipart upload while it is written
+func partKey(uploadID string, partNumber int) string {
+	return uploadID + "/" + strconv.Itoa(partNumber)
+}
+
+// partsReader reads the content of the parts one after another, each part is only opened once the previous one is read.
+// A part no longer matching its checksum fails the read, so a damaged part is never stored as part of the file.
+type partsReader struct {
+	dir     string
+	parts   []CompletedPart
+	current *os.File
+	digest  hash.Hash
+}
+
+func (pr *partsReader) Read(p []byte) (int, error) {
+	for {
+		if pr.current == nil {
+			if len(pr.parts) == 0 {
+				return 0, io.EOF
+			}
+			part, err := os.Open(filepath.Join(pr.dir, strconv.Itoa(pr.parts[0].PartNumber)))
+			if err != nil {
+				return 0, fmt.Errorf("failed to open part %d, err: %v", pr.parts[0].PartNumber, err)
+			}
+			pr.current = part
+			pr.digest = sha256.New()
+		}
+
+		n, err := pr.current.Read(p)
+		pr.digest.Write(p[:n])
+		if err == io.EOF {
+			if checksum := hex.EncodeToString(pr.digest.Sum(nil)); checksum != pr.parts[0].Checksum {
+				return n, fmt.Errorf("%w: content of part %d does not match its checksum", ErrorInvalidPart, pr.parts[0].PartNumber)
+			}
+			_ = pr.current.Close()
+			pr.current = nil
+			pr.parts = pr.parts[1:]
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close closes the part being read
+func (pr *partsReader) Close() error {
+	if pr.current == nil {
+		return nil
+	}
+	return pr.current.Close()
+}
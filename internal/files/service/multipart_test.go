@@ -0,0 +1,668 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+// partChecksum returns the checksum of a part with the content
+func partChecksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func Test_service_CreateMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+		filename fileid.ID
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     MultipartUploadInfo
+		wantErr  error
+		// failed is set when any error is expected, for the errors which are not wrapped
+		failed bool
+	}{
+		{
+			name:     "successfully create a multipart upload",
+			filename: "test.mp4",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertMultipartUpload(context.Background(), dbstore.MultipartUpload{
+					ID:   generatedID,
+					Name: "test.mp4",
+				}).Return(nil)
+			},
+			want:    MultipartUploadInfo{UploadID: generatedID, Name: "test.mp4"},
+			wantErr: nil,
+		},
+		{
+			name:     "multipart uploads are disabled",
+			disabled: true,
+			filename: "test.mp4",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:    MultipartUploadInfo{},
+			wantErr: ErrorMultipartUploadsDisabled,
+		},
+		{
+			name:     "unsupported file type",
+			filename: "test.txt",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:    MultipartUploadInfo{},
+			wantErr: ErrorUnsupportedFileTypes,
+		},
+		{
+			name:     "quota used up",
+			filename: "test.mp4",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{UsedBytes: 100, Quota: dbstore.Quota{MaxBytes: 100}})
+			},
+			want:    MultipartUploadInfo{},
+			wantErr: ErrorQuotaExceeded,
+		},
+		{
+			name:     "failed to insert the multipart upload",
+			filename: "test.mp4",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertMultipartUpload(context.Background(), gomock.Any()).Return(sql.ErrConnDone)
+			},
+			want:    MultipartUploadInfo{},
+			wantErr: nil,
+			failed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:      mockDBStore,
+				blobStore:    memstore.NewMemoryStore(),
+				newID:        fixedID,
+				multipartDir: t.TempDir(),
+			}
+			if tt.disabled {
+				s.multipartDir = ""
+			}
+			got, err := s.CreateMultipartUpload(context.Background(), tt.filename, "")
+			if (tt.failed && err == nil) || (!tt.failed && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("CreateMultipartUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateMultipartUpload() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_UploadPart(t *testing.T) {
+	upload := dbstore.MultipartUpload{ID: "upload-id", Name: "test.mp4"}
+	tests := []struct {
+		name   string
+		locked bool
+		// lockedUpload reserves the whole multipart upload, as when it is completed or aborted
+		lockedUpload bool
+		partNumber   int
+		mockFunc     func(mockDBStore *dbStoreMocks.MockDBStore)
+		want         PartInfo
+		wantErr      error
+		wantContent  bool
+	}{
+		{
+			name:       "successfully upload a part",
+			partNumber: 2,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(upload, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().PutMultipartPart(context.Background(), dbstore.MultipartPart{
+					UploadID:   "upload-id",
+					PartNumber: 2,
+					Size:       6,
+					Checksum:   partChecksum("string"),
+				}).Return(nil)
+			},
+			want:        PartInfo{PartNumber: 2, Size: 6, Checksum: partChecksum("string")},
+			wantErr:     nil,
+			wantContent: true,
+		},
+		{
+			name:       "part number out of range",
+			partNumber: MaxPartNumber + 1,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:        PartInfo{},
+			wantErr:     ErrorInvalidPartNumber,
+			wantContent: false,
+		},
+		{
+			name:       "part written concurrently",
+			locked:     true,
+			partNumber: 2,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:        PartInfo{},
+			wantErr:     ErrorUploadLocked,
+			wantContent: false,
+		},
+		{
+			name:         "multipart upload being completed",
+			lockedUpload: true,
+			partNumber:   2,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:        PartInfo{},
+			wantErr:     ErrorUploadLocked,
+			wantContent: false,
+		},
+		{
+			name:       "multipart upload not found",
+			partNumber: 2,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(dbstore.MultipartUpload{}, sql.ErrNoRows)
+			},
+			want:        PartInfo{},
+			wantErr:     sql.ErrNoRows,
+			wantContent: false,
+		},
+		{
+			name:       "part larger than the remaining quota",
+			partNumber: 2,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(upload, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{UsedBytes: 95, Quota: dbstore.Quota{MaxBytes: 100}})
+			},
+			want:        PartInfo{},
+			wantErr:     ErrorQuotaExceeded,
+			wantContent: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:      mockDBStore,
+				blobStore:    memstore.NewMemoryStore(),
+				writes:       newReservations(),
+				multipartDir: t.TempDir(),
+			}
+			if tt.locked {
+				release, _ := s.writes.reserve(partKey("upload-id", tt.partNumber))
+				defer release()
+			}
+			if tt.lockedUpload {
+				release, _ := s.writes.reserve("upload-id")
+				defer release()
+			}
+
+			got, err := s.UploadPart(context.Background(), "upload-id", tt.partNumber, strings.NewReader("string"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UploadPart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UploadPart() got = %v, want %v", got, tt.want)
+			}
+			entries, _ := os.ReadDir(filepath.Join(s.multipartDir, "upload-id"))
+			if tt.wantContent != (len(entries) > 0) {
+				t.Errorf("UploadPart() stored parts got = %v, want content %v", entries, tt.wantContent)
+			}
+			if tt.wantContent {
+				content, err := os.ReadFile(filepath.Join(s.multipartDir, "upload-id", "2"))
+				if err != nil || string(content) != "string" || len(entries) != 1 {
+					t.Errorf("UploadPart() content of the part = %q, err = %v, parts = %v", content, err, entries)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_CompleteMultipartUpload(t *testing.T) {
+	upload := dbstore.MultipartUpload{ID: "upload-id", Name: "test.mp4"}
+	uploadedParts := []dbstore.MultipartPart{
+		{UploadID: "upload-id", PartNumber: 1, Size: 7, Checksum: partChecksum("sample ")},
+		{UploadID: "upload-id", PartNumber: 2, Size: 5, Checksum: partChecksum("left ")},
+		{UploadID: "upload-id", PartNumber: 3, Size: 6, Checksum: partChecksum("string")},
+	}
+	tests := []struct {
+		name     string
+		locked   bool
+		parts    []CompletedPart
+		damaged  bool
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     string
+		wantErr  error
+		// failed is set when any error is expected, for the errors which are not wrapped
+		failed    bool
+		wantParts bool
+		wantBlobs map[string]string
+	}{
+		{
+			name: "successfully complete the multipart upload with the listed parts",
+			parts: []CompletedPart{
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+				{PartNumber: 3, Checksum: partChecksum("string")},
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().GetMultipartParts(context.Background(), "upload-id").Return(uploadedParts, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().DeleteMultipartUpload(context.Background(), "upload-id").Return(nil)
+			},
+			want:      "localhost/v1/files/" + generatedID,
+			wantErr:   nil,
+			wantParts: false,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:  "no parts listed",
+			parts: []CompletedPart{},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:      "",
+			wantErr:   ErrorInvalidPart,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name: "parts not in ascending order",
+			parts: []CompletedPart{
+				{PartNumber: 3, Checksum: partChecksum("string")},
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:      "",
+			wantErr:   ErrorInvalidPartOrder,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name: "part not uploaded",
+			parts: []CompletedPart{
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+				{PartNumber: 4, Checksum: partChecksum("string")},
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().GetMultipartParts(context.Background(), "upload-id").Return(uploadedParts, nil)
+			},
+			want:      "",
+			wantErr:   ErrorInvalidPart,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name: "part checksum not matching the uploaded part",
+			parts: []CompletedPart{
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+				{PartNumber: 3, Checksum: partChecksum("strong")},
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().GetMultipartParts(context.Background(), "upload-id").Return(uploadedParts, nil)
+			},
+			want:      "",
+			wantErr:   ErrorInvalidPart,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name: "damaged part is not stored",
+			parts: []CompletedPart{
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+				{PartNumber: 3, Checksum: partChecksum("string")},
+			},
+			damaged: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().GetMultipartParts(context.Background(), "upload-id").Return(uploadedParts, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+			},
+			want:      "",
+			wantErr:   nil,
+			failed:    true,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name: "multipart upload being completed",
+			parts: []CompletedPart{
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+			},
+			locked: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:      "",
+			wantErr:   ErrorUploadLocked,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name: "multipart upload not found",
+			parts: []CompletedPart{
+				{PartNumber: 1, Checksum: partChecksum("sample ")},
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUpload(context.Background(), "upload-id").Return(dbstore.MultipartUpload{}, sql.ErrNoRows)
+			},
+			want:      "",
+			wantErr:   sql.ErrNoRows,
+			wantParts: true,
+			wantBlobs: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore := memstore.NewMemoryStore()
+			s := service{
+				dbStore:      mockDBStore,
+				blobStore:    blobStore,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				newID:        fixedID,
+				multipartDir: t.TempDir(),
+			}
+			partsDir := filepath.Join(s.multipartDir, "upload-id")
+			if err := os.MkdirAll(partsDir, os.ModePerm); err != nil {
+				t.Fatalf("MkdirAll() error = %v", err)
+			}
+			parts := map[string]string{"1": "sample ", "2": "left ", "3": "string"}
+			if tt.damaged {
+				parts["3"] = "strong"
+			}
+			for name, content := range parts {
+				if err := os.WriteFile(filepath.Join(partsDir, name), []byte(content), 0o600); err != nil {
+					t.Fatalf("WriteFile() error = %v", err)
+				}
+			}
+			if tt.locked {
+				release, _ := s.writes.reserve("upload-id")
+				defer release()
+			}
+
+			got, err := s.CompleteMultipartUpload(context.Background(), "upload-id", "localhost", tt.parts)
+			if (tt.failed && err == nil) || (!tt.failed && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("CompleteMultipartUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("CompleteMultipartUpload() got = %v, want %v", got, tt.want)
+			}
+			if _, err := os.Stat(partsDir); (err == nil) != tt.wantParts {
+				t.Errorf("CompleteMultipartUpload() parts exist = %v, want %v", err == nil, tt.wantParts)
+			}
+			blobs, _ := blobStore.List(context.Background())
+			if len(blobs) != len(tt.wantBlobs) {
+				t.Errorf("CompleteMultipartUpload() stored blobs got = %v, want %v", blobs, tt.wantBlobs)
+			}
+			for key, wantContent := range tt.wantBlobs {
+				content, err := blobStore.Get(context.Background(), key)
+				if err != nil {
+					t.Errorf("CompleteMultipartUpload() stored blob %s err = %v", key, err)
+					continue
+				}
+				contentBytes, _ := io.ReadAll(content)
+				if string(contentBytes) != wantContent {
+					t.Errorf("CompleteMultipartUpload() stored content got = %s, want %s", string(contentBytes), wantContent)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_AbortMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name      string
+		locked    bool
+		mockFunc  func(mockDBStore *dbStoreMocks.MockDBStore)
+		wantErr   error
+		wantParts bool
+	}{
+		{
+			name: "successfully abort the multipart upload",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().DeleteMultipartUpload(context.Background(), "upload-id").Return(nil)
+			},
+			wantErr:   nil,
+			wantParts: false,
+		},
+		{
+			name: "multipart upload not found",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().DeleteMultipartUpload(context.Background(), "upload-id").Return(sql.ErrNoRows)
+			},
+			wantErr:   sql.ErrNoRows,
+			wantParts: true,
+		},
+		{
+			name:   "multipart upload being completed",
+			locked: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			wantErr:   ErrorUploadLocked,
+			wantParts: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:      mockDBStore,
+				writes:       newReservations(),
+				multipartDir: t.TempDir(),
+			}
+			partsDir := filepath.Join(s.multipartDir, "upload-id")
+			if err := os.MkdirAll(partsDir, os.ModePerm); err != nil {
+				t.Fatalf("MkdirAll() error = %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(partsDir, "1"), []byte("sample "), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			if tt.locked {
+				release, _ := s.writes.reserve("upload-id")
+				defer release()
+			}
+
+			err := s.AbortMultipartUpload(context.Background(), "upload-id")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AbortMultipartUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(partsDir); (err == nil) != tt.wantParts {
+				t.Errorf("AbortMultipartUpload() parts exist = %v, want %v", err == nil, tt.wantParts)
+			}
+		})
+	}
+}
+
+func Test_service_AbortMultipartUpload_racingPartUpload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+	// the multipart upload record, the parts records are removed along with it
+	var (
+		mu      sync.Mutex
+		aborted bool
+		parts   []dbstore.MultipartPart
+	)
+	mockDBStore.EXPECT().GetUsage(gomock.Any(), gomock.Any()).Return(dbstore.Usage{}, nil).AnyTimes()
+	mockDBStore.EXPECT().GetMultipartUpload(gomock.Any(), "upload-id").DoAndReturn(func(ctx context.Context, id string) (dbstore.MultipartUpload, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if aborted {
+			return dbstore.MultipartUpload{}, sql.ErrNoRows
+		}
+		return dbstore.MultipartUpload{ID: id, Name: "test.mp4"}, nil
+	}).AnyTimes()
+	mockDBStore.EXPECT().PutMultipartPart(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, part dbstore.MultipartPart) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if aborted {
+			return errors.New("violates foreign key constraint")
+		}
+		parts = append(parts, part)
+		return nil
+	}).AnyTimes()
+	mockDBStore.EXPECT().DeleteMultipartUpload(gomock.Any(), "upload-id").DoAndReturn(func(ctx context.Context, id string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if aborted {
+			return sql.ErrNoRows
+		}
+		aborted, parts = true, nil
+		return nil
+	}).AnyTimes()
+
+	s := service{
+		dbStore:      mockDBStore,
+		blobStore:    memstore.NewMemoryStore(),
+		writes:       newReservations(),
+		multipartDir: t.TempDir(),
+	}
+	partsDir := filepath.Join(s.multipartDir, "upload-id")
+
+	// the part is stuck midway until the abort was attempted
+	content, writer := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := s.UploadPart(context.Background(), "upload-id", 1, content)
+		done <- err
+	}()
+	if _, err := writer.Write([]byte("str")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := s.AbortMultipartUpload(context.Background(), "upload-id"); !errors.Is(err, ErrorUploadLocked) {
+		t.Errorf("AbortMultipartUpload() while a part is written error = %v, wantErr %v", err, ErrorUploadLocked)
+	}
+	if _, err := writer.Write([]byte("ing")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	_ = writer.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("UploadPart() error = %v", err)
+	}
+
+	if err := s.AbortMultipartUpload(context.Background(), "upload-id"); err != nil {
+		t.Errorf("AbortMultipartUpload() once the part is written error = %v", err)
+	}
+	if _, err := s.UploadPart(context.Background(), "upload-id", 2, strings.NewReader("string")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UploadPart() once aborted error = %v, wantErr %v", err, sql.ErrNoRows)
+	}
+	if _, err := os.Stat(partsDir); err == nil || len(parts) != 0 {
+		t.Errorf("AbortMultipartUpload() left parts on disk = %v or in the DB = %v", err == nil, parts)
+	}
+}
+
+func Test_service_AbortAbandonedMultipartUploads(t *testing.T) {
+	uploads := []dbstore.MultipartUpload{
+		{ID: "upload-1", Name: "test.mp4"},
+		{ID: "upload-2", Name: "test.mp4"},
+		{ID: "upload-3", Name: "test.mp4"},
+		{ID: "upload-4", Name: "test.mp4"},
+	}
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     MultipartCleanupReport
+		wantErr  bool
+	}{
+		{
+			name: "successfully abort the abandoned multipart uploads",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUploadsBefore(context.Background(), gomock.Any()).Return(uploads, nil)
+				mockDBStore.EXPECT().DeleteMultipartUpload(context.Background(), "upload-1").Return(nil)
+				mockDBStore.EXPECT().DeleteMultipartUpload(context.Background(), "upload-2").Return(sql.ErrNoRows)
+				mockDBStore.EXPECT().DeleteMultipartUpload(context.Background(), "upload-3").Return(sql.ErrConnDone)
+			},
+			want: MultipartCleanupReport{
+				AbortedUploads: 1,
+				FailedUploads:  []string{"upload-3"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to get the multipart uploads",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetMultipartUploadsBefore(context.Background(), gomock.Any()).Return(nil, sql.ErrConnDone)
+			},
+			want: MultipartCleanupReport{
+				FailedUploads: []string{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:      mockDBStore,
+				writes:       newReservations(),
+				multipartDir: t.TempDir(),
+			}
+			// the upload being completed is left for the next run
+			release, _ := s.writes.reserve("upload-4")
+			defer release()
+
+			got, err := s.AbortAbandonedMultipartUploads(context.Background(), DefaultMultipartExpiry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AbortAbandonedMultipartUploads() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AbortAbandonedMultipartUploads() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// Errors represent custom error that will be verified by the handler layer
+var (
+	ErrorQuotaExceeded = fmt.Errorf("storage quota exceeded")
+	ErrorInvalidOwner  = fmt.Errorf("invalid owner")
+)
+
+// maxOwnerLength is the maximum length of an owner name
+const maxOwnerLength = 128
+
+// QuotaUsage represents the storage consumed against a quota, a zero limit means unlimited
+type QuotaUsage struct {
+	UsedBytes int64 `json:"used_bytes"`
+	UsedFiles int64 `json:"used_files"`
+	MaxBytes  int64 `json:"max_bytes"`
+	MaxFiles  int64 `json:"max_files"`
+}
+
+// UsageReport represents the storage consumed by an owner and by the whole storage
+type UsageReport struct {
+	Owner  string     `json:"owner"`
+	Usage  QuotaUsage `json:"usage"`
+	Global QuotaUsage `json:"global"`
+}
+
+// GetUsage returns the storage consumed by the owner and by the whole storage against their quotas
+func (s service) GetUsage(ctx context.Context, owner string) (UsageReport, error) {
+	if err := validateOwner(owner); err != nil {
+		return UsageReport{}, err
+	}
+	ownerUsage, err := s.dbStore.GetUsage(ctx, owner)
+	if err != nil {
+		return UsageReport{}, fmt.Errorf("failed to get usage of owner: %s from DB, err: %v", owner, err)
+	}
+	globalUsage, err := s.dbStore.GetUsage(ctx, filesDBStore.GlobalOwner)
+	if err != nil {
+		return UsageReport{}, fmt.Errorf("failed to get global usage from DB, err: %v", err)
+	}
+	return UsageReport{
+		Owner:  owner,
+		Usage:  mapUsageToQuotaUsage(ownerUsage),
+		Global: mapUsageToQuotaUsage(globalUsage),
+	}, nil
+}
+
+// SetQuota sets the quota of the owner, an empty owner sets the quota of the whole storage
+func (s service) SetQuota(ctx context.Context, owner string, maxBytes, maxFiles int64) error {
+	if maxBytes < 0 || maxFiles < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	if owner == "" {
+		owner = filesDBStore.GlobalOwner
+	} else if err := validateOwner(owner); err != nil {
+		return err
+	}
+	err := s.dbStore.SetQuota(ctx, owner, filesDBStore.Quota{
+		MaxBytes: maxBytes,
+		MaxFiles: maxFiles,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set quota of owner: %s, err: %v", owner, err)
+	}
+	return nil
+}
+
+// remainingQuota returns the number of bytes the owner may still upload, or -1 when it is unlimited.
+// ErrorQuotaExceeded is returned when the owner or the whole storage cannot take another file.
+func (s service) remainingQuota(ctx context.Context, owner string) (int64, error) {
+	report, err := s.GetUsage(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+	remaining := int64(-1)
+	for _, usage := range []QuotaUsage{report.Usage, report.Global} {
+		if usage.MaxFiles > 0 && usage.UsedFiles >= usage.MaxFiles {
+			return 0, ErrorQuotaExceeded
+		}
+		if usage.MaxBytes <= 0 {
+			continue
+		}
+		left := usage.MaxBytes - usage.UsedBytes
+		if left <= 0 {
+			return 0, ErrorQuotaExceeded
+		}
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+	return remaining, nil
+}
+
+// validateOwner rejects the owners which cannot be told apart from the whole storage or are unreasonably long
+func validateOwner(owner string) error {
+	if owner == filesDBStore.GlobalOwner || len(owner) > maxOwnerLength {
+		return fmt.Errorf("%w: %s", ErrorInvalidOwner, owner)
+	}
+	return nil
+}
+
+func mapUsageToQuotaUsage(usage filesDBStore.Usage) QuotaUsage {
+	return QuotaUsage{
+		UsedBytes: usage.UsedBytes,
+		UsedFiles: usage.UsedFiles,
+		MaxBytes:  usage.Quota.MaxBytes,
+		MaxFiles:  usage.Quota.MaxFiles,
+	}
+}
+
+// quotaReader fails the upload as soon as more than the remaining quota has been read,
+// so an oversized upload is stopped while it is streamed instead of after it was stored
+type quotaReader struct {
+	reader    io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (qr *quotaReader) Read(p []byte) (int, error) {
+	n, err := qr.reader.Read(p)
+	qr.remaining -= int64(n)
+	if qr.remaining < 0 {
+		qr.exceeded = true
+		return n, ErrorQuotaExceeded
+	}
+	return n, err
+}
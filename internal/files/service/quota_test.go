@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_UploadFile_quota(t *testing.T) {
+	tests := []struct {
+		name     string
+		owner    string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		wantErr  error
+	}{
+		{
+			name:  "file fits the remaining quota",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "camera-1",
+					dbstore.Usage{UsedBytes: 87, UsedFiles: 1, Quota: dbstore.Quota{MaxBytes: 100, MaxFiles: 2}},
+					dbstore.Usage{UsedBytes: 87, UsedFiles: 1})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Owner:   "camera-1",
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "file count quota of the owner is used up",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "camera-1",
+					dbstore.Usage{UsedBytes: 10, UsedFiles: 2, Quota: dbstore.Quota{MaxFiles: 2}},
+					dbstore.Usage{UsedBytes: 10, UsedFiles: 2})
+			},
+			wantErr: ErrorQuotaExceeded,
+		},
+		{
+			name:  "byte quota of the whole storage is used up",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "camera-1",
+					dbstore.Usage{},
+					dbstore.Usage{UsedBytes: 100, UsedFiles: 3, Quota: dbstore.Quota{MaxBytes: 100}})
+			},
+			wantErr: ErrorQuotaExceeded,
+		},
+		{
+			name:  "file exceeds the remaining quota while it is streamed",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "camera-1",
+					dbstore.Usage{UsedBytes: 50, UsedFiles: 1, Quota: dbstore.Quota{MaxBytes: 100}},
+					dbstore.Usage{UsedBytes: 90, UsedFiles: 2, Quota: dbstore.Quota{MaxBytes: 100}})
+			},
+			wantErr: ErrorQuotaExceeded,
+		},
+		{
+			name:  "quota is used up by a concurrent upload",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "camera-1",
+					dbstore.Usage{UsedBytes: 50, UsedFiles: 1, Quota: dbstore.Quota{MaxBytes: 100}},
+					dbstore.Usage{UsedBytes: 50, UsedFiles: 1})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), gomock.Any(), gomock.Any()).
+					DoAndReturn(callBlobFunc(0, dbstore.ErrorQuotaExceeded))
+			},
+			wantErr: ErrorQuotaExceeded,
+		},
+		{
+			name:  "owner clashes with the whole storage",
+			owner: dbstore.GlobalOwner,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			wantErr: ErrorInvalidOwner,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore := memstore.NewMemoryStore()
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: blobStore,
+				uploads:   newReservations(),
+				newID:     fixedID,
+			}
+			_, err := s.UploadFile(context.Background(), strings.NewReader("sample string"), "localhost", "test.mp4", tt.owner, time.Time{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if blobs, _ := blobStore.List(context.Background()); len(blobs) != 0 {
+					t.Errorf("UploadFile() stored blobs got = %v, want none", blobs)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_GetUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		owner    string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     UsageReport
+		wantErr  bool
+	}{
+		{
+			name:  "successfully get the usage",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "camera-1",
+					dbstore.Usage{UsedBytes: 50, UsedFiles: 1, Quota: dbstore.Quota{MaxBytes: 100}},
+					dbstore.Usage{UsedBytes: 90, UsedFiles: 2, Quota: dbstore.Quota{MaxFiles: 10}})
+			},
+			want: UsageReport{
+				Owner:  "camera-1",
+				Usage:  QuotaUsage{UsedBytes: 50, UsedFiles: 1, MaxBytes: 100},
+				Global: QuotaUsage{UsedBytes: 90, UsedFiles: 2, MaxFiles: 10},
+			},
+			wantErr: false,
+		},
+		{
+			name:  "failed to get the usage from DB",
+			owner: "camera-1",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetUsage(context.Background(), "camera-1").Return(dbstore.Usage{}, errors.New("some-error"))
+			},
+			want:    UsageReport{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore: mockDBStore,
+			}
+			got, err := s.GetUsage(context.Background(), tt.owner)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetUsage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUsage() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_SetQuota(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	mockDBStore.EXPECT().SetQuota(context.Background(), dbstore.GlobalOwner, dbstore.Quota{MaxBytes: 100}).Return(nil)
+	mockDBStore.EXPECT().SetQuota(context.Background(), "camera-1", dbstore.Quota{MaxFiles: 5}).Return(nil)
+
+	s := service{
+		dbStore: mockDBStore,
+	}
+	if err := s.SetQuota(context.Background(), "", 100, 0); err != nil {
+		t.Errorf("SetQuota() global error = %v", err)
+	}
+	if err := s.SetQuota(context.Background(), "camera-1", 0, 5); err != nil {
+		t.Errorf("SetQuota() owner error = %v", err)
+	}
+	if err := s.SetQuota(context.Background(), "camera-1", -1, 0); err == nil {
+		t.Errorf("SetQuota() negative limit error = %v, wantErr %v", err, true)
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// DefaultRecoveryGracePeriod is the time a file is left pending or deleting before its operation is considered abandoned
+const DefaultRecoveryGracePeriod = time.Hour
+
+// RecoveryReport represents the result of completing or rolling back the uploads and deletions left unfinished
+type RecoveryReport struct {
+	ActivatedFiles  int `json:"activated_files"`
+	RolledBackFiles int `json:"rolled_back_files"`
+	DeletedFiles    int `json:"deleted_files"`
+	// SkippedFiles counts the files which entered their status within the grace period, they may still be handled by another instance
+	SkippedFiles int      `json:"skipped_files"`
+	FailedFiles  []string `json:"failed_files"`
+}
+
+// Recover finishes the operations interrupted by a crash. Only the files pending or deleting for longer than gracePeriod
+// are considered abandoned, so the uploads and deletions in progress on the other instances sharing the storage are left alone.
+// A pending file is activated when its blob was committed, otherwise it is rolled back. A deleting file is always removed.
+func (s service) Recover(ctx context.Context, gracePeriod time.Duration) (RecoveryReport, error) {
+	report := RecoveryReport{
+		FailedFiles: make([]string, 0),
+	}
+	before := time.Now().Add(-gracePeriod)
+
+	pendingFiles, err := s.dbStore.GetFilesByStatus(ctx, filesDBStore.FileStatusPending)
+	if err != nil {
+		return report, fmt.Errorf("failed to get pending files from DB, err: %v", err)
+	}
+	for _, file := range pendingFiles {
+		if !file.StatusChangedAt.Before(before) {
+			report.SkippedFiles++
+			continue
+		}
+		info, err := s.blobStore.Stat(ctx, blobKey(file))
+		if err != nil && !errors.Is(err, filesBlobStore.ErrorNotFound) {
+			report.FailedFiles = append(report.FailedFiles, file.ID)
+			continue
+		}
+		if err == nil && info.Size == file.Size {
+			if err := s.dbStore.SetFileStatus(ctx, file.ID, filesDBStore.FileStatusPending, filesDBStore.FileStatusActive); err != nil {
+				report.FailedFiles = append(report.FailedFiles, file.ID)
+				continue
+			}
+			report.ActivatedFiles++
+			continue
+		}
+		if err := s.removeFile(ctx, file.ID); err != nil {
+			report.FailedFiles = append(report.FailedFiles, file.ID)
+			continue
+		}
+		report.RolledBackFiles++
+	}
+
+	deletingFiles, err := s.dbStore.GetFilesByStatus(ctx, filesDBStore.FileStatusDeleting)
+	if err != nil {
+		return report, fmt.Errorf("failed to get deleting files from DB, err: %v", err)
+	}
+	for _, file := range deletingFiles {
+		if !file.StatusChangedAt.Before(before) {
+			report.SkippedFiles++
+			continue
+		}
+		if err := s.removeFile(ctx, file.ID); err != nil {
+			report.FailedFiles = append(report.FailedFiles, file.ID)
+			continue
+		}
+		report.DeletedFiles++
+	}
+	return report, nil
+}
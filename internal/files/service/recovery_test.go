@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_Recover(t *testing.T) {
+	ctx := context.Background()
+	abandonedAt, inProgressAt := time.Now().Add(-2*time.Hour), time.Now().Add(-time.Minute)
+	committed := dbstore.FileDetail{ID: "committed.mp4", Size: 13, Digest: sampleDigest, Status: dbstore.FileStatusPending, StatusChangedAt: abandonedAt}
+	uncommitted := dbstore.FileDetail{ID: "uncommitted.mp4", Size: 13, Status: dbstore.FileStatusPending, StatusChangedAt: abandonedAt}
+	truncated := dbstore.FileDetail{ID: "truncated.mp4", Size: 13, Status: dbstore.FileStatusPending, StatusChangedAt: abandonedAt}
+	deleting := dbstore.FileDetail{ID: "deleting.mp4", Size: 8, Status: dbstore.FileStatusDeleting, StatusChangedAt: abandonedAt}
+
+	tests := []struct {
+		name        string
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		want        RecoveryReport
+		wantErr     bool
+		wantBlobs   []string
+		wantMissing []string
+	}{
+		{
+			name: "successfully finish the interrupted operations",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return([]dbstore.FileDetail{committed, uncommitted, truncated}, nil)
+				mockDBStore.EXPECT().SetFileStatus(ctx, "committed.mp4", dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(ctx, "uncommitted.mp4", gomock.Any()).DoAndReturn(deleteWithBlobFunc(uncommitted, 0))
+				mockDBStore.EXPECT().DeleteFileByID(ctx, "truncated.mp4", gomock.Any()).DoAndReturn(deleteWithBlobFunc(truncated, 0))
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusDeleting).Return([]dbstore.FileDetail{deleting}, nil)
+				mockDBStore.EXPECT().DeleteFileByID(ctx, "deleting.mp4", gomock.Any()).DoAndReturn(deleteWithBlobFunc(deleting, 0))
+			},
+			want: RecoveryReport{
+				ActivatedFiles:  1,
+				RolledBackFiles: 2,
+				DeletedFiles:    1,
+				FailedFiles:     []string{},
+			},
+			wantErr:     false,
+			wantBlobs:   []string{sampleDigest},
+			wantMissing: []string{"truncated.mp4", "deleting.mp4"},
+		},
+		{
+			name: "failed operations are reported and the rest is recovered",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return([]dbstore.FileDetail{committed, uncommitted}, nil)
+				mockDBStore.EXPECT().SetFileStatus(ctx, "committed.mp4", dbstore.FileStatusPending, dbstore.FileStatusActive).Return(errors.New("some-error"))
+				mockDBStore.EXPECT().DeleteFileByID(ctx, "uncommitted.mp4", gomock.Any()).DoAndReturn(deleteWithBlobFunc(uncommitted, 0))
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusDeleting).Return([]dbstore.FileDetail{deleting}, nil)
+				mockDBStore.EXPECT().DeleteFileByID(ctx, "deleting.mp4", gomock.Any()).Return(dbstore.FileDetail{}, errors.New("some-error"))
+			},
+			want: RecoveryReport{
+				RolledBackFiles: 1,
+				FailedFiles:     []string{"committed.mp4", "deleting.mp4"},
+			},
+			wantErr:   false,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "deleting.mp4"},
+		},
+		{
+			name: "files pending or deleting within the grace period are left to the instance handling them",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				pending, deletingNow := truncated, deleting
+				pending.StatusChangedAt, deletingNow.StatusChangedAt = inProgressAt, inProgressAt
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return([]dbstore.FileDetail{pending}, nil)
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusDeleting).Return([]dbstore.FileDetail{deletingNow}, nil)
+			},
+			want: RecoveryReport{
+				SkippedFiles: 2,
+				FailedFiles:  []string{},
+			},
+			wantErr:   false,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "deleting.mp4"},
+		},
+		{
+			name: "failed to get the pending files from DB",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFilesByStatus(ctx, dbstore.FileStatusPending).Return(nil, errors.New("some-error"))
+			},
+			want: RecoveryReport{
+				FailedFiles: []string{},
+			},
+			wantErr:   true,
+			wantBlobs: []string{sampleDigest, "truncated.mp4", "deleting.mp4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = blobStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+			_, _ = blobStore.Put(ctx, "truncated.mp4", strings.NewReader("trunc"))
+			_, _ = blobStore.Put(ctx, "deleting.mp4", strings.NewReader("deleting"))
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: blobStore,
+			}
+			got, err := s.Recover(ctx, time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Recover() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Recover() got = %+v, want %+v", got, tt.want)
+			}
+			for _, key := range tt.wantBlobs {
+				if _, err := blobStore.Stat(ctx, key); err != nil {
+					t.Errorf("Recover() blob %s err = %v", key, err)
+				}
+			}
+			for _, key := range tt.wantMissing {
+				if _, err := blobStore.Stat(ctx, key); !errors.Is(err, blobstore.ErrorNotFound) {
+					t.Errorf("Recover() blob %s err = %v, want %v", key, err, blobstore.ErrorNotFound)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// Errors represent custom error that will be verified by the caller
+var (
+	ErrorReplicationUnsupported = fmt.Errorf("blob storage does not keep replicas")
+)
+
+// ReplicaInfo represents the state of a copy of the file content
+type ReplicaInfo struct {
+	Replica string `json:"replica"`
+	State   string `json:"state"`
+}
+
+// ResyncReport represents the result of restoring the missing and mismatched replicas
+type ResyncReport struct {
+	CheckedBlobs     int      `json:"checked_blobs"`
+	RestoredReplicas int      `json:"restored_replicas"`
+	FailedFiles      []string `json:"failed_files"`
+}
+
+// ResyncReplicas restores the missing and mismatched replicas of every file listed on the DB from a healthy copy,
+// including the trashed files which can still be restored.
+// Blobs which are not referenced by any file are left untouched, so deleted files are never resurrected.
+func (s service) ResyncReplicas(ctx context.Context) (ResyncReport, error) {
+	report := ResyncReport{
+		FailedFiles: make([]string, 0),
+	}
+
+	replicator, ok := s.blobStore.(filesBlobStore.Replicator)
+	if !ok {
+		return report, ErrorReplicationUnsupported
+	}
+
+	files, err := s.dbStore.GetAllFiles(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get all files from DB, err: %v", err)
+	}
+	trashed, err := s.dbStore.GetTrashedFiles(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to get trashed files from DB, err: %v", err)
+	}
+	files = append(files, trashed...)
+	checked := make(map[string]bool)
+	for _, file := range files {
+		key := blobKey(file)
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		report.CheckedBlobs++
+
+		restored, err := replicator.Repair(ctx, key, file.Size)
+		report.RestoredReplicas += restored
+		if err != nil {
+			report.FailedFiles = append(report.FailedFiles, file.ID)
+		}
+	}
+	return report, nil
+}
+
+// replicaInfos returns the state of the replicas of the file content, or nil when the blob storage keeps a single copy
+func (s service) replicaInfos(ctx context.Context, key string, size int64) ([]ReplicaInfo, error) {
+	replicator, ok := s.blobStore.(filesBlobStore.Replicator)
+	if !ok {
+		return nil, nil
+	}
+	states, err := replicator.ReplicaStates(ctx, key, size)
+	// the wrapping blob storages report no state when the blob is not kept by a replicated store
+	if err != nil || states == nil {
+		return nil, err
+	}
+	result := make([]ReplicaInfo, 0, len(states))
+	for _, state := range states {
+		result = append(result, ReplicaInfo{
+			Replica: state.Replica,
+			State:   state.State,
+		})
+	}
+	return result, nil
+}
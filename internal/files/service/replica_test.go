@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mirrorstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func newTestMirrorStore(t *testing.T) (blobstore.BlobStore, []mirrorstore.Replica) {
+	replicas := make([]mirrorstore.Replica, 0)
+	for _, name := range []string{"disk1", "disk2"} {
+		store, err := localstore.NewLocalStore(filepath.Join(t.TempDir(), name), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, mirrorstore.Replica{Name: name, Store: store})
+	}
+	store, err := mirrorstore.NewMirrorStore(replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, replicas
+}
+
+func Test_service_GetAllFiles_replicas(t *testing.T) {
+	ctx := context.Background()
+	mirrorStore, replicas := newTestMirrorStore(t)
+	_, _ = mirrorStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	_ = replicas[1].Store.Delete(ctx, sampleDigest)
+
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{
+		{ID: "sample.mp4", FileID: "sample.mp4", Version: 1, Name: "sample.mp4", Size: 13, Digest: sampleDigest},
+	}, nil)
+
+	s := service{
+		dbStore:   mockDBStore,
+		blobStore: mirrorStore,
+	}
+	got, err := s.GetAllFiles(ctx)
+	if err != nil {
+		t.Fatalf("GetAllFiles() error = %v", err)
+	}
+	want := []FileInfo{
+		{
+			FileID:  "sample.mp4",
+			Version: 1,
+			Name:    "sample.mp4",
+			Size:    13,
+			Replicas: []ReplicaInfo{
+				{Replica: "disk1", State: blobstore.ReplicaStateHealthy},
+				{Replica: "disk2", State: blobstore.ReplicaStateMissing},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllFiles() got = %v, want %v", got, want)
+	}
+}
+
+func Test_service_ResyncReplicas(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		blobStore func(t *testing.T) blobstore.BlobStore
+		mockFunc  func(mockDBStore *dbStoreMocks.MockDBStore)
+		want      ResyncReport
+		wantErr   bool
+	}{
+		{
+			name: "successfully restore the missing replicas of referenced blobs",
+			blobStore: func(t *testing.T) blobstore.BlobStore {
+				mirrorStore, replicas := newTestMirrorStore(t)
+				_, _ = mirrorStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+				_ = replicas[0].Store.Delete(ctx, sampleDigest)
+				_, _ = mirrorStore.Put(ctx, "trashed.mp4", strings.NewReader("trashed"))
+				_ = replicas[1].Store.Delete(ctx, "trashed.mp4")
+				// not referenced by any file, so it must not be copied
+				_, _ = replicas[0].Store.Put(ctx, "orphan.mp4", strings.NewReader("orphan"))
+				return mirrorStore
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{
+					{ID: "sample.mp4", Size: 13, Digest: sampleDigest},
+					{ID: "copy.mp4", Size: 13, Digest: sampleDigest},
+					{ID: "missing.mp4", Size: 7},
+				}, nil)
+				mockDBStore.EXPECT().GetTrashedFiles(ctx).Return([]dbstore.FileDetail{
+					{ID: "trashed.mp4", Size: 7, Status: dbstore.FileStatusTrashed},
+				}, nil)
+			},
+			want: ResyncReport{
+				CheckedBlobs:     3,
+				RestoredReplicas: 2,
+				FailedFiles:      []string{"missing.mp4"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to get trashed files",
+			blobStore: func(t *testing.T) blobstore.BlobStore {
+				mirrorStore, _ := newTestMirrorStore(t)
+				return mirrorStore
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().GetTrashedFiles(ctx).Return(nil, errors.New("db error"))
+			},
+			want: ResyncReport{
+				FailedFiles: []string{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "blob storage does not keep replicas",
+			blobStore: func(t *testing.T) blobstore.BlobStore {
+				return memstore.NewMemoryStore()
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want: ResyncReport{
+				FailedFiles: []string{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: tt.blobStore(t),
+			}
+			got, err := s.ResyncReplicas(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResyncReplicas() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResyncReplicas() got = %v, want %v", got, tt.want)
+			}
+			if mirrorStore, ok := s.blobStore.(blobstore.Replicator); ok {
+				states, _ := mirrorStore.ReplicaStates(ctx, "orphan.mp4", 6)
+				if states[1].State != blobstore.ReplicaStateMissing {
+					t.Errorf("ResyncReplicas() orphan blob is copied")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"sync"
+)
+
+// reservations keeps the ids of the files being uploaded by this instance,
+// so a concurrent upload of the same id is rejected before its content is streamed
+type reservations struct {
+	mu sync.Mutex
+	// ids keeps the number of holders sharing each id, or exclusive when it is reserved
+	ids map[string]int
+}
+
+// exclusive marks an id reserved by a single holder
+const exclusive = -1
+
+func newReservations() *reservations {
+	return &reservations{
+		ids: make(map[string]int),
+	}
+}
+
+// reserve reserves the id until the returned func is called, false is returned when the id is already reserved or shared
+func (r *reservations) reserve(id string) (func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.ids[id]; ok {
+		return nil, false
+	}
+	r.ids[id] = exclusive
+	return func() {
+		r.mu.Lock()
+		delete(r.ids, id)
+		r.mu.Unlock()
+	}, true
+}
+
+// share shares the id with its other holders until the returned func is called, so the id cannot be reserved meanwhile.
+// False is returned when the id is already reserved.
+func (r *reservations) share(id string) (func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ids[id] == exclusive {
+		return nil, false
+	}
+	r.ids[id]++
+	return func() {
+		r.mu.Lock()
+		if r.ids[id]--; r.ids[id] == 0 {
+			delete(r.ids, id)
+		}
+		r.mu.Unlock()
+	}, true
+}
@@ -0,0 +1,526 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_reservations(t *testing.T) {
+	r := newReservations()
+
+	release, ok := r.reserve("test.mp4")
+	if !ok {
+		t.Fatalf("reserve() ok = %v, want %v", ok, true)
+	}
+	if _, ok := r.reserve("test.mp4"); ok {
+		t.Errorf("reserve() of a reserved id ok = %v, want %v", ok, false)
+	}
+	if _, ok := r.reserve("other.mp4"); !ok {
+		t.Errorf("reserve() of another id ok = %v, want %v", ok, true)
+	}
+	release()
+	if _, ok := r.reserve("test.mp4"); !ok {
+		t.Errorf("reserve() of a released id ok = %v, want %v", ok, true)
+	}
+}
+
+func Test_reservations_share(t *testing.T) {
+	r := newReservations()
+
+	release, ok := r.share("upload-id")
+	if !ok {
+		t.Fatalf("share() ok = %v, want %v", ok, true)
+	}
+	releaseOther, ok := r.share("upload-id")
+	if !ok {
+		t.Fatalf("share() of a shared id ok = %v, want %v", ok, true)
+	}
+	if _, ok := r.reserve("upload-id"); ok {
+		t.Errorf("reserve() of a shared id ok = %v, want %v", ok, false)
+	}
+	release()
+	if _, ok := r.reserve("upload-id"); ok {
+		t.Errorf("reserve() of an id still shared ok = %v, want %v", ok, false)
+	}
+	releaseOther()
+	releaseReserved, ok := r.reserve("upload-id")
+	if !ok {
+		t.Fatalf("reserve() of an id no longer shared ok = %v, want %v", ok, true)
+	}
+	if _, ok := r.share("upload-id"); ok {
+		t.Errorf("share() of a reserved id ok = %v, want %v", ok, false)
+	}
+	releaseReserved()
+	if _, ok := r.share("upload-id"); !ok {
+		t.Errorf("share() of a released id ok = %v, want %v", ok, true)
+	}
+}
+
+// fakeFilesTable mimics the unique keys and the versioning of the files table, it is safe for concurrent use
+type fakeFilesTable struct {
+	mu    sync.Mutex
+	files map[string]dbstore.FileDetail
+	refs  map[string]int64
+	// beforeGetVersions is called, when set, before the versions of a file are listed
+	beforeGetVersions func()
+}
+
+func newFakeFilesTable(mockDBStore *dbStoreMocks.MockDBStore, files ...dbstore.FileDetail) *fakeFilesTable {
+	table := &fakeFilesTable{
+		files: make(map[string]dbstore.FileDetail),
+		refs:  make(map[string]int64),
+	}
+	for _, file := range files {
+		table.files[file.ID] = file
+		table.refs[file.Digest]++
+	}
+	mockDBStore.EXPECT().GetUsage(gomock.Any(), gomock.Any()).Return(dbstore.Usage{}, nil).AnyTimes()
+	mockDBStore.EXPECT().InsertNewFile(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(table.insert).AnyTimes()
+	mockDBStore.EXPECT().SetFileStatus(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(table.setStatus).AnyTimes()
+	mockDBStore.EXPECT().DeleteFileByID(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(table.delete).AnyTimes()
+	mockDBStore.EXPECT().GetFileByID(gomock.Any(), gomock.Any()).DoAndReturn(table.getByID).AnyTimes()
+	mockDBStore.EXPECT().GetFileByName(gomock.Any(), gomock.Any()).DoAndReturn(table.getByName).AnyTimes()
+	mockDBStore.EXPECT().GetFileVersions(gomock.Any(), gomock.Any()).DoAndReturn(table.getVersions).AnyTimes()
+	mockDBStore.EXPECT().GetTrashedFileVersions(gomock.Any(), gomock.Any()).DoAndReturn(table.getTrashedVersions).AnyTimes()
+	return table
+}
+
+func (f *fakeFilesTable) insert(ctx context.Context, file dbstore.FileDetail, blobFunc dbstore.BlobFunc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if file.FileID == "" {
+		file.FileID, file.Version = file.ID, 1
+	}
+	if file.Version == 0 {
+		file.Version = 1
+		if latest, ok := f.latest(func(stored dbstore.FileDetail) bool { return stored.FileID == file.FileID }); ok {
+			file.Version = latest.Version + 1
+		}
+	}
+	for _, stored := range f.files {
+		if stored.ID == file.ID || (stored.FileID == file.FileID && stored.Version == file.Version) {
+			return &pq.Error{Code: "23505"}
+		}
+	}
+	if err := blobFunc(ctx, file, f.refs[file.Digest]+1); err != nil {
+		return err
+	}
+	f.files[file.ID] = file
+	f.refs[file.Digest]++
+	return nil
+}
+
+// latest returns the latest active version of the files matching the filter
+func (f *fakeFilesTable) latest(filter func(stored dbstore.FileDetail) bool) (dbstore.FileDetail, bool) {
+	var (
+		latest dbstore.FileDetail
+		found  bool
+	)
+	for _, stored := range f.files {
+		if stored.Status == dbstore.FileStatusActive && filter(stored) && (!found || stored.Version > latest.Version) {
+			latest, found = stored, true
+		}
+	}
+	return latest, found
+}
+
+func (f *fakeFilesTable) getByID(_ context.Context, id string) (dbstore.FileDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	latest, ok := f.latest(func(stored dbstore.FileDetail) bool { return stored.FileID == id })
+	if !ok {
+		return dbstore.FileDetail{}, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+func (f *fakeFilesTable) getByName(_ context.Context, name string) (dbstore.FileDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	latest, ok := f.latest(func(stored dbstore.FileDetail) bool { return stored.Name == name })
+	if !ok {
+		return dbstore.FileDetail{}, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+func (f *fakeFilesTable) getVersions(_ context.Context, fileID string) ([]dbstore.FileDetail, error) {
+	if f.beforeGetVersions != nil {
+		f.beforeGetVersions()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	versions := make([]dbstore.FileDetail, 0)
+	for _, stored := range f.files {
+		if stored.FileID == fileID && stored.Status == dbstore.FileStatusActive {
+			versions = append(versions, stored)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+func (f *fakeFilesTable) getTrashedVersions(_ context.Context, fileID string) ([]dbstore.FileDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	trashed := make([]dbstore.FileDetail, 0)
+	for _, stored := range f.files {
+		if stored.FileID == fileID && stored.Status == dbstore.FileStatusTrashed {
+			trashed = append(trashed, stored)
+		}
+	}
+	return trashed, nil
+}
+
+func (f *fakeFilesTable) setStatus(_ context.Context, id, from, to string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[id]
+	if !ok || file.Status != from {
+		return sql.ErrNoRows
+	}
+	file.Status = to
+	f.files[id] = file
+	return nil
+}
+
+func (f *fakeFilesTable) delete(ctx context.Context, id string, blobFunc dbstore.BlobFunc) (dbstore.FileDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[id]
+	if !ok {
+		return dbstore.FileDetail{}, sql.ErrNoRows
+	}
+	if err := blobFunc(ctx, file, f.refs[file.Digest]-1); err != nil {
+		return dbstore.FileDetail{}, err
+	}
+	delete(f.files, id)
+	f.refs[file.Digest]--
+	return file, nil
+}
+
+// raceUploads runs the uploads of different contents concurrently and returns the contents of the successful uploads,
+// upload is called with the index of the upload and only fails with ErrorDuplicateKey or ErrorFileExists
+func raceUploads(t *testing.T, uploads int, upload func(i int, file io.Reader) error) []string {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded []string
+	)
+	start := make(chan struct{})
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := fmt.Sprintf("content of upload %d", i)
+			<-start
+			err := upload(i, strings.NewReader(content))
+			if err != nil && !errors.Is(err, ErrorDuplicateKey) && !errors.Is(err, ErrorFileExists) {
+				t.Errorf("UploadFile() error = %v, want nil, %v or %v", err, ErrorDuplicateKey, ErrorFileExists)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				succeeded = append(succeeded, content)
+				mu.Unlock()
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return succeeded
+}
+
+// storedContents returns the contents of all blobs on the store
+func storedContents(t *testing.T, blobStore blobstore.BlobStore) []string {
+	ctx := context.Background()
+	blobs, err := blobStore.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		content, err := blobStore.Get(ctx, blob.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentBytes, _ := io.ReadAll(content)
+		_ = content.Close()
+		contents = append(contents, string(contentBytes))
+	}
+	return contents
+}
+
+func Test_service_PutFile_concurrentUploadsOfSameID(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances int
+	}{
+		{
+			name:      "uploads to a single instance",
+			instances: 1,
+		},
+		{
+			name:      "uploads spread over several instances sharing the storage",
+			instances: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			table := newFakeFilesTable(mockDBStore)
+
+			blobStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			services := make([]Service, 0, tt.instances)
+			for i := 0; i < tt.instances; i++ {
+				services = append(services, New(mockDBStore, blobStore))
+			}
+
+			succeeded := raceUploads(t, 50, func(i int, file io.Reader) error {
+				_, err := services[i%len(services)].PutFile(context.Background(), file, "localhost", "race.mp4", "video/mp4", "", time.Time{}, true)
+				return err
+			})
+			if len(succeeded) != 1 {
+				t.Fatalf("PutFile() succeeded uploads = %d, want 1", len(succeeded))
+			}
+			contents := storedContents(t, blobStore)
+			if len(contents) != 1 || contents[0] != succeeded[0] {
+				t.Errorf("PutFile() stored contents = %v, want %v", contents, succeeded)
+			}
+			if len(table.files) != 1 {
+				t.Fatalf("PutFile() stored files = %+v, want 1", table.files)
+			}
+			for _, file := range table.files {
+				if file.FileID != "race.mp4" || file.Status != dbstore.FileStatusActive || file.Size != int64(len(succeeded[0])) {
+					t.Errorf("PutFile() stored file = %+v", file)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_PutFile_concurrentUploadsOfExistingID(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+	blobStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = blobStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	newFakeFilesTable(mockDBStore, dbstore.FileDetail{ID: "existing-id", FileID: "race.mp4", Version: 1, Name: "race.mp4", Size: 13, Digest: sampleDigest, Status: dbstore.FileStatusActive})
+
+	s := New(mockDBStore, blobStore)
+	succeeded := raceUploads(t, 50, func(_ int, file io.Reader) error {
+		_, err := s.PutFile(ctx, file, "localhost", "race.mp4", "video/mp4", "", time.Time{}, true)
+		return err
+	})
+	if len(succeeded) != 0 {
+		t.Errorf("PutFile() succeeded uploads = %v, want none", succeeded)
+	}
+	contents := storedContents(t, blobStore)
+	if len(contents) != 1 || contents[0] != "sample string" {
+		t.Errorf("PutFile() stored contents = %v, want %v", contents, []string{"sample string"})
+	}
+}
+
+func Test_service_PutFile_concurrentReplacementsOfSameID(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+	blobStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = blobStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	table := newFakeFilesTable(mockDBStore, dbstore.FileDetail{ID: "existing-id", FileID: "race.mp4", Version: 1, Name: "race.mp4", Size: 13, Digest: sampleDigest, Status: dbstore.FileStatusActive})
+	// both replacements are stored before any of them removes the versions it replaces
+	var stored sync.WaitGroup
+	stored.Add(2)
+	table.beforeGetVersions = func() {
+		stored.Done()
+		stored.Wait()
+	}
+
+	// the replacements go to different instances, so they are not serialized by the reservation of the id
+	services := []Service{New(mockDBStore, blobStore), New(mockDBStore, blobStore)}
+	succeeded := raceUploads(t, 2, func(i int, file io.Reader) error {
+		_, err := services[i].PutFile(ctx, file, "localhost", "race.mp4", "video/mp4", "", time.Time{}, false)
+		return err
+	})
+	if len(succeeded) != 2 {
+		t.Fatalf("PutFile() succeeded uploads = %d, want 2", len(succeeded))
+	}
+	if len(table.files) != 1 {
+		t.Fatalf("PutFile() stored versions = %+v, want 1", table.files)
+	}
+	for _, file := range table.files {
+		if file.FileID != "race.mp4" || file.Status != dbstore.FileStatusActive || file.Version != 3 {
+			t.Errorf("PutFile() stored file = %+v, want the version 3", file)
+		}
+		contents := storedContents(t, blobStore)
+		if len(contents) != 1 || int64(len(contents[0])) != file.Size {
+			t.Errorf("PutFile() stored contents = %v, want the content of %+v", contents, file)
+		}
+	}
+}
+
+func Test_service_UploadFile_concurrentVersionsOfSameName(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	table := newFakeFilesTable(mockDBStore)
+
+	blobStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without the reservation of the name, the uploads racing for a new name would each create a file of that name
+	s := New(mockDBStore, blobStore, WithVersioning())
+	succeeded := raceUploads(t, 50, func(_ int, file io.Reader) error {
+		_, err := s.UploadFile(ctx, file, "localhost", "race.mp4", "", time.Time{})
+		return err
+	})
+	if len(succeeded) == 0 || len(table.files) != len(succeeded) {
+		t.Fatalf("UploadFile() succeeded uploads = %d, stored files = %d", len(succeeded), len(table.files))
+	}
+	fileIDs, versions := make(map[string]bool), make(map[int]bool)
+	for _, file := range table.files {
+		fileIDs[file.FileID] = true
+		versions[file.Version] = true
+	}
+	if len(fileIDs) != 1 || len(versions) != len(succeeded) {
+		t.Errorf("UploadFile() stored files = %+v, want versions of a single file", table.files)
+	}
+}
+
+func Test_service_UploadFile_concurrentUploadsOfSameName(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+	blobStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = blobStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	// a file uploaded before the ids were generated is addressed by its name
+	table := newFakeFilesTable(mockDBStore, dbstore.FileDetail{ID: "race.mp4", Name: "race.mp4", Size: 13, Digest: sampleDigest, Status: dbstore.FileStatusActive})
+
+	s := New(mockDBStore, blobStore)
+	var (
+		mu        sync.Mutex
+		locations = make(map[string]bool)
+	)
+	succeeded := raceUploads(t, 50, func(_ int, file io.Reader) error {
+		location, err := s.UploadFile(ctx, file, "localhost", "race.mp4", "", time.Time{})
+		mu.Lock()
+		locations[location] = true
+		mu.Unlock()
+		return err
+	})
+	if len(succeeded) != 50 || len(locations) != 50 {
+		t.Fatalf("UploadFile() succeeded uploads = %d, locations = %d, want 50", len(succeeded), len(locations))
+	}
+	if contents := storedContents(t, blobStore); len(contents) != 51 {
+		t.Errorf("UploadFile() stored contents = %d, want 51", len(contents))
+	}
+	for id, file := range table.files {
+		if file.Name != "race.mp4" || file.Status != dbstore.FileStatusActive {
+			t.Errorf("UploadFile() stored file = %+v", file)
+		}
+		if id != "race.mp4" && !locations["localhost/v1/files/"+id] {
+			t.Errorf("UploadFile() stored file %s not returned as location", id)
+		}
+	}
+}
+
+// countingBlobStore counts the commits of the staged blobs of the wrapped store, which are slowed down
+type countingBlobStore struct {
+	blobstore.BlobStore
+	mu      sync.Mutex
+	commits map[string]int
+}
+
+type countingStagedBlob struct {
+	blobstore.StagedBlob
+	store *countingBlobStore
+}
+
+func (c *countingBlobStore) Stage(ctx context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	staged, err := c.BlobStore.Stage(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return countingStagedBlob{StagedBlob: staged, store: c}, nil
+}
+
+func (c countingStagedBlob) Commit(ctx context.Context, key string) error {
+	c.store.mu.Lock()
+	c.store.commits[key]++
+	c.store.mu.Unlock()
+	// a slow commit widens the window for concurrent commits of the same digest
+	time.Sleep(10 * time.Millisecond)
+	return c.StagedBlob.Commit(ctx, key)
+}
+
+func Test_service_UploadFile_concurrentUploadsOfSameContent(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	table := newFakeFilesTable(mockDBStore)
+
+	localStore, err := localstore.NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobStore := &countingBlobStore{BlobStore: localStore, commits: make(map[string]int)}
+
+	// the blob is committed while its blob record is locked, so only the first of the identical uploads commits it
+	s := New(mockDBStore, blobStore)
+	succeeded := raceUploads(t, 50, func(_ int, _ io.Reader) error {
+		_, err := s.UploadFile(ctx, strings.NewReader("sample string"), "localhost", "race.mp4", "", time.Time{})
+		return err
+	})
+	if len(succeeded) != 50 || len(table.files) != 50 {
+		t.Fatalf("UploadFile() succeeded uploads = %d, stored files = %d, want 50", len(succeeded), len(table.files))
+	}
+	if len(blobStore.commits) != 1 || blobStore.commits[sampleDigest] != 1 {
+		t.Errorf("UploadFile() commits = %v, want a single commit of %s", blobStore.commits, sampleDigest)
+	}
+	if contents := storedContents(t, blobStore); len(contents) != 1 || contents[0] != "sample string" {
+		t.Errorf("UploadFile() stored contents = %v, want %v", contents, []string{"sample string"})
+	}
+}
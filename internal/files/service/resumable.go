@@ -0,0 +1,391 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// Errors represent custom error that will be verified by the handler layer
+var (
+	ErrorResumableUploadsDisabled = errors.New("resumable uploads are disabled")
+	ErrorInvalidUploadLength      = errors.New("invalid upload length")
+	ErrorUploadOffsetMismatch     = errors.New("upload offset mismatch")
+	ErrorUploadLengthExceeded     = errors.New("upload length exceeded")
+	ErrorUploadLocked             = errors.New("upload is being written")
+	ErrorUploadExpired            = errors.New("upload expired")
+	ErrorUnsupportedChecksum      = errors.New("unsupported checksum algorithm")
+	ErrorChecksumMismatch         = errors.New("checksum mismatch")
+)
+
+// DefaultUploadExpiry is how long a resumable upload is kept without receiving any chunk before it is aborted
+const DefaultUploadExpiry = 24 * time.Hour
+
+// checksumHashes are the hashes of the checksum algorithms supported by the resumable uploads
+var checksumHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// UploadInfo represents the state of a resumable upload
+type UploadInfo struct {
+	ID       string
+	Length   int64
+	Offset   int64
+	Metadata string
+	// ExpiresAt is when the upload is aborted unless it receives another chunk, every chunk pushes it back
+	ExpiresAt time.Time
+	// Location is only set once the upload is complete, it is the location of the uploaded file
+	Location string
+}
+
+// Checksum represents the checksum of a chunk of a resumable upload, the zero value means the chunk has none
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// WithResumableUploads enables the resumable uploads, the content they received so far is kept under dir
+func WithResumableUploads(dir string) Option {
+	return func(s *service) {
+		s.uploadsDir = dir
+	}
+}
+
+// WithUploadExpiry aborts the resumable uploads which received no chunk for expiry, DefaultUploadExpiry is used otherwise
+func WithUploadExpiry(expiry time.Duration) Option {
+	return func(s *service) {
+		s.uploadExpiry = expiry
+	}
+}
+
+// UploadCleanupReport represents the result of aborting the expired resumable uploads
+type UploadCleanupReport struct {
+	AbortedUploads int      `json:"aborted_uploads"`
+	FailedUploads  []string `json:"failed_uploads"`
+}
+
+// ChecksumAlgorithms returns the checksum algorithms supported by the resumable uploads, sorted by name
+func ChecksumAlgorithms() []string {
+	algorithms := make([]string, 0, len(checksumHashes))
+	for algorithm := range checksumHashes {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// CreateUpload starts a resumable upload of a file with specified name and length, its content is then sent with WriteUpload.
+// The upload is refused right away when the file could not be stored once complete.
+func (s service) CreateUpload(ctx context.Context, name fileid.ID, owner string, length int64, metadata string) (UploadInfo, error) {
+	if s.uploadsDir == "" {
+		return UploadInfo{}, ErrorResumableUploadsDisabled
+	}
+	if length <= 0 {
+		return UploadInfo{}, fmt.Errorf("%w: %d", ErrorInvalidUploadLength, length)
+	}
+	if !slices.Contains(allowedExtensions, filepath.Ext(name.String())) {
+		return UploadInfo{}, ErrorUnsupportedFileTypes
+	}
+	if err := s.checkFreeSpace(ctx); err != nil {
+		return UploadInfo{}, err
+	}
+	remaining, err := s.remainingQuota(ctx, owner)
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	if remaining >= 0 && length > remaining {
+		return UploadInfo{}, ErrorQuotaExceeded
+	}
+
+	upload := filesDBStore.Upload{
+		ID:        s.newID(),
+		Name:      name.String(),
+		Owner:     owner,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(s.uploadExpiry),
+	}
+	if err := os.MkdirAll(s.uploadsDir, os.ModePerm); err != nil {
+		return UploadInfo{}, fmt.Errorf("failed to create directory: %s, err: %v", s.uploadsDir, err)
+	}
+	content, err := os.OpenFile(s.uploadPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return UploadInfo{}, fmt.Errorf("failed to create upload content, err: %v", err)
+	}
+	_ = content.Close()
+
+	if err := s.dbStore.InsertUpload(ctx, upload); err != nil {
+		_ = os.Remove(s.uploadPath(upload.ID))
+		return UploadInfo{}, fmt.Errorf("failed to insert upload to DB, err: %v", err)
+	}
+	return mapUploadToUploadInfo(upload), nil
+}
+
+// GetUpload returns the state of the resumable upload
+func (s service) GetUpload(ctx context.Context, id fileid.ID) (UploadInfo, error) {
+	upload, err := s.dbStore.GetUpload(ctx, id.String())
+	if err != nil {
+		return UploadInfo{}, fmt.Errorf("failed to get upload from DB, err: %w", err)
+	}
+	return mapUploadToUploadInfo(upload), nil
+}
+
+// WriteUpload appends the chunk to the content of the resumable upload, the chunk must start at the offset reached so far.
+// A chunk interrupted midway is kept up to where it was interrupted, unless it has a checksum which can no longer be verified.
+// A chunk failing its checksum or going past the length of the upload is discarded.
+// Once the whole content is received it is stored as a new file and the upload is removed, the location of the file is returned.
+// When storing the file fails the upload is kept complete, so it can be retried with an empty chunk or deleted.
+// An expired upload no longer accepts chunks, it is left to AbortExpiredUploads.
+func (s service) WriteUpload(ctx context.Context, id fileid.ID, host string, offset int64, chunk io.Reader, checksum Checksum) (UploadInfo, error) {
+	var newHash func() hash.Hash
+	if checksum.Algorithm != "" {
+		var ok bool
+		if newHash, ok = checksumHashes[checksum.Algorithm]; !ok {
+			return UploadInfo{}, fmt.Errorf("%w: %s", ErrorUnsupportedChecksum, checksum.Algorithm)
+		}
+	}
+
+	// the chunks of an upload are written one at a time, a concurrent chunk would write over the same offset
+	release, err := s.lockUpload(ctx, id.String())
+	if err != nil {
+		return UploadInfo{}, err
+	}
+	defer release()
+
+	upload, err := s.dbStore.GetUpload(ctx, id.String())
+	if err != nil {
+		return UploadInfo{}, fmt.Errorf("failed to get upload from DB, err: %w", err)
+	}
+	if !upload.ExpiresAt.IsZero() && upload.ExpiresAt.Before(time.Now()) {
+		return UploadInfo{}, ErrorUploadExpired
+	}
+	if offset != upload.Offset {
+		return mapUploadToUploadInfo(upload), fmt.Errorf("%w: got %d, the upload is at %d", ErrorUploadOffsetMismatch, offset, upload.Offset)
+	}
+
+	if upload.Offset < upload.Length {
+		written, writeErr := s.appendChunk(upload, chunk, newHash, checksum.Sum)
+		if written > 0 {
+			expiresAt := time.Now().Add(s.uploadExpiry)
+			if err := s.dbStore.SetUploadOffset(ctx, upload.ID, upload.Offset, upload.Offset+written, expiresAt); err != nil {
+				return mapUploadToUploadInfo(upload), fmt.Errorf("failed to update offset of upload, err: %w", err)
+			}
+			upload.Offset += written
+			upload.ExpiresAt = expiresAt
+		}
+		if writeErr != nil {
+			return mapUploadToUploadInfo(upload), writeErr
+		}
+	} else if readsMore(chunk) {
+		return mapUploadToUploadInfo(upload), ErrorUploadLengthExceeded
+	}
+
+	uploadInfo := mapUploadToUploadInfo(upload)
+	if upload.Offset < upload.Length {
+		return uploadInfo, nil
+	}
+	uploadInfo.Location, err = s.completeUpload(ctx, host, upload)
+	if err != nil {
+		return uploadInfo, err
+	}
+	return uploadInfo, nil
+}
+
+// appendChunk writes the chunk at the offset of the upload and returns the number of bytes kept
+func (s service) appendChunk(upload filesDBStore.Upload, chunk io.Reader, newHash func() hash.Hash, sum []byte) (int64, error) {
+	content, err := os.OpenFile(s.uploadPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload content, err: %v", err)
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	// the bytes written past the offset, e.g. by a write interrupted by a crash, were never acknowledged
+	if err := content.Truncate(upload.Offset); err != nil {
+		return 0, fmt.Errorf("failed to truncate upload content, err: %v", err)
+	}
+	if _, err := content.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek upload content, err: %v", err)
+	}
+
+	reader := io.LimitReader(chunk, upload.Length-upload.Offset)
+	var digest hash.Hash
+	if newHash != nil {
+		digest = newHash()
+		reader = io.TeeReader(reader, digest)
+	}
+	written, err := io.Copy(content, reader)
+	discard := false
+	switch {
+	case err != nil:
+		err = fmt.Errorf("failed to write upload content, err: %v", err)
+		discard = digest != nil
+	case written == upload.Length-upload.Offset && readsMore(chunk):
+		err = ErrorUploadLengthExceeded
+		discard = true
+	case digest != nil && !bytes.Equal(digest.Sum(nil), sum):
+		err = ErrorChecksumMismatch
+		discard = true
+	}
+	if discard {
+		written = 0
+		if truncateErr := content.Truncate(upload.Offset); truncateErr != nil {
+			return 0, fmt.Errorf("failed to discard chunk, err: %v", truncateErr)
+		}
+	}
+	if syncErr := content.Sync(); syncErr != nil {
+		return 0, fmt.Errorf("failed to write upload content, err: %v", syncErr)
+	}
+	return written, err
+}
+
+// completeUpload stores the received content as a new file, then removes the upload
+func (s service) completeUpload(ctx context.Context, host string, upload filesDBStore.Upload) (string, error) {
+	content, err := os.Open(s.uploadPath(upload.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to open upload content, err: %v", err)
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	record, release, err := s.newFileRecord(ctx, fileid.ID(upload.Name), upload.Owner, time.Time{})
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	location, err := s.uploadFile(ctx, content, host, record)
+	if err != nil {
+		return "", err
+	}
+	if err := s.removeUpload(ctx, upload.ID); err != nil {
+		log.Printf("failed to remove completed upload: %s, err: %v", upload.ID, err)
+	}
+	return location, nil
+}
+
+// DeleteUpload stops the resumable upload and removes the content it received
+func (s service) DeleteUpload(ctx context.Context, id fileid.ID) error {
+	release, err := s.lockUpload(ctx, id.String())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := s.removeUpload(ctx, id.String()); err != nil {
+		return fmt.Errorf("failed to delete upload, err: %w", err)
+	}
+	return nil
+}
+
+// AbortExpiredUploads aborts the resumable uploads which received no chunk before their expiry, they are left unfinished by their clients
+func (s service) AbortExpiredUploads(ctx context.Context) (UploadCleanupReport, error) {
+	report := UploadCleanupReport{
+		FailedUploads: make([]string, 0),
+	}
+
+	uploads, err := s.dbStore.GetExpiredUploads(ctx, time.Now())
+	if err != nil {
+		return report, fmt.Errorf("failed to get expired uploads from DB, err: %v", err)
+	}
+	for _, upload := range uploads {
+		// the uploads still being written are left for the next run, an expired upload accepts no more chunks
+		release, err := s.lockUpload(ctx, upload.ID)
+		if errors.Is(err, ErrorUploadLocked) {
+			continue
+		}
+		if err != nil {
+			report.FailedUploads = append(report.FailedUploads, upload.ID)
+			continue
+		}
+		err = s.removeUpload(ctx, upload.ID)
+		release()
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			report.FailedUploads = append(report.FailedUploads, upload.ID)
+			continue
+		}
+		report.AbortedUploads++
+	}
+	return report, nil
+}
+
+// lockUpload keeps the upload from being written or removed by anyone else until the returned func is called.
+// The upload is locked within this instance and then in the DB, so the instances sharing the uploads directory
+// never write the same content concurrently.
+func (s service) lockUpload(ctx context.Context, id string) (func(), error) {
+	release, ok := s.writes.reserve(id)
+	if !ok {
+		return nil, ErrorUploadLocked
+	}
+	unlock, err := s.dbStore.TryLock(ctx, "upload:"+id)
+	if errors.Is(err, filesDBStore.ErrorLocked) {
+		release()
+		return nil, ErrorUploadLocked
+	}
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to lock upload, err: %v", err)
+	}
+	return func() {
+		unlock()
+		release()
+	}, nil
+}
+
+// removeUpload removes the upload record and then its content
+func (s service) removeUpload(ctx context.Context, id string) error {
+	if err := s.dbStore.DeleteUpload(ctx, id); err != nil {
+		return err
+	}
+	err := os.Remove(s.uploadPath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// uploadPath returns the path of the content received by the upload
+func (s service) uploadPath(id string) string {
+	return filepath.Join(s.uploadsDir, id)
+}
+
+// readsMore reports whether the reader has at least one more byte to read
+func readsMore(r io.Reader) bool {
+	n, _ := io.ReadFull(r, make([]byte, 1))
+	return n > 0
+}
+
+func mapUploadToUploadInfo(upload filesDBStore.Upload) UploadInfo {
+	return UploadInfo{
+		ID:        upload.ID,
+		Length:    upload.Length,
+		Offset:    upload.Offset,
+		Metadata:  upload.Metadata,
+		ExpiresAt: upload.ExpiresAt,
+	}
+}
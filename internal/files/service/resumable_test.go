@@ -0,0 +1,629 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	want := []string{"md5", "sha1", "sha256", "sha512"}
+	if got := ChecksumAlgorithms(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChecksumAlgorithms() got = %v, want %v", got, want)
+	}
+}
+
+func Test_service_CreateUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		disabled    bool
+		filename    fileid.ID
+		length      int64
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		want        UploadInfo
+		wantErr     bool
+		wantContent bool
+	}{
+		{
+			name:     "successfully create an upload",
+			filename: "test.mp4",
+			length:   13,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertUpload(context.Background(), gomock.Any()).DoAndReturn(func(_ context.Context, upload dbstore.Upload) error {
+					if !expiresWithin(upload.ExpiresAt, time.Hour) {
+						return fmt.Errorf("unexpected expiry of the upload: %v", upload.ExpiresAt)
+					}
+					upload.ExpiresAt = time.Time{}
+					if want := (dbstore.Upload{ID: generatedID, Name: "test.mp4", Length: 13, Metadata: "filename dGVzdC5tcDQ="}); upload != want {
+						return fmt.Errorf("unexpected upload: %+v", upload)
+					}
+					return nil
+				})
+			},
+			want: UploadInfo{
+				ID:       generatedID,
+				Length:   13,
+				Metadata: "filename dGVzdC5tcDQ=",
+			},
+			wantErr:     false,
+			wantContent: true,
+		},
+		{
+			name:     "resumable uploads are disabled",
+			disabled: true,
+			filename: "test.mp4",
+			length:   13,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:    UploadInfo{},
+			wantErr: true,
+		},
+		{
+			name:     "empty upload",
+			filename: "test.mp4",
+			length:   0,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:    UploadInfo{},
+			wantErr: true,
+		},
+		{
+			name:     "unsupported file type",
+			filename: "test.txt",
+			length:   13,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:    UploadInfo{},
+			wantErr: true,
+		},
+		{
+			name:     "upload larger than the remaining quota",
+			filename: "test.mp4",
+			length:   13,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{UsedBytes: 90, Quota: dbstore.Quota{MaxBytes: 100}})
+			},
+			want:    UploadInfo{},
+			wantErr: true,
+		},
+		{
+			name:     "failed to insert the upload",
+			filename: "test.mp4",
+			length:   13,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertUpload(context.Background(), gomock.Any()).Return(sql.ErrConnDone)
+			},
+			want:    UploadInfo{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:      mockDBStore,
+				blobStore:    memstore.NewMemoryStore(),
+				newID:        fixedID,
+				uploadsDir:   filepath.Join(t.TempDir(), ".tus"),
+				uploadExpiry: time.Hour,
+			}
+			if tt.disabled {
+				s.uploadsDir = ""
+			}
+			got, err := s.CreateUpload(context.Background(), tt.filename, "", tt.length, "filename dGVzdC5tcDQ=")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !expiresWithin(got.ExpiresAt, time.Hour) {
+				t.Errorf("CreateUpload() got expiry = %v, want in %v", got.ExpiresAt, time.Hour)
+			}
+			got.ExpiresAt = time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateUpload() got = %v, want %v", got, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(s.uploadsDir, generatedID)); (err == nil) != tt.wantContent {
+				t.Errorf("CreateUpload() content of the upload exists = %v, want %v", err == nil, tt.wantContent)
+			}
+		})
+	}
+}
+
+func Test_service_GetUpload(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     UploadInfo
+		wantErr  error
+	}{
+		{
+			name: "successfully get the upload",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(dbstore.Upload{ID: "upload-id", Name: "test.mp4", Length: 13, Offset: 7, ExpiresAt: expiresAt}, nil)
+			},
+			want:    UploadInfo{ID: "upload-id", Length: 13, Offset: 7, ExpiresAt: expiresAt},
+			wantErr: nil,
+		},
+		{
+			name: "upload not found",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(dbstore.Upload{}, sql.ErrNoRows)
+			},
+			want:    UploadInfo{},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore: mockDBStore,
+			}
+			got, err := s.GetUpload(context.Background(), "upload-id")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUpload() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_WriteUpload(t *testing.T) {
+	chunkSum := sha256.Sum256([]byte("string"))
+	expiresAt := time.Now().Add(time.Minute)
+	upload := dbstore.Upload{ID: "upload-id", Name: "test.mp4", Length: 13, Offset: 7, ExpiresAt: expiresAt}
+	tests := []struct {
+		name     string
+		locked   bool
+		offset   int64
+		chunk    string
+		checksum Checksum
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     UploadInfo
+		// wantExtended expects the expiry of the upload to be pushed back by the chunk
+		wantExtended bool
+		wantErr      error
+		wantContent  string
+		wantBlobs    map[string]string
+	}{
+		{
+			name:   "successfully write a chunk",
+			offset: 7,
+			chunk:  "str",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().SetUploadOffset(context.Background(), "upload-id", int64(7), int64(10), gomock.Any()).Return(nil)
+			},
+			want:         UploadInfo{ID: "upload-id", Length: 13, Offset: 10, ExpiresAt: expiresAt},
+			wantExtended: true,
+			wantErr:      nil,
+			wantContent:  "sample str",
+			wantBlobs:    map[string]string{},
+		},
+		{
+			name:     "successfully write the last chunk and store the file",
+			offset:   7,
+			chunk:    "string",
+			checksum: Checksum{Algorithm: "sha256", Sum: chunkSum[:]},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().SetUploadOffset(context.Background(), "upload-id", int64(7), int64(13), gomock.Any()).Return(nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "upload-id").Return(nil)
+			},
+			want:         UploadInfo{ID: "upload-id", Length: 13, Offset: 13, ExpiresAt: expiresAt, Location: "localhost/v1/files/" + generatedID},
+			wantExtended: true,
+			wantErr:      nil,
+			wantContent:  "",
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:   "chunk not starting at the offset of the upload",
+			offset: 3,
+			chunk:  "string",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(upload, nil)
+			},
+			want:        UploadInfo{ID: "upload-id", Length: 13, Offset: 7, ExpiresAt: expiresAt},
+			wantErr:     ErrorUploadOffsetMismatch,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:     "chunk not matching its checksum",
+			offset:   7,
+			chunk:    "strong",
+			checksum: Checksum{Algorithm: "sha256", Sum: chunkSum[:]},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(upload, nil)
+			},
+			want:        UploadInfo{ID: "upload-id", Length: 13, Offset: 7, ExpiresAt: expiresAt},
+			wantErr:     ErrorChecksumMismatch,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:     "unsupported checksum algorithm",
+			offset:   7,
+			chunk:    "string",
+			checksum: Checksum{Algorithm: "crc32", Sum: []byte{1, 2, 3, 4}},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:        UploadInfo{},
+			wantErr:     ErrorUnsupportedChecksum,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:   "chunk going past the length of the upload",
+			offset: 7,
+			chunk:  "strings",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(upload, nil)
+			},
+			want:        UploadInfo{ID: "upload-id", Length: 13, Offset: 7, ExpiresAt: expiresAt},
+			wantErr:     ErrorUploadLengthExceeded,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:   "chunk written concurrently",
+			locked: true,
+			offset: 7,
+			chunk:  "string",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:        UploadInfo{},
+			wantErr:     ErrorUploadLocked,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:   "upload locked by another instance",
+			offset: 7,
+			chunk:  "string",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:upload-id").Return(nil, dbstore.ErrorLocked)
+			},
+			want:        UploadInfo{},
+			wantErr:     ErrorUploadLocked,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:   "expired upload",
+			offset: 7,
+			chunk:  "string",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				expired := upload
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(expired, nil)
+			},
+			want:        UploadInfo{},
+			wantErr:     ErrorUploadExpired,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:   "upload not found",
+			offset: 7,
+			chunk:  "string",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(dbstore.Upload{}, sql.ErrNoRows)
+			},
+			want:        UploadInfo{},
+			wantErr:     sql.ErrNoRows,
+			wantContent: "sample ",
+			wantBlobs:   map[string]string{},
+		},
+		{
+			name:   "complete upload not fitting the quota is kept",
+			offset: 7,
+			chunk:  "string",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().GetUpload(context.Background(), "upload-id").Return(upload, nil)
+				mockDBStore.EXPECT().SetUploadOffset(context.Background(), "upload-id", int64(7), int64(13), gomock.Any()).Return(nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{UsedFiles: 1, Quota: dbstore.Quota{MaxFiles: 1}})
+			},
+			want:         UploadInfo{ID: "upload-id", Length: 13, Offset: 13, ExpiresAt: expiresAt},
+			wantExtended: true,
+			wantErr:      ErrorQuotaExceeded,
+			wantContent:  "sample string",
+			wantBlobs:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore := memstore.NewMemoryStore()
+			s := service{
+				dbStore:      mockDBStore,
+				blobStore:    blobStore,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				newID:        fixedID,
+				uploadsDir:   t.TempDir(),
+				uploadExpiry: time.Hour,
+			}
+			// the content received so far, along with bytes written past the offset which were never acknowledged
+			contentPath := filepath.Join(s.uploadsDir, "upload-id")
+			if err := os.WriteFile(contentPath, []byte("sample unacknowledged"), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			if err := os.Truncate(contentPath, 7); err != nil {
+				t.Fatalf("Truncate() error = %v", err)
+			}
+			if tt.locked {
+				release, _ := s.writes.reserve("upload-id")
+				defer release()
+			}
+
+			got, err := s.WriteUpload(context.Background(), "upload-id", "localhost", tt.offset, strings.NewReader(tt.chunk), tt.checksum)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("WriteUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantExtended {
+				if !expiresWithin(got.ExpiresAt, time.Hour) {
+					t.Errorf("WriteUpload() got expiry = %v, want in %v", got.ExpiresAt, time.Hour)
+				}
+				got.ExpiresAt = expiresAt
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WriteUpload() got = %v, want %v", got, tt.want)
+			}
+			content, err := os.ReadFile(contentPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				content, err = nil, nil
+			}
+			if err != nil || string(content) != tt.wantContent {
+				t.Errorf("WriteUpload() content of the upload = %q, err = %v, want %q", content, err, tt.wantContent)
+			}
+			blobs, _ := blobStore.List(context.Background())
+			if len(blobs) != len(tt.wantBlobs) {
+				t.Errorf("WriteUpload() stored blobs got = %v, want %v", blobs, tt.wantBlobs)
+			}
+			for key, wantContent := range tt.wantBlobs {
+				content, err := blobStore.Get(context.Background(), key)
+				if err != nil {
+					t.Errorf("WriteUpload() stored blob %s err = %v", key, err)
+					continue
+				}
+				contentBytes, _ := io.ReadAll(content)
+				if string(contentBytes) != wantContent {
+					t.Errorf("WriteUpload() stored content got = %s, want %s", string(contentBytes), wantContent)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_DeleteUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		locked      bool
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		wantErr     error
+		wantContent bool
+	}{
+		{
+			name: "successfully delete the upload",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "upload-id").Return(nil)
+			},
+			wantErr:     nil,
+			wantContent: false,
+		},
+		{
+			name: "upload not found",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "upload-id").Return(sql.ErrNoRows)
+			},
+			wantErr:     sql.ErrNoRows,
+			wantContent: true,
+		},
+		{
+			name: "upload being written by another instance",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUploadLock(mockDBStore, dbstore.ErrorLocked)
+			},
+			wantErr:     ErrorUploadLocked,
+			wantContent: true,
+		},
+		{
+			name:   "upload being written",
+			locked: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			wantErr:     ErrorUploadLocked,
+			wantContent: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:    mockDBStore,
+				writes:     newReservations(),
+				uploadsDir: t.TempDir(),
+			}
+			contentPath := filepath.Join(s.uploadsDir, "upload-id")
+			if err := os.WriteFile(contentPath, []byte("sample "), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			if tt.locked {
+				release, _ := s.writes.reserve("upload-id")
+				defer release()
+			}
+
+			err := s.DeleteUpload(context.Background(), "upload-id")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(contentPath); (err == nil) != tt.wantContent {
+				t.Errorf("DeleteUpload() content of the upload exists = %v, want %v", err == nil, tt.wantContent)
+			}
+		})
+	}
+}
+
+func Test_service_AbortExpiredUploads(t *testing.T) {
+	tests := []struct {
+		name         string
+		mockFunc     func(mockDBStore *dbStoreMocks.MockDBStore)
+		want         UploadCleanupReport
+		wantErr      bool
+		wantContents []string
+	}{
+		{
+			name: "successfully abort the expired uploads",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetExpiredUploads(context.Background(), gomock.Any()).Return([]dbstore.Upload{
+					{ID: "expired-1"}, {ID: "expired-2"}, {ID: "written"}, {ID: "written-elsewhere"}, {ID: "deleted"}, {ID: "failed"}, {ID: "unlockable"},
+				}, nil)
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:expired-1").Return(func() {}, nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "expired-1").Return(nil)
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:expired-2").Return(func() {}, nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "expired-2").Return(nil)
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:written-elsewhere").Return(nil, dbstore.ErrorLocked)
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:deleted").Return(func() {}, nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "deleted").Return(sql.ErrNoRows)
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:failed").Return(func() {}, nil)
+				mockDBStore.EXPECT().DeleteUpload(context.Background(), "failed").Return(sql.ErrConnDone)
+				mockDBStore.EXPECT().TryLock(context.Background(), "upload:unlockable").Return(nil, sql.ErrConnDone)
+			},
+			want: UploadCleanupReport{
+				AbortedUploads: 2,
+				FailedUploads:  []string{"failed", "unlockable"},
+			},
+			wantErr:      false,
+			wantContents: []string{"deleted", "failed", "unlockable", "written", "written-elsewhere"},
+		},
+		{
+			name: "failed to get the expired uploads",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetExpiredUploads(context.Background(), gomock.Any()).Return(nil, sql.ErrConnDone)
+			},
+			want: UploadCleanupReport{
+				FailedUploads: []string{},
+			},
+			wantErr:      true,
+			wantContents: []string{"deleted", "expired-1", "expired-2", "failed", "unlockable", "written", "written-elsewhere"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:    mockDBStore,
+				writes:     newReservations(),
+				uploadsDir: t.TempDir(),
+			}
+			for _, id := range []string{"expired-1", "expired-2", "written", "written-elsewhere", "deleted", "failed", "unlockable"} {
+				if err := os.WriteFile(filepath.Join(s.uploadsDir, id), []byte("sample "), 0o600); err != nil {
+					t.Fatalf("WriteFile() error = %v", err)
+				}
+			}
+			release, _ := s.writes.reserve("written")
+			defer release()
+
+			got, err := s.AbortExpiredUploads(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AbortExpiredUploads() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AbortExpiredUploads() got = %v, want %v", got, tt.want)
+			}
+			entries, _ := os.ReadDir(s.uploadsDir)
+			contents := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				contents = append(contents, entry.Name())
+			}
+			if !reflect.DeepEqual(contents, tt.wantContents) {
+				t.Errorf("AbortExpiredUploads() remaining contents got = %v, want %v", contents, tt.wantContents)
+			}
+		})
+	}
+}
+
+// expectUploadLock expects the upload-id upload to be locked in the DB, err being the result of the lock
+func expectUploadLock(mockDBStore *dbStoreMocks.MockDBStore, err error) {
+	var unlock func()
+	if err == nil {
+		unlock = func() {}
+	}
+	mockDBStore.EXPECT().TryLock(context.Background(), "upload:upload-id").Return(unlock, err)
+}
+
+// expiresWithin reports whether expiresAt is expiry from now, give or take the time taken by the test
+func expiresWithin(expiresAt time.Time, expiry time.Duration) bool {
+	until := time.Until(expiresAt)
+	return until > expiry-time.Minute && until <= expiry
+}
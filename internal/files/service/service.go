@@ -2,148 +2,524 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"os"
+	"log"
+	"net/url"
 	"path/filepath"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"golang.org/x/exp/slices"
 
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
 	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
 )
 
-const (
-	localStoragePath = "storage/videos/"
-)
-
 // Errors represent custom error that will be verified by the handler layer
 var (
 	ErrorUnsupportedFileTypes = fmt.Errorf("unsupported file types")
 	ErrorDuplicateKey         = fmt.Errorf("duplicate key value")
+	ErrorFileExists           = fmt.Errorf("file already exists")
 )
 
 var allowedExtensions = []string{
 	".mp4", ".mpg", ".mpeg",
 }
 
+// mediaTypeExtensions maps the media types of the raw uploads to their allowed extensions, the first one is the default
+var mediaTypeExtensions = map[string][]string{
+	"video/mp4":  {".mp4"},
+	"video/mpeg": {".mpg", ".mpeg"},
+}
+
 // FileInfo represents information of a file
 type FileInfo struct {
 	FileID    string    `json:"fileid"`
+	Version   int       `json:"version"`
 	Name      string    `json:"name"`
 	Size      int64     `json:"size"`
 	CreatedAt time.Time `json:"created_at"`
+	// Replicas is only set when the blob storage keeps several copies of every file
+	Replicas []ReplicaInfo `json:"replicas,omitempty"`
+	// Tier is only set when the blob storage moves the files between storage tiers
+	Tier string `json:"tier,omitempty"`
+	// Broken is set when fsck found the content of the file missing or damaged
+	Broken bool `json:"broken,omitempty"`
+	// ExpiresAt is only set when the file is deleted once it is passed
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // Service provides mechanism to interact with files
 //
 //go:generate mockgen -destination mocks/mock_service.go github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service Service
 type Service interface {
-	UploadFile(ctx context.Context, file multipart.File, host, filename string, size int64) (string, error)
+	UploadFile(ctx context.Context, file io.Reader, host string, name fileid.ID, owner string, expiresAt time.Time) (string, error)
+	PutFile(ctx context.Context, file io.Reader, host string, id fileid.ID, mediaType, owner string, expiresAt time.Time, createOnly bool) (string, error)
+	GetFileByID(ctx context.Context, id fileid.ID) (FileInfo, io.ReadSeekCloser, error)
 	GetAllFiles(ctx context.Context) ([]FileInfo, error)
-	DeleteFileByID(ctx context.Context, id string) error
+	DeleteFileByID(ctx context.Context, id fileid.ID, permanent bool) error
+	RestoreFile(ctx context.Context, id fileid.ID) error
+	GetTrash(ctx context.Context) ([]TrashedFileInfo, error)
+	PurgeTrash(ctx context.Context, retention time.Duration) (PurgeReport, error)
+	GetFileVersions(ctx context.Context, id fileid.ID) ([]FileInfo, error)
+	GetFileVersion(ctx context.Context, id fileid.ID, version int) (FileInfo, io.ReadSeekCloser, error)
+	DeleteFileVersion(ctx context.Context, id fileid.ID, version int) error
+	SetFileExpiry(ctx context.Context, id fileid.ID, expiresAt time.Time) error
+	ReapExpiredFiles(ctx context.Context) (ReapReport, error)
+	MigrateLayout(ctx context.Context) (LayoutMigrationReport, error)
+	ResyncReplicas(ctx context.Context) (ResyncReport, error)
+	RotateEncryptionKey(ctx context.Context) (KeyRotationReport, error)
+	DemoteColdFiles(ctx context.Context, coldAfter time.Duration) (TieringReport, error)
+	Shutdown(ctx context.Context) error
+	GetUsage(ctx context.Context, owner string) (UsageReport, error)
+	SetQuota(ctx context.Context, owner string, maxBytes, maxFiles int64) error
+	Fsck(ctx context.Context, repair bool) (FsckReport, error)
+	Recover(ctx context.Context, gracePeriod time.Duration) (RecoveryReport, error)
+	CheckStorage(ctx context.Context) (StorageReport, error)
+	CollectGarbage(ctx context.Context, gracePeriod time.Duration, dryRun bool) (GCReport, error)
+	CreateUpload(ctx context.Context, name fileid.ID, owner string, length int64, metadata string) (UploadInfo, error)
+	GetUpload(ctx context.Context, id fileid.ID) (UploadInfo, error)
+	WriteUpload(ctx context.Context, id fileid.ID, host string, offset int64, chunk io.Reader, checksum Checksum) (UploadInfo, error)
+	DeleteUpload(ctx context.Context, id fileid.ID) error
+	CreateMultipartUpload(ctx context.Context, name fileid.ID, owner string) (MultipartUploadInfo, error)
+	UploadPart(ctx context.Context, uploadID fileid.ID, partNumber int, reader io.Reader) (PartInfo, error)
+	CompleteMultipartUpload(ctx context.Context, uploadID fileid.ID, host string, parts []CompletedPart) (string, error)
+	AbortMultipartUpload(ctx context.Context, uploadID fileid.ID) error
+	AbortAbandonedMultipartUploads(ctx context.Context, olderThan time.Duration) (MultipartCleanupReport, error)
+	AbortExpiredUploads(ctx context.Context) (UploadCleanupReport, error)
 }
 
 type service struct {
-	dbStore filesDBStore.DBStore
+	dbStore   filesDBStore.DBStore
+	blobStore filesBlobStore.BlobStore
+	// uploads keeps the file ids and, with versioning, the names being uploaded by this instance
+	uploads *reservations
+	// newID generates the id of an uploaded file
+	newID func() string
+	// minFreeBytes is the free space every local disk must keep for an upload to be accepted, zero disables the check
+	minFreeBytes uint64
+	// versioning makes an upload named after an existing file a new version of that file
+	versioning bool
+	// uploadsDir keeps the content received by the resumable uploads, they are disabled when it is empty
+	uploadsDir string
+	// uploadExpiry is how long a resumable upload is kept without receiving any chunk
+	uploadExpiry time.Duration
+	// writes keeps the ids of the resumable and multipart uploads being written by this instance
+	writes *reservations
+	// multipartDir keeps the parts received by the multipart uploads, they are disabled when it is empty
+	multipartDir string
+}
+
+// Option configures optional behaviour of the Service
+type Option func(s *service)
+
+// WithMinFreeBytes refuses new uploads with ErrorInsufficientStorage while a local disk keeping the files has less than minFreeBytes free
+func WithMinFreeBytes(minFreeBytes uint64) Option {
+	return func(s *service) {
+		s.minFreeBytes = minFreeBytes
+	}
 }
 
 // New returned new Service instance
-func New(dbStore filesDBStore.DBStore) Service {
-	return service{
-		dbStore: dbStore,
+func New(dbStore filesDBStore.DBStore, blobStore filesBlobStore.BlobStore, opts ...Option) Service {
+	s := service{
+		dbStore:      dbStore,
+		blobStore:    blobStore,
+		uploads:      newReservations(),
+		writes:       newReservations(),
+		newID:        uuid.NewString,
+		uploadExpiry: DefaultUploadExpiry,
+	}
+	for _, opt := range opts {
+		opt(&s)
 	}
+	return s
 }
 
-// UploadFile do save file to local storage (file system) and also insert the file detail info to the DB
-func (s service) UploadFile(ctx context.Context, file multipart.File, host, filename string, size int64) (string, error) {
-	// save file to local storage
-	err := os.MkdirAll(localStoragePath, os.ModePerm)
+// UploadFile streams the file to the blob storage and also insert the file detail info to the DB.
+// The file gets a newly generated id, returned as part of its location, and keeps name as its file name,
+// so files uploaded with the same name do not collide.
+// With versioning, an upload named after an existing file is stored as the next version of that file instead.
+// A non-zero expiresAt must be in the future, the file is deleted once it is passed unless a later version is uploaded.
+func (s service) UploadFile(ctx context.Context, file io.Reader, host string, name fileid.ID, owner string, expiresAt time.Time) (string, error) {
+	if err := validateExpiry(expiresAt); err != nil {
+		return "", err
+	}
+	record, release, err := s.newFileRecord(ctx, name, owner, expiresAt)
 	if err != nil {
-		return "", fmt.Errorf("failed to create directory: %s, err: %v", localStoragePath, err)
+		return "", err
+	}
+	defer release()
+	return s.uploadFile(ctx, file, host, record)
+}
+
+// PutFile streams the file of the specified media type to the blob storage under the specified id, which is also kept as its file name.
+// An id without extension, such as a generated one, is named with the extension of the media type,
+// ErrorUnsupportedFileTypes is returned when the extension of the id does not match the media type.
+// A file already stored under the id is replaced, or with versioning the upload is stored as its next version,
+// unless createOnly is set: ErrorFileExists is then returned instead. A file only left in the trash does not exist,
+// the upload is then stored as the version following the trashed ones.
+// A concurrent upload of the same id to this instance is rejected with ErrorDuplicateKey before streaming.
+func (s service) PutFile(ctx context.Context, file io.Reader, host string, id fileid.ID, mediaType, owner string, expiresAt time.Time, createOnly bool) (string, error) {
+	if err := validateExpiry(expiresAt); err != nil {
+		return "", err
 	}
-	targetFilename := localStoragePath + filename
-	dst, err := os.Create(targetFilename)
+	name, err := putFileName(id, mediaType)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %s, err: %v", targetFilename, err)
+		return "", err
 	}
+	release, ok := s.uploads.reserve(id.String())
+	if !ok {
+		return "", ErrorDuplicateKey
+	}
+	defer release()
 
-	defer func() {
-		_ = dst.Close()
-	}()
+	record := filesDBStore.FileDetail{
+		ID:        s.newID(),
+		FileID:    id.String(),
+		Name:      name,
+		Owner:     owner,
+		ExpiresAt: expiresAt,
+	}
+	if createOnly {
+		// the existing file is rejected before streaming, a file created concurrently is still rejected
+		// by the unique key of the DB since only one version following the trashed ones can be inserted
+		_, err := s.dbStore.GetFileByID(ctx, id.String())
+		if err == nil {
+			return "", ErrorFileExists
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("failed to get file from DB, err: %v", err)
+		}
+		trashedVersions, err := s.trashedVersions(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		record.Version = 1
+		for _, version := range trashedVersions {
+			if version.Version >= record.Version {
+				record.Version = version.Version + 1
+			}
+		}
+	}
 
-	fileBytes, err := io.ReadAll(file)
+	record, location, err := s.storeFile(ctx, file, host, record)
 	if err != nil {
-		return "", fmt.Errorf("failed to write read uploaded file, err: %v", err)
+		if createOnly && err == ErrorDuplicateKey {
+			return "", ErrorFileExists
+		}
+		return "", err
 	}
+	if !s.versioning {
+		s.removePreviousVersions(ctx, record)
+	}
+	return location, nil
+}
 
+// putFileName returns the file name of a raw upload of the media type under the id,
+// the id is given the default extension of the media type when it has none
+func putFileName(id fileid.ID, mediaType string) (string, error) {
+	extensions, ok := mediaTypeExtensions[mediaType]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrorUnsupportedFileTypes, mediaType)
+	}
+	extension := filepath.Ext(id.String())
+	if extension == "" {
+		return id.String() + extensions[0], nil
+	}
+	if !slices.Contains(extensions, extension) {
+		return "", fmt.Errorf("%w: %s does not match the extension of %s", ErrorUnsupportedFileTypes, mediaType, id)
+	}
+	return id.String(), nil
+}
+
+// removePreviousVersions deletes the versions of the file stored before the record, so the record replaces them.
+// A version stored meanwhile by a concurrent upload replaces the record in turn, so only the latest version is kept
+// whichever of the uploads gets here first.
+// The record is already stored, so the versions failing to be deleted are only logged.
+func (s service) removePreviousVersions(ctx context.Context, record filesDBStore.FileDetail) {
+	versions, err := s.dbStore.GetFileVersions(ctx, record.FileID)
+	if err != nil {
+		log.Printf("failed to get replaced versions of file: %s, err: %v", record.FileID, err)
+		return
+	}
+	latest := record.Version
+	for _, version := range versions {
+		if version.Version > latest {
+			latest = version.Version
+		}
+	}
+	for _, version := range versions {
+		if version.Version >= latest {
+			continue
+		}
+		if err := s.deleteFile(ctx, version.ID, filesDBStore.FileStatusActive); err != nil {
+			log.Printf("failed to delete replaced version %d of file: %s, err: %v", version.Version, record.FileID, err)
+		}
+	}
+}
+
+// newFileRecord returns the record of a file uploaded with specified name, under a newly generated id.
+// With versioning, the record of an upload named after an existing file is the next version of that file instead,
+// the name is then reserved until the returned func is called, so concurrent uploads of a new name do not create two files.
+// ErrorDuplicateKey is returned when the name is already being uploaded to this instance.
+func (s service) newFileRecord(ctx context.Context, name fileid.ID, owner string, expiresAt time.Time) (filesDBStore.FileDetail, func(), error) {
+	id := s.newID()
+	record := filesDBStore.FileDetail{
+		ID:        id,
+		FileID:    id,
+		Version:   1,
+		Name:      name.String(),
+		Owner:     owner,
+		ExpiresAt: expiresAt,
+	}
+	if !s.versioning {
+		return record, func() {}, nil
+	}
+
+	release, ok := s.uploads.reserve(name.String())
+	if !ok {
+		return filesDBStore.FileDetail{}, nil, ErrorDuplicateKey
+	}
+	latest, err := s.dbStore.GetFileByName(ctx, name.String())
+	if err == nil {
+		record.FileID, record.Version = latest.FileID, 0
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		release()
+		return filesDBStore.FileDetail{}, nil, fmt.Errorf("failed to get file from DB, err: %v", err)
+	}
+	return record, release, nil
+}
+
+// uploadFile stores the file as the specified record, the record without Version is stored as the next version of its file.
+// The content is stored once per SHA-256 digest, so identical uploads share the same blob.
+// The file is accounted to the owner, ErrorQuotaExceeded is returned when it does not fit the quota of the owner or of the whole storage.
+// An upload never replaces the content of an existing file, ErrorDuplicateKey is returned when the id is taken.
+// The callers reserve what concurrent uploads race on, the id or the name, uploads across instances are still rejected by the unique key of the DB.
+// ErrorInsufficientStorage is returned when the storage is below the configured free space watermark.
+func (s service) uploadFile(ctx context.Context, file io.Reader, host string, record filesDBStore.FileDetail) (string, error) {
+	_, location, err := s.storeFile(ctx, file, host, record)
+	return location, err
+}
+
+// storeFile is uploadFile also returning the stored record, which has the version it was stored as
+func (s service) storeFile(ctx context.Context, file io.Reader, host string, record filesDBStore.FileDetail) (filesDBStore.FileDetail, string, error) {
 	// validate content type
-	if !slices.Contains(allowedExtensions, filepath.Ext(filename)) {
-		return "", ErrorUnsupportedFileTypes
+	if !slices.Contains(allowedExtensions, filepath.Ext(record.Name)) {
+		return filesDBStore.FileDetail{}, "", ErrorUnsupportedFileTypes
 	}
 
-	_, err = dst.Write(fileBytes)
+	if err := s.checkFreeSpace(ctx); err != nil {
+		return filesDBStore.FileDetail{}, "", err
+	}
+
+	// reject the upload before streaming it when the quota is already used up
+	remaining, err := s.remainingQuota(ctx, record.Owner)
 	if err != nil {
-		return "", fmt.Errorf("failed to write file to local storage, err: %v", err)
+		return filesDBStore.FileDetail{}, "", err
+	}
+	if remaining >= 0 {
+		file = &quotaReader{reader: file, remaining: remaining}
 	}
 
-	fileFullPath := host + "/v1/files/" + filename
+	// stream file to blob storage
+	stagedBlob, err := s.blobStore.Stage(ctx, file)
+	if err != nil {
+		if limited, ok := file.(*quotaReader); ok && limited.exceeded {
+			return filesDBStore.FileDetail{}, "", ErrorQuotaExceeded
+		}
+		return filesDBStore.FileDetail{}, "", fmt.Errorf("failed to save file to blob storage, err: %v", err)
+	}
+	defer func() {
+		_ = stagedBlob.Abort()
+	}()
+
+	fileFullPath := host + "/v1/files/" + url.PathEscape(record.FileID)
 
-	err = s.dbStore.InsertNewFile(ctx, filesDBStore.FileDetail{
-		ID:        filename,
-		Size:      size,
-		Path:      fileFullPath,
-		CreatedAt: time.Time{},
+	// the blob is committed while its blob record is locked, so identical concurrent uploads do not both commit the same digest.
+	// The file stays pending until it is activated, a crash in between is rolled back by the recovery
+	var commitErr error
+	record.Size = stagedBlob.Size()
+	record.Path = s.blobStore.Path(stagedBlob.Digest())
+	record.Digest = stagedBlob.Digest()
+	record.Status = filesDBStore.FileStatusPending
+	err = s.dbStore.InsertNewFile(ctx, record, func(ctx context.Context, stored filesDBStore.FileDetail, refCount int64) error {
+		record.Version = stored.Version
+		commitErr = s.commitBlob(ctx, stagedBlob, refCount)
+		return commitErr
 	})
+	if commitErr != nil {
+		return filesDBStore.FileDetail{}, "", commitErr
+	}
 	if err != nil {
 		if pgErr, ok := err.(*pq.Error); ok {
 			if pgErr.Code == "23505" {
-				return "", ErrorDuplicateKey
+				return filesDBStore.FileDetail{}, "", ErrorDuplicateKey
 			}
 		}
-		// revert file saving
-		_ = os.Remove(localStoragePath + filename)
-		return "", fmt.Errorf("failed to insert file information to DB, err: %v", err)
+		// concurrent uploads may use up the quota while the file is streamed
+		if errors.Is(err, filesDBStore.ErrorQuotaExceeded) {
+			return filesDBStore.FileDetail{}, "", ErrorQuotaExceeded
+		}
+		return filesDBStore.FileDetail{}, "", fmt.Errorf("failed to insert file information to DB, err: %v", err)
+	}
+
+	if err := s.dbStore.SetFileStatus(ctx, record.ID, filesDBStore.FileStatusPending, filesDBStore.FileStatusActive); err != nil {
+		return filesDBStore.FileDetail{}, "", fmt.Errorf("failed to activate file, err: %v", err)
 	}
+	return record, fileFullPath, nil
+}
 
-	return fileFullPath, nil
+// commitBlob makes the staged content visible under its digest unless an identical blob is already stored
+func (s service) commitBlob(ctx context.Context, stagedBlob filesBlobStore.StagedBlob, refCount int64) error {
+	if refCount > 1 {
+		_, err := s.blobStore.Stat(ctx, stagedBlob.Digest())
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, filesBlobStore.ErrorNotFound) {
+			return fmt.Errorf("failed to check existing blob, err: %v", err)
+		}
+	}
+
+	if err := stagedBlob.Commit(ctx, stagedBlob.Digest()); err != nil {
+		return fmt.Errorf("failed to save file to blob storage, err: %v", err)
+	}
+	return nil
+}
+
+// GetFileByID returned the file info and the content of the latest version of the file, the content must be closed by the caller.
+// The access time of the file is recorded so recently downloaded files are kept on the hot tier
+func (s service) GetFileByID(ctx context.Context, id fileid.ID) (FileInfo, io.ReadSeekCloser, error) {
+	fileDetail, err := s.dbStore.GetFileByID(ctx, id.String())
+	if err != nil {
+		return FileInfo{}, nil, fmt.Errorf("failed to get file from DB, err: %w", err)
+	}
+	return s.openFile(ctx, fileDetail)
+}
+
+// openFile returns the file info and the content of the file record, and records its access time
+func (s service) openFile(ctx context.Context, fileDetail filesDBStore.FileDetail) (FileInfo, io.ReadSeekCloser, error) {
+	content, err := s.blobStore.Get(ctx, blobKey(fileDetail))
+	if err != nil {
+		return FileInfo{}, nil, fmt.Errorf("failed to get file from blob storage, err: %w", err)
+	}
+	// failing to record the access only affects the tiering, so the download is not interrupted
+	if err := s.dbStore.TouchFile(ctx, fileDetail.ID, time.Now()); err != nil {
+		log.Printf("failed to record access of file: %s, err: %v", fileDetail.ID, err)
+	}
+	return mapFileDetailsToFileInfo(fileDetail), content, nil
 }
 
-// GetAllFiles returned all files info listed on the DB
+// GetAllFiles returned the info of the latest version of all files listed on the DB
 func (s service) GetAllFiles(ctx context.Context) ([]FileInfo, error) {
 	files, err := s.dbStore.GetAllFiles(ctx)
 	if err != nil {
 		return []FileInfo{}, fmt.Errorf("failed to get all files from DB, err: %v", err)
 	}
 	fileInfos := make([]FileInfo, 0)
-	for _, file := range files {
-		fileInfos = append(fileInfos, mapFileDetailsToFileInfo(file))
+	for _, file := range latestVersions(files) {
+		fileInfo := mapFileDetailsToFileInfo(file)
+		fileInfo.Replicas, err = s.replicaInfos(ctx, blobKey(file), file.Size)
+		if err != nil {
+			return []FileInfo{}, fmt.Errorf("failed to get replicas of file: %s, err: %v", file.ID, err)
+		}
+		fileInfo.Tier, err = s.tier(ctx, blobKey(file))
+		if err != nil {
+			return []FileInfo{}, fmt.Errorf("failed to get tier of file: %s, err: %v", file.ID, err)
+		}
+		fileInfos = append(fileInfos, fileInfo)
 	}
 	return fileInfos, nil
 }
 
 func mapFileDetailsToFileInfo(fileDetail filesDBStore.FileDetail) FileInfo {
-	return FileInfo{
-		FileID:    fileDetail.ID,
-		Name:      fileDetail.ID,
+	fileInfo := FileInfo{
+		FileID:    fileDetail.FileID,
+		Version:   fileDetail.Version,
+		Name:      fileDetail.Name,
 		Size:      fileDetail.Size,
 		CreatedAt: fileDetail.CreatedAt,
+		Broken:    fileDetail.Broken,
+	}
+	if !fileDetail.ExpiresAt.IsZero() {
+		expiresAt := fileDetail.ExpiresAt
+		fileInfo.ExpiresAt = &expiresAt
 	}
+	return fileInfo
 }
 
-// DeleteFileByID delete a file by its id
-func (s service) DeleteFileByID(ctx context.Context, id string) error {
-	fileDetail, err := s.dbStore.DeleteFileByID(ctx, id)
+// DeleteFileByID moves a file to the trash together with all its versions, until it is restored or purged.
+// With permanent the file is deleted right away, from the trash as well, the blob is only removed when the last reference goes away.
+func (s service) DeleteFileByID(ctx context.Context, id fileid.ID, permanent bool) error {
+	if !permanent {
+		if err := s.dbStore.TrashFile(ctx, id.String(), time.Now()); err != nil {
+			return fmt.Errorf("failed to move file to the trash, err: %w", err)
+		}
+		return nil
+	}
+
+	versions, err := s.dbStore.GetFileVersions(ctx, id.String())
 	if err != nil {
-		return fmt.Errorf("failed to delete entry from DB, err: %w", err)
+		return fmt.Errorf("failed to get versions of file from DB, err: %w", err)
 	}
+	trashedVersions, err := s.trashedVersions(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 && len(trashedVersions) == 0 {
+		return fmt.Errorf("failed to delete file, err: %w", sql.ErrNoRows)
+	}
+	for _, version := range versions {
+		if err := s.deleteFile(ctx, version.ID, filesDBStore.FileStatusActive); err != nil {
+			return err
+		}
+	}
+	for _, version := range trashedVersions {
+		if err := s.deleteFile(ctx, version.ID, filesDBStore.FileStatusTrashed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	err = os.Remove(localStoragePath + fileDetail.ID)
+// deleteFile deletes the file record with specified id, which is expected in the from status.
+// The file is hidden as deleting first, so a removal failing afterwards is completed by the recovery.
+func (s service) deleteFile(ctx context.Context, id, from string) error {
+	err := s.dbStore.SetFileStatus(ctx, id, from, filesDBStore.FileStatusDeleting)
 	if err != nil {
-		_ = s.dbStore.InsertNewFile(ctx, fileDetail)
-		return fmt.Errorf("failed to delete file from local storage, err: %w", err)
+		return fmt.Errorf("failed to delete file, err: %w", err)
+	}
+	if err := s.removeFile(ctx, id); err != nil {
+		log.Printf("failed to remove deleted file: %s, it is left to the recovery, err: %v", id, err)
 	}
 	return nil
 }
+
+// removeFile removes the file record and its blob once the blob is no longer referenced
+func (s service) removeFile(ctx context.Context, id string) error {
+	_, err := s.dbStore.DeleteFileByID(ctx, id, func(ctx context.Context, fileDetail filesDBStore.FileDetail, refCount int64) error {
+		if refCount > 0 {
+			return nil
+		}
+		err := s.blobStore.Delete(ctx, blobKey(fileDetail))
+		if err != nil && !errors.Is(err, filesBlobStore.ErrorNotFound) {
+			return fmt.Errorf("failed to delete file from blob storage, err: %w", err)
+		}
+		return nil
+	})
+	return err
+}
+
+// blobKey returns the key of the file content on the blob storage,
+// files stored before content addressing was introduced are kept under their id
+func blobKey(fileDetail filesDBStore.FileDetail) string {
+	if fileDetail.Digest == "" {
+		return fileDetail.ID
+	}
+	return fileDetail.Digest
+}
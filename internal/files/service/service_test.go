@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"mime/multipart"
-	"os"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
@@ -13,13 +14,19 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/lib/pq"
 
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	blobStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mocks"
 	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
 	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
 )
 
 func TestNew(t *testing.T) {
 	type args struct {
-		dbStore dbstore.DBStore
+		dbStore   dbstore.DBStore
+		blobStore blobstore.BlobStore
+		opts      []Option
 	}
 	tests := []struct {
 		name string
@@ -29,16 +36,91 @@ func TestNew(t *testing.T) {
 		{
 			name: "successfully get new Service",
 			args: args{
-				dbStore: nil,
+				dbStore:   nil,
+				blobStore: nil,
 			},
 			want: service{
-				dbStore: nil,
+				dbStore:      nil,
+				blobStore:    nil,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				uploadExpiry: DefaultUploadExpiry,
+			},
+		},
+		{
+			name: "successfully get new Service with free space watermark",
+			args: args{
+				dbStore:   nil,
+				blobStore: nil,
+				opts:      []Option{WithMinFreeBytes(1024)},
+			},
+			want: service{
+				dbStore:      nil,
+				blobStore:    nil,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				minFreeBytes: 1024,
+				uploadExpiry: DefaultUploadExpiry,
+			},
+		},
+		{
+			name: "successfully get new Service with versioning",
+			args: args{
+				dbStore:   nil,
+				blobStore: nil,
+				opts:      []Option{WithVersioning()},
+			},
+			want: service{
+				dbStore:      nil,
+				blobStore:    nil,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				versioning:   true,
+				uploadExpiry: DefaultUploadExpiry,
+			},
+		},
+		{
+			name: "successfully get new Service with resumable uploads",
+			args: args{
+				dbStore:   nil,
+				blobStore: nil,
+				opts:      []Option{WithResumableUploads("storage/videos/.tus"), WithUploadExpiry(time.Hour)},
+			},
+			want: service{
+				dbStore:      nil,
+				blobStore:    nil,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				uploadsDir:   "storage/videos/.tus",
+				uploadExpiry: time.Hour,
+			},
+		},
+		{
+			name: "successfully get new Service with multipart uploads",
+			args: args{
+				dbStore:   nil,
+				blobStore: nil,
+				opts:      []Option{WithMultipartUploads("storage/videos/.multipart")},
+			},
+			want: service{
+				dbStore:      nil,
+				blobStore:    nil,
+				uploads:      newReservations(),
+				writes:       newReservations(),
+				multipartDir: "storage/videos/.multipart",
+				uploadExpiry: DefaultUploadExpiry,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := New(tt.args.dbStore); !reflect.DeepEqual(got, tt.want) {
+			got := New(tt.args.dbStore, tt.args.blobStore, tt.args.opts...).(service)
+			if got.newID == nil || got.newID() == got.newID() {
+				t.Errorf("New() newID does not generate unique ids")
+			}
+			// functions are only deeply equal when nil
+			got.newID = nil
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -65,99 +147,198 @@ func (m mockMultipartFile) Close() error {
 	return nil
 }
 
+const sampleDigest = "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b"
+
+// generatedID is the id given to the files uploaded by the tests
+const generatedID = "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b"
+
+// fixedID is the id generator of the tests, it always returns generatedID
+func fixedID() string {
+	return generatedID
+}
+
+// callBlobFunc returns gomock action that calls the given dbstore.BlobFunc with specified reference count
+func callBlobFunc(refCount int64, err error) func(ctx context.Context, file dbstore.FileDetail, blobFunc dbstore.BlobFunc) error {
+	return func(ctx context.Context, file dbstore.FileDetail, blobFunc dbstore.BlobFunc) error {
+		if err != nil {
+			return err
+		}
+		return blobFunc(ctx, file, refCount)
+	}
+}
+
+// expectUsage expects the quota check of an upload by the owner with specified usages
+func expectUsage(mockDBStore *dbStoreMocks.MockDBStore, owner string, ownerUsage, globalUsage dbstore.Usage) {
+	mockDBStore.EXPECT().GetUsage(context.Background(), owner).Return(ownerUsage, nil)
+	mockDBStore.EXPECT().GetUsage(context.Background(), dbstore.GlobalOwner).Return(globalUsage, nil)
+}
+
 func Test_service_UploadFile(t *testing.T) {
 	type args struct {
 		ctx      context.Context
-		file     multipart.File
+		file     io.Reader
 		host     string
-		filename string
-		size     int64
+		filename fileid.ID
 	}
 	tests := []struct {
-		name     string
-		args     args
-		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
-		want     string
-		wantErr  bool
+		name        string
+		args        args
+		storedBlobs map[string]string
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		want        string
+		wantErr     bool
+		wantBlobs   map[string]string
 	}{
 		{
 			name: "successfully upload a file",
 			args: args{
-				ctx: context.Background(),
-				file: mockMultipartFile{
-					reader: strings.NewReader("sample string"),
-				},
+				ctx:      context.Background(),
+				file:     strings.NewReader("sample string"),
 				host:     "localhost",
 				filename: "test.mp4",
-				size:     123,
 			},
 			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
 				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
-					ID:   "test.mp4",
-					Size: 123,
-					Path: "localhost/v1/files/test.mp4",
-				}).Return(nil)
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
 			},
-			want:    "localhost/v1/files/test.mp4",
+			want:    "localhost/v1/files/" + generatedID,
+			wantErr: false,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name: "successfully upload an already stored content",
+			args: args{
+				ctx:      context.Background(),
+				file:     strings.NewReader("sample string"),
+				host:     "localhost",
+				filename: "test-copy.mp4",
+			},
+			storedBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test-copy.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(2, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			want:    "localhost/v1/files/" + generatedID,
+			wantErr: false,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name: "referenced content is missing from the blob storage",
+			args: args{
+				ctx:      context.Background(),
+				file:     strings.NewReader("sample string"),
+				host:     "localhost",
+				filename: "test-copy.mp4",
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test-copy.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(2, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			want:    "localhost/v1/files/" + generatedID,
 			wantErr: false,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
 		},
 		{
 			name: "unsupported file type",
 			args: args{
-				ctx: context.Background(),
-				file: mockMultipartFile{
-					reader: strings.NewReader("sample string"),
-				},
+				ctx:      context.Background(),
+				file:     strings.NewReader("sample string"),
 				host:     "localhost",
 				filename: "text.txt",
-				size:     123,
 			},
 			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
 			},
-			want:    "",
-			wantErr: true,
+			want:      "",
+			wantErr:   true,
+			wantBlobs: map[string]string{},
 		},
 		{
 			name: "failed to insert to DB",
 			args: args{
-				ctx: context.Background(),
-				file: mockMultipartFile{
-					reader: strings.NewReader("sample string"),
-				},
+				ctx:      context.Background(),
+				file:     strings.NewReader("sample string"),
 				host:     "localhost",
 				filename: "test.mp4",
-				size:     123,
 			},
 			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
 				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
-					ID:   "test.mp4",
-					Size: 123,
-					Path: "localhost/v1/files/test.mp4",
-				}).Return(fmt.Errorf("some-error"))
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(0, fmt.Errorf("some-error")))
 			},
-			want:    "",
-			wantErr: true,
+			want:      "",
+			wantErr:   true,
+			wantBlobs: map[string]string{},
 		},
 		{
 			name: "duplicate entry",
 			args: args{
-				ctx: context.Background(),
-				file: mockMultipartFile{
-					reader: strings.NewReader("sample string"),
-				},
+				ctx:      context.Background(),
+				file:     strings.NewReader("sample string"),
 				host:     "localhost",
 				filename: "test.mp4",
-				size:     123,
 			},
 			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
 				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
-					ID:   "test.mp4",
-					Size: 123,
-					Path: "localhost/v1/files/test.mp4",
-				}).Return(&pq.Error{Code: "23505"})
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(0, &pq.Error{Code: "23505"}))
 			},
-			want:    "",
-			wantErr: true,
+			want:      "",
+			wantErr:   true,
+			wantBlobs: map[string]string{},
 		},
 	}
 	for _, tt := range tests {
@@ -167,10 +348,17 @@ func Test_service_UploadFile(t *testing.T) {
 
 			tt.mockFunc(mockDBStore)
 
+			blobStore := memstore.NewMemoryStore()
+			for key, content := range tt.storedBlobs {
+				_, _ = blobStore.Put(tt.args.ctx, key, strings.NewReader(content))
+			}
 			s := service{
-				dbStore: mockDBStore,
+				dbStore:   mockDBStore,
+				blobStore: blobStore,
+				uploads:   newReservations(),
+				newID:     fixedID,
 			}
-			got, err := s.UploadFile(tt.args.ctx, tt.args.file, tt.args.host, tt.args.filename, tt.args.size)
+			got, err := s.UploadFile(tt.args.ctx, tt.args.file, tt.args.host, tt.args.filename, "", time.Time{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UploadFile() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -178,10 +366,310 @@ func Test_service_UploadFile(t *testing.T) {
 			if got != tt.want {
 				t.Errorf("UploadFile() got = %v, want %v", got, tt.want)
 			}
+
+			blobs, _ := blobStore.List(tt.args.ctx)
+			if len(blobs) != len(tt.wantBlobs) {
+				t.Errorf("UploadFile() stored blobs got = %v, want %v", blobs, tt.wantBlobs)
+			}
+			for key, wantContent := range tt.wantBlobs {
+				content, err := blobStore.Get(tt.args.ctx, key)
+				if err != nil {
+					t.Errorf("UploadFile() stored blob %s err = %v", key, err)
+					continue
+				}
+				contentBytes, _ := io.ReadAll(content)
+				if string(contentBytes) != wantContent {
+					t.Errorf("UploadFile() stored content got = %s, want %s", string(contentBytes), wantContent)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_PutFile(t *testing.T) {
+	newRecord := func(version int) dbstore.FileDetail {
+		return dbstore.FileDetail{
+			ID:      generatedID,
+			FileID:  "test.mp4",
+			Version: version,
+			Name:    "test.mp4",
+			Size:    13,
+			Path:    sampleDigest,
+			Digest:  sampleDigest,
+			Status:  dbstore.FileStatusPending,
+		}
+	}
+	tests := []struct {
+		name        string
+		id          fileid.ID
+		mediaType   string
+		versioning  bool
+		createOnly  bool
+		storedBlobs map[string]string
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore)
+		want        string
+		wantErr     error
+		wantBlobs   map[string]string
+	}{
+		{
+			name: "successfully put a new file",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), newRecord(0), gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{
+					{ID: generatedID, FileID: "test.mp4", Version: 1},
+				}, nil)
+			},
+			want:    "localhost/v1/files/test.mp4",
+			wantErr: nil,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name: "successfully replace an existing file",
+			storedBlobs: map[string]string{
+				"old-digest": "old string",
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), newRecord(0), gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{
+					{ID: "old-id", FileID: "test.mp4", Version: 1, Digest: "old-digest"},
+					{ID: generatedID, FileID: "test.mp4", Version: 2},
+				}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "old-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "old-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "old-id",
+					Digest: "old-digest",
+				}, 0))
+			},
+			want:    "localhost/v1/files/test.mp4",
+			wantErr: nil,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:       "successfully put the next version of an existing file",
+			versioning: true,
+			storedBlobs: map[string]string{
+				"old-digest": "old string",
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), newRecord(0), gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			want:    "localhost/v1/files/test.mp4",
+			wantErr: nil,
+			wantBlobs: map[string]string{
+				"old-digest": "old string",
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:       "successfully create a file",
+			createOnly: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "test.mp4").Return(dbstore.FileDetail{}, sql.ErrNoRows)
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{}, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), newRecord(1), gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{
+					{ID: generatedID, FileID: "test.mp4", Version: 1},
+				}, nil)
+			},
+			want:    "localhost/v1/files/test.mp4",
+			wantErr: nil,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:       "successfully create a file only left in the trash",
+			createOnly: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				// the trashed file is not found as GetFileByID does not find it, its versions are kept for a restore
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "test.mp4").Return(dbstore.FileDetail{}, sql.ErrNoRows)
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{
+					{ID: "trashed-id", FileID: "test.mp4", Version: 1},
+					{ID: "trashed-version-id", FileID: "test.mp4", Version: 2},
+				}, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), newRecord(3), gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{
+					{ID: generatedID, FileID: "test.mp4", Version: 3},
+				}, nil)
+			},
+			want:    "localhost/v1/files/test.mp4",
+			wantErr: nil,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:      "successfully put a file under an id without extension",
+			id:        "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b",
+			mediaType: "video/mpeg",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				// the file is named with the extension of the media type, so it is downloaded as such
+				record := newRecord(0)
+				record.FileID, record.Name = "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b", "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b.mpg"
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), record, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b").Return([]dbstore.FileDetail{
+					{ID: generatedID, FileID: "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b", Version: 1},
+				}, nil)
+			},
+			want:    "localhost/v1/files/6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b",
+			wantErr: nil,
+			wantBlobs: map[string]string{
+				sampleDigest: "sample string",
+			},
+		},
+		{
+			name:      "put a file which extension does not match the media type",
+			mediaType: "video/mpeg",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:      "",
+			wantErr:   ErrorUnsupportedFileTypes,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name:      "put a file of an unsupported media type",
+			id:        "6f1c2b0e-5d4a-4f8e-9b3a-2c7d1e0f9a8b",
+			mediaType: "application/octet-stream",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want:      "",
+			wantErr:   ErrorUnsupportedFileTypes,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name:       "create an existing file",
+			createOnly: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "test.mp4").Return(dbstore.FileDetail{ID: "old-id", FileID: "test.mp4", Version: 1}, nil)
+			},
+			want:      "",
+			wantErr:   ErrorFileExists,
+			wantBlobs: map[string]string{},
+		},
+		{
+			name:       "create a file created concurrently",
+			createOnly: true,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "test.mp4").Return(dbstore.FileDetail{}, sql.ErrNoRows)
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "test.mp4").Return([]dbstore.FileDetail{}, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), newRecord(1), gomock.Any()).Return(&pq.Error{Code: "23505"})
+			},
+			want:      "",
+			wantErr:   ErrorFileExists,
+			wantBlobs: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			blobStore := memstore.NewMemoryStore()
+			for key, content := range tt.storedBlobs {
+				_, _ = blobStore.Put(context.Background(), key, strings.NewReader(content))
+			}
+			s := service{
+				dbStore:    mockDBStore,
+				blobStore:  blobStore,
+				uploads:    newReservations(),
+				newID:      fixedID,
+				versioning: tt.versioning,
+			}
+			id, mediaType := tt.id, tt.mediaType
+			if id == "" {
+				id = "test.mp4"
+			}
+			if mediaType == "" {
+				mediaType = "video/mp4"
+			}
+			got, err := s.PutFile(context.Background(), strings.NewReader("sample string"), "localhost", id, mediaType, "", time.Time{}, tt.createOnly)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("PutFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PutFile() got = %v, want %v", got, tt.want)
+			}
+
+			blobs, _ := blobStore.List(context.Background())
+			if len(blobs) != len(tt.wantBlobs) {
+				t.Errorf("PutFile() stored blobs got = %v, want %v", blobs, tt.wantBlobs)
+			}
+			for key, wantContent := range tt.wantBlobs {
+				content, err := blobStore.Get(context.Background(), key)
+				if err != nil {
+					t.Errorf("PutFile() stored blob %s err = %v", key, err)
+					continue
+				}
+				contentBytes, _ := io.ReadAll(content)
+				if string(contentBytes) != wantContent {
+					t.Errorf("PutFile() stored content got = %s, want %s", string(contentBytes), wantContent)
+				}
+			}
 		})
 	}
 }
 
+func Test_service_UploadFile_failedToCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
+	mockStagedBlob := blobStoreMocks.NewMockStagedBlob(ctrl)
+
+	content := strings.NewReader("sample string")
+	expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+	mockBlobStore.EXPECT().Stage(context.Background(), content).Return(mockStagedBlob, nil)
+	mockStagedBlob.EXPECT().Size().Return(int64(13))
+	mockStagedBlob.EXPECT().Digest().Return(sampleDigest).AnyTimes()
+	mockBlobStore.EXPECT().Path(sampleDigest).Return("99/ad/" + sampleDigest)
+	mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+		ID:      generatedID,
+		FileID:  generatedID,
+		Version: 1,
+		Name:    "test.mp4",
+		Size:    13,
+		Path:    "99/ad/" + sampleDigest,
+		Digest:  sampleDigest,
+		Status:  dbstore.FileStatusPending,
+	}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+	// the failed commit rolls the insert back, so there is no file to remove
+	mockStagedBlob.EXPECT().Commit(context.Background(), sampleDigest).Return(fmt.Errorf("some-error"))
+	mockStagedBlob.EXPECT().Abort().Return(nil)
+
+	s := service{
+		dbStore:   mockDBStore,
+		blobStore: mockBlobStore,
+		uploads:   newReservations(),
+		newID:     fixedID,
+	}
+	got, err := s.UploadFile(context.Background(), content, "localhost", "test.mp4", "", time.Time{})
+	if err == nil {
+		t.Errorf("UploadFile() error = %v, wantErr %v", err, true)
+	}
+	if got != "" {
+		t.Errorf("UploadFile() got = %v, want %v", got, "")
+	}
+}
+
 func Test_service_GetAllFiles(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -201,19 +689,28 @@ func Test_service_GetAllFiles(t *testing.T) {
 			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
 				mockDBStore.EXPECT().GetAllFiles(context.Background()).Return([]dbstore.FileDetail{
 					{
-						ID:        "file-1.mp4",
+						ID:        "file-1",
+						FileID:    "file-1",
+						Version:   1,
+						Name:      "file-1.mp4",
 						Size:      1111,
 						Path:      "path/to/file-1.mp4",
 						CreatedAt: time.Time{},
 					},
 					{
-						ID:        "file-2.mp4",
+						ID:        "file-2",
+						FileID:    "file-2",
+						Version:   1,
+						Name:      "file-2.mp4",
 						Size:      2222,
 						Path:      "path/to/file-2.mp4",
 						CreatedAt: time.Time{},
 					},
 					{
-						ID:        "file-3.mp4",
+						ID:        "file-3",
+						FileID:    "file-3",
+						Version:   1,
+						Name:      "file-3.mp4",
 						Size:      3333,
 						Path:      "path/to/file-3.mp4",
 						CreatedAt: time.Time{},
@@ -222,19 +719,22 @@ func Test_service_GetAllFiles(t *testing.T) {
 			},
 			want: []FileInfo{
 				{
-					FileID:    "file-1.mp4",
+					FileID:    "file-1",
+					Version:   1,
 					Size:      1111,
 					Name:      "file-1.mp4",
 					CreatedAt: time.Time{},
 				},
 				{
-					FileID:    "file-2.mp4",
+					FileID:    "file-2",
+					Version:   1,
 					Size:      2222,
 					Name:      "file-2.mp4",
 					CreatedAt: time.Time{},
 				},
 				{
-					FileID:    "file-3.mp4",
+					FileID:    "file-3",
+					Version:   1,
 					Size:      3333,
 					Name:      "file-3.mp4",
 					CreatedAt: time.Time{},
@@ -276,65 +776,108 @@ func Test_service_GetAllFiles(t *testing.T) {
 	}
 }
 
-func Test_service_DeleteFileByID(t *testing.T) {
+func Test_service_GetFileByID(t *testing.T) {
 	type args struct {
 		ctx context.Context
-		id  string
+		id  fileid.ID
 	}
 	tests := []struct {
-		name     string
-		args     args
-		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
-		wantErr  bool
+		name        string
+		args        args
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore)
+		want        FileInfo
+		wantContent string
+		wantErr     bool
 	}{
 		{
-			name: "successfully delete a file by its ID",
+			name: "successfully get a file by its ID",
 			args: args{
 				ctx: context.Background(),
-				id:  "some-id",
+				id:  "file-id.mp4",
 			},
-			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
-				os.Create("storage/videos/file-id")
-				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "some-id").Return(dbstore.FileDetail{
-					ID:        "file-id",
-					Size:      123,
-					Path:      "path/to/file-id",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "file-id.mp4").Return(dbstore.FileDetail{
+					ID:        "file-id.mp4",
+					FileID:    "file-id.mp4",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      13,
+					Path:      "path/to/file-id.mp4",
+					Digest:    sampleDigest,
 					CreatedAt: time.Time{},
 				}, nil)
+				mockBlobStore.EXPECT().Get(context.Background(), sampleDigest).Return(mockMultipartFile{
+					reader: strings.NewReader("sample string"),
+				}, nil)
+				mockDBStore.EXPECT().TouchFile(context.Background(), "file-id.mp4", gomock.Any()).Return(nil)
 			},
-			wantErr: false,
+			want: FileInfo{
+				FileID:    "file-id.mp4",
+				Version:   1,
+				Name:      "sample.mp4",
+				Size:      13,
+				CreatedAt: time.Time{},
+			},
+			wantContent: "sample string",
+			wantErr:     false,
 		},
 		{
-			name: "failed to delete from DB",
+			name: "failing to record the access does not fail the download",
 			args: args{
 				ctx: context.Background(),
-				id:  "some-id",
+				id:  "file-id.mp4",
 			},
-			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
-				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "some-id").Return(dbstore.FileDetail{}, fmt.Errorf("some-err"))
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "file-id.mp4").Return(dbstore.FileDetail{
+					ID:        "file-id.mp4",
+					FileID:    "file-id.mp4",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      13,
+					Path:      "path/to/file-id.mp4",
+					Digest:    sampleDigest,
+					CreatedAt: time.Time{},
+				}, nil)
+				mockBlobStore.EXPECT().Get(context.Background(), sampleDigest).Return(mockMultipartFile{
+					reader: strings.NewReader("sample string"),
+				}, nil)
+				mockDBStore.EXPECT().TouchFile(context.Background(), "file-id.mp4", gomock.Any()).Return(sql.ErrConnDone)
+			},
+			want: FileInfo{
+				FileID:    "file-id.mp4",
+				Version:   1,
+				Name:      "sample.mp4",
+				Size:      13,
+				CreatedAt: time.Time{},
+			},
+			wantContent: "sample string",
+			wantErr:     false,
+		},
+		{
+			name: "file not found on DB",
+			args: args{
+				ctx: context.Background(),
+				id:  "file-id.mp4",
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "file-id.mp4").Return(dbstore.FileDetail{}, sql.ErrNoRows)
 			},
+			want:    FileInfo{},
 			wantErr: true,
 		},
 		{
-			name: "failed to delete file from system",
+			name: "file not found on blob storage",
 			args: args{
 				ctx: context.Background(),
-				id:  "some-id",
+				id:  "file-id.mp4",
 			},
-			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
-				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "some-id").Return(dbstore.FileDetail{
-					ID:        "file-id",
-					Size:      123,
-					Path:      "path/to/file-id",
-					CreatedAt: time.Time{},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileByID(context.Background(), "file-id.mp4").Return(dbstore.FileDetail{
+					ID: "file-id.mp4",
 				}, nil)
-				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
-					ID:        "file-id",
-					Size:      123,
-					Path:      "path/to/file-id",
-					CreatedAt: time.Time{},
-				}).Return(nil)
+				mockBlobStore.EXPECT().Get(context.Background(), "file-id.mp4").Return(nil, blobstore.ErrorNotFound)
 			},
+			want:    FileInfo{},
 			wantErr: true,
 		},
 	}
@@ -342,13 +885,304 @@ func Test_service_DeleteFileByID(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
 
-			tt.mockFunc(mockDBStore)
+			tt.mockFunc(mockDBStore, mockBlobStore)
 
 			s := service{
-				dbStore: mockDBStore,
+				dbStore:   mockDBStore,
+				blobStore: mockBlobStore,
+			}
+			got, content, err := s.GetFileByID(tt.args.ctx, tt.args.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFileByID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileByID() got = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer content.Close()
+			contentBytes, _ := io.ReadAll(content)
+			if string(contentBytes) != tt.wantContent {
+				t.Errorf("GetFileByID() content got = %s, want %s", string(contentBytes), tt.wantContent)
+			}
+		})
+	}
+}
+
+// deleteWithBlobFunc returns gomock action that deletes the file and calls the given dbstore.BlobFunc with specified reference count
+func deleteWithBlobFunc(file dbstore.FileDetail, refCount int64) func(ctx context.Context, id string, blobFunc dbstore.BlobFunc) (dbstore.FileDetail, error) {
+	return func(ctx context.Context, id string, blobFunc dbstore.BlobFunc) (dbstore.FileDetail, error) {
+		if err := blobFunc(ctx, file, refCount); err != nil {
+			return dbstore.FileDetail{}, err
+		}
+		return file, nil
+	}
+}
+
+// expectVersions expects the versions of the file with specified id to be listed, the records of the versions have the specified ids,
+// a single version recorded under the id of the file by default
+func expectVersions(mockDBStore *dbStoreMocks.MockDBStore, fileID string, ids ...string) {
+	if len(ids) == 0 {
+		ids = []string{fileID}
+	}
+	versions := make([]dbstore.FileDetail, 0, len(ids))
+	for i, id := range ids {
+		versions = append(versions, dbstore.FileDetail{ID: id, FileID: fileID, Version: i + 1})
+	}
+	mockDBStore.EXPECT().GetFileVersions(context.Background(), fileID).Return(versions, nil)
+}
+
+func Test_service_DeleteFileByID(t *testing.T) {
+	type args struct {
+		ctx       context.Context
+		id        fileid.ID
+		permanent bool
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore)
+		wantErr  bool
+	}{
+		{
+			name: "successfully delete the last reference of a blob",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id",
+					Size:   123,
+					Path:   "path/to/file-id",
+					Digest: sampleDigest,
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully delete a file which blob is still referenced",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id",
+					Size:   123,
+					Path:   "path/to/file-id",
+					Digest: sampleDigest,
+				}, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully delete a file stored before content addressing",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:   "file-id",
+					Size: 123,
+					Path: "path/to/file-id",
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), "file-id").Return(blobstore.ErrorNotFound)
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed removal from DB is left to the recovery",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).Return(dbstore.FileDetail{}, fmt.Errorf("some-err"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed removal from blob storage is left to the recovery",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id",
+					Size:   123,
+					Path:   "path/to/file-id",
+					Digest: sampleDigest,
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(fmt.Errorf("some-err"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully delete every version of a file",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id", "file-id", "file-id-2")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id",
+					Size:   123,
+					Digest: sampleDigest,
+				}, 1))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id-2", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id-2", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id-2",
+					Size:   123,
+					Digest: sampleDigest,
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "file deleted meanwhile",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(sql.ErrNoRows)
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to get the versions from DB",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, fmt.Errorf("some-err"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "successfully move every version of a file to the trash",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: false,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().TrashFile(context.Background(), "file-id", gomock.Any()).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found or already in the trash",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: false,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().TrashFile(context.Background(), "file-id", gomock.Any()).Return(sql.ErrNoRows)
+			},
+			wantErr: true,
+		},
+		{
+			name: "successfully delete a file from the trash",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{
+					{ID: "file-id", FileID: "file-id", Version: 1},
+				}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id", dbstore.FileStatusTrashed, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id",
+					Size:   123,
+					Digest: sampleDigest,
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to get the trashed files from DB",
+			args: args{
+				ctx:       context.Background(),
+				id:        "file-id",
+				permanent: true,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				expectVersions(mockDBStore, "file-id")
+				mockDBStore.EXPECT().GetTrashedFileVersions(context.Background(), "file-id").Return(nil, fmt.Errorf("some-err"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
+
+			tt.mockFunc(mockDBStore, mockBlobStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: mockBlobStore,
 			}
-			if err := s.DeleteFileByID(tt.args.ctx, tt.args.id); (err != nil) != tt.wantErr {
+			if err := s.DeleteFileByID(tt.args.ctx, tt.args.id, tt.args.permanent); (err != nil) != tt.wantErr {
 				t.Errorf("DeleteFileByID() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	filesBlobStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// Errors represent custom error that will be verified by the caller
+var (
+	ErrorTieringUnsupported = fmt.Errorf("blob storage does not support tiering")
+)
+
+// TieringReport represents the result of moving the cold files to the cold tier
+type TieringReport struct {
+	DemotedBlobs int      `json:"demoted_blobs"`
+	FailedFiles  []string `json:"failed_files"`
+}
+
+// Shutdown waits for the background work of the blob storage, such as the promotions of the cold blobs read by the
+// last requests, or until ctx is done. It is called once the server stopped serving requests.
+func (s service) Shutdown(ctx context.Context) error {
+	drainer, ok := s.blobStore.(filesBlobStore.Drainer)
+	if !ok {
+		return nil
+	}
+	return drainer.Drain(ctx)
+}
+
+// DemoteColdFiles moves the content of the files which were not accessed within coldAfter to the cold tier.
+// A blob shared by several files is only demoted when none of them was accessed recently.
+func (s service) DemoteColdFiles(ctx context.Context, coldAfter time.Duration) (TieringReport, error) {
+	report := TieringReport{
+		FailedFiles: make([]string, 0),
+	}
+
+	tierer, ok := s.blobStore.(filesBlobStore.Tierer)
+	if !ok {
+		return report, ErrorTieringUnsupported
+	}
+
+	files, err := s.dbStore.GetColdFiles(ctx, time.Now().Add(-coldAfter))
+	if err != nil {
+		return report, fmt.Errorf("failed to get cold files from DB, err: %v", err)
+	}
+	checked := make(map[string]bool)
+	for _, file := range files {
+		key := blobKey(file)
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		tier, err := tierer.Tier(ctx, key)
+		if err != nil {
+			if !errors.Is(err, filesBlobStore.ErrorNotFound) {
+				report.FailedFiles = append(report.FailedFiles, file.ID)
+			}
+			continue
+		}
+		if tier == filesBlobStore.TierCold {
+			continue
+		}
+		if err := tierer.Demote(ctx, key); err != nil {
+			report.FailedFiles = append(report.FailedFiles, file.ID)
+			continue
+		}
+		report.DemotedBlobs++
+	}
+	return report, nil
+}
+
+// tier returns the tier currently holding the file content, or empty when the blob storage has a single tier
+func (s service) tier(ctx context.Context, key string) (string, error) {
+	tierer, ok := s.blobStore.(filesBlobStore.Tierer)
+	if !ok {
+		return "", nil
+	}
+	tier, err := tierer.Tier(ctx, key)
+	if errors.Is(err, filesBlobStore.ErrorNotFound) {
+		return "", nil
+	}
+	return tier, err
+}
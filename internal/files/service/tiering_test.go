@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/tierstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_DemoteColdFiles(t *testing.T) {
+	ctx := context.Background()
+	tierStore := tierstore.NewTierStore(memstore.NewMemoryStore(), memstore.NewMemoryStore())
+	_, _ = tierStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	_, _ = tierStore.Put(ctx, "legacy.mp4", strings.NewReader("legacy"))
+
+	tests := []struct {
+		name      string
+		blobStore blobstore.BlobStore
+		mockFunc  func(mockDBStore *dbStoreMocks.MockDBStore)
+		want      TieringReport
+		wantTiers map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "successfully demote the cold files",
+			blobStore: tierStore,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetColdFiles(ctx, gomock.Any()).Return([]dbstore.FileDetail{
+					{ID: "sample.mp4", Digest: sampleDigest},
+					{ID: "copy.mp4", Digest: sampleDigest},
+					{ID: "legacy.mp4"},
+					{ID: "missing.mp4"},
+				}, nil)
+			},
+			want: TieringReport{
+				DemotedBlobs: 2,
+				FailedFiles:  []string{},
+			},
+			wantTiers: map[string]string{
+				sampleDigest: blobstore.TierCold,
+				"legacy.mp4": blobstore.TierCold,
+			},
+			wantErr: false,
+		},
+		{
+			name:      "running the demotion again changes nothing",
+			blobStore: tierStore,
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetColdFiles(ctx, gomock.Any()).Return([]dbstore.FileDetail{
+					{ID: "sample.mp4", Digest: sampleDigest},
+					{ID: "legacy.mp4"},
+				}, nil)
+			},
+			want: TieringReport{
+				DemotedBlobs: 0,
+				FailedFiles:  []string{},
+			},
+			wantTiers: map[string]string{
+				sampleDigest: blobstore.TierCold,
+				"legacy.mp4": blobstore.TierCold,
+			},
+			wantErr: false,
+		},
+		{
+			name:      "blob storage does not support tiering",
+			blobStore: memstore.NewMemoryStore(),
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+			},
+			want: TieringReport{
+				FailedFiles: []string{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: tt.blobStore,
+			}
+			got, err := s.DemoteColdFiles(ctx, 7*24*time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DemoteColdFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DemoteColdFiles() got = %v, want %v", got, tt.want)
+			}
+			for key, wantTier := range tt.wantTiers {
+				tier, err := tt.blobStore.(blobstore.Tierer).Tier(ctx, key)
+				if err != nil || tier != wantTier {
+					t.Errorf("Tier() of %s got = %s, err = %v, want %s", key, tier, err, wantTier)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_GetAllFiles_tier(t *testing.T) {
+	ctx := context.Background()
+	tierStore := tierstore.NewTierStore(memstore.NewMemoryStore(), memstore.NewMemoryStore())
+	_, _ = tierStore.Put(ctx, sampleDigest, strings.NewReader("sample string"))
+	_, _ = tierStore.Put(ctx, "legacy.mp4", strings.NewReader("legacy"))
+	_ = tierStore.(blobstore.Tierer).Demote(ctx, "legacy.mp4")
+
+	ctrl := gomock.NewController(t)
+	mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+	mockDBStore.EXPECT().GetAllFiles(ctx).Return([]dbstore.FileDetail{
+		{ID: "sample.mp4", FileID: "sample.mp4", Version: 1, Name: "sample.mp4", Size: 13, Digest: sampleDigest},
+		{ID: "legacy.mp4", FileID: "legacy.mp4", Version: 1, Name: "legacy.mp4", Size: 6},
+	}, nil)
+
+	s := service{
+		dbStore:   mockDBStore,
+		blobStore: tierStore,
+	}
+	got, err := s.GetAllFiles(ctx)
+	if err != nil {
+		t.Fatalf("GetAllFiles() error = %v", err)
+	}
+	want := []FileInfo{
+		{FileID: "sample.mp4", Version: 1, Name: "sample.mp4", Size: 13, Tier: blobstore.TierHot},
+		{FileID: "legacy.mp4", Version: 1, Name: "legacy.mp4", Size: 6, Tier: blobstore.TierCold},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllFiles() got = %v, want %v", got, want)
+	}
+}
+
+func Test_service_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		blobStore blobstore.BlobStore
+	}{
+		{
+			name:      "drain the tiered blob storage",
+			blobStore: tierstore.NewTierStore(memstore.NewMemoryStore(), memstore.NewMemoryStore()),
+		},
+		{
+			name:      "blob storage without background work",
+			blobStore: memstore.NewMemoryStore(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := service{
+				blobStore: tt.blobStore,
+			}
+			if err := s.Shutdown(ctx); err != nil {
+				t.Errorf("Shutdown() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// DefaultTrashRetention is how long a deleted file is kept in the trash before it is purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashedFileInfo represents information of a file in the trash
+type TrashedFileInfo struct {
+	FileInfo
+	TrashedAt time.Time `json:"trashed_at"`
+}
+
+// PurgeReport represents the result of purging the files kept in the trash longer than the retention
+type PurgeReport struct {
+	// PurgedFiles counts every purged version of a file
+	PurgedFiles int      `json:"purged_files"`
+	FailedFiles []string `json:"failed_files"`
+}
+
+// RestoreFile moves the file back from the trash together with all its versions,
+// the versions which expired are not restored as they are deleted permanently by the reaper
+func (s service) RestoreFile(ctx context.Context, id fileid.ID) error {
+	if err := s.dbStore.RestoreFile(ctx, id.String()); err != nil {
+		return fmt.Errorf("failed to restore file, err: %w", err)
+	}
+	return nil
+}
+
+// GetTrash returns the info of the files in the trash, the earliest trashed first
+func (s service) GetTrash(ctx context.Context) ([]TrashedFileInfo, error) {
+	files, err := s.dbStore.GetTrashedFiles(ctx)
+	if err != nil {
+		return []TrashedFileInfo{}, fmt.Errorf("failed to get trashed files from DB, err: %v", err)
+	}
+	files = latestVersions(files)
+	fileInfos := make([]TrashedFileInfo, 0, len(files))
+	for _, file := range files {
+		fileInfos = append(fileInfos, TrashedFileInfo{
+			FileInfo:  mapFileDetailsToFileInfo(file),
+			TrashedAt: file.TrashedAt,
+		})
+	}
+	return fileInfos, nil
+}
+
+// PurgeTrash permanently deletes the files kept in the trash longer than retention,
+// a file restored meanwhile is left alone
+func (s service) PurgeTrash(ctx context.Context, retention time.Duration) (PurgeReport, error) {
+	report := PurgeReport{
+		FailedFiles: make([]string, 0),
+	}
+
+	files, err := s.dbStore.GetTrashedFilesBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return report, fmt.Errorf("failed to get trashed files from DB, err: %v", err)
+	}
+	for _, file := range files {
+		err := s.deleteFile(ctx, file.ID, filesDBStore.FileStatusTrashed)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			report.FailedFiles = append(report.FailedFiles, file.ID)
+			continue
+		}
+		report.PurgedFiles++
+	}
+	return report, nil
+}
+
+// trashedVersions returns the versions of the file which are in the trash
+func (s service) trashedVersions(ctx context.Context, id fileid.ID) ([]filesDBStore.FileDetail, error) {
+	versions, err := s.dbStore.GetTrashedFileVersions(ctx, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed versions from DB, err: %w", err)
+	}
+	return versions, nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	blobStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mocks"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_RestoreFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		wantErr  error
+	}{
+		{
+			name: "successfully restore a file",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().RestoreFile(context.Background(), "file-id").Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "file not in the trash",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().RestoreFile(context.Background(), "file-id").Return(sql.ErrNoRows)
+			},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore: mockDBStore,
+			}
+			err := s.RestoreFile(context.Background(), "file-id")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RestoreFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_service_GetTrash(t *testing.T) {
+	trashedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     []TrashedFileInfo
+		wantErr  bool
+	}{
+		{
+			name: "successfully list the latest version of every trashed file",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetTrashedFiles(context.Background()).Return([]dbstore.FileDetail{
+					{ID: "file-id", FileID: "file-id", Version: 1, Name: "test.mp4", Size: 13, TrashedAt: trashedAt},
+					{ID: "file-id-2", FileID: "file-id", Version: 2, Name: "test.mp4", Size: 7, TrashedAt: trashedAt},
+					{ID: "other-id", FileID: "other-id", Version: 1, Name: "other.mp4", Size: 5, TrashedAt: trashedAt.Add(time.Hour)},
+				}, nil)
+			},
+			want: []TrashedFileInfo{
+				{
+					FileInfo:  FileInfo{FileID: "file-id", Version: 2, Name: "test.mp4", Size: 7},
+					TrashedAt: trashedAt,
+				},
+				{
+					FileInfo:  FileInfo{FileID: "other-id", Version: 1, Name: "other.mp4", Size: 5},
+					TrashedAt: trashedAt.Add(time.Hour),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to get the trashed files from DB",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetTrashedFiles(context.Background()).Return(nil, fmt.Errorf("some-error"))
+			},
+			want:    []TrashedFileInfo{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore: mockDBStore,
+			}
+			got, err := s.GetTrash(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTrash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTrash() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_PurgeTrash(t *testing.T) {
+	retention := 24 * time.Hour
+	expired := time.Now().Add(-2 * retention)
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore)
+		want     PurgeReport
+		wantErr  bool
+	}{
+		{
+			name: "successfully purge the files trashed before the retention",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetTrashedFilesBefore(context.Background(), gomock.Any()).DoAndReturn(func(_ context.Context, before time.Time) ([]dbstore.FileDetail, error) {
+					if before.After(time.Now().Add(-retention)) {
+						t.Errorf("PurgeTrash() lists the files trashed before %v, within the retention", before)
+					}
+					return []dbstore.FileDetail{
+						{ID: "expired-id", FileID: "expired-id", Version: 1, Digest: sampleDigest, TrashedAt: expired},
+						{ID: "restored-id", FileID: "restored-id", Version: 1, TrashedAt: expired},
+						{ID: "failing-id", FileID: "failing-id", Version: 1, TrashedAt: expired},
+					}, nil
+				})
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "expired-id", dbstore.FileStatusTrashed, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "expired-id", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "expired-id",
+					Size:   13,
+					Digest: sampleDigest,
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(nil)
+				// the file got restored after the trash was listed
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "restored-id", dbstore.FileStatusTrashed, dbstore.FileStatusDeleting).Return(sql.ErrNoRows)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "failing-id", dbstore.FileStatusTrashed, dbstore.FileStatusDeleting).Return(fmt.Errorf("some-error"))
+			},
+			want: PurgeReport{
+				PurgedFiles: 1,
+				FailedFiles: []string{"failing-id"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to get the trashed files from DB",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetTrashedFilesBefore(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some-error"))
+			},
+			want: PurgeReport{
+				FailedFiles: []string{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
+
+			tt.mockFunc(mockDBStore, mockBlobStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: mockBlobStore,
+			}
+			got, err := s.PurgeTrash(context.Background(), retention)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PurgeTrash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PurgeTrash() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
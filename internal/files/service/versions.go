@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	filesDBStore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+)
+
+// WithVersioning stores an upload named after an existing file as the next version of that file, instead of as a new file.
+// The latest version is served by the id of the file, the older ones stay available until they are deleted.
+func WithVersioning() Option {
+	return func(s *service) {
+		s.versioning = true
+	}
+}
+
+// GetFileVersions returns the info of the versions of the file, oldest first
+func (s service) GetFileVersions(ctx context.Context, id fileid.ID) ([]FileInfo, error) {
+	versions, err := s.dbStore.GetFileVersions(ctx, id.String())
+	if err != nil {
+		return []FileInfo{}, fmt.Errorf("failed to get versions of file from DB, err: %w", err)
+	}
+	if len(versions) == 0 {
+		return []FileInfo{}, fmt.Errorf("failed to get versions of file, err: %w", sql.ErrNoRows)
+	}
+	fileInfos := make([]FileInfo, 0, len(versions))
+	for _, version := range versions {
+		fileInfos = append(fileInfos, mapFileDetailsToFileInfo(version))
+	}
+	return fileInfos, nil
+}
+
+// GetFileVersion returns the file info and the content of the specified version of the file, the content must be closed by the caller
+func (s service) GetFileVersion(ctx context.Context, id fileid.ID, version int) (FileInfo, io.ReadSeekCloser, error) {
+	fileDetail, err := s.dbStore.GetFileVersion(ctx, id.String(), version)
+	if err != nil {
+		return FileInfo{}, nil, fmt.Errorf("failed to get file version from DB, err: %w", err)
+	}
+	return s.openFile(ctx, fileDetail)
+}
+
+// DeleteFileVersion permanently deletes the specified version of the file, the file is gone once its last version is deleted
+func (s service) DeleteFileVersion(ctx context.Context, id fileid.ID, version int) error {
+	fileDetail, err := s.dbStore.GetFileVersion(ctx, id.String(), version)
+	if err != nil {
+		return fmt.Errorf("failed to get file version from DB, err: %w", err)
+	}
+	return s.deleteFile(ctx, fileDetail.ID, filesDBStore.FileStatusActive)
+}
+
+// latestVersions returns the latest version of every file in files, in the order the files first appear
+func latestVersions(files []filesDBStore.FileDetail) []filesDBStore.FileDetail {
+	result := make([]filesDBStore.FileDetail, 0, len(files))
+	positions := make(map[string]int, len(files))
+	for _, file := range files {
+		position, ok := positions[file.FileID]
+		if !ok {
+			positions[file.FileID] = len(result)
+			result = append(result, file)
+			continue
+		}
+		if file.Version > result[position].Version {
+			result[position] = file
+		}
+	}
+	return result
+}
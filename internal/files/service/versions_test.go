@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/fileid"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	blobStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mocks"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
+	dbStoreMocks "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore/mocks"
+)
+
+func Test_service_UploadFile_versioning(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "upload named after an existing file is its next version",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileByName(context.Background(), "test.mp4").Return(dbstore.FileDetail{
+					ID:      "file-id-2",
+					FileID:  "file-id",
+					Version: 2,
+					Name:    "test.mp4",
+				}, nil)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:     generatedID,
+					FileID: "file-id",
+					Name:   "test.mp4",
+					Size:   13,
+					Path:   sampleDigest,
+					Digest: sampleDigest,
+					Status: dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			want:    "localhost/v1/files/file-id",
+			wantErr: false,
+		},
+		{
+			name: "upload with a new name is a new file",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileByName(context.Background(), "test.mp4").Return(dbstore.FileDetail{}, sql.ErrNoRows)
+				expectUsage(mockDBStore, "", dbstore.Usage{}, dbstore.Usage{})
+				mockDBStore.EXPECT().InsertNewFile(context.Background(), dbstore.FileDetail{
+					ID:      generatedID,
+					FileID:  generatedID,
+					Version: 1,
+					Name:    "test.mp4",
+					Size:    13,
+					Path:    sampleDigest,
+					Digest:  sampleDigest,
+					Status:  dbstore.FileStatusPending,
+				}, gomock.Any()).DoAndReturn(callBlobFunc(1, nil))
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), generatedID, dbstore.FileStatusPending, dbstore.FileStatusActive).Return(nil)
+			},
+			want:    "localhost/v1/files/" + generatedID,
+			wantErr: false,
+		},
+		{
+			name: "failed to look up the file by name",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileByName(context.Background(), "test.mp4").Return(dbstore.FileDetail{}, fmt.Errorf("some-error"))
+			},
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore:    mockDBStore,
+				blobStore:  memstore.NewMemoryStore(),
+				uploads:    newReservations(),
+				newID:      fixedID,
+				versioning: true,
+			}
+			got, err := s.UploadFile(context.Background(), strings.NewReader("sample string"), "localhost", "test.mp4", "", time.Time{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UploadFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("UploadFile() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_GetFileVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore)
+		want     []FileInfo
+		wantErr  error
+	}{
+		{
+			name: "successfully get the versions",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{
+					{ID: "file-id", FileID: "file-id", Version: 1, Name: "sample.mp4", Size: 13},
+					{ID: "file-id-3", FileID: "file-id", Version: 3, Name: "sample.mp4", Size: 15},
+				}, nil)
+			},
+			want: []FileInfo{
+				{FileID: "file-id", Version: 1, Name: "sample.mp4", Size: 13},
+				{FileID: "file-id", Version: 3, Name: "sample.mp4", Size: 15},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "file not found",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore) {
+				mockDBStore.EXPECT().GetFileVersions(context.Background(), "file-id").Return([]dbstore.FileDetail{}, nil)
+			},
+			want:    []FileInfo{},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+
+			tt.mockFunc(mockDBStore)
+
+			s := service{
+				dbStore: mockDBStore,
+			}
+			got, err := s.GetFileVersions(context.Background(), "file-id")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetFileVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileVersions() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_GetFileVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		mockFunc    func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore)
+		want        FileInfo
+		wantContent string
+		wantErr     error
+	}{
+		{
+			name: "successfully get the version",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersion(context.Background(), "file-id", 2).Return(dbstore.FileDetail{
+					ID:      "file-id-2",
+					FileID:  "file-id",
+					Version: 2,
+					Name:    "sample.mp4",
+					Size:    13,
+					Digest:  sampleDigest,
+				}, nil)
+				mockBlobStore.EXPECT().Get(context.Background(), sampleDigest).Return(mockMultipartFile{
+					reader: strings.NewReader("sample string"),
+				}, nil)
+				mockDBStore.EXPECT().TouchFile(context.Background(), "file-id-2", gomock.Any()).Return(nil)
+			},
+			want:        FileInfo{FileID: "file-id", Version: 2, Name: "sample.mp4", Size: 13},
+			wantContent: "sample string",
+			wantErr:     nil,
+		},
+		{
+			name: "version not found",
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersion(context.Background(), "file-id", 2).Return(dbstore.FileDetail{}, sql.ErrNoRows)
+			},
+			want:    FileInfo{},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
+
+			tt.mockFunc(mockDBStore, mockBlobStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: mockBlobStore,
+			}
+			got, content, err := s.GetFileVersion(context.Background(), "file-id", 2)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetFileVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileVersion() got = %v, want %v", got, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			contentBytes, _ := io.ReadAll(content)
+			if string(contentBytes) != tt.wantContent {
+				t.Errorf("GetFileVersion() content got = %s, want %s", string(contentBytes), tt.wantContent)
+			}
+		})
+	}
+}
+
+func Test_service_DeleteFileVersion(t *testing.T) {
+	type args struct {
+		id      fileid.ID
+		version int
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore)
+		wantErr  error
+	}{
+		{
+			name: "successfully delete the version",
+			args: args{
+				id:      "file-id",
+				version: 2,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersion(context.Background(), "file-id", 2).Return(dbstore.FileDetail{
+					ID:      "file-id-2",
+					FileID:  "file-id",
+					Version: 2,
+				}, nil)
+				mockDBStore.EXPECT().SetFileStatus(context.Background(), "file-id-2", dbstore.FileStatusActive, dbstore.FileStatusDeleting).Return(nil)
+				mockDBStore.EXPECT().DeleteFileByID(context.Background(), "file-id-2", gomock.Any()).DoAndReturn(deleteWithBlobFunc(dbstore.FileDetail{
+					ID:     "file-id-2",
+					Size:   13,
+					Digest: sampleDigest,
+				}, 0))
+				mockBlobStore.EXPECT().Delete(context.Background(), sampleDigest).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "version not found",
+			args: args{
+				id:      "file-id",
+				version: 2,
+			},
+			mockFunc: func(mockDBStore *dbStoreMocks.MockDBStore, mockBlobStore *blobStoreMocks.MockBlobStore) {
+				mockDBStore.EXPECT().GetFileVersion(context.Background(), "file-id", 2).Return(dbstore.FileDetail{}, sql.ErrNoRows)
+			},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDBStore := dbStoreMocks.NewMockDBStore(ctrl)
+			mockBlobStore := blobStoreMocks.NewMockBlobStore(ctrl)
+
+			tt.mockFunc(mockDBStore, mockBlobStore)
+
+			s := service{
+				dbStore:   mockDBStore,
+				blobStore: mockBlobStore,
+			}
+			if err := s.DeleteFileVersion(context.Background(), tt.args.id, tt.args.version); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteFileVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_latestVersions(t *testing.T) {
+	files := []dbstore.FileDetail{
+		{ID: "file-a-2", FileID: "file-a", Version: 2},
+		{ID: "file-b", FileID: "file-b", Version: 1},
+		{ID: "file-a-3", FileID: "file-a", Version: 3},
+		{ID: "file-a", FileID: "file-a", Version: 1},
+	}
+	want := []dbstore.FileDetail{
+		{ID: "file-a-3", FileID: "file-a", Version: 3},
+		{ID: "file-b", FileID: "file-b", Version: 1},
+	}
+	if got := latestVersions(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("latestVersions() got = %v, want %v", got, want)
+	}
+}
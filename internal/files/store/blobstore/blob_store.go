@@ -0,0 +1,123 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Errors represent custom error that will be verified by the upper layer
+var (
+	ErrorNotFound = fmt.Errorf("blob not found")
+)
+
+// BlobInfo represent the detail of a blob kept on the blob storage
+type BlobInfo struct {
+	Key     string
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// StagedBlob represent a fully written blob content that is not yet visible under any key
+type StagedBlob interface {
+	// Size returns the number of bytes written
+	Size() int64
+	// Digest returns the hex encoded SHA-256 digest of the content
+	Digest() string
+	// Commit makes the content visible under the specified key
+	Commit(ctx context.Context, key string) error
+	// Abort discards the content, it is a no-op after a successful Commit
+	Abort() error
+}
+
+// BlobStore provides mechanism to keep the content of the files
+//
+//go:generate mockgen -destination mocks/mock_blob_store.go github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore BlobStore,StagedBlob
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Stage(ctx context.Context, r io.Reader) (StagedBlob, error)
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) ([]BlobInfo, error)
+	Path(key string) string
+}
+
+// LayoutMigrator is implemented by the blob storages which layout can be changed after blobs have been stored
+type LayoutMigrator interface {
+	// MigrateLayout moves the blobs into the currently configured layout and returns the moved blobs
+	MigrateLayout(ctx context.Context) ([]BlobInfo, error)
+}
+
+// States of a blob copy kept by a Replicator
+const (
+	ReplicaStateHealthy     = "healthy"
+	ReplicaStateMissing     = "missing"
+	ReplicaStateMismatch    = "mismatch"
+	ReplicaStateUnavailable = "unavailable"
+)
+
+// ReplicaState represent the state of the copy of a blob kept by a single replica
+type ReplicaState struct {
+	Replica string
+	State   string
+}
+
+// Replicator is implemented by the blob storages keeping several copies of every blob
+type Replicator interface {
+	// ReplicaStates returns the state of every copy of the blob with specified key and expected size
+	ReplicaStates(ctx context.Context, key string, size int64) ([]ReplicaState, error)
+	// Repair restores the missing and mismatched copies of the blob from a healthy one and returns the number of restored copies
+	Repair(ctx context.Context, key string, size int64) (int, error)
+}
+
+// KeyRotator is implemented by the blob storages encrypting the blobs with data keys wrapped by a master key
+type KeyRotator interface {
+	// RotateKeys rewraps the data keys with the active master key, renaming the blobs named with another master key,
+	// and returns the number of rewrapped keys
+	RotateKeys(ctx context.Context) (int, error)
+}
+
+// Storage tiers of a Tierer
+const (
+	TierHot  = "hot"
+	TierCold = "cold"
+)
+
+// Tierer is implemented by the blob storages keeping the blobs on a fast hot tier or a cheaper cold tier.
+// Reading a cold blob promotes it back to the hot tier.
+type Tierer interface {
+	// Tier returns the tier currently holding the blob with specified key
+	Tier(ctx context.Context, key string) (string, error)
+	// Demote moves the blob with specified key to the cold tier
+	Demote(ctx context.Context, key string) error
+}
+
+// Drainer is implemented by the blob storages running work in the background
+type Drainer interface {
+	// Drain stops starting background work and waits for the work in progress, or until ctx is done
+	Drain(ctx context.Context) error
+}
+
+// DiskUsage represent the usage of a local disk keeping blobs
+type DiskUsage struct {
+	Path        string
+	FreeBytes   uint64
+	TotalBytes  uint64
+	FreeInodes  uint64
+	TotalInodes uint64
+}
+
+// DiskUser is implemented by the blob storages keeping the blobs, or staging them, on local disks
+type DiskUser interface {
+	// DiskUsages returns the usage of every disk, with probe the disks are also verified to be writable
+	DiskUsages(ctx context.Context, probe bool) ([]DiskUsage, error)
+}
+
+// TempCleaner is implemented by the blob storages leaving temporary content behind when an upload is interrupted
+type TempCleaner interface {
+	// CleanTemp removes the temporary content last modified before the specified time and returns it, with dryRun nothing is removed
+	CleanTemp(ctx context.Context, before time.Time, dryRun bool) ([]BlobInfo, error)
+}
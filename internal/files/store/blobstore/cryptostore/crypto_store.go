@@ -0,0 +1,473 @@
+package cryptostore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+type cryptoStore struct {
+	store      blobstore.BlobStore
+	activeKey  MasterKey
+	oldKeys    []MasterKey
+	masterKeys map[string]MasterKey
+}
+
+// NewCryptoStore returns new blob store encrypting the blobs kept on store with AES-256-GCM.
+// New data keys are wrapped with activeKey, oldKeys are only used to unwrap the data keys not rotated yet.
+// The blobs keyed by their digest are stored under a name given by activeKey, see blobName,
+// the ones named with oldKeys or still stored under their digest are found until they are renamed by RotateKeys.
+// Blobs written before the encryption was enabled have no data key and are still served as they are.
+func NewCryptoStore(store blobstore.BlobStore, activeKey MasterKey, oldKeys ...MasterKey) (blobstore.BlobStore, error) {
+	if len(activeKey.key) != masterKeySize {
+		return nil, fmt.Errorf("invalid active master key")
+	}
+	masterKeys := map[string]MasterKey{
+		activeKey.ID: activeKey,
+	}
+	for _, oldKey := range oldKeys {
+		masterKeys[oldKey.ID] = oldKey
+	}
+	return &cryptoStore{
+		store:      store,
+		activeKey:  activeKey,
+		oldKeys:    oldKeys,
+		masterKeys: masterKeys,
+	}, nil
+}
+
+// Put encrypts the content of r to the blob with specified key and returns the plaintext size
+func (cs *cryptoStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	staged, err := cs.Stage(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = staged.Abort()
+	}()
+	if err := staged.Commit(ctx, key); err != nil {
+		return 0, err
+	}
+	return staged.Size(), nil
+}
+
+// Stage encrypts the content of r with a new data key while it is staged on the underlying store
+func (cs *cryptoStore) Stage(ctx context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key, err: %v", err)
+	}
+
+	digestReader := blobstore.NewDigestReader(r)
+	encryptingReader, err := newEncryptingReader(digestReader, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	staged, err := cs.store.Stage(ctx, encryptingReader)
+	if err != nil {
+		return nil, err
+	}
+	return &stagedEncryptedBlob{
+		store:   cs,
+		staged:  staged,
+		dataKey: dataKey,
+		size:    digestReader.Size(),
+		digest:  digestReader.Digest(),
+	}, nil
+}
+
+// Get opens the blob for decryption, every read only decrypts the chunks holding the requested range
+func (cs *cryptoStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	name, err := cs.locate(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := cs.dataKey(ctx, name)
+	if errors.Is(err, blobstore.ErrorNotFound) {
+		// the blob was written before the encryption was enabled
+		return cs.store.Get(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := cs.store.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := plainSize(info.Size)
+	if err != nil {
+		return nil, err
+	}
+	content, err := cs.store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newDecryptingReader(content, dataKey, size)
+	if err != nil {
+		_ = content.Close()
+		return nil, fmt.Errorf("failed to open encrypted blob: %s, err: %v", key, err)
+	}
+	return reader, nil
+}
+
+// Stat returns the detail of the blob with its plaintext size
+func (cs *cryptoStore) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	name, err := cs.locate(ctx, key)
+	if err != nil {
+		return blobstore.BlobInfo{}, err
+	}
+	info, err := cs.store.Stat(ctx, name)
+	if err != nil {
+		return blobstore.BlobInfo{}, err
+	}
+	info.Key = key
+	if _, err := cs.store.Stat(ctx, name+keySuffix); errors.Is(err, blobstore.ErrorNotFound) {
+		return info, nil
+	} else if err != nil {
+		return blobstore.BlobInfo{}, err
+	}
+	info.Size, err = plainSize(info.Size)
+	if err != nil {
+		return blobstore.BlobInfo{}, fmt.Errorf("blob: %s, err: %w", key, err)
+	}
+	return info, nil
+}
+
+// Delete removes the blob together with its data key, under every name it may be stored under
+func (cs *cryptoStore) Delete(ctx context.Context, key string) error {
+	var notFoundErr error
+	deleted := false
+	for _, name := range cs.names(key) {
+		err := cs.store.Delete(ctx, name)
+		if errors.Is(err, blobstore.ErrorNotFound) {
+			notFoundErr = err
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		deleted = true
+		if err := cs.store.Delete(ctx, name+keySuffix); err != nil && !errors.Is(err, blobstore.ErrorNotFound) {
+			return err
+		}
+	}
+	if !deleted {
+		return notFoundErr
+	}
+	return nil
+}
+
+// List returns the detail of all blobs with their key and plaintext size, the data keys are not listed.
+// The blobs named with a master key which is not configured can not be read and are not listed either
+func (cs *cryptoStore) List(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	blobs, err := cs.store.List(ctx)
+	if err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+	encrypted := make(map[string]bool)
+	for _, blob := range blobs {
+		if strings.HasSuffix(blob.Key, keySuffix) {
+			encrypted[strings.TrimSuffix(blob.Key, keySuffix)] = true
+		}
+	}
+
+	listed := make(map[string]bool)
+	result := make([]blobstore.BlobInfo, 0, len(blobs))
+	for _, blob := range blobs {
+		if strings.HasSuffix(blob.Key, keySuffix) {
+			continue
+		}
+		if encrypted[blob.Key] {
+			if blob.Size, err = plainSize(blob.Size); err != nil {
+				return []blobstore.BlobInfo{}, fmt.Errorf("blob: %s, err: %w", blob.Key, err)
+			}
+		}
+		key, ok := cs.blobKey(blob.Key)
+		// a blob renamed by an interrupted rotation is kept under both names until the rotation is resumed
+		if !ok || listed[key] {
+			continue
+		}
+		listed[key] = true
+		blob.Key = key
+		result = append(result, blob)
+	}
+	return result, nil
+}
+
+// Path returns the path of the blob on the underlying store
+func (cs *cryptoStore) Path(key string) string {
+	return cs.store.Path(blobName(cs.activeKey, key))
+}
+
+// MigrateLayout migrates the layout of the underlying store when it supports it
+func (cs *cryptoStore) MigrateLayout(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	migrator, ok := cs.store.(blobstore.LayoutMigrator)
+	if !ok {
+		return []blobstore.BlobInfo{}, nil
+	}
+	moved, err := migrator.MigrateLayout(ctx)
+	result := make([]blobstore.BlobInfo, 0, len(moved))
+	for _, blob := range moved {
+		if strings.HasSuffix(blob.Key, keySuffix) {
+			continue
+		}
+		if key, ok := cs.blobKey(blob.Key); ok {
+			blob.Key = key
+			result = append(result, blob)
+		}
+	}
+	return result, err
+}
+
+// DiskUsages returns the usage of the disks of the underlying store
+func (cs *cryptoStore) DiskUsages(ctx context.Context, probe bool) ([]blobstore.DiskUsage, error) {
+	diskUser, ok := cs.store.(blobstore.DiskUser)
+	if !ok {
+		return []blobstore.DiskUsage{}, nil
+	}
+	return diskUser.DiskUsages(ctx, probe)
+}
+
+// CleanTemp removes the temporary content of the underlying store
+func (cs *cryptoStore) CleanTemp(ctx context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	cleaner, ok := cs.store.(blobstore.TempCleaner)
+	if !ok {
+		return []blobstore.BlobInfo{}, nil
+	}
+	return cleaner.CleanTemp(ctx, before, dryRun)
+}
+
+// ReplicaStates returns the state of the copies of the encrypted blob kept by the underlying store
+func (cs *cryptoStore) ReplicaStates(ctx context.Context, key string, size int64) ([]blobstore.ReplicaState, error) {
+	replicator, ok := cs.store.(blobstore.Replicator)
+	if !ok {
+		return nil, nil
+	}
+	name, err := cs.locate(ctx, key)
+	if errors.Is(err, blobstore.ErrorNotFound) {
+		name = blobName(cs.activeKey, key)
+	} else if err != nil {
+		return nil, err
+	}
+	return replicator.ReplicaStates(ctx, name, cipherSize(size))
+}
+
+// Repair repairs the copies of both the encrypted blob and its data key kept by the underlying store
+func (cs *cryptoStore) Repair(ctx context.Context, key string, size int64) (int, error) {
+	replicator, ok := cs.store.(blobstore.Replicator)
+	if !ok {
+		return 0, nil
+	}
+	name, err := cs.locate(ctx, key)
+	if errors.Is(err, blobstore.ErrorNotFound) {
+		name = blobName(cs.activeKey, key)
+	} else if err != nil {
+		return 0, err
+	}
+	restoredKeys, err := replicator.Repair(ctx, name+keySuffix, keyBlobSize)
+	if err != nil {
+		return restoredKeys, err
+	}
+	restored, err := replicator.Repair(ctx, name, cipherSize(size))
+	return restoredKeys + restored, err
+}
+
+// RotateKeys rewraps every data key not wrapped with the active master key, the encrypted blobs are not re-encrypted.
+// The blobs named with an old master key or still stored under their digest are moved to the name given by the active one.
+func (cs *cryptoStore) RotateKeys(ctx context.Context) (int, error) {
+	blobs, err := cs.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Key, keySuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(blob.Key, keySuffix)
+		key, ok := cs.blobKey(name)
+		if !ok {
+			return rotated, fmt.Errorf("blob: %s is named with an unknown master key", name)
+		}
+		keyBlob, err := cs.readKeyBlob(ctx, name)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to read data key of blob: %s, err: %w", name, err)
+		}
+		keyID, err := wrappedKeyID(keyBlob)
+		if err != nil {
+			return rotated, fmt.Errorf("blob: %s, err: %w", name, err)
+		}
+		activeName := blobName(cs.activeKey, key)
+		if keyID == cs.activeKey.ID && name == activeName {
+			continue
+		}
+
+		dataKey, err := unwrapKey(cs.masterKeys, keyBlob, name)
+		if err != nil {
+			return rotated, fmt.Errorf("blob: %s, err: %w", name, err)
+		}
+		if name != activeName {
+			err = cs.rename(ctx, name, activeName, dataKey)
+		} else {
+			err = cs.writeKeyBlob(ctx, name, dataKey)
+		}
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// rename moves the encrypted blob to the specified name, the content is copied as it is with its data key rewrapped.
+// The blob is kept under the previous name until it is copied, so an interrupted rename is resumed by the next rotation
+func (cs *cryptoStore) rename(ctx context.Context, from, to string, dataKey []byte) error {
+	content, err := cs.store.Get(ctx, from)
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %s, err: %w", from, err)
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	if err := cs.writeKeyBlob(ctx, to, dataKey); err != nil {
+		return err
+	}
+	if _, err := cs.store.Put(ctx, to, content); err != nil {
+		return fmt.Errorf("failed to write blob: %s, err: %w", to, err)
+	}
+	if err := cs.store.Delete(ctx, from); err != nil && !errors.Is(err, blobstore.ErrorNotFound) {
+		return fmt.Errorf("failed to delete blob: %s, err: %w", from, err)
+	}
+	if err := cs.store.Delete(ctx, from+keySuffix); err != nil && !errors.Is(err, blobstore.ErrorNotFound) {
+		return fmt.Errorf("failed to delete data key of blob: %s, err: %w", from, err)
+	}
+	return nil
+}
+
+// names returns the names the blob with specified key may be stored under: the name given by the active master key,
+// the ones given by the old master keys and the key itself for the blobs stored before they were named
+func (cs *cryptoStore) names(key string) []string {
+	activeName := blobName(cs.activeKey, key)
+	if activeName == key {
+		return []string{key}
+	}
+	names := []string{activeName}
+	for _, oldKey := range cs.oldKeys {
+		names = append(names, blobName(oldKey, key))
+	}
+	return append(names, key)
+}
+
+// locate returns the name the blob with specified key is stored under, ErrorNotFound is returned when it is stored under none
+func (cs *cryptoStore) locate(ctx context.Context, key string) (string, error) {
+	names := cs.names(key)
+	if len(names) == 1 {
+		return key, nil
+	}
+	for _, name := range names {
+		_, err := cs.store.Stat(ctx, name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, blobstore.ErrorNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", blobstore.ErrorNotFound, key)
+}
+
+// blobKey returns the key of the blob stored under name, ok is false when it is named with a master key which is not configured
+func (cs *cryptoStore) blobKey(name string) (string, bool) {
+	if !isKeyedName(name) {
+		return name, true
+	}
+	for _, masterKey := range cs.masterKeys {
+		if key, ok := nameKey(masterKey, name); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (cs *cryptoStore) dataKey(ctx context.Context, name string) ([]byte, error) {
+	keyBlob, err := cs.readKeyBlob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := unwrapKey(cs.masterKeys, keyBlob, name)
+	if err != nil {
+		return nil, fmt.Errorf("blob: %s, err: %w", name, err)
+	}
+	return dataKey, nil
+}
+
+func (cs *cryptoStore) readKeyBlob(ctx context.Context, name string) ([]byte, error) {
+	content, err := cs.store.Get(ctx, name+keySuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	// one more byte is read to detect an oversized key blob
+	keyBlob, err := io.ReadAll(io.LimitReader(content, keyBlobSize+1))
+	if err != nil {
+		return nil, err
+	}
+	return keyBlob, nil
+}
+
+func (cs *cryptoStore) writeKeyBlob(ctx context.Context, name string, dataKey []byte) error {
+	keyBlob, err := wrapKey(cs.activeKey, dataKey, name)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key of blob: %s, err: %v", name, err)
+	}
+	if _, err := cs.store.Put(ctx, name+keySuffix, bytes.NewReader(keyBlob)); err != nil {
+		return fmt.Errorf("failed to write data key of blob: %s, err: %w", name, err)
+	}
+	return nil
+}
+
+type stagedEncryptedBlob struct {
+	store   *cryptoStore
+	staged  blobstore.StagedBlob
+	dataKey []byte
+	size    int64
+	digest  string
+}
+
+// Size returns the plaintext size
+func (sb *stagedEncryptedBlob) Size() int64 {
+	return sb.size
+}
+
+// Digest returns the digest of the plaintext
+func (sb *stagedEncryptedBlob) Digest() string {
+	return sb.digest
+}
+
+// Commit writes the wrapped data key and then makes the encrypted blob visible under the name given by the active master key
+func (sb *stagedEncryptedBlob) Commit(ctx context.Context, key string) error {
+	name := blobName(sb.store.activeKey, key)
+	if err := sb.store.writeKeyBlob(ctx, name, sb.dataKey); err != nil {
+		return err
+	}
+	if err := sb.staged.Commit(ctx, name); err != nil {
+		_ = sb.store.store.Delete(ctx, name+keySuffix)
+		return err
+	}
+	return nil
+}
+
+func (sb *stagedEncryptedBlob) Abort() error {
+	return sb.staged.Abort()
+}
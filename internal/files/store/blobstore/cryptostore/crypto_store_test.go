@@ -0,0 +1,388 @@
+package cryptostore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+)
+
+func newTestMasterKey(t *testing.T, seed string) MasterKey {
+	hash := sha256.Sum256([]byte(seed))
+	masterKey, err := NewMasterKey(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return masterKey
+}
+
+func sampleContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func readBlob(store blobstore.BlobStore, key string) ([]byte, error) {
+	content, err := store.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return io.ReadAll(content)
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	dir := t.TempDir()
+	rawKey := sampleContent(masterKeySize)
+	_ = os.WriteFile(filepath.Join(dir, "raw.key"), rawKey, 0o600)
+	_ = os.WriteFile(filepath.Join(dir, "hex.key"), []byte(hex.EncodeToString(rawKey)+"\n"), 0o600)
+	_ = os.WriteFile(filepath.Join(dir, "short.key"), []byte("abcd"), 0o600)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "raw keyfile", path: filepath.Join(dir, "raw.key"), wantErr: false},
+		{name: "hex keyfile", path: filepath.Join(dir, "hex.key"), wantErr: false},
+		{name: "too short keyfile", path: filepath.Join(dir, "short.key"), wantErr: true},
+		{name: "missing keyfile", path: filepath.Join(dir, "missing.key"), wantErr: true},
+	}
+	want, _ := NewMasterKey(rawKey)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadMasterKey(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadMasterKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.ID != want.ID {
+				t.Errorf("LoadMasterKey() id = %s, want %s", got.ID, want.ID)
+			}
+		})
+	}
+}
+
+func Test_plainSize(t *testing.T) {
+	for _, size := range []int64{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		got, err := plainSize(cipherSize(size))
+		if err != nil || got != size {
+			t.Errorf("plainSize(cipherSize(%d)) = %d, err = %v", size, got, err)
+		}
+	}
+	if _, err := plainSize(headerSize + tagSize - 1); err == nil {
+		t.Errorf("plainSize() expected error for too small blob")
+	}
+}
+
+func Test_cryptoStore_PutAndGet(t *testing.T) {
+	for _, size := range []int{0, 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		ctx := context.Background()
+		inner := memstore.NewMemoryStore()
+		store, _ := NewCryptoStore(inner, newTestMasterKey(t, "active"))
+		content := sampleContent(size)
+
+		staged, err := store.Stage(ctx, bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Stage() error = %v", err)
+		}
+		plainDigest := sha256.Sum256(content)
+		if staged.Size() != int64(size) || staged.Digest() != hex.EncodeToString(plainDigest[:]) {
+			t.Errorf("Stage() size = %d, digest = %s, want the plaintext ones", staged.Size(), staged.Digest())
+		}
+		if err := staged.Commit(ctx, "sample"); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+
+		got, err := readBlob(store, "sample")
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("Get() size %d, got %d bytes, err = %v", size, len(got), err)
+		}
+		stored, _ := readBlob(inner, "sample")
+		if int64(len(stored)) != cipherSize(int64(size)) || (size > 0 && bytes.Contains(stored, content)) {
+			t.Errorf("stored blob of size %d is not encrypted, got %d bytes", size, len(stored))
+		}
+
+		info, err := store.Stat(ctx, "sample")
+		if err != nil || info.Size != int64(size) {
+			t.Errorf("Stat() got = %+v, err = %v", info, err)
+		}
+		blobs, err := store.List(ctx)
+		if err != nil || len(blobs) != 1 || blobs[0].Key != "sample" || blobs[0].Size != int64(size) {
+			t.Errorf("List() got = %+v, err = %v", blobs, err)
+		}
+
+		if err := store.Delete(ctx, "sample"); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+		if blobs, _ := inner.List(ctx); len(blobs) != 0 {
+			t.Errorf("Delete() left blobs behind: %+v", blobs)
+		}
+	}
+}
+
+func Test_cryptoStore_RangeRead(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewCryptoStore(memstore.NewMemoryStore(), newTestMasterKey(t, "active"))
+	content := sampleContent(3*chunkSize + 5)
+	if _, err := store.Put(ctx, "sample", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := store.Get(ctx, "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	tests := []struct {
+		offset int64
+		length int
+	}{
+		{offset: chunkSize - 10, length: 20},
+		{offset: 2*chunkSize + 3, length: chunkSize + 2},
+		{offset: 5, length: 10},
+	}
+	for _, tt := range tests {
+		if _, err := reader.Seek(tt.offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, tt.length)
+		if _, err := io.ReadFull(reader, got); err != nil {
+			t.Fatalf("Read() at %d error = %v", tt.offset, err)
+		}
+		if !bytes.Equal(got, content[tt.offset:tt.offset+int64(tt.length)]) {
+			t.Errorf("Read() at %d content mismatch", tt.offset)
+		}
+	}
+}
+
+func Test_cryptoStore_Tampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(stored []byte) []byte
+	}{
+		{
+			name: "modified byte",
+			tamper: func(stored []byte) []byte {
+				stored[headerSize+10] ^= 1
+				return stored
+			},
+		},
+		{
+			name: "truncated at chunk boundary",
+			tamper: func(stored []byte) []byte {
+				return stored[:headerSize+chunkSize+tagSize]
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			inner := memstore.NewMemoryStore()
+			store, _ := NewCryptoStore(inner, newTestMasterKey(t, "active"))
+			if _, err := store.Put(ctx, "sample", bytes.NewReader(sampleContent(2*chunkSize))); err != nil {
+				t.Fatal(err)
+			}
+			stored, _ := readBlob(inner, "sample")
+			_, _ = inner.Put(ctx, "sample", bytes.NewReader(tt.tamper(stored)))
+
+			if _, err := readBlob(store, "sample"); err == nil {
+				t.Errorf("Get() expected error for tampered blob")
+			}
+		})
+	}
+}
+
+func Test_cryptoStore_RotateKeys(t *testing.T) {
+	ctx := context.Background()
+	inner := memstore.NewMemoryStore()
+	oldKey := newTestMasterKey(t, "old")
+	newKey := newTestMasterKey(t, "new")
+	content := sampleContent(chunkSize + 1)
+
+	oldStore, _ := NewCryptoStore(inner, oldKey)
+	for _, key := range []string{"a", "b"} {
+		if _, err := oldStore.Put(ctx, key, bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// written before the encryption was enabled
+	_, _ = inner.Put(ctx, "legacy", bytes.NewReader([]byte("legacy")))
+	storedBefore, _ := readBlob(inner, "a")
+
+	if _, err := readBlob(mustCryptoStore(t, inner, newKey), "a"); err == nil {
+		t.Errorf("Get() expected error without the old master key")
+	}
+
+	rotatingStore := mustCryptoStore(t, inner, newKey, oldKey)
+	rotated, err := rotatingStore.(blobstore.KeyRotator).RotateKeys(ctx)
+	if err != nil || rotated != 2 {
+		t.Fatalf("RotateKeys() rotated = %d, err = %v", rotated, err)
+	}
+	if rotated, err := rotatingStore.(blobstore.KeyRotator).RotateKeys(ctx); err != nil || rotated != 0 {
+		t.Errorf("RotateKeys() again rotated = %d, err = %v", rotated, err)
+	}
+
+	storedAfter, _ := readBlob(inner, "a")
+	if !bytes.Equal(storedBefore, storedAfter) {
+		t.Errorf("RotateKeys() rewrote the encrypted blob")
+	}
+	newStore := mustCryptoStore(t, inner, newKey)
+	for _, key := range []string{"a", "b"} {
+		if got, err := readBlob(newStore, key); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("Get() after rotation key: %s, err = %v", key, err)
+		}
+	}
+	if got, err := readBlob(newStore, "legacy"); err != nil || string(got) != "legacy" {
+		t.Errorf("Get() legacy blob got = %s, err = %v", got, err)
+	}
+}
+
+func Test_cryptoStore_swappedKeyBlob(t *testing.T) {
+	ctx := context.Background()
+	inner := memstore.NewMemoryStore()
+	store := mustCryptoStore(t, inner, newTestMasterKey(t, "active"))
+	for _, key := range []string{"a", "b"} {
+		if _, err := store.Put(ctx, key, bytes.NewReader(sampleContent(10))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyBlob, _ := readBlob(inner, "b"+keySuffix)
+	_, _ = inner.Put(ctx, "a"+keySuffix, bytes.NewReader(keyBlob))
+
+	if _, err := readBlob(store, "a"); err == nil {
+		t.Errorf("Get() expected error for a data key of another blob")
+	}
+}
+
+func Test_cryptoStore_digestNames(t *testing.T) {
+	ctx := context.Background()
+	inner := memstore.NewMemoryStore()
+	activeKey := newTestMasterKey(t, "active")
+	store := mustCryptoStore(t, inner, activeKey)
+	content := sampleContent(10)
+	digest := sha256.Sum256(content)
+	key := hex.EncodeToString(digest[:])
+
+	if _, err := store.Put(ctx, key, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	innerBlobs, _ := inner.List(ctx)
+	if len(innerBlobs) != 2 {
+		t.Fatalf("Put() stored blobs = %+v, want the blob and its data key", innerBlobs)
+	}
+	for _, blob := range innerBlobs {
+		if strings.Contains(blob.Key, key) {
+			t.Errorf("Put() stored blob: %s named after the digest", blob.Key)
+		}
+	}
+	if name := blobName(activeKey, key); name == blobName(newTestMasterKey(t, "other"), key) || !strings.HasPrefix(store.Path(key), name) {
+		t.Errorf("blobName() = %s is not given by the master key", name)
+	}
+
+	if got, err := readBlob(store, key); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Get() got %d bytes, err = %v", len(got), err)
+	}
+	if info, err := store.Stat(ctx, key); err != nil || info.Key != key || info.Size != int64(len(content)) {
+		t.Errorf("Stat() got = %+v, err = %v", info, err)
+	}
+	if blobs, err := store.List(ctx); err != nil || len(blobs) != 1 || blobs[0].Key != key || blobs[0].Size != int64(len(content)) {
+		t.Errorf("List() got = %+v, err = %v", blobs, err)
+	}
+	// the blobs named with a master key which is not configured can not be listed
+	if blobs, err := mustCryptoStore(t, inner, newTestMasterKey(t, "other")).List(ctx); err != nil || len(blobs) != 0 {
+		t.Errorf("List() with another master key got = %+v, err = %v", blobs, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if blobs, _ := inner.List(ctx); len(blobs) != 0 {
+		t.Errorf("Delete() left blobs behind: %+v", blobs)
+	}
+	if err := store.Delete(ctx, key); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Delete() of a deleted blob error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_cryptoStore_RotateKeys_renamesBlobs(t *testing.T) {
+	ctx := context.Background()
+	inner := memstore.NewMemoryStore()
+	oldKey := newTestMasterKey(t, "old")
+	newKey := newTestMasterKey(t, "new")
+
+	contents := make(map[string][]byte)
+	for _, size := range []int{10, chunkSize + 1} {
+		content := sampleContent(size)
+		digest := sha256.Sum256(content)
+		contents[hex.EncodeToString(digest[:])] = content
+	}
+	keys := make([]string, 0, len(contents))
+	for key := range contents {
+		keys = append(keys, key)
+	}
+	// named with the old master key
+	if _, err := mustCryptoStore(t, inner, oldKey).Put(ctx, keys[0], bytes.NewReader(contents[keys[0]])); err != nil {
+		t.Fatal(err)
+	}
+	// encrypted before the blobs were named, so still stored under its digest
+	dataKey := sampleContent(dataKeySize)
+	encryptingReader, _ := newEncryptingReader(bytes.NewReader(contents[keys[1]]), dataKey)
+	_, _ = inner.Put(ctx, keys[1], encryptingReader)
+	keyBlob, _ := wrapKey(oldKey, dataKey, keys[1])
+	_, _ = inner.Put(ctx, keys[1]+keySuffix, bytes.NewReader(keyBlob))
+
+	rotatingStore := mustCryptoStore(t, inner, newKey, oldKey)
+	for _, key := range keys {
+		if got, err := readBlob(rotatingStore, key); err != nil || !bytes.Equal(got, contents[key]) {
+			t.Errorf("Get() before rotation key: %s, err = %v", key, err)
+		}
+	}
+	rotated, err := rotatingStore.(blobstore.KeyRotator).RotateKeys(ctx)
+	if err != nil || rotated != 2 {
+		t.Fatalf("RotateKeys() rotated = %d, err = %v", rotated, err)
+	}
+	if rotated, err := rotatingStore.(blobstore.KeyRotator).RotateKeys(ctx); err != nil || rotated != 0 {
+		t.Errorf("RotateKeys() again rotated = %d, err = %v", rotated, err)
+	}
+
+	innerBlobs, _ := inner.List(ctx)
+	if len(innerBlobs) != 4 {
+		t.Errorf("RotateKeys() stored blobs = %+v, want 2 blobs and their data keys", innerBlobs)
+	}
+	for _, blob := range innerBlobs {
+		name := strings.TrimSuffix(blob.Key, keySuffix)
+		if key, ok := nameKey(newKey, name); !ok || contents[key] == nil {
+			t.Errorf("RotateKeys() left blob: %s not named with the active master key", blob.Key)
+		}
+	}
+	newStore := mustCryptoStore(t, inner, newKey)
+	for _, key := range keys {
+		if got, err := readBlob(newStore, key); err != nil || !bytes.Equal(got, contents[key]) {
+			t.Errorf("Get() after rotation key: %s, err = %v", key, err)
+		}
+	}
+	if blobs, err := newStore.List(ctx); err != nil || len(blobs) != 2 {
+		t.Errorf("List() after rotation got = %+v, err = %v", blobs, err)
+	}
+}
+
+func mustCryptoStore(t *testing.T, inner blobstore.BlobStore, activeKey MasterKey, oldKeys ...MasterKey) blobstore.BlobStore {
+	store, err := NewCryptoStore(inner, activeKey, oldKeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
@@ -0,0 +1,292 @@
+package cryptostore
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// An encrypted blob starts with a header followed by the plaintext split into chunks of chunkSize bytes,
+// every chunk sealed on its own with AES-256-GCM so any byte range can be decrypted independently:
+//
+//	magic | version | chunk 0 + tag | chunk 1 + tag | ... | last chunk + tag
+//
+// The nonce of a chunk is its index, which is safe since every blob has its own data key.
+// The additional data binds the index and whether it is the last chunk, so chunks can neither be
+// reordered nor the blob be truncated at a chunk boundary. An empty blob holds a single empty chunk.
+//
+// The data key is wrapped with the master key and kept in a separate fixed size key blob,
+// so rotating the master key only rewrites the key blobs:
+//
+//	magic | version | master key id | nonce | wrapped data key + tag
+//
+// The name a blob is stored under is described in naming.go.
+const (
+	blobMagic   = "VSEN"
+	keyMagic    = "VSEK"
+	version     = 1
+	headerSize  = 4 + 1
+	chunkSize   = 64 << 10
+	tagSize     = 16
+	nonceSize   = 12
+	dataKeySize = 32
+	keyBlobSize = 4 + 1 + keyIDSize + nonceSize + dataKeySize + tagSize
+
+	// keySuffix is appended to the key of a blob to get the key of its wrapped data key
+	keySuffix = ".dek"
+)
+
+// cipherSize returns the size of the encrypted blob holding plainSize bytes
+func cipherSize(plainSize int64) int64 {
+	chunks := (plainSize + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return headerSize + plainSize + chunks*tagSize
+}
+
+// plainSize returns the size of the plaintext held by an encrypted blob of cipherSize bytes
+func plainSize(cipherSize int64) (int64, error) {
+	body := cipherSize - headerSize
+	if body < tagSize {
+		return 0, fmt.Errorf("encrypted blob is too small: %d bytes", cipherSize)
+	}
+	chunks := (body + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	if body-(chunks-1)*(chunkSize+tagSize) < tagSize {
+		return 0, fmt.Errorf("encrypted blob has invalid size: %d bytes", cipherSize)
+	}
+	return body - chunks*tagSize, nil
+}
+
+func chunkNonce(index int64) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], uint64(index))
+	return nonce
+}
+
+func chunkAdditionalData(index int64, last bool) []byte {
+	additionalData := make([]byte, 9)
+	binary.BigEndian.PutUint64(additionalData, uint64(index))
+	if last {
+		additionalData[8] = 1
+	}
+	return additionalData
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapKey seals the data key with the master key, the blob key is bound as additional data
+// so a key blob can not be swapped with the one of another blob
+func wrapKey(masterKey MasterKey, dataKey []byte, blobKey string) ([]byte, error) {
+	aead, err := newGCM(masterKey.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	keyID, err := hex.DecodeString(masterKey.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, keyBlobSize)
+	result = append(result, keyMagic...)
+	result = append(result, version)
+	result = append(result, keyID...)
+	result = append(result, nonce...)
+	return aead.Seal(result, nonce, dataKey, []byte(blobKey)), nil
+}
+
+// wrappedKeyID returns the id of the master key used to wrap the data key
+func wrappedKeyID(keyBlob []byte) (string, error) {
+	if len(keyBlob) != keyBlobSize || string(keyBlob[:4]) != keyMagic || keyBlob[4] != version {
+		return "", fmt.Errorf("invalid key blob")
+	}
+	return hex.EncodeToString(keyBlob[5 : 5+keyIDSize]), nil
+}
+
+// unwrapKey opens the data key with the master key it was wrapped with
+func unwrapKey(masterKeys map[string]MasterKey, keyBlob []byte, blobKey string) ([]byte, error) {
+	keyID, err := wrappedKeyID(keyBlob)
+	if err != nil {
+		return nil, err
+	}
+	masterKey, ok := masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key: %s", keyID)
+	}
+	aead, err := newGCM(masterKey.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := keyBlob[5+keyIDSize : 5+keyIDSize+nonceSize]
+	dataKey, err := aead.Open(nil, nonce, keyBlob[5+keyIDSize+nonceSize:], []byte(blobKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key, err: %v", err)
+	}
+	return dataKey, nil
+}
+
+// encryptingReader encrypts the content of the source chunk by chunk while it is read
+type encryptingReader struct {
+	source  *bufio.Reader
+	aead    cipher.AEAD
+	plain   []byte
+	pending []byte
+	index   int64
+	done    bool
+}
+
+func newEncryptingReader(source io.Reader, dataKey []byte) (*encryptingReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingReader{
+		source:  bufio.NewReaderSize(source, chunkSize),
+		aead:    aead,
+		plain:   make([]byte, chunkSize),
+		pending: append([]byte(blobMagic), version),
+	}, nil
+}
+
+func (er *encryptingReader) Read(p []byte) (int, error) {
+	for len(er.pending) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.sealNextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, er.pending)
+	er.pending = er.pending[n:]
+	return n, nil
+}
+
+func (er *encryptingReader) sealNextChunk() error {
+	n, err := io.ReadFull(er.source, er.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < chunkSize
+	if !last {
+		// a full chunk is the last one only when nothing follows it
+		if _, peekErr := er.source.Peek(1); peekErr == io.EOF {
+			last = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	}
+
+	er.pending = er.aead.Seal(er.pending[:0], chunkNonce(er.index), er.plain[:n], chunkAdditionalData(er.index, last))
+	er.index++
+	er.done = last
+	return nil
+}
+
+// decryptingReader decrypts the chunk holding the current offset, seeking only moves the offset
+type decryptingReader struct {
+	source     io.ReadSeekCloser
+	aead       cipher.AEAD
+	size       int64
+	offset     int64
+	chunk      []byte
+	chunkIndex int64
+	sealed     []byte
+}
+
+func newDecryptingReader(source io.ReadSeekCloser, dataKey []byte, size int64) (*decryptingReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(source, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != blobMagic || header[4] != version {
+		return nil, fmt.Errorf("invalid encrypted blob header")
+	}
+	return &decryptingReader{
+		source:     source,
+		aead:       aead,
+		size:       size,
+		chunkIndex: -1,
+		sealed:     make([]byte, chunkSize+tagSize),
+	}, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	if dr.offset >= dr.size {
+		return 0, io.EOF
+	}
+	index := dr.offset / chunkSize
+	if index != dr.chunkIndex {
+		if err := dr.openChunk(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.chunk[dr.offset-index*chunkSize:])
+	dr.offset += int64(n)
+	return n, nil
+}
+
+func (dr *decryptingReader) openChunk(index int64) error {
+	dr.chunkIndex = -1
+	if _, err := dr.source.Seek(headerSize+index*(chunkSize+tagSize), io.SeekStart); err != nil {
+		return err
+	}
+	lastIndex := (dr.size - 1) / chunkSize
+	sealedSize := int64(chunkSize + tagSize)
+	if index == lastIndex {
+		sealedSize = dr.size - index*chunkSize + tagSize
+	}
+	sealed := dr.sealed[:sealedSize]
+	if _, err := io.ReadFull(dr.source, sealed); err != nil {
+		return err
+	}
+	chunk, err := dr.aead.Open(dr.chunk[:0], chunkNonce(index), sealed, chunkAdditionalData(index, index == lastIndex))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt chunk: %d, err: %v", index, err)
+	}
+	dr.chunk = chunk
+	dr.chunkIndex = index
+	return nil
+}
+
+func (dr *decryptingReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = dr.offset + offset
+	case io.SeekEnd:
+		target = dr.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position: %d", target)
+	}
+	dr.offset = target
+	return target, nil
+}
+
+func (dr *decryptingReader) Close() error {
+	return dr.source.Close()
+}
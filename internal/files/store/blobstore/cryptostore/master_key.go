@@ -0,0 +1,56 @@
+package cryptostore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	masterKeySize = 32
+	keyIDSize     = 8
+)
+
+// MasterKey represents the key wrapping the data keys of the blobs
+type MasterKey struct {
+	// ID identifies the key without revealing it, it is stored next to every data key wrapped with it
+	ID  string
+	key []byte
+	// nameMacKey and nameEncryptionKey name the blobs keyed by their digest
+	nameMacKey        []byte
+	nameEncryptionKey []byte
+}
+
+// NewMasterKey returns new MasterKey from 32 bytes of key material
+func NewMasterKey(key []byte) (MasterKey, error) {
+	if len(key) != masterKeySize {
+		return MasterKey{}, fmt.Errorf("master key must be %d bytes, got %d", masterKeySize, len(key))
+	}
+	hash := sha256.Sum256(key)
+	nameMacKey, nameEncryptionKey := nameKeys(key)
+	return MasterKey{
+		ID:                hex.EncodeToString(hash[:keyIDSize]),
+		key:               append([]byte{}, key...),
+		nameMacKey:        nameMacKey,
+		nameEncryptionKey: nameEncryptionKey,
+	}, nil
+}
+
+// LoadMasterKey reads the master key from a keyfile holding either 32 raw bytes or 64 hex characters,
+// e.g. generated with `head -c 32 /dev/urandom | xxd -p -c 64 > master.key`
+func LoadMasterKey(path string) (MasterKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return MasterKey{}, fmt.Errorf("failed to read keyfile: %s, err: %v", path, err)
+	}
+	if len(content) == masterKeySize {
+		return NewMasterKey(content)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return MasterKey{}, fmt.Errorf("keyfile: %s must hold %d raw bytes or %d hex characters", path, masterKeySize, masterKeySize*2)
+	}
+	return NewMasterKey(key)
+}
@@ -0,0 +1,88 @@
+package cryptostore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// The blobs keyed by the SHA-256 digest of their content are not stored under the digest, which would tell anyone able
+// to list the storage whether a known video is kept. They are stored under a name derived from the digest with the master key:
+//
+//	tag | encrypted digest
+//
+// The tag is the truncated HMAC-SHA256 of the digest and also serves as the IV encrypting the digest with AES-256-CTR,
+// so the name is the same for the same digest and the digest can still be recovered from the name to list the blobs.
+// The other keys, such as the ids of the files stored before content addressing, tell nothing about the content
+// and are kept as they are.
+const (
+	nameTagSize = 16
+	nameSize    = nameTagSize + sha256.Size
+)
+
+// nameKeys derives the keys naming the blobs from the master key material
+func nameKeys(key []byte) (macKey, encryptionKey []byte) {
+	return deriveKey(key, "blob name mac"), deriveKey(key, "blob name encryption")
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// blobName returns the name the blob with specified key is stored under with the master key
+func blobName(masterKey MasterKey, key string) string {
+	digest, err := hex.DecodeString(key)
+	if err != nil || len(digest) != sha256.Size {
+		return key
+	}
+	tag := nameTag(masterKey, digest)
+	name := make([]byte, nameSize)
+	copy(name, tag)
+	if err := xorDigest(masterKey, tag, name[nameTagSize:], digest); err != nil {
+		return key
+	}
+	return hex.EncodeToString(name)
+}
+
+// nameKey returns the key of the blob stored under the name given by the master key,
+// ok is false when the name was not given by the master key
+func nameKey(masterKey MasterKey, name string) (string, bool) {
+	raw, err := hex.DecodeString(name)
+	if err != nil || len(raw) != nameSize {
+		return "", false
+	}
+	tag := raw[:nameTagSize]
+	digest := make([]byte, sha256.Size)
+	if err := xorDigest(masterKey, tag, digest, raw[nameTagSize:]); err != nil {
+		return "", false
+	}
+	if !hmac.Equal(tag, nameTag(masterKey, digest)) {
+		return "", false
+	}
+	return hex.EncodeToString(digest), true
+}
+
+// isKeyedName reports whether the name has the shape of a name given by a master key
+func isKeyedName(name string) bool {
+	raw, err := hex.DecodeString(name)
+	return err == nil && len(raw) == nameSize
+}
+
+func nameTag(masterKey MasterKey, digest []byte) []byte {
+	mac := hmac.New(sha256.New, masterKey.nameMacKey)
+	mac.Write(digest)
+	return mac.Sum(nil)[:nameTagSize]
+}
+
+func xorDigest(masterKey MasterKey, tag, dst, src []byte) error {
+	block, err := aes.NewCipher(masterKey.nameEncryptionKey)
+	if err != nil {
+		return err
+	}
+	cipher.NewCTR(block, tag).XORKeyStream(dst, src)
+	return nil
+}
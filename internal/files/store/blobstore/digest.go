@@ -0,0 +1,43 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// DigestReader counts and hashes (SHA-256) everything that is read through it
+type DigestReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	size   int64
+}
+
+// NewDigestReader returns new DigestReader wrapping r
+func NewDigestReader(r io.Reader) *DigestReader {
+	return &DigestReader{
+		reader: r,
+		hash:   sha256.New(),
+	}
+}
+
+// Read reads from the wrapped reader and feeds the read bytes to the hash
+func (dr *DigestReader) Read(p []byte) (int, error) {
+	n, err := dr.reader.Read(p)
+	if n > 0 {
+		_, _ = dr.hash.Write(p[:n])
+		dr.size += int64(n)
+	}
+	return n, err
+}
+
+// Size returns the number of bytes read so far
+func (dr *DigestReader) Size() int64 {
+	return dr.size
+}
+
+// Digest returns the hex encoded SHA-256 digest of the bytes read so far
+func (dr *DigestReader) Digest() string {
+	return hex.EncodeToString(dr.hash.Sum(nil))
+}
@@ -0,0 +1,27 @@
+package blobstore
+
+import (
+	"github.com/cityos-dev/Cornelius-David-Herianto/helper/disk"
+)
+
+// LocalDiskUsages returns the usage of the disk holding dir, with probe a file named with prefix is written to dir first
+func LocalDiskUsages(dir, prefix string, probe bool) ([]DiskUsage, error) {
+	if probe {
+		if err := disk.CheckWritable(dir, prefix); err != nil {
+			return nil, err
+		}
+	}
+	usage, err := disk.GetUsage(dir)
+	if err != nil {
+		return nil, err
+	}
+	return []DiskUsage{
+		{
+			Path:        dir,
+			FreeBytes:   usage.FreeBytes,
+			TotalBytes:  usage.TotalBytes,
+			FreeInodes:  usage.FreeInodes,
+			TotalInodes: usage.TotalInodes,
+		},
+	}, nil
+}
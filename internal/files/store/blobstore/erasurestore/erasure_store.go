@@ -0,0 +1,525 @@
+package erasurestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/klauspost/reedsolomon"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+const (
+	// DefaultBlockSize is the number of bytes every shard holds per stripe
+	DefaultBlockSize = 256 << 10
+
+	maxShards    = 256
+	maxBlockSize = 1 << 30
+)
+
+// Shard represents one of the blob storages holding a shard of every blob, usually a directory on its own disk
+type Shard struct {
+	Name  string
+	Store blobstore.BlobStore
+}
+
+type erasureStore struct {
+	shards       []Shard
+	dataShards   int
+	parityShards int
+	blockSize    int64
+	encoder      reedsolomon.Encoder
+}
+
+// NewErasureStore returns new blob store splitting every blob into dataShards data shards plus
+// len(shards)-dataShards parity shards using Reed-Solomon coding, one shard per store.
+// A blob stays readable as long as at most the number of parity shards are missing.
+func NewErasureStore(shards []Shard, dataShards int, blockSize int64) (blobstore.BlobStore, error) {
+	parityShards := len(shards) - dataShards
+	if dataShards < 1 || parityShards < 1 || len(shards) > maxShards {
+		return nil, fmt.Errorf("invalid shards, got %d shards with %d data shards", len(shards), dataShards)
+	}
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+	if blockSize < 0 || blockSize > maxBlockSize {
+		return nil, fmt.Errorf("invalid block size: %d", blockSize)
+	}
+	names := make(map[string]bool)
+	for _, shard := range shards {
+		if shard.Name == "" || names[shard.Name] {
+			return nil, fmt.Errorf("shard name must be unique and not empty, got: %q", shard.Name)
+		}
+		names[shard.Name] = true
+	}
+	encoder, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	return &erasureStore{
+		shards:       shards,
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		blockSize:    blockSize,
+		encoder:      encoder,
+	}, nil
+}
+
+// Put encodes the content of r into the shards and returns the written size
+func (es *erasureStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	staged, err := es.Stage(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = staged.Abort()
+	}()
+	if err := staged.Commit(ctx, key); err != nil {
+		return 0, err
+	}
+	return staged.Size(), nil
+}
+
+// Stage encodes the content of r stripe by stripe and stages every shard on its store
+func (es *erasureStore) Stage(ctx context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	digestReader := blobstore.NewDigestReader(r)
+	writers, wait := es.stageShards(ctx, allShards(len(es.shards)))
+
+	blocks := newBlocks(len(es.shards), es.blockSize)
+	stripe := make([]byte, es.stripeSize())
+	size := int64(0)
+	err := func() error {
+		for {
+			n, err := io.ReadFull(digestReader, stripe)
+			if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				return nil
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			size += int64(n)
+
+			// the last stripe is padded with zeroes
+			for i := n; i < len(stripe); i++ {
+				stripe[i] = 0
+			}
+			for i := 0; i < es.dataShards; i++ {
+				copy(blocks[i], stripe[int64(i)*es.blockSize:])
+			}
+			if err := es.encoder.Encode(blocks); err != nil {
+				return err
+			}
+			if err := writeBlocks(writers, blocks); err != nil {
+				return err
+			}
+			if n < len(stripe) {
+				return nil
+			}
+		}
+	}()
+	if err == nil {
+		err = es.writeTrailers(writers, es.blockSize, size)
+	}
+	staged, stageErr := closeAndWait(writers, wait, err)
+	if err == nil {
+		err = stageErr
+	}
+	if err != nil {
+		for _, shard := range staged {
+			if shard != nil {
+				_ = shard.Abort()
+			}
+		}
+		return nil, fmt.Errorf("failed to stage shards, err: %w", err)
+	}
+
+	return &stagedShards{
+		store:  es,
+		staged: staged,
+		size:   size,
+		digest: digestReader.Digest(),
+	}, nil
+}
+
+// Get opens the blob for reading, the stripes are decoded lazily so only the read ranges are fetched
+func (es *erasureStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	set, err := es.openShards(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if set.available() < es.dataShards {
+		err := set.notEnoughShardsError(key)
+		set.close()
+		return nil, err
+	}
+	return &erasureReader{
+		set:         set,
+		blocks:      newBlocks(len(es.shards), set.trailer.blockSize),
+		stripeIndex: -1,
+	}, nil
+}
+
+// Stat returns the detail of the blob from the first readable shard
+func (es *erasureStore) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	set, err := es.openShards(ctx, key)
+	if err != nil {
+		return blobstore.BlobInfo{}, err
+	}
+	defer set.close()
+	if set.available() == 0 {
+		return blobstore.BlobInfo{}, set.notEnoughShardsError(key)
+	}
+
+	for i, shard := range es.shards {
+		if set.readers[i] == nil {
+			continue
+		}
+		info, err := shard.Store.Stat(ctx, key)
+		if err != nil {
+			continue
+		}
+		return blobstore.BlobInfo{
+			Key:     key,
+			Path:    info.Path,
+			Size:    set.trailer.size,
+			ModTime: info.ModTime,
+		}, nil
+	}
+	return blobstore.BlobInfo{}, set.notEnoughShardsError(key)
+}
+
+// Delete removes every shard of the blob, it only fails when a store holding a shard can not remove it
+func (es *erasureStore) Delete(ctx context.Context, key string) error {
+	var firstErr error
+	deleted := false
+	for _, shard := range es.shards {
+		err := shard.Store.Delete(ctx, key)
+		if err == nil {
+			deleted = true
+			continue
+		}
+		if !errors.Is(err, blobstore.ErrorNotFound) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to delete shard: %s, err: %w", shard.Name, err)
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if !deleted {
+		return fmt.Errorf("%w: %s", blobstore.ErrorNotFound, key)
+	}
+	return nil
+}
+
+// List returns the detail of every blob having at least one shard
+func (es *erasureStore) List(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	keys := make(map[string]bool)
+	for _, shard := range es.shards {
+		shardBlobs, err := shard.Store.List(ctx)
+		if err != nil {
+			return []blobstore.BlobInfo{}, fmt.Errorf("failed to list shard: %s, err: %w", shard.Name, err)
+		}
+		for _, blob := range shardBlobs {
+			keys[blob.Key] = true
+		}
+	}
+
+	result := make([]blobstore.BlobInfo, 0, len(keys))
+	for key := range keys {
+		info, err := es.Stat(ctx, key)
+		if err != nil {
+			return []blobstore.BlobInfo{}, err
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// Path returns the path of the shards of the blob, relative to the root of every shard store
+func (es *erasureStore) Path(key string) string {
+	return es.shards[0].Store.Path(key)
+}
+
+// MigrateLayout migrates the layout of every shard store supporting it
+func (es *erasureStore) MigrateLayout(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	moved := make([]blobstore.BlobInfo, 0)
+	for _, shard := range es.shards {
+		migrator, ok := shard.Store.(blobstore.LayoutMigrator)
+		if !ok {
+			continue
+		}
+		shardMoved, err := migrator.MigrateLayout(ctx)
+		moved = append(moved, shardMoved...)
+		if err != nil {
+			return moved, fmt.Errorf("failed to migrate shard: %s, err: %w", shard.Name, err)
+		}
+	}
+	return moved, nil
+}
+
+// DiskUsages returns the usage of the disks of every shard
+func (es *erasureStore) DiskUsages(ctx context.Context, probe bool) ([]blobstore.DiskUsage, error) {
+	usages := make([]blobstore.DiskUsage, 0, len(es.shards))
+	for _, shard := range es.shards {
+		diskUser, ok := shard.Store.(blobstore.DiskUser)
+		if !ok {
+			continue
+		}
+		shardUsages, err := diskUser.DiskUsages(ctx, probe)
+		if err != nil {
+			return usages, fmt.Errorf("failed to check disk of shard: %s, err: %w", shard.Name, err)
+		}
+		usages = append(usages, shardUsages...)
+	}
+	return usages, nil
+}
+
+// CleanTemp removes the temporary content of every shard
+func (es *erasureStore) CleanTemp(ctx context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	removed := make([]blobstore.BlobInfo, 0)
+	for _, shard := range es.shards {
+		cleaner, ok := shard.Store.(blobstore.TempCleaner)
+		if !ok {
+			continue
+		}
+		shardRemoved, err := cleaner.CleanTemp(ctx, before, dryRun)
+		removed = append(removed, shardRemoved...)
+		if err != nil {
+			return removed, fmt.Errorf("failed to clean temporary content of shard: %s, err: %w", shard.Name, err)
+		}
+	}
+	return removed, nil
+}
+
+// ReplicaStates returns the state of every shard of the blob, a shard is healthy when its trailer and size match the blob
+func (es *erasureStore) ReplicaStates(ctx context.Context, key string, size int64) ([]blobstore.ReplicaState, error) {
+	set, err := es.openShards(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer set.close()
+
+	states := make([]blobstore.ReplicaState, 0, len(es.shards))
+	for i, shard := range es.shards {
+		state := set.states[i]
+		if state == blobstore.ReplicaStateHealthy && set.trailer.size != size {
+			state = blobstore.ReplicaStateMismatch
+		}
+		states = append(states, blobstore.ReplicaState{
+			Replica: shard.Name,
+			State:   state,
+		})
+	}
+	return states, nil
+}
+
+// Repair rebuilds the missing and mismatched shards of the blob from the healthy ones and returns the number of rebuilt shards
+func (es *erasureStore) Repair(ctx context.Context, key string, size int64) (int, error) {
+	set, err := es.openShards(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer set.close()
+
+	broken := make([]int, 0)
+	for i, state := range set.states {
+		if state == blobstore.ReplicaStateMissing || state == blobstore.ReplicaStateMismatch {
+			broken = append(broken, i)
+		}
+	}
+	if len(broken) == 0 {
+		return 0, nil
+	}
+	if set.available() < es.dataShards {
+		return 0, set.notEnoughShardsError(key)
+	}
+	if set.trailer.size != size {
+		return 0, fmt.Errorf("size of blob: %s is %d, want %d", key, set.trailer.size, size)
+	}
+
+	writers, wait := es.stageShards(ctx, broken)
+	blocks := newBlocks(len(es.shards), set.trailer.blockSize)
+	err = func() error {
+		for stripeIndex := int64(0); stripeIndex < set.trailer.stripes(); stripeIndex++ {
+			if err := set.readStripe(stripeIndex, blocks, true); err != nil {
+				return err
+			}
+			if err := writeBlocks(writers, blocks); err != nil {
+				return err
+			}
+		}
+		return es.writeTrailers(writers, set.trailer.blockSize, set.trailer.size)
+	}()
+	staged, stageErr := closeAndWait(writers, wait, err)
+	if err == nil {
+		err = stageErr
+	}
+
+	restored := 0
+	for _, i := range broken {
+		if staged[i] == nil {
+			continue
+		}
+		if err == nil {
+			err = staged[i].Commit(ctx, key)
+			if err == nil {
+				restored++
+			}
+		}
+		_ = staged[i].Abort()
+	}
+	if err != nil {
+		return restored, fmt.Errorf("failed to rebuild shards of blob: %s, err: %w", key, err)
+	}
+	return restored, nil
+}
+
+func (es *erasureStore) stripeSize() int64 {
+	return int64(es.dataShards) * es.blockSize
+}
+
+func (es *erasureStore) writeTrailers(writers []*io.PipeWriter, blockSize, size int64) error {
+	for i, writer := range writers {
+		if writer == nil {
+			continue
+		}
+		shardTrailer := trailer{
+			dataShards:   es.dataShards,
+			parityShards: es.parityShards,
+			index:        i,
+			blockSize:    blockSize,
+			size:         size,
+		}
+		if _, err := writer.Write(shardTrailer.marshal()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageShards starts staging the specified shards, the content is written through the returned pipes
+func (es *erasureStore) stageShards(ctx context.Context, indexes []int) ([]*io.PipeWriter, <-chan stageResult) {
+	writers := make([]*io.PipeWriter, len(es.shards))
+	results := make(chan stageResult, len(indexes))
+	for _, i := range indexes {
+		pipeReader, pipeWriter := io.Pipe()
+		writers[i] = pipeWriter
+		go func(i int, pipeReader *io.PipeReader) {
+			staged, err := es.shards[i].Store.Stage(ctx, pipeReader)
+			if err != nil {
+				err = fmt.Errorf("shard: %s, err: %w", es.shards[i].Name, err)
+			}
+			// unblock the writer when the store stopped reading early
+			_ = pipeReader.CloseWithError(io.ErrClosedPipe)
+			results <- stageResult{index: i, staged: staged, err: err}
+		}(i, pipeReader)
+	}
+	return writers, results
+}
+
+type stageResult struct {
+	index  int
+	staged blobstore.StagedBlob
+	err    error
+}
+
+// closeAndWait closes the pipes, failing the staging when writeErr is set, and collects the staged shards
+func closeAndWait(writers []*io.PipeWriter, results <-chan stageResult, writeErr error) ([]blobstore.StagedBlob, error) {
+	pending := 0
+	for _, writer := range writers {
+		if writer == nil {
+			continue
+		}
+		pending++
+		if writeErr != nil {
+			_ = writer.CloseWithError(writeErr)
+		} else {
+			_ = writer.Close()
+		}
+	}
+
+	staged := make([]blobstore.StagedBlob, len(writers))
+	var err error
+	for ; pending > 0; pending-- {
+		result := <-results
+		staged[result.index] = result.staged
+		if result.err != nil && err == nil {
+			err = result.err
+		}
+	}
+	return staged, err
+}
+
+func writeBlocks(writers []*io.PipeWriter, blocks [][]byte) error {
+	for i, writer := range writers {
+		if writer == nil {
+			continue
+		}
+		if _, err := writer.Write(blocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newBlocks(count int, blockSize int64) [][]byte {
+	blocks := make([][]byte, count)
+	for i := range blocks {
+		blocks[i] = make([]byte, blockSize)
+	}
+	return blocks
+}
+
+func allShards(count int) []int {
+	indexes := make([]int, count)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+type stagedShards struct {
+	store  *erasureStore
+	staged []blobstore.StagedBlob
+	size   int64
+	digest string
+}
+
+func (ss *stagedShards) Size() int64 {
+	return ss.size
+}
+
+func (ss *stagedShards) Digest() string {
+	return ss.digest
+}
+
+// Commit commits every shard, the already committed shards are removed again when one of them fails
+func (ss *stagedShards) Commit(ctx context.Context, key string) error {
+	for i, staged := range ss.staged {
+		if err := staged.Commit(ctx, key); err != nil {
+			for _, shard := range ss.store.shards[:i] {
+				_ = shard.Store.Delete(ctx, key)
+			}
+			return fmt.Errorf("failed to commit shard: %s, err: %w", ss.store.shards[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Abort discards the shards which are not committed yet
+func (ss *stagedShards) Abort() error {
+	var firstErr error
+	for _, staged := range ss.staged {
+		if err := staged.Abort(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,338 @@
+package erasurestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+)
+
+const (
+	testDataShards = 3
+	testBlockSize  = 16
+)
+
+// countingStore counts the bytes read from the blobs of the wrapped store
+type countingStore struct {
+	blobstore.BlobStore
+	read *int64
+}
+
+func (cs countingStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	reader, err := cs.BlobStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadSeekCloser: reader, read: cs.read}, nil
+}
+
+type countingReader struct {
+	io.ReadSeekCloser
+	read *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadSeekCloser.Read(p)
+	*cr.read += int64(n)
+	return n, err
+}
+
+func newTestStore(t *testing.T) (*erasureStore, []Shard, *int64) {
+	read := new(int64)
+	shards := make([]Shard, 0)
+	for i := 0; i < testDataShards+2; i++ {
+		name := fmt.Sprintf("disk%d", i)
+		store, err := localstore.NewLocalStore(filepath.Join(t.TempDir(), name), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, Shard{Name: name, Store: countingStore{BlobStore: store, read: read}})
+	}
+	store, err := NewErasureStore(shards, testDataShards, testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*erasureStore), shards, read
+}
+
+func sampleContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i*7 + i/256)
+	}
+	return content
+}
+
+func readAll(store blobstore.BlobStore, key string) ([]byte, error) {
+	reader, err := store.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func TestNewErasureStore(t *testing.T) {
+	tests := []struct {
+		name       string
+		shards     []Shard
+		dataShards int
+		blockSize  int64
+		wantErr    bool
+	}{
+		{
+			name:       "no parity shard",
+			shards:     []Shard{{Name: "disk0"}, {Name: "disk1"}},
+			dataShards: 2,
+			wantErr:    true,
+		},
+		{
+			name:       "no data shard",
+			shards:     []Shard{{Name: "disk0"}, {Name: "disk1"}},
+			dataShards: 0,
+			wantErr:    true,
+		},
+		{
+			name:       "duplicated shard name",
+			shards:     []Shard{{Name: "disk0"}, {Name: "disk0"}},
+			dataShards: 1,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid block size",
+			shards:     []Shard{{Name: "disk0"}, {Name: "disk1"}},
+			dataShards: 1,
+			blockSize:  -1,
+			wantErr:    true,
+		},
+		{
+			name:       "successfully get new erasure store",
+			shards:     []Shard{{Name: "disk0"}, {Name: "disk1"}, {Name: "disk2"}},
+			dataShards: 2,
+			wantErr:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewErasureStore(tt.shards, tt.dataShards, tt.blockSize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewErasureStore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.(*erasureStore).blockSize != DefaultBlockSize {
+				t.Errorf("NewErasureStore() block size = %d, want %d", got.(*erasureStore).blockSize, DefaultBlockSize)
+			}
+		})
+	}
+}
+
+func Test_erasureStore_PutAndGet(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		missingShards []int
+		wantErr       error
+	}{
+		{name: "empty blob", size: 0},
+		{name: "blob smaller than a block", size: 5},
+		{name: "blob filling whole stripes", size: 2 * testDataShards * testBlockSize},
+		{name: "blob with partial last stripe", size: 1000},
+		{name: "missing data shard", size: 1000, missingShards: []int{1}},
+		{name: "missing as many shards as parity shards", size: 1000, missingShards: []int{0, 2}},
+		{name: "missing parity shards", size: 1000, missingShards: []int{3, 4}},
+		{name: "missing too many shards", size: 1000, missingShards: []int{0, 1, 4}, wantErr: errors.New("not enough shards")},
+		{name: "missing all shards", size: 1000, missingShards: []int{0, 1, 2, 3, 4}, wantErr: blobstore.ErrorNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, shards, _ := newTestStore(t)
+			content := sampleContent(tt.size)
+
+			written, err := store.Put(ctx, "sample", bytes.NewReader(content))
+			if err != nil || written != int64(tt.size) {
+				t.Fatalf("Put() written = %d, error = %v", written, err)
+			}
+			for _, i := range tt.missingShards {
+				if err := shards[i].Store.Delete(ctx, "sample"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := readAll(store, "sample")
+			if tt.wantErr != nil {
+				if err == nil || !(errors.Is(err, tt.wantErr) || strings.Contains(err.Error(), tt.wantErr.Error())) {
+					t.Errorf("Get() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("Get() content mismatch, got %d bytes, want %d bytes", len(got), len(content))
+			}
+
+			info, err := store.Stat(ctx, "sample")
+			if err != nil || info.Size != int64(tt.size) {
+				t.Errorf("Stat() got = %+v, err = %v", info, err)
+			}
+		})
+	}
+}
+
+func Test_erasureStore_RangeRead(t *testing.T) {
+	ctx := context.Background()
+	store, shards, read := newTestStore(t)
+	content := sampleContent(1000)
+	if _, err := store.Put(ctx, "sample", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	// a data shard is missing, so the stripes have to be reconstructed
+	if err := shards[0].Store.Delete(ctx, "sample"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := store.Get(ctx, "sample")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer reader.Close()
+
+	*read = 0
+	if _, err := reader.Seek(500, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 40)
+	if _, err := io.ReadFull(reader, got); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !bytes.Equal(got, content[500:540]) {
+		t.Errorf("Read() got = %v, want %v", got, content[500:540])
+	}
+
+	// bytes 500-539 are held by 2 stripes, only those are read from the data shards needed to decode them
+	if want := int64(2 * testDataShards * testBlockSize); *read != want {
+		t.Errorf("Read() read %d bytes from the shards, want %d", *read, want)
+	}
+
+	if _, err := reader.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(tail, content[990:]) {
+		t.Errorf("Read() tail = %v, err = %v", tail, err)
+	}
+}
+
+func Test_erasureStore_Repair(t *testing.T) {
+	ctx := context.Background()
+	store, shards, _ := newTestStore(t)
+	content := sampleContent(1000)
+	if _, err := store.Put(ctx, "sample", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shards[1].Store.Delete(ctx, "sample"); err != nil {
+		t.Fatal(err)
+	}
+	// a shard of another blob has a valid trailer but does not belong to this blob
+	if _, err := shards[3].Store.Put(ctx, "sample", strings.NewReader("truncated")); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := store.ReplicaStates(ctx, "sample", 1000)
+	if err != nil {
+		t.Fatalf("ReplicaStates() error = %v", err)
+	}
+	gotStates := make([]string, 0)
+	for _, state := range states {
+		gotStates = append(gotStates, state.State)
+	}
+	wantStates := []string{
+		blobstore.ReplicaStateHealthy, blobstore.ReplicaStateMissing, blobstore.ReplicaStateHealthy,
+		blobstore.ReplicaStateMismatch, blobstore.ReplicaStateHealthy,
+	}
+	if !reflect.DeepEqual(gotStates, wantStates) {
+		t.Errorf("ReplicaStates() got = %v, want %v", gotStates, wantStates)
+	}
+
+	restored, err := store.Repair(ctx, "sample", 1000)
+	if err != nil || restored != 2 {
+		t.Fatalf("Repair() restored = %d, err = %v", restored, err)
+	}
+	if restored, err := store.Repair(ctx, "sample", 1000); err != nil || restored != 0 {
+		t.Errorf("Repair() again restored = %d, err = %v", restored, err)
+	}
+
+	// the rebuilt shards are enough to read the blob without the other ones
+	for _, i := range []int{0, 2} {
+		if err := shards[i].Store.Delete(ctx, "sample"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := readAll(store, "sample")
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Get() after repair err = %v", err)
+	}
+}
+
+func Test_erasureStore_StageFailure(t *testing.T) {
+	ctx := context.Background()
+	store, shards, _ := newTestStore(t)
+
+	reader := io.MultiReader(bytes.NewReader(sampleContent(500)), iotestErrReader{})
+	if _, err := store.Stage(ctx, reader); err == nil {
+		t.Fatalf("Stage() expected error")
+	}
+
+	for _, shard := range shards {
+		blobs, err := shard.Store.List(ctx)
+		if err != nil || len(blobs) != 0 {
+			t.Errorf("shard: %s blobs = %v, err = %v", shard.Name, blobs, err)
+		}
+	}
+	if err := store.Delete(ctx, "sample"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_erasureStore_StageLeavesNoTemporaryFile(t *testing.T) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	shards := make([]Shard, 0)
+	for i := 0; i < 3; i++ {
+		store, _ := localstore.NewLocalStore(filepath.Join(rootPath, fmt.Sprint(i)), 0)
+		shards = append(shards, Shard{Name: fmt.Sprint(i), Store: store})
+	}
+	store, _ := NewErasureStore(shards, 2, testBlockSize)
+
+	staged, err := store.Stage(ctx, bytes.NewReader(sampleContent(100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Abort(); err != nil {
+		t.Fatalf("Abort() error = %v", err)
+	}
+	for i := range shards {
+		entries, _ := os.ReadDir(filepath.Join(rootPath, fmt.Sprint(i)))
+		if len(entries) != 0 {
+			t.Errorf("shard: %d is not empty after abort, got %d entries", i, len(entries))
+		}
+	}
+}
+
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
@@ -0,0 +1,82 @@
+package erasurestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Every shard file holds one block of every stripe followed by a fixed size trailer,
+// so any surviving shard is enough to know the size and the geometry of the blob:
+//
+//	block of stripe 0 | block of stripe 1 | ... | trailer
+//
+// The trailer is written last because the blob size is only known once the upload is fully read.
+const (
+	trailerMagic  = "VSEC"
+	formatVersion = 1
+	trailerSize   = 4 + 1 + 1 + 1 + 1 + 4 + 8
+)
+
+type trailer struct {
+	dataShards   int
+	parityShards int
+	index        int
+	blockSize    int64
+	size         int64
+}
+
+func (t trailer) marshal() []byte {
+	buf := make([]byte, trailerSize)
+	copy(buf, trailerMagic)
+	buf[4] = formatVersion
+	buf[5] = byte(t.dataShards)
+	buf[6] = byte(t.parityShards)
+	buf[7] = byte(t.index)
+	binary.BigEndian.PutUint32(buf[8:], uint32(t.blockSize))
+	binary.BigEndian.PutUint64(buf[12:], uint64(t.size))
+	return buf
+}
+
+func parseTrailer(buf []byte) (trailer, error) {
+	if len(buf) != trailerSize || string(buf[:4]) != trailerMagic {
+		return trailer{}, fmt.Errorf("invalid shard trailer")
+	}
+	if buf[4] != formatVersion {
+		return trailer{}, fmt.Errorf("unsupported shard format version: %d", buf[4])
+	}
+	return trailer{
+		dataShards:   int(buf[5]),
+		parityShards: int(buf[6]),
+		index:        int(buf[7]),
+		blockSize:    int64(binary.BigEndian.Uint32(buf[8:])),
+		size:         int64(binary.BigEndian.Uint64(buf[12:])),
+	}, nil
+}
+
+// readTrailer reads the trailer at the end of the shard file
+func readTrailer(shard io.ReadSeeker) (trailer, error) {
+	if _, err := shard.Seek(-trailerSize, io.SeekEnd); err != nil {
+		return trailer{}, fmt.Errorf("shard is too small, err: %v", err)
+	}
+	buf := make([]byte, trailerSize)
+	if _, err := io.ReadFull(shard, buf); err != nil {
+		return trailer{}, err
+	}
+	return parseTrailer(buf)
+}
+
+// stripeSize returns the number of blob bytes kept by a stripe
+func (t trailer) stripeSize() int64 {
+	return int64(t.dataShards) * t.blockSize
+}
+
+// stripes returns the number of stripes the blob is split into
+func (t trailer) stripes() int64 {
+	return (t.size + t.stripeSize() - 1) / t.stripeSize()
+}
+
+// shardFileSize returns the expected size of every shard file of the blob
+func (t trailer) shardFileSize() int64 {
+	return t.stripes()*t.blockSize + trailerSize
+}
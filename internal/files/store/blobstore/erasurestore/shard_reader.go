@@ -0,0 +1,199 @@
+package erasurestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// shardSet holds the opened shards of a blob, a nil reader means the shard is not usable
+type shardSet struct {
+	store   *erasureStore
+	readers []io.ReadSeekCloser
+	states  []string
+	trailer trailer
+	// unavailable is set when a shard failed for another reason than being missing
+	unavailable bool
+}
+
+// openShards opens every shard of the blob and validates its trailer against the store geometry and the other shards
+func (es *erasureStore) openShards(ctx context.Context, key string) (*shardSet, error) {
+	set := &shardSet{
+		store:   es,
+		readers: make([]io.ReadSeekCloser, len(es.shards)),
+		states:  make([]string, len(es.shards)),
+	}
+	trailerFound := false
+	for i, shard := range es.shards {
+		reader, err := shard.Store.Get(ctx, key)
+		if errors.Is(err, blobstore.ErrorNotFound) {
+			set.states[i] = blobstore.ReplicaStateMissing
+			continue
+		}
+		if err != nil {
+			set.states[i] = blobstore.ReplicaStateUnavailable
+			set.unavailable = true
+			continue
+		}
+
+		shardTrailer, err := readTrailer(reader)
+		valid := err == nil &&
+			shardTrailer.index == i &&
+			shardTrailer.dataShards == es.dataShards &&
+			shardTrailer.parityShards == es.parityShards &&
+			shardTrailer.blockSize > 0 && shardTrailer.blockSize <= maxBlockSize
+		if valid && trailerFound {
+			valid = shardTrailer.size == set.trailer.size && shardTrailer.blockSize == set.trailer.blockSize
+		}
+		if valid {
+			fileSize, seekErr := reader.Seek(0, io.SeekEnd)
+			valid = seekErr == nil && fileSize == shardTrailer.shardFileSize()
+		}
+		if !valid {
+			_ = reader.Close()
+			set.states[i] = blobstore.ReplicaStateMismatch
+			continue
+		}
+
+		if !trailerFound {
+			set.trailer = shardTrailer
+			trailerFound = true
+		}
+		set.readers[i] = reader
+		set.states[i] = blobstore.ReplicaStateHealthy
+	}
+	return set, nil
+}
+
+func (set *shardSet) available() int {
+	count := 0
+	for _, reader := range set.readers {
+		if reader != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func (set *shardSet) notEnoughShardsError(key string) error {
+	if set.available() == 0 && !set.unavailable {
+		for _, state := range set.states {
+			if state != blobstore.ReplicaStateMissing {
+				return fmt.Errorf("no readable shard of blob: %s", key)
+			}
+		}
+		return fmt.Errorf("%w: %s", blobstore.ErrorNotFound, key)
+	}
+	return fmt.Errorf("not enough shards to read blob: %s, got %d, want %d", key, set.available(), set.store.dataShards)
+}
+
+// readStripe reads the blocks of the stripe into blocks, reading just enough shards to decode it.
+// Unless full is set only the data blocks are reconstructed.
+func (set *shardSet) readStripe(stripeIndex int64, blocks [][]byte, full bool) error {
+	blockSize := set.trailer.blockSize
+	loaded := 0
+	for i, reader := range set.readers {
+		blocks[i] = blocks[i][:0]
+		if reader == nil || loaded == set.store.dataShards {
+			continue
+		}
+		block := blocks[i][:blockSize]
+		_, err := reader.Seek(stripeIndex*blockSize, io.SeekStart)
+		if err == nil {
+			_, err = io.ReadFull(reader, block)
+		}
+		if err != nil {
+			// the shard failed while reading, the stripe is decoded from the other ones
+			_ = reader.Close()
+			set.readers[i] = nil
+			set.states[i] = blobstore.ReplicaStateUnavailable
+			continue
+		}
+		blocks[i] = block
+		loaded++
+	}
+	if loaded < set.store.dataShards {
+		return fmt.Errorf("not enough shards to decode stripe: %d, got %d, want %d", stripeIndex, loaded, set.store.dataShards)
+	}
+
+	if full {
+		return set.store.encoder.Reconstruct(blocks)
+	}
+	return set.store.encoder.ReconstructData(blocks)
+}
+
+func (set *shardSet) close() {
+	for i, reader := range set.readers {
+		if reader != nil {
+			_ = reader.Close()
+			set.readers[i] = nil
+		}
+	}
+}
+
+// erasureReader reads the blob by decoding the stripe holding the current offset, seeking only moves the offset
+type erasureReader struct {
+	set         *shardSet
+	blocks      [][]byte
+	stripeIndex int64
+	offset      int64
+}
+
+func (er *erasureReader) Read(p []byte) (int, error) {
+	size := er.set.trailer.size
+	if er.offset >= size {
+		return 0, io.EOF
+	}
+
+	stripeSize := er.set.trailer.stripeSize()
+	stripeIndex := er.offset / stripeSize
+	if stripeIndex != er.stripeIndex {
+		er.stripeIndex = -1
+		if err := er.set.readStripe(stripeIndex, er.blocks, false); err != nil {
+			return 0, err
+		}
+		er.stripeIndex = stripeIndex
+	}
+
+	blockSize := er.set.trailer.blockSize
+	n := 0
+	for n < len(p) && er.offset < size && er.offset/stripeSize == stripeIndex {
+		inStripe := er.offset - stripeIndex*stripeSize
+		block := er.blocks[inStripe/blockSize]
+		end := int64(len(block))
+		if remaining := size - er.offset + inStripe%blockSize; remaining < end {
+			end = remaining
+		}
+		copied := copy(p[n:], block[inStripe%blockSize:end])
+		n += copied
+		er.offset += int64(copied)
+	}
+	return n, nil
+}
+
+func (er *erasureReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = er.offset + offset
+	case io.SeekEnd:
+		target = er.set.trailer.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position: %d", target)
+	}
+	er.offset = target
+	return target, nil
+}
+
+func (er *erasureReader) Close() error {
+	er.set.close()
+	return nil
+}
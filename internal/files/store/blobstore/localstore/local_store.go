@@ -0,0 +1,318 @@
+package localstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+const (
+	// DefaultRootPath is the root path used when none is specified
+	DefaultRootPath = "storage/videos"
+
+	// TempFilePrefix is the prefix of the temporary files holding in-progress uploads
+	TempFilePrefix = ".upload-"
+
+	// shardWidth is the number of hex characters used for every fan-out directory level
+	shardWidth = 2
+)
+
+type localStore struct {
+	rootPath     string
+	fanOutLevels int
+}
+
+// NewLocalStore returns new localStore instance which keeps the blobs under rootPath.
+// With fanOutLevels > 0 the blobs are spread over nested directories named after the key's hash prefix,
+// e.g. with 2 levels blob "abcdef..." is kept under "ab/cd/abcdef...". Blobs still kept flat are read transparently.
+func NewLocalStore(rootPath string, fanOutLevels int) (blobstore.BlobStore, error) {
+	if rootPath == "" {
+		rootPath = DefaultRootPath
+	}
+	if fanOutLevels < 0 || fanOutLevels*shardWidth > sha256.Size*2 {
+		return nil, fmt.Errorf("invalid fan-out levels: %d", fanOutLevels)
+	}
+	if err := os.MkdirAll(rootPath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %s, err: %v", rootPath, err)
+	}
+	return &localStore{
+		rootPath:     rootPath,
+		fanOutLevels: fanOutLevels,
+	}, nil
+}
+
+// Put writes the content of r to the blob with specified key and returns the written size
+func (ls *localStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	staged, err := ls.Stage(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	if err := staged.Commit(ctx, key); err != nil {
+		_ = staged.Abort()
+		return 0, err
+	}
+	return staged.Size(), nil
+}
+
+// Stage streams the content of r to a temporary file under the root path
+func (ls *localStore) Stage(_ context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	tmpFile, err := os.CreateTemp(ls.rootPath, TempFilePrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file, err: %v", err)
+	}
+
+	digestReader := blobstore.NewDigestReader(r)
+	_, err = io.Copy(tmpFile, digestReader)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return nil, fmt.Errorf("failed to write file to local storage, err: %v", err)
+	}
+
+	return &stagedFile{
+		store:   ls,
+		tmpPath: tmpFile.Name(),
+		size:    digestReader.Size(),
+		digest:  digestReader.Digest(),
+	}, nil
+}
+
+// Get opens the blob with specified key for reading
+func (ls *localStore) Get(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	relPath, err := ls.locate(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(ls.absPath(relPath))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return file, nil
+}
+
+// Stat returns the detail of the blob with specified key
+func (ls *localStore) Stat(_ context.Context, key string) (blobstore.BlobInfo, error) {
+	relPath, err := ls.locate(key)
+	if err != nil {
+		return blobstore.BlobInfo{}, err
+	}
+	info, err := os.Stat(ls.absPath(relPath))
+	if err != nil {
+		return blobstore.BlobInfo{}, mapError(err)
+	}
+	return blobstore.BlobInfo{
+		Key:     key,
+		Path:    relPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Delete removes the blob with specified key
+func (ls *localStore) Delete(_ context.Context, key string) error {
+	relPath, err := ls.locate(key)
+	if err != nil {
+		return err
+	}
+	return mapError(os.Remove(ls.absPath(relPath)))
+}
+
+// List returns the detail of all blobs kept under the root path.
+// The hidden directories are skipped, they keep data which is not a blob such as the content of the resumable uploads.
+func (ls *localStore) List(_ context.Context) ([]blobstore.BlobInfo, error) {
+	result := make([]blobstore.BlobInfo, 0)
+	err := filepath.WalkDir(ls.rootPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && filePath != ls.rootPath && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), TempFilePrefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(ls.rootPath, filePath)
+		if err != nil {
+			return err
+		}
+		result = append(result, blobstore.BlobInfo{
+			Key:     entry.Name(),
+			Path:    filepath.ToSlash(relPath),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+	return result, nil
+}
+
+// DiskUsages returns the usage of the disk holding the root path
+func (ls *localStore) DiskUsages(_ context.Context, probe bool) ([]blobstore.DiskUsage, error) {
+	return blobstore.LocalDiskUsages(ls.rootPath, TempFilePrefix, probe)
+}
+
+// CleanTemp removes the temporary files of the uploads staged before the specified time that were never committed nor aborted
+func (ls *localStore) CleanTemp(_ context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	return blobstore.CleanLocalTempFiles(ls.rootPath, TempFilePrefix, before, dryRun)
+}
+
+// Path returns the path, relative to the root path, where the blob with specified key is committed to
+func (ls *localStore) Path(key string) string {
+	source := key
+	if !isHex(key) || len(key) < ls.fanOutLevels*shardWidth {
+		hash := sha256.Sum256([]byte(key))
+		source = hex.EncodeToString(hash[:])
+	}
+
+	elems := make([]string, 0, ls.fanOutLevels+1)
+	for i := 0; i < ls.fanOutLevels; i++ {
+		elems = append(elems, source[i*shardWidth:(i+1)*shardWidth])
+	}
+	return path.Join(append(elems, key)...)
+}
+
+// MigrateLayout moves the blobs kept flat under the root path into the configured fan-out layout.
+// It is safe to run repeatedly, already migrated blobs are left untouched.
+func (ls *localStore) MigrateLayout(_ context.Context) ([]blobstore.BlobInfo, error) {
+	moved := make([]blobstore.BlobInfo, 0)
+	if ls.fanOutLevels == 0 {
+		return moved, nil
+	}
+
+	entries, err := os.ReadDir(ls.rootPath)
+	if err != nil {
+		return moved, err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), TempFilePrefix) {
+			continue
+		}
+		key := entry.Name()
+		info, err := entry.Info()
+		if err != nil {
+			return moved, err
+		}
+		target := ls.Path(key)
+		if err := os.MkdirAll(filepath.Dir(ls.absPath(target)), os.ModePerm); err != nil {
+			return moved, fmt.Errorf("failed to create directory for blob: %s, err: %v", key, err)
+		}
+		if err := os.Rename(ls.absPath(key), ls.absPath(target)); err != nil {
+			return moved, fmt.Errorf("failed to move blob: %s, err: %v", key, err)
+		}
+		moved = append(moved, blobstore.BlobInfo{
+			Key:     key,
+			Path:    target,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return moved, nil
+}
+
+// locate returns the relative path of an existing blob, looking at the fan-out layout first and then at the flat one
+func (ls *localStore) locate(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", fmt.Errorf("%w: %v", blobstore.ErrorNotFound, err)
+	}
+	candidates := []string{ls.Path(key)}
+	if ls.fanOutLevels > 0 {
+		candidates = append(candidates, key)
+	}
+	for _, candidate := range candidates {
+		_, err := os.Stat(ls.absPath(candidate))
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", blobstore.ErrorNotFound, key)
+}
+
+func (ls *localStore) absPath(relPath string) string {
+	return filepath.Join(ls.rootPath, filepath.FromSlash(relPath))
+}
+
+type stagedFile struct {
+	store     *localStore
+	tmpPath   string
+	size      int64
+	digest    string
+	committed bool
+}
+
+func (sf *stagedFile) Size() int64 {
+	return sf.size
+}
+
+func (sf *stagedFile) Digest() string {
+	return sf.digest
+}
+
+// Commit atomically renames the temporary file into its final place
+func (sf *stagedFile) Commit(_ context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	target := sf.store.absPath(sf.store.Path(key))
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for blob: %s, err: %v", key, err)
+	}
+	if err := os.Rename(sf.tmpPath, target); err != nil {
+		return fmt.Errorf("failed to move file into place, err: %v", err)
+	}
+	sf.committed = true
+	return nil
+}
+
+// Abort removes the temporary file
+func (sf *stagedFile) Abort() error {
+	if sf.committed {
+		return nil
+	}
+	return mapError(os.Remove(sf.tmpPath))
+}
+
+// validateKey makes sure the key can not refer to a path outside of its directory
+func validateKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("invalid key: %q", key)
+	}
+	return nil
+}
+
+func isHex(key string) bool {
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+func mapError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", blobstore.ErrorNotFound, err)
+	}
+	return err
+}
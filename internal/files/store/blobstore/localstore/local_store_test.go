@@ -0,0 +1,397 @@
+package localstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+func TestNewLocalStore(t *testing.T) {
+	rootPath := filepath.Join(t.TempDir(), "videos")
+	tests := []struct {
+		name         string
+		rootPath     string
+		fanOutLevels int
+		want         blobstore.BlobStore
+		wantErr      bool
+	}{
+		{
+			name:         "successfully get new local store",
+			rootPath:     rootPath,
+			fanOutLevels: 2,
+			want: &localStore{
+				rootPath:     rootPath,
+				fanOutLevels: 2,
+			},
+			wantErr: false,
+		},
+		{
+			name:         "invalid fan-out levels",
+			rootPath:     rootPath,
+			fanOutLevels: -1,
+			want:         nil,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLocalStore(tt.rootPath, tt.fanOutLevels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLocalStore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewLocalStore() = %v, want %v", got, tt.want)
+			}
+			if _, err := os.Stat(tt.rootPath); err != nil {
+				t.Errorf("NewLocalStore() root path is not created, err: %v", err)
+			}
+		})
+	}
+}
+
+func Test_localStore_PutAndGet(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		content     string
+		getKey      string
+		wantContent string
+		wantErr     error
+	}{
+		{
+			name:        "successfully put and get a blob",
+			key:         "sample.mp4",
+			content:     "sample string",
+			getKey:      "sample.mp4",
+			wantContent: "sample string",
+		},
+		{
+			name:    "get not existing blob",
+			key:     "sample.mp4",
+			content: "sample string",
+			getKey:  "other.mp4",
+			wantErr: blobstore.ErrorNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := &localStore{
+				rootPath:     t.TempDir(),
+				fanOutLevels: 2,
+			}
+			written, err := ls.Put(context.Background(), tt.key, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if written != int64(len(tt.content)) {
+				t.Errorf("Put() written got = %d, want %d", written, len(tt.content))
+			}
+
+			content, err := ls.Get(context.Background(), tt.getKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			defer content.Close()
+			got, _ := io.ReadAll(content)
+			if string(got) != tt.wantContent {
+				t.Errorf("Get() got = %s, want %s", string(got), tt.wantContent)
+			}
+		})
+	}
+}
+
+func Test_localStore_StatListDelete(t *testing.T) {
+	ls := &localStore{
+		rootPath:     t.TempDir(),
+		fanOutLevels: 1,
+	}
+	ctx := context.Background()
+	for _, key := range []string{"b.mp4", "a.mp4"} {
+		if _, err := ls.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	// the hidden directories do not keep blobs
+	if err := os.MkdirAll(filepath.Join(ls.rootPath, ".tus"), os.ModePerm); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(ls.rootPath, ".tus", "sample-upload"), []byte("partial"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	info, err := ls.Stat(ctx, "a.mp4")
+	if err != nil || info.Key != "a.mp4" || info.Size != 5 || info.Path != ls.Path("a.mp4") {
+		t.Errorf("Stat() got = %v, err = %v", info, err)
+	}
+
+	blobs, err := ls.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(blobs) != 2 {
+		t.Errorf("List() got = %v", blobs)
+	}
+	for _, blob := range blobs {
+		if blob.Path != ls.Path(blob.Key) {
+			t.Errorf("List() path of %s got = %s, want %s", blob.Key, blob.Path, ls.Path(blob.Key))
+		}
+	}
+
+	if err := ls.Delete(ctx, "a.mp4"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := ls.Delete(ctx, "a.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+	if _, err := ls.Stat(ctx, "a.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Stat() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_localStore_Stage(t *testing.T) {
+	tests := []struct {
+		name       string
+		commitKey  string
+		wantDigest string
+		wantBlobs  int
+	}{
+		{
+			name:       "staged blob is committed",
+			commitKey:  "sample.mp4",
+			wantDigest: "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b",
+			wantBlobs:  1,
+		},
+		{
+			name:       "staged blob is aborted",
+			wantDigest: "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b",
+			wantBlobs:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ls := &localStore{
+				rootPath: t.TempDir(),
+			}
+			staged, err := ls.Stage(ctx, strings.NewReader("sample string"))
+			if err != nil {
+				t.Fatalf("Stage() error = %v", err)
+			}
+			if staged.Size() != 13 {
+				t.Errorf("Stage() size got = %d, want %d", staged.Size(), 13)
+			}
+			if staged.Digest() != tt.wantDigest {
+				t.Errorf("Stage() digest got = %s, want %s", staged.Digest(), tt.wantDigest)
+			}
+
+			// in-progress upload must not be listed
+			if blobs, _ := ls.List(ctx); len(blobs) != 0 {
+				t.Errorf("List() got = %v, want none", blobs)
+			}
+
+			if tt.commitKey != "" {
+				if err := staged.Commit(ctx, tt.commitKey); err != nil {
+					t.Errorf("Commit() error = %v", err)
+				}
+			}
+			if err := staged.Abort(); err != nil {
+				t.Errorf("Abort() error = %v", err)
+			}
+
+			blobs, _ := ls.List(ctx)
+			if len(blobs) != tt.wantBlobs {
+				t.Errorf("List() got = %v, want %d blobs", blobs, tt.wantBlobs)
+			}
+			entries, _ := os.ReadDir(ls.rootPath)
+			if len(entries) != tt.wantBlobs {
+				t.Errorf("root path entries got = %d, want %d", len(entries), tt.wantBlobs)
+			}
+		})
+	}
+}
+
+func Test_localStore_Path(t *testing.T) {
+	tests := []struct {
+		name         string
+		fanOutLevels int
+		key          string
+		want         string
+	}{
+		{
+			name:         "flat layout",
+			fanOutLevels: 0,
+			key:          "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b",
+			want:         "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b",
+		},
+		{
+			name:         "digest key is sharded by its own prefix",
+			fanOutLevels: 2,
+			key:          "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b",
+			want:         "99/ad/99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b",
+		},
+		{
+			name:         "other key is sharded by the prefix of its hash",
+			fanOutLevels: 2,
+			key:          "sample string",
+			want:         "99/ad/sample string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := &localStore{
+				rootPath:     t.TempDir(),
+				fanOutLevels: tt.fanOutLevels,
+			}
+			if got := ls.Path(tt.key); got != tt.want {
+				t.Errorf("Path() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_localStore_MigrateLayout(t *testing.T) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	flatStore := &localStore{
+		rootPath: rootPath,
+	}
+	for _, key := range []string{"a.mp4", "b.mp4"} {
+		if _, err := flatStore.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	ls := &localStore{
+		rootPath:     rootPath,
+		fanOutLevels: 2,
+	}
+	// flat blobs are still readable before the migration
+	if info, err := ls.Stat(ctx, "a.mp4"); err != nil || info.Path != "a.mp4" {
+		t.Errorf("Stat() got = %v, err = %v", info, err)
+	}
+
+	moved, err := ls.MigrateLayout(ctx)
+	if err != nil {
+		t.Fatalf("MigrateLayout() error = %v", err)
+	}
+	if len(moved) != 2 {
+		t.Errorf("MigrateLayout() moved got = %v, want 2 blobs", moved)
+	}
+	for _, key := range []string{"a.mp4", "b.mp4"} {
+		info, err := ls.Stat(ctx, key)
+		if err != nil || info.Path != ls.Path(key) {
+			t.Errorf("Stat() got = %v, err = %v, want path %s", info, err, ls.Path(key))
+		}
+	}
+
+	// running the migration again is a no-op
+	moved, err = ls.MigrateLayout(ctx)
+	if err != nil || len(moved) != 0 {
+		t.Errorf("MigrateLayout() moved got = %v, err = %v, want none", moved, err)
+	}
+}
+
+func Test_localStore_DiskUsages(t *testing.T) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	ls := &localStore{
+		rootPath:     rootPath,
+		fanOutLevels: 1,
+	}
+
+	usages, err := ls.DiskUsages(ctx, true)
+	if err != nil {
+		t.Fatalf("DiskUsages() error = %v", err)
+	}
+	if len(usages) != 1 || usages[0].Path != rootPath || usages[0].TotalBytes == 0 || usages[0].FreeBytes > usages[0].TotalBytes {
+		t.Errorf("DiskUsages() got = %+v", usages)
+	}
+	// the probe file is removed and never listed as a blob
+	entries, _ := os.ReadDir(rootPath)
+	if len(entries) != 0 {
+		t.Errorf("DiskUsages() left files = %v", entries)
+	}
+
+	// a root path that disappeared is not writable anymore
+	if err := os.RemoveAll(rootPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.DiskUsages(ctx, true); err == nil {
+		t.Errorf("DiskUsages() of a removed root path error = %v, want an error", err)
+	}
+}
+
+func Test_localStore_CleanTemp(t *testing.T) {
+	ctx := context.Background()
+	ls := &localStore{
+		rootPath:     t.TempDir(),
+		fanOutLevels: 1,
+	}
+
+	if _, err := ls.Put(ctx, "committed.mp4", strings.NewReader("committed")); err != nil {
+		t.Fatal(err)
+	}
+	abandoned, err := ls.Stage(ctx, strings.NewReader("abandoned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abandonedPath := abandoned.(*stagedFile).tmpPath
+	staleTime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(abandonedPath, staleTime, staleTime); err != nil {
+		t.Fatal(err)
+	}
+	inProgress, err := ls.Stage(ctx, strings.NewReader("in progress"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = inProgress.Abort()
+	}()
+
+	before := time.Now().Add(-time.Hour)
+	removed, err := ls.CleanTemp(ctx, before, true)
+	if err != nil {
+		t.Fatalf("CleanTemp() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0].Path != abandonedPath || removed[0].Size != int64(len("abandoned")) {
+		t.Errorf("CleanTemp() dry run got = %+v", removed)
+	}
+	if _, err := os.Stat(abandonedPath); err != nil {
+		t.Errorf("CleanTemp() dry run removed the file, err = %v", err)
+	}
+
+	removed, err = ls.CleanTemp(ctx, before, false)
+	if err != nil {
+		t.Fatalf("CleanTemp() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0].Path != abandonedPath {
+		t.Errorf("CleanTemp() got = %+v", removed)
+	}
+	if _, err := os.Stat(abandonedPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("CleanTemp() left the abandoned file, err = %v", err)
+	}
+	// the committed blob and the recent upload are kept
+	if _, err := ls.Stat(ctx, "committed.mp4"); err != nil {
+		t.Errorf("CleanTemp() removed the committed blob, err = %v", err)
+	}
+	if err := inProgress.Commit(ctx, "in-progress.mp4"); err != nil {
+		t.Errorf("CleanTemp() removed the in-progress upload, err = %v", err)
+	}
+}
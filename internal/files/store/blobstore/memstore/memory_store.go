@@ -0,0 +1,157 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+type memoryBlob struct {
+	data    []byte
+	modTime time.Time
+}
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+// NewMemoryStore returns new in-memory blob store, mainly used for testing purpose
+func NewMemoryStore() blobstore.BlobStore {
+	return &memoryStore{
+		blobs: make(map[string]memoryBlob),
+	}
+}
+
+// Put keeps the content of r in memory with specified key and returns the written size
+func (ms *memoryStore) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.blobs[key] = memoryBlob{
+		data:    data,
+		modTime: time.Now(),
+	}
+	return int64(len(data)), nil
+}
+
+// Stage reads the whole content of r into memory without making it visible yet
+func (ms *memoryStore) Stage(_ context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	digestReader := blobstore.NewDigestReader(r)
+	data, err := io.ReadAll(digestReader)
+	if err != nil {
+		return nil, err
+	}
+	return &stagedMemoryBlob{
+		store:  ms,
+		data:   data,
+		digest: digestReader.Digest(),
+	}, nil
+}
+
+// Get returns a reader of the blob with specified key
+func (ms *memoryStore) Get(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	blob, ok := ms.blobs[key]
+	if !ok {
+		return nil, blobstore.ErrorNotFound
+	}
+	return nopCloser{bytes.NewReader(blob.data)}, nil
+}
+
+// Stat returns the detail of the blob with specified key
+func (ms *memoryStore) Stat(_ context.Context, key string) (blobstore.BlobInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	blob, ok := ms.blobs[key]
+	if !ok {
+		return blobstore.BlobInfo{}, blobstore.ErrorNotFound
+	}
+	return blobstore.BlobInfo{
+		Key:     key,
+		Path:    key,
+		Size:    int64(len(blob.data)),
+		ModTime: blob.modTime,
+	}, nil
+}
+
+// Delete removes the blob with specified key
+func (ms *memoryStore) Delete(_ context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.blobs[key]; !ok {
+		return blobstore.ErrorNotFound
+	}
+	delete(ms.blobs, key)
+	return nil
+}
+
+// List returns the detail of all blobs sorted by its key
+func (ms *memoryStore) List(_ context.Context) ([]blobstore.BlobInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	result := make([]blobstore.BlobInfo, 0, len(ms.blobs))
+	for key, blob := range ms.blobs {
+		result = append(result, blobstore.BlobInfo{
+			Key:     key,
+			Path:    key,
+			Size:    int64(len(blob.data)),
+			ModTime: blob.modTime,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// Path returns the key itself as the blobs are not kept in any hierarchy
+func (ms *memoryStore) Path(key string) string {
+	return key
+}
+
+type stagedMemoryBlob struct {
+	store  *memoryStore
+	data   []byte
+	digest string
+}
+
+func (sb *stagedMemoryBlob) Size() int64 {
+	return int64(len(sb.data))
+}
+
+func (sb *stagedMemoryBlob) Digest() string {
+	return sb.digest
+}
+
+func (sb *stagedMemoryBlob) Commit(_ context.Context, key string) error {
+	sb.store.mu.Lock()
+	defer sb.store.mu.Unlock()
+	sb.store.blobs[key] = memoryBlob{
+		data:    sb.data,
+		modTime: time.Now(),
+	}
+	return nil
+}
+
+func (sb *stagedMemoryBlob) Abort() error {
+	return nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+func Test_memoryStore(t *testing.T) {
+	ms := NewMemoryStore()
+	ctx := context.Background()
+
+	for _, key := range []string{"b.mp4", "a.mp4"} {
+		written, err := ms.Put(ctx, key, strings.NewReader(key))
+		if err != nil || written != 5 {
+			t.Fatalf("Put() written = %d, error = %v", written, err)
+		}
+	}
+
+	content, err := ms.Get(ctx, "a.mp4")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(content)
+	if string(got) != "a.mp4" {
+		t.Errorf("Get() got = %s, want %s", string(got), "a.mp4")
+	}
+
+	blobs, err := ms.List(ctx)
+	if err != nil || len(blobs) != 2 || blobs[0].Key != "a.mp4" || blobs[1].Key != "b.mp4" {
+		t.Errorf("List() got = %v, err = %v", blobs, err)
+	}
+
+	if err := ms.Delete(ctx, "a.mp4"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := ms.Get(ctx, "a.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+	if _, err := ms.Stat(ctx, "a.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Stat() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
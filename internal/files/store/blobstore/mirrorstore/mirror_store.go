@@ -0,0 +1,572 @@
+package mirrorstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// Errors of a single replica, they are combined by joinErrors
+var (
+	errDigestMismatch = fmt.Errorf("copy does not match the digest")
+	errSizeMismatch   = fmt.Errorf("copy does not have the size of the other copies")
+	errNoReplicaLeft  = fmt.Errorf("every replica failed to stage the blob")
+)
+
+// Replica represents one of the blob storages holding a copy of every blob
+type Replica struct {
+	Name  string
+	Store blobstore.BlobStore
+}
+
+type mirrorStore struct {
+	replicas []Replica
+}
+
+// NewMirrorStore returns new blob store writing every blob to all replicas and reading it from the first verified copy.
+// A replica failing during a write is left behind and restored later by Repair.
+func NewMirrorStore(replicas []Replica) (blobstore.BlobStore, error) {
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("at least one replica is required")
+	}
+	names := make(map[string]bool)
+	for _, replica := range replicas {
+		if replica.Name == "" || names[replica.Name] {
+			return nil, fmt.Errorf("replica name must be unique and not empty, got: %q", replica.Name)
+		}
+		names[replica.Name] = true
+	}
+	return &mirrorStore{
+		replicas: replicas,
+	}, nil
+}
+
+// Put writes the content of r to all replicas and returns the written size
+func (ms *mirrorStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	staged, err := ms.Stage(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = staged.Abort()
+	}()
+	if err := staged.Commit(ctx, key); err != nil {
+		return 0, err
+	}
+	return staged.Size(), nil
+}
+
+// Stage stages the content of r on every replica at once, since the reader can only be consumed once.
+// A replica failing to stage it is left behind and gets a copy on commit, Stage only fails when every replica failed.
+func (ms *mirrorStore) Stage(ctx context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	writers, results := ms.stageReplicas(ctx)
+	_, err := io.Copy(&fanOutWriter{writers: writers, failed: make([]bool, len(writers))}, r)
+	staged, stageErrs := closeAndWait(writers, results, err)
+	if err == nil {
+		for _, replicaStaged := range staged {
+			if replicaStaged != nil {
+				return &stagedMirror{
+					store:  ms,
+					staged: staged,
+				}, nil
+			}
+		}
+	}
+
+	for _, replicaStaged := range staged {
+		if replicaStaged != nil {
+			_ = replicaStaged.Abort()
+		}
+	}
+	if err != nil && !errors.Is(err, errNoReplicaLeft) {
+		return nil, fmt.Errorf("failed to read blob content, err: %w", err)
+	}
+	if len(stageErrs) == 0 {
+		stageErrs = append(stageErrs, err)
+	}
+	return nil, fmt.Errorf("failed to stage blob on every replica, first error: %w", stageErrs[0])
+}
+
+// Get opens the blob from the first replica holding a verified copy and falls back to the next one otherwise.
+// Blobs keyed by their SHA-256 digest are verified against it, the other ones against the size most replicas agree on.
+func (ms *mirrorStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if isDigestKey(key) {
+		return ms.getByDigest(ctx, key)
+	}
+	return ms.getBySize(ctx, key)
+}
+
+// Stat returns the detail of the blob from the first replica holding it
+func (ms *mirrorStore) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	var errs []error
+	for _, replica := range ms.replicas {
+		info, err := replica.Store.Stat(ctx, key)
+		if err == nil {
+			return info, nil
+		}
+		errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, err))
+	}
+	return blobstore.BlobInfo{}, joinErrors(errs)
+}
+
+// Delete removes the blob from all replicas, it only fails when a replica holding the blob can not remove it
+func (ms *mirrorStore) Delete(ctx context.Context, key string) error {
+	var errs []error
+	deleted := false
+	for _, replica := range ms.replicas {
+		err := replica.Store.Delete(ctx, key)
+		if err == nil {
+			deleted = true
+			continue
+		}
+		errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, err))
+	}
+	if deleted {
+		for _, err := range errs {
+			if !errors.Is(err, blobstore.ErrorNotFound) {
+				return err
+			}
+		}
+		return nil
+	}
+	return joinErrors(errs)
+}
+
+// List returns the detail of every blob held by at least one replica
+func (ms *mirrorStore) List(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	blobs := make(map[string]blobstore.BlobInfo)
+	for _, replica := range ms.replicas {
+		replicaBlobs, err := replica.Store.List(ctx)
+		if err != nil {
+			return []blobstore.BlobInfo{}, fmt.Errorf("failed to list replica: %s, err: %w", replica.Name, err)
+		}
+		for _, blob := range replicaBlobs {
+			if _, ok := blobs[blob.Key]; !ok {
+				blobs[blob.Key] = blob
+			}
+		}
+	}
+
+	result := make([]blobstore.BlobInfo, 0, len(blobs))
+	for _, blob := range blobs {
+		result = append(result, blob)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// Path returns the path of the blob on the first replica
+func (ms *mirrorStore) Path(key string) string {
+	return ms.replicas[0].Store.Path(key)
+}
+
+// MigrateLayout migrates the layout of every replica supporting it
+func (ms *mirrorStore) MigrateLayout(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	moved := make([]blobstore.BlobInfo, 0)
+	for _, replica := range ms.replicas {
+		migrator, ok := replica.Store.(blobstore.LayoutMigrator)
+		if !ok {
+			continue
+		}
+		replicaMoved, err := migrator.MigrateLayout(ctx)
+		moved = append(moved, replicaMoved...)
+		if err != nil {
+			return moved, fmt.Errorf("failed to migrate replica: %s, err: %w", replica.Name, err)
+		}
+	}
+	return moved, nil
+}
+
+// DiskUsages returns the usage of the disks of every replica
+func (ms *mirrorStore) DiskUsages(ctx context.Context, probe bool) ([]blobstore.DiskUsage, error) {
+	usages := make([]blobstore.DiskUsage, 0, len(ms.replicas))
+	for _, replica := range ms.replicas {
+		diskUser, ok := replica.Store.(blobstore.DiskUser)
+		if !ok {
+			continue
+		}
+		replicaUsages, err := diskUser.DiskUsages(ctx, probe)
+		if err != nil {
+			return usages, fmt.Errorf("failed to check disk of replica: %s, err: %w", replica.Name, err)
+		}
+		usages = append(usages, replicaUsages...)
+	}
+	return usages, nil
+}
+
+// CleanTemp removes the temporary content of every replica
+func (ms *mirrorStore) CleanTemp(ctx context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	removed := make([]blobstore.BlobInfo, 0)
+	for _, replica := range ms.replicas {
+		cleaner, ok := replica.Store.(blobstore.TempCleaner)
+		if !ok {
+			continue
+		}
+		replicaRemoved, err := cleaner.CleanTemp(ctx, before, dryRun)
+		removed = append(removed, replicaRemoved...)
+		if err != nil {
+			return removed, fmt.Errorf("failed to clean temporary content of replica: %s, err: %w", replica.Name, err)
+		}
+	}
+	return removed, nil
+}
+
+// ReplicaStates checks the existence and the size of every copy of the blob
+func (ms *mirrorStore) ReplicaStates(ctx context.Context, key string, size int64) ([]blobstore.ReplicaState, error) {
+	states := make([]blobstore.ReplicaState, 0, len(ms.replicas))
+	for _, replica := range ms.replicas {
+		states = append(states, blobstore.ReplicaState{
+			Replica: replica.Name,
+			State:   statState(ctx, replica, key, size),
+		})
+	}
+	return states, nil
+}
+
+// Repair verifies the content of every copy of the blob and overwrites the missing and mismatched ones with a healthy copy.
+// Blobs keyed by their SHA-256 digest are verified against it, the other ones only by their size.
+func (ms *mirrorStore) Repair(ctx context.Context, key string, size int64) (int, error) {
+	var source *Replica
+	broken := make([]Replica, 0)
+	for i, replica := range ms.replicas {
+		state := statState(ctx, replica, key, size)
+		if state == blobstore.ReplicaStateHealthy && isDigestKey(key) {
+			state = verifyDigest(ctx, replica, key)
+		}
+		switch state {
+		case blobstore.ReplicaStateHealthy:
+			if source == nil {
+				source = &ms.replicas[i]
+			}
+		case blobstore.ReplicaStateMissing, blobstore.ReplicaStateMismatch:
+			broken = append(broken, replica)
+		}
+	}
+	if len(broken) == 0 {
+		return 0, nil
+	}
+	if source == nil {
+		return 0, fmt.Errorf("no healthy replica of blob: %s", key)
+	}
+
+	restored := 0
+	for _, target := range broken {
+		if err := copyBlob(ctx, *source, target, key); err != nil {
+			return restored, fmt.Errorf("failed to restore blob: %s on replica: %s, err: %w", key, target.Name, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// getByDigest serves the first copy hashing to the key.
+// When no copy does but every readable copy is the same, the content is not keyed by its own digest,
+// such as a blob encrypted before its name was derived from the master key, and the first copy is served.
+func (ms *mirrorStore) getByDigest(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	var errs []error
+	var fallback io.ReadSeekCloser
+	fallbackDigest := ""
+	consistent := true
+	for _, replica := range ms.replicas {
+		content, err := replica.Store.Get(ctx, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, err))
+			continue
+		}
+		digest, err := contentDigest(content)
+		if err != nil {
+			_ = content.Close()
+			errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, err))
+			continue
+		}
+		if digest == key {
+			if fallback != nil {
+				_ = fallback.Close()
+			}
+			return content, nil
+		}
+		errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, errDigestMismatch))
+		if fallback == nil {
+			fallback, fallbackDigest = content, digest
+			continue
+		}
+		consistent = consistent && digest == fallbackDigest
+		_ = content.Close()
+	}
+	if fallback != nil && consistent {
+		return fallback, nil
+	}
+	if fallback != nil {
+		_ = fallback.Close()
+	}
+	return nil, joinErrors(errs)
+}
+
+// getBySize serves the first copy having the size most replicas agree on, the first replica wins a tie
+func (ms *mirrorStore) getBySize(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	var errs []error
+	sizes := make([]int64, len(ms.replicas))
+	found := make([]bool, len(ms.replicas))
+	votes := make(map[int64]int)
+	for i, replica := range ms.replicas {
+		info, err := replica.Store.Stat(ctx, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, err))
+			continue
+		}
+		sizes[i], found[i] = info.Size, true
+		votes[info.Size]++
+	}
+	expected, best := int64(0), 0
+	for i := range ms.replicas {
+		if found[i] && votes[sizes[i]] > best {
+			expected, best = sizes[i], votes[sizes[i]]
+		}
+	}
+
+	for i, replica := range ms.replicas {
+		if !found[i] {
+			continue
+		}
+		if sizes[i] != expected {
+			errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, errSizeMismatch))
+			continue
+		}
+		content, err := replica.Store.Get(ctx, key)
+		if err == nil {
+			return content, nil
+		}
+		errs = append(errs, fmt.Errorf("replica: %s, err: %w", replica.Name, err))
+	}
+	return nil, joinErrors(errs)
+}
+
+// stageReplicas starts staging on every replica, the content is written through the returned pipes
+func (ms *mirrorStore) stageReplicas(ctx context.Context) ([]*io.PipeWriter, <-chan stageResult) {
+	writers := make([]*io.PipeWriter, len(ms.replicas))
+	results := make(chan stageResult, len(ms.replicas))
+	for i := range ms.replicas {
+		pipeReader, pipeWriter := io.Pipe()
+		writers[i] = pipeWriter
+		go func(i int, pipeReader *io.PipeReader) {
+			replica := ms.replicas[i]
+			staged, err := replica.Store.Stage(ctx, pipeReader)
+			if err != nil {
+				err = fmt.Errorf("replica: %s, err: %w", replica.Name, err)
+			}
+			// unblock the writer when the store stopped reading early
+			_ = pipeReader.CloseWithError(io.ErrClosedPipe)
+			results <- stageResult{index: i, staged: staged, err: err}
+		}(i, pipeReader)
+	}
+	return writers, results
+}
+
+type stageResult struct {
+	index  int
+	staged blobstore.StagedBlob
+	err    error
+}
+
+// closeAndWait closes the pipes, failing the staging when writeErr is set, and collects the staged blob and the error of every replica
+func closeAndWait(writers []*io.PipeWriter, results <-chan stageResult, writeErr error) ([]blobstore.StagedBlob, []error) {
+	for _, writer := range writers {
+		if writeErr != nil {
+			_ = writer.CloseWithError(writeErr)
+		} else {
+			_ = writer.Close()
+		}
+	}
+
+	staged := make([]blobstore.StagedBlob, len(writers))
+	errs := make([]error, 0)
+	failed := make([]error, len(writers))
+	for range writers {
+		result := <-results
+		staged[result.index] = result.staged
+		failed[result.index] = result.err
+	}
+	for _, err := range failed {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return staged, errs
+}
+
+// fanOutWriter writes to every replica still staging the content, the replicas failing are left behind
+type fanOutWriter struct {
+	writers []*io.PipeWriter
+	failed  []bool
+}
+
+func (fw *fanOutWriter) Write(p []byte) (int, error) {
+	written := false
+	for i, writer := range fw.writers {
+		if fw.failed[i] {
+			continue
+		}
+		if _, err := writer.Write(p); err != nil {
+			fw.failed[i] = true
+			continue
+		}
+		written = true
+	}
+	if !written {
+		return 0, errNoReplicaLeft
+	}
+	return len(p), nil
+}
+
+// stagedMirror holds the blob staged on every replica, nil for the replicas which failed to stage it
+type stagedMirror struct {
+	store  *mirrorStore
+	staged []blobstore.StagedBlob
+}
+
+func (sm *stagedMirror) primary() blobstore.StagedBlob {
+	for _, staged := range sm.staged {
+		if staged != nil {
+			return staged
+		}
+	}
+	return nil
+}
+
+func (sm *stagedMirror) Size() int64 {
+	return sm.primary().Size()
+}
+
+func (sm *stagedMirror) Digest() string {
+	return sm.primary().Digest()
+}
+
+// Commit commits the blob on every replica which staged it and copies it to the other ones
+func (sm *stagedMirror) Commit(ctx context.Context, key string) error {
+	committed := make([]bool, len(sm.staged))
+	source := -1
+	var firstErr error
+	for i, staged := range sm.staged {
+		if staged == nil {
+			continue
+		}
+		if err := staged.Commit(ctx, key); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("replica: %s, err: %w", sm.store.replicas[i].Name, err)
+			}
+			continue
+		}
+		committed[i] = true
+		if source < 0 {
+			source = i
+		}
+	}
+	if source < 0 {
+		return firstErr
+	}
+
+	for i, replica := range sm.store.replicas {
+		if committed[i] {
+			continue
+		}
+		if err := copyBlob(ctx, sm.store.replicas[source], replica, key); err != nil {
+			log.Printf("failed to write blob: %s to replica: %s, it is left for repair, err: %v", key, replica.Name, err)
+		}
+	}
+	return nil
+}
+
+// Abort discards the blob staged on every replica and returns the first error
+func (sm *stagedMirror) Abort() error {
+	var firstErr error
+	for _, staged := range sm.staged {
+		if staged == nil {
+			continue
+		}
+		if err := staged.Abort(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func copyBlob(ctx context.Context, source, target Replica, key string) error {
+	content, err := source.Store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	_, err = target.Store.Put(ctx, key, content)
+	return err
+}
+
+func statState(ctx context.Context, replica Replica, key string, size int64) string {
+	info, err := replica.Store.Stat(ctx, key)
+	if errors.Is(err, blobstore.ErrorNotFound) {
+		return blobstore.ReplicaStateMissing
+	}
+	if err != nil {
+		return blobstore.ReplicaStateUnavailable
+	}
+	if info.Size != size {
+		return blobstore.ReplicaStateMismatch
+	}
+	return blobstore.ReplicaStateHealthy
+}
+
+func verifyDigest(ctx context.Context, replica Replica, key string) string {
+	content, err := replica.Store.Get(ctx, key)
+	if err != nil {
+		return blobstore.ReplicaStateUnavailable
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	digest, err := contentDigest(content)
+	if err != nil {
+		return blobstore.ReplicaStateUnavailable
+	}
+	if digest != key {
+		return blobstore.ReplicaStateMismatch
+	}
+	return blobstore.ReplicaStateHealthy
+}
+
+// contentDigest returns the hex encoded SHA-256 digest of the content and rewinds it
+func contentDigest(content io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func isDigestKey(key string) bool {
+	decoded, err := hex.DecodeString(key)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// joinErrors combines the error of every replica, the result is ErrorNotFound only when no replica has the blob
+func joinErrors(errs []error) error {
+	for _, err := range errs {
+		if !errors.Is(err, blobstore.ErrorNotFound) {
+			return fmt.Errorf("all replicas failed, first error: %w", err)
+		}
+	}
+	return fmt.Errorf("%w: not found on any replica", blobstore.ErrorNotFound)
+}
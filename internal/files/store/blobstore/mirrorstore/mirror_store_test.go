@@ -0,0 +1,366 @@
+package mirrorstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/localstore"
+)
+
+// sampleDigest is the SHA-256 digest of "sample string"
+const sampleDigest = "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b"
+
+func newTestStore(t *testing.T, names ...string) (*mirrorStore, []Replica) {
+	if len(names) == 0 {
+		names = []string{"disk1", "disk2"}
+	}
+	replicas := make([]Replica, 0)
+	for _, name := range names {
+		store, err := localstore.NewLocalStore(filepath.Join(t.TempDir(), name), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, Replica{Name: name, Store: store})
+	}
+	store, err := NewMirrorStore(replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*mirrorStore), replicas
+}
+
+// failingStageStore fails to stage any content after reading the first bytes of it
+type failingStageStore struct {
+	blobstore.BlobStore
+}
+
+func (fs failingStageStore) Stage(_ context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	_, _ = r.Read(make([]byte, 4))
+	return nil, errors.New("disk full")
+}
+
+func readBlob(t *testing.T, store blobstore.BlobStore, key string) string {
+	content, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer content.Close()
+	data, _ := io.ReadAll(content)
+	return string(data)
+}
+
+func TestNewMirrorStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas []Replica
+		wantErr  bool
+	}{
+		{
+			name:     "no replica",
+			replicas: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "duplicated replica name",
+			replicas: []Replica{{Name: "disk1"}, {Name: "disk1"}},
+			wantErr:  true,
+		},
+		{
+			name:     "successfully get new mirror store",
+			replicas: []Replica{{Name: "disk1"}, {Name: "disk2"}},
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMirrorStore(tt.replicas)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMirrorStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_mirrorStore_WriteAndFailover(t *testing.T) {
+	ctx := context.Background()
+	store, replicas := newTestStore(t)
+
+	staged, err := store.Stage(ctx, strings.NewReader("sample string"))
+	if err != nil {
+		t.Fatalf("Stage() error = %v", err)
+	}
+	if err := staged.Commit(ctx, staged.Digest()); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	for _, replica := range replicas {
+		if got := readBlob(t, replica.Store, sampleDigest); got != "sample string" {
+			t.Errorf("replica: %s content = %s, want %s", replica.Name, got, "sample string")
+		}
+	}
+
+	// the first replica lost its copy, the blob is served by the second one
+	if err := replicas[0].Store.Delete(ctx, sampleDigest); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, store, sampleDigest); got != "sample string" {
+		t.Errorf("Get() after failover content = %s", got)
+	}
+	if _, err := store.Stat(ctx, sampleDigest); err != nil {
+		t.Errorf("Stat() after failover error = %v", err)
+	}
+
+	if err := store.Delete(ctx, sampleDigest); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, sampleDigest); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+	if err := store.Delete(ctx, sampleDigest); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_mirrorStore_Repair(t *testing.T) {
+	tests := []struct {
+		name         string
+		damage       func(t *testing.T, replicas []Replica)
+		wantStates   []string
+		wantRestored int
+		wantErr      bool
+	}{
+		{
+			name:         "all replicas are healthy",
+			damage:       func(t *testing.T, replicas []Replica) {},
+			wantStates:   []string{blobstore.ReplicaStateHealthy, blobstore.ReplicaStateHealthy},
+			wantRestored: 0,
+		},
+		{
+			name: "missing replica is restored",
+			damage: func(t *testing.T, replicas []Replica) {
+				if err := replicas[1].Store.Delete(context.Background(), sampleDigest); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStates:   []string{blobstore.ReplicaStateHealthy, blobstore.ReplicaStateMissing},
+			wantRestored: 1,
+		},
+		{
+			name: "replica with different size is restored",
+			damage: func(t *testing.T, replicas []Replica) {
+				if _, err := replicas[0].Store.Put(context.Background(), sampleDigest, strings.NewReader("truncated")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStates:   []string{blobstore.ReplicaStateMismatch, blobstore.ReplicaStateHealthy},
+			wantRestored: 1,
+		},
+		{
+			name: "corrupted replica with the same size is restored",
+			damage: func(t *testing.T, replicas []Replica) {
+				if _, err := replicas[0].Store.Put(context.Background(), sampleDigest, strings.NewReader("sample strinG")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			// the size based check can not detect it, only the repair verifies the digest
+			wantStates:   []string{blobstore.ReplicaStateHealthy, blobstore.ReplicaStateHealthy},
+			wantRestored: 1,
+		},
+		{
+			name: "no healthy replica left",
+			damage: func(t *testing.T, replicas []Replica) {
+				for _, replica := range replicas {
+					if err := replica.Store.Delete(context.Background(), sampleDigest); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			wantStates: []string{blobstore.ReplicaStateMissing, blobstore.ReplicaStateMissing},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, replicas := newTestStore(t)
+			if _, err := store.Put(ctx, sampleDigest, strings.NewReader("sample string")); err != nil {
+				t.Fatal(err)
+			}
+			tt.damage(t, replicas)
+
+			states, err := store.ReplicaStates(ctx, sampleDigest, 13)
+			if err != nil {
+				t.Fatalf("ReplicaStates() error = %v", err)
+			}
+			gotStates := make([]string, 0, len(states))
+			for _, state := range states {
+				gotStates = append(gotStates, state.State)
+			}
+			if !reflect.DeepEqual(gotStates, tt.wantStates) {
+				t.Errorf("ReplicaStates() got = %v, want %v", gotStates, tt.wantStates)
+			}
+
+			restored, err := store.Repair(ctx, sampleDigest, 13)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Repair() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if restored != tt.wantRestored {
+				t.Errorf("Repair() restored = %d, want %d", restored, tt.wantRestored)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, replica := range replicas {
+				if got := readBlob(t, replica.Store, sampleDigest); got != "sample string" {
+					t.Errorf("replica: %s content after repair = %s", replica.Name, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_mirrorStore_DiskUsages(t *testing.T) {
+	store, replicas := newTestStore(t)
+
+	usages, err := store.DiskUsages(context.Background(), true)
+	if err != nil {
+		t.Fatalf("DiskUsages() error = %v", err)
+	}
+	if len(usages) != len(replicas) {
+		t.Fatalf("DiskUsages() got = %+v, want one usage per replica", usages)
+	}
+	for i, usage := range usages {
+		if filepath.Base(usage.Path) != replicas[i].Name || usage.TotalBytes == 0 {
+			t.Errorf("DiskUsages() usage of replica %s got = %+v", replicas[i].Name, usage)
+		}
+	}
+}
+
+func Test_mirrorStore_Stage_fallback(t *testing.T) {
+	ctx := context.Background()
+	store, replicas := newTestStore(t)
+	store.replicas[0].Store = failingStageStore{BlobStore: replicas[0].Store}
+
+	staged, err := store.Stage(ctx, strings.NewReader("sample string"))
+	if err != nil {
+		t.Fatalf("Stage() error = %v", err)
+	}
+	if staged.Size() != 13 || staged.Digest() != sampleDigest {
+		t.Errorf("Stage() size = %d, digest = %s", staged.Size(), staged.Digest())
+	}
+	if err := staged.Commit(ctx, sampleDigest); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	// the replica which failed to stage the blob gets a copy on commit
+	for _, replica := range replicas {
+		if got := readBlob(t, replica.Store, sampleDigest); got != "sample string" {
+			t.Errorf("replica: %s content = %s, want %s", replica.Name, got, "sample string")
+		}
+	}
+
+	store.replicas[1].Store = failingStageStore{BlobStore: replicas[1].Store}
+	if _, err := store.Stage(ctx, strings.NewReader("sample string")); err == nil {
+		t.Errorf("Stage() on failing replicas error = nil")
+	}
+}
+
+func Test_mirrorStore_Stage_readError(t *testing.T) {
+	store, replicas := newTestStore(t)
+
+	_, err := store.Stage(context.Background(), io.MultiReader(strings.NewReader("sample"), iotest.ErrReader(io.ErrUnexpectedEOF)))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Stage() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	for _, replica := range replicas {
+		if blobs, _ := replica.Store.List(context.Background()); len(blobs) != 0 {
+			t.Errorf("replica: %s blobs = %+v, want none", replica.Name, blobs)
+		}
+	}
+}
+
+func Test_mirrorStore_Get_verified(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		key     string
+		damage  func(t *testing.T, replicas []Replica)
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "corrupted copy with the same size falls back to the next replica",
+			key:  sampleDigest,
+			damage: func(t *testing.T, replicas []Replica) {
+				if _, err := replicas[0].Store.Put(context.Background(), sampleDigest, strings.NewReader("sample strinG")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "sample string",
+		},
+		{
+			name: "every copy is corrupted differently",
+			key:  sampleDigest,
+			damage: func(t *testing.T, replicas []Replica) {
+				if _, err := replicas[0].Store.Put(context.Background(), sampleDigest, strings.NewReader("sample strinG")); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := replicas[1].Store.Put(context.Background(), sampleDigest, strings.NewReader("Sample string")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "content not keyed by its own digest is served when every copy is the same",
+			key:  sampleDigest,
+			damage: func(t *testing.T, replicas []Replica) {
+				for _, replica := range replicas {
+					if _, err := replica.Store.Put(context.Background(), sampleDigest, strings.NewReader("encrypted")); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			want: "encrypted",
+		},
+		{
+			name:  "truncated copy falls back to the size most replicas agree on",
+			names: []string{"disk1", "disk2", "disk3"},
+			key:   "sample.mp4",
+			damage: func(t *testing.T, replicas []Replica) {
+				if _, err := replicas[0].Store.Put(context.Background(), "sample.mp4", strings.NewReader("sample")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "sample string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, replicas := newTestStore(t, tt.names...)
+			if _, err := store.Put(ctx, tt.key, strings.NewReader("sample string")); err != nil {
+				t.Fatal(err)
+			}
+			tt.damage(t, replicas)
+
+			content, err := store.Get(ctx, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer content.Close()
+			got, _ := io.ReadAll(content)
+			if string(got) != tt.want {
+				t.Errorf("Get() content = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
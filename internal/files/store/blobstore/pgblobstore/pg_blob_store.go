@@ -0,0 +1,470 @@
+package pgblobstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+// DefaultChunkSize is the size of the bytea row every blob content is split into
+const DefaultChunkSize = 1 << 20
+
+type pgBlobStore struct {
+	dbConn    *sqlx.DB
+	chunkSize int
+}
+
+// NewPGBlobStore returns new blob store keeping the blobs in the database as chunks of chunkSize bytes.
+// The content is streamed chunk by chunk, so a blob is never held in memory as a whole.
+func NewPGBlobStore(dbConn *sqlx.DB, chunkSize int) (blobstore.BlobStore, error) {
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < 0 {
+		return nil, fmt.Errorf("invalid chunk size: %d", chunkSize)
+	}
+	return &pgBlobStore{
+		dbConn:    dbConn,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+// blobContent is the internal db structure of a stored content
+type blobContent struct {
+	ID        int64     `db:"id"`
+	Key       string    `db:"key"`
+	Size      int64     `db:"size"`
+	ChunkSize int       `db:"chunk_size"`
+	ModTime   time.Time `db:"mod_time"`
+}
+
+// Put writes the content of r as the blob with specified key and returns the written size
+func (ps *pgBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	staged, err := ps.Stage(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = staged.Abort()
+	}()
+	if err := staged.Commit(ctx, key); err != nil {
+		return 0, err
+	}
+	return staged.Size(), nil
+}
+
+// Stage writes the content of r as a new content not yet referenced by any key
+func (ps *pgBlobStore) Stage(ctx context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	query := `
+		INSERT INTO blob_contents (
+			chunk_size
+		) VALUES (
+			$1
+		)
+		RETURNING
+			id`
+
+	var contentID int64
+	if err := ps.dbConn.GetContext(ctx, &contentID, query, ps.chunkSize); err != nil {
+		return nil, fmt.Errorf("failed to create blob content, err: %v", err)
+	}
+
+	digestReader := blobstore.NewDigestReader(r)
+	if err := ps.writeChunks(ctx, contentID, digestReader); err != nil {
+		_ = ps.deleteContent(context.Background(), contentID)
+		return nil, fmt.Errorf("failed to write blob content, err: %v", err)
+	}
+
+	return &stagedContent{
+		store:     ps,
+		contentID: contentID,
+		size:      digestReader.Size(),
+		digest:    digestReader.Digest(),
+	}, nil
+}
+
+// writeChunks writes the content of r as consecutive chunks of the content and records its size
+func (ps *pgBlobStore) writeChunks(ctx context.Context, contentID int64, r io.Reader) error {
+	insertQuery := `
+		INSERT INTO blob_chunks (
+			content_id,
+			seq,
+			data
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)`
+
+	updateQuery := `
+		UPDATE
+			blob_contents
+		SET
+			size = $2
+		WHERE
+			id = $1`
+
+	buf := make([]byte, ps.chunkSize)
+	var size int64
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := ps.dbConn.ExecContext(ctx, insertQuery, contentID, seq, buf[:n]); err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := ps.dbConn.ExecContext(ctx, updateQuery, contentID, size)
+	return err
+}
+
+// Get opens the blob with specified key for reading, the chunks are fetched lazily while reading
+func (ps *pgBlobStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	content, err := ps.getContent(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{
+		ctx:     ctx,
+		dbConn:  ps.dbConn,
+		content: content,
+		seq:     -1,
+	}, nil
+}
+
+// Stat returns the detail of the blob with specified key
+func (ps *pgBlobStore) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	content, err := ps.getContent(ctx, key)
+	if err != nil {
+		return blobstore.BlobInfo{}, err
+	}
+	return mapBlobContent(content), nil
+}
+
+// Delete removes the blob with specified key together with its content
+func (ps *pgBlobStore) Delete(ctx context.Context, key string) error {
+	query := `
+		DELETE FROM
+			blob_keys
+		WHERE
+			key = $1
+		RETURNING
+			content_id`
+
+	tx, err := ps.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var contentIDs []int64
+	if err := tx.SelectContext(ctx, &contentIDs, query, key); err != nil {
+		return err
+	}
+	if len(contentIDs) == 0 {
+		return fmt.Errorf("%w: %s", blobstore.ErrorNotFound, key)
+	}
+	if err := deleteContent(ctx, tx, contentIDs[0]); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// List returns the detail of all blobs
+func (ps *pgBlobStore) List(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	query := `
+		SELECT
+			c.id,
+			k.key,
+			c.size,
+			c.chunk_size,
+			k.mod_time
+		FROM
+			blob_keys k
+			JOIN blob_contents c ON c.id = k.content_id
+		ORDER BY
+			k.key`
+
+	var contents []blobContent
+	if err := ps.dbConn.SelectContext(ctx, &contents, query); err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+	result := make([]blobstore.BlobInfo, 0, len(contents))
+	for _, content := range contents {
+		result = append(result, mapBlobContent(content))
+	}
+	return result, nil
+}
+
+// CleanTemp removes the contents staged before the specified time that were never committed nor aborted
+func (ps *pgBlobStore) CleanTemp(ctx context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	selectQuery := `
+		SELECT
+			c.id,
+			c.size,
+			c.chunk_size,
+			c.created_at AS mod_time
+		FROM
+			blob_contents c
+		WHERE
+			c.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM blob_keys k WHERE k.content_id = c.id)
+		ORDER BY
+			c.id`
+
+	deleteQuery := `
+		DELETE FROM
+			blob_contents c
+		WHERE
+			c.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM blob_keys k WHERE k.content_id = c.id)
+		RETURNING
+			c.id,
+			c.size,
+			c.chunk_size,
+			c.created_at AS mod_time`
+
+	query := deleteQuery
+	if dryRun {
+		query = selectQuery
+	}
+	var contents []blobContent
+	if err := ps.dbConn.SelectContext(ctx, &contents, query, before.UTC()); err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+	result := make([]blobstore.BlobInfo, 0, len(contents))
+	for _, content := range contents {
+		// staged contents are not addressed by any key yet, so they are reported by their id
+		content.Key = strconv.FormatInt(content.ID, 10)
+		result = append(result, mapBlobContent(content))
+	}
+	return result, nil
+}
+
+// Path returns the key itself, the blobs are only addressed by their key in the database
+func (ps *pgBlobStore) Path(key string) string {
+	return key
+}
+
+func (ps *pgBlobStore) getContent(ctx context.Context, key string) (blobContent, error) {
+	query := `
+		SELECT
+			c.id,
+			k.key,
+			c.size,
+			c.chunk_size,
+			k.mod_time
+		FROM
+			blob_keys k
+			JOIN blob_contents c ON c.id = k.content_id
+		WHERE
+			k.key = $1`
+
+	var content blobContent
+	err := ps.dbConn.GetContext(ctx, &content, query, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return blobContent{}, fmt.Errorf("%w: %s", blobstore.ErrorNotFound, key)
+	}
+	return content, err
+}
+
+func (ps *pgBlobStore) deleteContent(ctx context.Context, contentID int64) error {
+	return deleteContent(ctx, ps.dbConn, contentID)
+}
+
+// deleteContent removes the content, its chunks are removed by the cascading foreign key
+func deleteContent(ctx context.Context, execer sqlx.ExecerContext, contentID int64) error {
+	query := `
+		DELETE FROM
+			blob_contents
+		WHERE
+			id = $1`
+
+	_, err := execer.ExecContext(ctx, query, contentID)
+	return err
+}
+
+func mapBlobContent(content blobContent) blobstore.BlobInfo {
+	return blobstore.BlobInfo{
+		Key:     content.Key,
+		Path:    content.Key,
+		Size:    content.Size,
+		ModTime: content.ModTime,
+	}
+}
+
+type stagedContent struct {
+	store     *pgBlobStore
+	contentID int64
+	size      int64
+	digest    string
+	committed bool
+}
+
+func (sc *stagedContent) Size() int64 {
+	return sc.size
+}
+
+func (sc *stagedContent) Digest() string {
+	return sc.digest
+}
+
+// Commit points the key to the staged content, the content previously stored under the key is removed
+func (sc *stagedContent) Commit(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("invalid key: %q", key)
+	}
+
+	releaseQuery := `
+		DELETE FROM
+			blob_keys
+		WHERE
+			key = $1
+		RETURNING
+			content_id`
+
+	insertQuery := `
+		INSERT INTO blob_keys (
+			key,
+			content_id,
+			mod_time
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)`
+
+	tx, err := sc.store.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var previousIDs []int64
+	if err := tx.SelectContext(ctx, &previousIDs, releaseQuery, key); err != nil {
+		return fmt.Errorf("failed to release blob key: %s, err: %v", key, err)
+	}
+	if _, err := tx.ExecContext(ctx, insertQuery, key, sc.contentID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to insert blob key: %s, err: %v", key, err)
+	}
+	for _, previousID := range previousIDs {
+		if err := deleteContent(ctx, tx, previousID); err != nil {
+			return fmt.Errorf("failed to delete replaced blob content, err: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	sc.committed = true
+	return nil
+}
+
+// Abort removes the staged content
+func (sc *stagedContent) Abort() error {
+	if sc.committed {
+		return nil
+	}
+	sc.committed = true
+	return sc.store.deleteContent(context.Background(), sc.contentID)
+}
+
+// chunkReader reads a content chunk by chunk, seeking only moves the offset
+type chunkReader struct {
+	ctx     context.Context
+	dbConn  *sqlx.DB
+	content blobContent
+
+	offset int64
+	seq    int64
+	chunk  []byte
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	if cr.offset >= cr.content.Size {
+		return 0, io.EOF
+	}
+
+	chunkSize := int64(cr.content.ChunkSize)
+	if seq := cr.offset / chunkSize; seq != cr.seq {
+		if err := cr.fetch(seq); err != nil {
+			return 0, err
+		}
+	}
+
+	start := cr.offset - cr.seq*chunkSize
+	if start >= int64(len(cr.chunk)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, cr.chunk[start:])
+	cr.offset += int64(n)
+	return n, nil
+}
+
+// fetch loads the chunk with specified sequence number
+func (cr *chunkReader) fetch(seq int64) error {
+	query := `
+		SELECT
+			data
+		FROM
+			blob_chunks
+		WHERE
+			content_id = $1
+			AND seq = $2`
+
+	var chunk []byte
+	err := cr.dbConn.GetContext(cr.ctx, &chunk, query, cr.content.ID, seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	cr.seq = seq
+	cr.chunk = chunk
+	return nil
+}
+
+func (cr *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = cr.offset + offset
+	case io.SeekEnd:
+		target = cr.content.Size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position: %d", target)
+	}
+	cr.offset = target
+	return target, nil
+}
+
+func (cr *chunkReader) Close() error {
+	cr.chunk = nil
+	return nil
+}
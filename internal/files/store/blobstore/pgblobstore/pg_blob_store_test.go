@@ -0,0 +1,534 @@
+package pgblobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+const (
+	queryInsertContent = `
+		INSERT INTO blob_contents (
+			chunk_size
+		) VALUES (
+			$1
+		)
+		RETURNING
+			id`
+
+	queryInsertChunk = `
+		INSERT INTO blob_chunks (
+			content_id,
+			seq,
+			data
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)`
+
+	queryUpdateContentSize = `
+		UPDATE
+			blob_contents
+		SET
+			size = $2
+		WHERE
+			id = $1`
+
+	queryDeleteContent = `
+		DELETE FROM
+			blob_contents
+		WHERE
+			id = $1`
+
+	queryInsertKey = `
+		INSERT INTO blob_keys (
+			key,
+			content_id,
+			mod_time
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)`
+
+	queryDeleteKey = `
+		DELETE FROM
+			blob_keys
+		WHERE
+			key = $1
+		RETURNING
+			content_id`
+
+	queryGetContent = `
+		SELECT
+			c.id,
+			k.key,
+			c.size,
+			c.chunk_size,
+			k.mod_time
+		FROM
+			blob_keys k
+			JOIN blob_contents c ON c.id = k.content_id
+		WHERE
+			k.key = $1`
+
+	queryListContents = `
+		SELECT
+			c.id,
+			k.key,
+			c.size,
+			c.chunk_size,
+			k.mod_time
+		FROM
+			blob_keys k
+			JOIN blob_contents c ON c.id = k.content_id
+		ORDER BY
+			k.key`
+
+	queryGetChunk = `
+		SELECT
+			data
+		FROM
+			blob_chunks
+		WHERE
+			content_id = $1
+			AND seq = $2`
+
+	querySelectStaleContents = `
+		SELECT
+			c.id,
+			c.size,
+			c.chunk_size,
+			c.created_at AS mod_time
+		FROM
+			blob_contents c
+		WHERE
+			c.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM blob_keys k WHERE k.content_id = c.id)
+		ORDER BY
+			c.id`
+
+	queryDeleteStaleContents = `
+		DELETE FROM
+			blob_contents c
+		WHERE
+			c.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM blob_keys k WHERE k.content_id = c.id)
+		RETURNING
+			c.id,
+			c.size,
+			c.chunk_size,
+			c.created_at AS mod_time`
+
+	sampleDigest = "99ad9154f94977dd8913f3b7ea14091d00e52b8931c2bc1cfc7ea62b7c26727b"
+)
+
+var contentColumns = []string{"id", "key", "size", "chunk_size", "mod_time"}
+
+func newTestStore(t *testing.T, chunkSize int) (*pgBlobStore, sqlmock.Sqlmock) {
+	mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("error when opening a database connection: %v\n", err)
+	}
+	t.Cleanup(func() {
+		_ = mockDB.Close()
+	})
+	store, err := NewPGBlobStore(sqlx.NewDb(mockDB, "postgres"), chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*pgBlobStore), sqlMock
+}
+
+func TestNewPGBlobStore(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunkSize     int
+		wantChunkSize int
+		wantErr       bool
+	}{
+		{
+			name:          "successfully get new store with default chunk size",
+			chunkSize:     0,
+			wantChunkSize: DefaultChunkSize,
+			wantErr:       false,
+		},
+		{
+			name:          "successfully get new store with custom chunk size",
+			chunkSize:     1024,
+			wantChunkSize: 1024,
+			wantErr:       false,
+		},
+		{
+			name:      "negative chunk size",
+			chunkSize: -1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPGBlobStore(nil, tt.chunkSize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPGBlobStore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.(*pgBlobStore).chunkSize != tt.wantChunkSize {
+				t.Errorf("NewPGBlobStore() chunk size = %d, want %d", got.(*pgBlobStore).chunkSize, tt.wantChunkSize)
+			}
+		})
+	}
+}
+
+func Test_pgBlobStore_Stage(t *testing.T) {
+	tests := []struct {
+		name       string
+		mockFunc   func(sqlMock sqlmock.Sqlmock)
+		wantSize   int64
+		wantDigest string
+		wantErr    bool
+	}{
+		{
+			name: "successfully stage the content chunk by chunk",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryInsertContent).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				sqlMock.ExpectExec(queryInsertChunk).WithArgs(7, 0, []byte("sampl")).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(queryInsertChunk).WithArgs(7, 1, []byte("e str")).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(queryInsertChunk).WithArgs(7, 2, []byte("ing")).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(queryUpdateContentSize).WithArgs(7, 13).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantSize:   13,
+			wantDigest: sampleDigest,
+			wantErr:    false,
+		},
+		{
+			name: "failed to write a chunk",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryInsertContent).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				sqlMock.ExpectExec(queryInsertChunk).WithArgs(7, 0, []byte("sampl")).WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectExec(queryDeleteContent).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to create the content",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryInsertContent).WithArgs(5).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, sqlMock := newTestStore(t, 5)
+			tt.mockFunc(sqlMock)
+
+			got, err := store.Stage(context.Background(), strings.NewReader("sample string"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (got.Size() != tt.wantSize || got.Digest() != tt.wantDigest) {
+				t.Errorf("Stage() got size = %d, digest = %s, want size = %d, digest = %s", got.Size(), got.Digest(), tt.wantSize, tt.wantDigest)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Stage() unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_stagedContent_Commit(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully commit a new key",
+			key:  sampleDigest,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteKey).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows([]string{"content_id"}))
+				sqlMock.ExpectExec(queryInsertKey).WithArgs(sampleDigest, 7, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectCommit()
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully replace the content of an existing key",
+			key:  sampleDigest,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteKey).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows([]string{"content_id"}).AddRow(3))
+				sqlMock.ExpectExec(queryInsertKey).WithArgs(sampleDigest, 7, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(queryDeleteContent).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectCommit()
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to insert the key",
+			key:  sampleDigest,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteKey).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows([]string{"content_id"}))
+				sqlMock.ExpectExec(queryInsertKey).WithArgs(sampleDigest, 7, sqlmock.AnyArg()).WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name:     "empty key",
+			key:      "",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, sqlMock := newTestStore(t, 5)
+			tt.mockFunc(sqlMock)
+
+			staged := &stagedContent{store: store, contentID: 7, size: 13, digest: sampleDigest}
+			err := staged.Commit(context.Background(), tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Commit() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			// the content stays with its key after a successful commit
+			if !tt.wantErr {
+				if err := staged.Abort(); err != nil {
+					t.Errorf("Abort() error = %v", err)
+				}
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Commit() unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_stagedContent_Abort(t *testing.T) {
+	store, sqlMock := newTestStore(t, 5)
+	sqlMock.ExpectExec(queryDeleteContent).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	staged := &stagedContent{store: store, contentID: 7, size: 13, digest: sampleDigest}
+	if err := staged.Abort(); err != nil {
+		t.Errorf("Abort() error = %v", err)
+	}
+	if err := staged.Abort(); err != nil {
+		t.Errorf("Abort() second call error = %v", err)
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Abort() unmet expectations: %v", err)
+	}
+}
+
+func Test_pgBlobStore_Get(t *testing.T) {
+	modTime := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		offset   int64
+		length   int
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     string
+		wantErr  error
+	}{
+		{
+			name:   "successfully read the whole blob",
+			offset: 0,
+			length: 13,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetContent).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows(contentColumns).AddRow(7, sampleDigest, 13, 5, modTime))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 0).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("sampl")))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 1).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("e str")))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 2).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("ing")))
+			},
+			want:    "sample string",
+			wantErr: nil,
+		},
+		{
+			name:   "successfully read a range fetching only the chunks it covers",
+			offset: 6,
+			length: 5,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetContent).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows(contentColumns).AddRow(7, sampleDigest, 13, 5, modTime))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 1).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("e str")))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 2).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("ing")))
+			},
+			want:    " stri",
+			wantErr: nil,
+		},
+		{
+			name:   "chunk is missing",
+			offset: 0,
+			length: 13,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetContent).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows(contentColumns).AddRow(7, sampleDigest, 13, 5, modTime))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 0).WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("sampl")))
+				sqlMock.ExpectQuery(queryGetChunk).WithArgs(7, 1).WillReturnRows(sqlmock.NewRows([]string{"data"}))
+			},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "blob not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetContent).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows(contentColumns))
+			},
+			wantErr: blobstore.ErrorNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, sqlMock := newTestStore(t, 5)
+			tt.mockFunc(sqlMock)
+
+			content, err := store.Get(context.Background(), sampleDigest)
+			if err == nil {
+				defer content.Close()
+				if _, err = content.Seek(tt.offset, io.SeekStart); err == nil {
+					buf := make([]byte, tt.length)
+					_, err = io.ReadFull(content, buf)
+					if err == nil && string(buf) != tt.want {
+						t.Errorf("Get() content = %q, want %q", string(buf), tt.want)
+					}
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Get() unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_pgBlobStore_Stat(t *testing.T) {
+	modTime := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	store, sqlMock := newTestStore(t, 5)
+	sqlMock.ExpectQuery(queryGetContent).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows(contentColumns).AddRow(7, sampleDigest, 13, 5, modTime))
+
+	got, err := store.Stat(context.Background(), sampleDigest)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	want := blobstore.BlobInfo{Key: sampleDigest, Path: sampleDigest, Size: 13, ModTime: modTime}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stat() got = %+v, want %+v", got, want)
+	}
+}
+
+func Test_pgBlobStore_Delete(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  error
+	}{
+		{
+			name: "successfully delete the blob and its content",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteKey).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows([]string{"content_id"}).AddRow(7))
+				sqlMock.ExpectExec(queryDeleteContent).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectCommit()
+			},
+			wantErr: nil,
+		},
+		{
+			name: "blob not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteKey).WithArgs(sampleDigest).WillReturnRows(sqlmock.NewRows([]string{"content_id"}))
+				sqlMock.ExpectRollback()
+			},
+			wantErr: blobstore.ErrorNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, sqlMock := newTestStore(t, 5)
+			tt.mockFunc(sqlMock)
+
+			if err := store.Delete(context.Background(), sampleDigest); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Delete() unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_pgBlobStore_List(t *testing.T) {
+	modTime := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	store, sqlMock := newTestStore(t, 5)
+	rows := sqlmock.NewRows(contentColumns).
+		AddRow(7, "a.mp4", 13, 5, modTime).
+		AddRow(8, "b.mp4", 7, 5, modTime)
+	sqlMock.ExpectQuery(queryListContents).WillReturnRows(rows)
+
+	got, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []blobstore.BlobInfo{
+		{Key: "a.mp4", Path: "a.mp4", Size: 13, ModTime: modTime},
+		{Key: "b.mp4", Path: "b.mp4", Size: 7, ModTime: modTime},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %+v, want %+v", got, want)
+	}
+}
+
+func Test_pgBlobStore_CleanTemp(t *testing.T) {
+	before := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	createdAt := before.Add(-time.Hour)
+	tests := []struct {
+		name   string
+		dryRun bool
+		query  string
+	}{
+		{
+			name:   "remove the stale staged contents",
+			dryRun: false,
+			query:  queryDeleteStaleContents,
+		},
+		{
+			name:   "only report the stale staged contents on dry run",
+			dryRun: true,
+			query:  querySelectStaleContents,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, sqlMock := newTestStore(t, 5)
+			rows := sqlmock.NewRows([]string{"id", "size", "chunk_size", "mod_time"}).AddRow(7, 13, 5, createdAt)
+			sqlMock.ExpectQuery(tt.query).WithArgs(before).WillReturnRows(rows)
+
+			got, err := store.CleanTemp(context.Background(), before, tt.dryRun)
+			if err != nil {
+				t.Fatalf("CleanTemp() error = %v", err)
+			}
+			want := []blobstore.BlobInfo{{Key: "7", Path: "7", Size: 13, ModTime: createdAt}}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("CleanTemp() got = %+v, want %+v", got, want)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("CleanTemp() unmet expectations: %v", err)
+			}
+		})
+	}
+}
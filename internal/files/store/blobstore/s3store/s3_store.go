@@ -0,0 +1,354 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/s3"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+const (
+	// DefaultPartSize is the size of every part of a multipart upload, blobs up to this size are uploaded in a single request
+	DefaultPartSize = 16 << 20
+	// DefaultReadWindow is the maximum size fetched by a single ranged GET while reading a blob
+	DefaultReadWindow = 8 << 20
+
+	// minPartSize is the minimum size of a non-last part accepted by S3
+	minPartSize = 5 << 20
+
+	spoolFilePrefix = ".s3-upload-"
+)
+
+// Options represents the tunables of the S3 blob store
+type Options struct {
+	// Prefix is prepended to every key to build the object key
+	Prefix string
+	// SpoolDir keeps the staged uploads until they are committed, defaults to the OS temporary directory
+	SpoolDir string
+	// PartSize is the size of a multipart upload part, defaults to DefaultPartSize
+	PartSize int64
+	// ReadWindow is the size of a ranged GET, defaults to DefaultReadWindow
+	ReadWindow int64
+}
+
+type s3Store struct {
+	client     *s3.Client
+	prefix     string
+	spoolDir   string
+	partSize   int64
+	readWindow int64
+}
+
+// NewS3Store returns new blob store keeping the blobs as objects of an S3-compatible bucket.
+// Uploads are spooled to a local temporary file first so that their digest is known before the object key is chosen.
+func NewS3Store(client *s3.Client, opts Options) (blobstore.BlobStore, error) {
+	if opts.SpoolDir == "" {
+		opts.SpoolDir = os.TempDir()
+	}
+	if opts.PartSize == 0 {
+		opts.PartSize = DefaultPartSize
+	}
+	if opts.ReadWindow == 0 {
+		opts.ReadWindow = DefaultReadWindow
+	}
+	if opts.PartSize < minPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes, got: %d", minPartSize, opts.PartSize)
+	}
+	if opts.ReadWindow < 0 {
+		return nil, fmt.Errorf("invalid read window: %d", opts.ReadWindow)
+	}
+	if err := os.MkdirAll(opts.SpoolDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %s, err: %v", opts.SpoolDir, err)
+	}
+	return &s3Store{
+		client:     client,
+		prefix:     opts.Prefix,
+		spoolDir:   opts.SpoolDir,
+		partSize:   opts.PartSize,
+		readWindow: opts.ReadWindow,
+	}, nil
+}
+
+// Put uploads the content of r as the blob with specified key and returns the written size
+func (ss *s3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	staged, err := ss.Stage(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = staged.Abort()
+	}()
+	if err := staged.Commit(ctx, key); err != nil {
+		return 0, err
+	}
+	return staged.Size(), nil
+}
+
+// Stage spools the content of r to a local temporary file
+func (ss *s3Store) Stage(_ context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	tmpFile, err := os.CreateTemp(ss.spoolDir, spoolFilePrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file, err: %v", err)
+	}
+
+	digestReader := blobstore.NewDigestReader(r)
+	_, err = io.Copy(tmpFile, digestReader)
+	if err == nil {
+		_, err = tmpFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return nil, fmt.Errorf("failed to spool file, err: %v", err)
+	}
+
+	return &stagedObject{
+		store:  ss,
+		file:   tmpFile,
+		size:   digestReader.Size(),
+		digest: digestReader.Digest(),
+	}, nil
+}
+
+// Get opens the blob with specified key for reading, the content is fetched lazily with ranged GETs
+func (ss *s3Store) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	info, err := ss.client.HeadObject(ctx, ss.Path(key))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &objectReader{
+		ctx:    ctx,
+		client: ss.client,
+		key:    ss.Path(key),
+		size:   info.Size,
+		window: ss.readWindow,
+	}, nil
+}
+
+// Stat returns the detail of the blob with specified key
+func (ss *s3Store) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	info, err := ss.client.HeadObject(ctx, ss.Path(key))
+	if err != nil {
+		return blobstore.BlobInfo{}, mapError(err)
+	}
+	return blobstore.BlobInfo{
+		Key:     key,
+		Path:    info.Key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+	}, nil
+}
+
+// Delete removes the blob with specified key
+func (ss *s3Store) Delete(ctx context.Context, key string) error {
+	// S3 does not report deleting a missing object, so its existence is checked first
+	if _, err := ss.client.HeadObject(ctx, ss.Path(key)); err != nil {
+		return mapError(err)
+	}
+	return ss.client.DeleteObject(ctx, ss.Path(key))
+}
+
+// List returns the detail of all blobs kept under the prefix
+func (ss *s3Store) List(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	objects, err := ss.client.ListObjects(ctx, ss.prefix)
+	if err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+	result := make([]blobstore.BlobInfo, 0, len(objects))
+	for _, object := range objects {
+		result = append(result, blobstore.BlobInfo{
+			Key:     strings.TrimPrefix(object.Key, ss.prefix),
+			Path:    object.Key,
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
+	}
+	return result, nil
+}
+
+// DiskUsages returns the usage of the disk holding the spool directory, where the uploads are staged
+func (ss *s3Store) DiskUsages(_ context.Context, probe bool) ([]blobstore.DiskUsage, error) {
+	return blobstore.LocalDiskUsages(ss.spoolDir, spoolFilePrefix, probe)
+}
+
+// CleanTemp removes the spooled files of the uploads staged before the specified time that were never committed nor aborted
+func (ss *s3Store) CleanTemp(_ context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	return blobstore.CleanLocalTempFiles(ss.spoolDir, spoolFilePrefix, before, dryRun)
+}
+
+// Path returns the object key of the blob with specified key
+func (ss *s3Store) Path(key string) string {
+	return ss.prefix + key
+}
+
+type stagedObject struct {
+	store     *s3Store
+	file      *os.File
+	size      int64
+	digest    string
+	committed bool
+}
+
+func (so *stagedObject) Size() int64 {
+	return so.size
+}
+
+func (so *stagedObject) Digest() string {
+	return so.digest
+}
+
+// Commit uploads the spooled file, using a multipart upload when it is larger than the part size
+func (so *stagedObject) Commit(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("invalid key: %q", key)
+	}
+	if _, err := so.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	objectKey := so.store.Path(key)
+	var err error
+	if so.size <= so.store.partSize {
+		err = so.store.client.PutObject(ctx, objectKey, so.file, so.size)
+	} else {
+		err = so.uploadMultipart(ctx, objectKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %s, err: %w", objectKey, err)
+	}
+
+	so.committed = true
+	so.cleanup()
+	return nil
+}
+
+// Abort removes the spooled file
+func (so *stagedObject) Abort() error {
+	if so.committed {
+		return nil
+	}
+	so.committed = true
+	return so.cleanup()
+}
+
+func (so *stagedObject) uploadMultipart(ctx context.Context, objectKey string) error {
+	client := so.store.client
+	uploadID, err := client.CreateMultipartUpload(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+
+	parts := make([]s3.CompletedPart, 0, so.size/so.store.partSize+1)
+	for offset, partNumber := int64(0), 1; offset < so.size; offset, partNumber = offset+so.store.partSize, partNumber+1 {
+		partSize := so.store.partSize
+		if remaining := so.size - offset; remaining < partSize {
+			partSize = remaining
+		}
+		etag, err := client.UploadPart(ctx, objectKey, uploadID, partNumber, io.NewSectionReader(so.file, offset, partSize), partSize)
+		if err != nil {
+			_ = client.AbortMultipartUpload(ctx, objectKey, uploadID)
+			return err
+		}
+		parts = append(parts, s3.CompletedPart{PartNumber: partNumber, ETag: etag})
+	}
+
+	if err := client.CompleteMultipartUpload(ctx, objectKey, uploadID, parts); err != nil {
+		_ = client.AbortMultipartUpload(ctx, objectKey, uploadID)
+		return err
+	}
+	return nil
+}
+
+func (so *stagedObject) cleanup() error {
+	_ = so.file.Close()
+	return os.Remove(so.file.Name())
+}
+
+// objectReader reads an object through ranged GETs of at most window bytes, seeking only moves the offset
+type objectReader struct {
+	ctx    context.Context
+	client *s3.Client
+	key    string
+	size   int64
+	window int64
+
+	offset int64
+	body   io.ReadCloser
+}
+
+func (or *objectReader) Read(p []byte) (int, error) {
+	if or.offset >= or.size {
+		return 0, io.EOF
+	}
+	if or.body == nil {
+		length := or.size - or.offset
+		if or.window > 0 && length > or.window {
+			length = or.window
+		}
+		body, err := or.client.GetObject(or.ctx, or.key, or.offset, length)
+		if err != nil {
+			return 0, mapError(err)
+		}
+		or.body = body
+	}
+
+	n, err := or.body.Read(p)
+	or.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		// the window is exhausted, the next read fetches the following range
+		_ = or.body.Close()
+		or.body = nil
+		if or.offset < or.size {
+			err = nil
+			if n == 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+		}
+	}
+	return n, err
+}
+
+func (or *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = or.offset + offset
+	case io.SeekEnd:
+		target = or.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position: %d", target)
+	}
+	if target != or.offset && or.body != nil {
+		_ = or.body.Close()
+		or.body = nil
+	}
+	or.offset = target
+	return target, nil
+}
+
+func (or *objectReader) Close() error {
+	if or.body == nil {
+		return nil
+	}
+	err := or.body.Close()
+	or.body = nil
+	return err
+}
+
+func mapError(err error) error {
+	if errors.Is(err, s3.ErrorNotFound) {
+		return fmt.Errorf("%w: %v", blobstore.ErrorNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,219 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/s3"
+	"github.com/cityos-dev/Cornelius-David-Herianto/infrastructure/s3/s3test"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+func newTestStore(t *testing.T, opts Options) (*s3Store, *s3test.Server) {
+	server := s3test.NewServer("videos")
+	t.Cleanup(server.Close)
+
+	client, err := s3.NewClient(s3.Config{
+		Endpoint:  server.URL,
+		Bucket:    "videos",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.SpoolDir = t.TempDir()
+	store, err := NewS3Store(client, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*s3Store), server
+}
+
+func TestNewS3Store(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{
+			name:    "successfully get new s3 store with default options",
+			opts:    Options{},
+			wantErr: false,
+		},
+		{
+			name:    "part size below the S3 minimum",
+			opts:    Options{PartSize: 1024},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.SpoolDir = t.TempDir()
+			got, err := NewS3Store(&s3.Client{}, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewS3Store() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if store := got.(*s3Store); store.partSize != DefaultPartSize || store.readWindow != DefaultReadWindow {
+				t.Errorf("NewS3Store() = %+v, want default part size and read window", store)
+			}
+		})
+	}
+}
+
+func Test_s3Store_Stage(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestStore(t, Options{Prefix: "videos/", PartSize: minPartSize})
+
+	tests := []struct {
+		name          string
+		content       []byte
+		wantMultipart bool
+	}{
+		{
+			name:          "small blob is uploaded in a single request",
+			content:       []byte("sample string"),
+			wantMultipart: false,
+		},
+		{
+			name:          "large blob is uploaded in parts",
+			content:       bytes.Repeat([]byte("0123456789"), minPartSize/10*2+1),
+			wantMultipart: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staged, err := store.Stage(ctx, bytes.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Stage() error = %v", err)
+			}
+			if staged.Size() != int64(len(tt.content)) {
+				t.Errorf("Stage() size = %d, want %d", staged.Size(), len(tt.content))
+			}
+			if _, ok := server.Object("videos/" + staged.Digest()); ok {
+				t.Errorf("Stage() object is visible before commit")
+			}
+
+			if err := staged.Commit(ctx, staged.Digest()); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			if err := staged.Abort(); err != nil {
+				t.Errorf("Abort() after commit error = %v", err)
+			}
+			got, _ := server.Object("videos/" + staged.Digest())
+			if !bytes.Equal(got, tt.content) {
+				t.Errorf("Commit() object size = %d, want %d", len(got), len(tt.content))
+			}
+
+			uploadedParts := 0
+			for _, request := range server.Requests() {
+				if request.Key == "videos/"+staged.Digest() && strings.Contains(request.Query, "partNumber") {
+					uploadedParts++
+				}
+			}
+			if (uploadedParts > 0) != tt.wantMultipart {
+				t.Errorf("Commit() uploaded parts = %d, wantMultipart %v", uploadedParts, tt.wantMultipart)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(store.spoolDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("spool directory is not cleaned up, got %d entries", len(entries))
+	}
+}
+
+func Test_s3Store_Get(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestStore(t, Options{ReadWindow: 4})
+	if _, err := store.Put(ctx, "sample.mp4", strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := store.Get(ctx, "sample.mp4")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	if err != nil || string(got) != "0123456789" {
+		t.Errorf("Get() content = %s, err = %v", got, err)
+	}
+
+	if _, err := reader.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	part := make([]byte, 2)
+	if _, err := io.ReadFull(reader, part); err != nil || string(part) != "56" {
+		t.Errorf("Get() content after seek = %s, err = %v", part, err)
+	}
+
+	gotRanges := make([]string, 0)
+	for _, request := range server.Requests() {
+		if request.Method == "GET" {
+			gotRanges = append(gotRanges, request.Range)
+		}
+	}
+	wantRanges := []string{"bytes=0-3", "bytes=4-7", "bytes=8-9", "bytes=5-8"}
+	if !reflect.DeepEqual(gotRanges, wantRanges) {
+		t.Errorf("Get() ranges = %v, want %v", gotRanges, wantRanges)
+	}
+
+	if _, err := store.Get(ctx, "missing.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_s3Store_StatListDelete(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t, Options{Prefix: "videos/"})
+	for _, key := range []string{"a.mp4", "b.mp4"} {
+		if _, err := store.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := store.Stat(ctx, "a.mp4")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Key != "a.mp4" || info.Path != "videos/a.mp4" || info.Size != 5 {
+		t.Errorf("Stat() got = %+v", info)
+	}
+
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	gotKeys := make([]string, 0, len(list))
+	for _, blob := range list {
+		gotKeys = append(gotKeys, blob.Key)
+	}
+	if want := []string{"a.mp4", "b.mp4"}; !reflect.DeepEqual(gotKeys, want) {
+		t.Errorf("List() keys = %v, want %v", gotKeys, want)
+	}
+
+	if err := store.Delete(ctx, "a.mp4"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := store.Delete(ctx, "a.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+	if _, err := store.Stat(ctx, "a.mp4"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Stat() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
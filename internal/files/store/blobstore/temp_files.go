@@ -0,0 +1,53 @@
+package blobstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CleanLocalTempFiles removes the files named with prefix directly under dir and last modified before the specified time.
+// It returns the removed files, with dryRun the files are only returned.
+func CleanLocalTempFiles(dir, prefix string, before time.Time, dryRun bool) ([]BlobInfo, error) {
+	removed := make([]BlobInfo, 0)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return removed, err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// the upload finished in the meantime
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if !info.ModTime().Before(before) {
+			continue
+		}
+		filePath := filepath.Join(dir, entry.Name())
+		if !dryRun {
+			err := os.Remove(filePath)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, BlobInfo{
+			Key:     entry.Name(),
+			Path:    filePath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return removed, nil
+}
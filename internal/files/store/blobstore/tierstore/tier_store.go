@@ -0,0 +1,381 @@
+package tierstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+)
+
+type tierStore struct {
+	hot   blobstore.BlobStore
+	cold  blobstore.BlobStore
+	locks *keyLocks
+
+	// promoting keeps the keys of the blobs being promoted in the background, promotions waits for them,
+	// no promotion is started once draining
+	mu         sync.Mutex
+	promoting  map[string]bool
+	promotions sync.WaitGroup
+	draining   bool
+}
+
+// NewTierStore returns new blob store writing the blobs to the hot store, from which they can be demoted to the cold store.
+// A demoted blob is promoted back to the hot store in the background when it is read.
+func NewTierStore(hot, cold blobstore.BlobStore) blobstore.BlobStore {
+	return &tierStore{
+		hot:       hot,
+		cold:      cold,
+		locks:     newKeyLocks(),
+		promoting: make(map[string]bool),
+	}
+}
+
+// Put writes the content of r to the hot store
+func (ts *tierStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	return ts.hot.Put(ctx, key, r)
+}
+
+// Stage stages the content of r on the hot store
+func (ts *tierStore) Stage(ctx context.Context, r io.Reader) (blobstore.StagedBlob, error) {
+	return ts.hot.Stage(ctx, r)
+}
+
+// Get opens the blob from the hot store, a cold blob is served right away from the cold store and promoted in the background,
+// so reading a large cold blob neither waits for its copy nor holds the other readers of the key.
+func (ts *tierStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	content, err := ts.hot.Get(ctx, key)
+	if !errors.Is(err, blobstore.ErrorNotFound) {
+		return content, err
+	}
+
+	content, err = ts.cold.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrorNotFound) {
+		// the blob may have moved between the tiers since it was looked up on the hot store,
+		// so both tiers are looked up again while it cannot move
+		unlock := ts.locks.lock(key)
+		defer unlock()
+		content, err = ts.hot.Get(ctx, key)
+		if !errors.Is(err, blobstore.ErrorNotFound) {
+			return content, err
+		}
+		content, err = ts.cold.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ts.promote(key)
+	return content, nil
+}
+
+// promote moves the cold blob to the hot store in the background, a blob already being promoted is left to that promotion.
+// The promotion outlives the request reading the blob, so it is not bound to the context of the request.
+func (ts *tierStore) promote(key string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.promoting[key] || ts.draining {
+		return
+	}
+	ts.promoting[key] = true
+	ts.promotions.Add(1)
+
+	go func() {
+		defer ts.promotions.Done()
+		defer func() {
+			ts.mu.Lock()
+			delete(ts.promoting, key)
+			ts.mu.Unlock()
+		}()
+
+		unlock := ts.locks.lock(key)
+		defer unlock()
+
+		// the blob may have been promoted, demoted again or deleted while waiting for the lock
+		ctx := context.Background()
+		if _, err := ts.hot.Stat(ctx, key); !errors.Is(err, blobstore.ErrorNotFound) {
+			return
+		}
+		if err := moveBlob(ctx, ts.cold, ts.hot, key); err != nil && !errors.Is(err, blobstore.ErrorNotFound) {
+			log.Printf("failed to promote blob: %s, it is kept on the cold store, err: %v", key, err)
+		}
+	}()
+}
+
+// Drain stops promoting the cold blobs which are read and waits for the promotions in progress, or until ctx is done.
+// A promotion interrupted by the exit leaves the blob on the cold store, it is promoted again when it is read.
+func (ts *tierStore) Drain(ctx context.Context) error {
+	ts.mu.Lock()
+	ts.draining = true
+	ts.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ts.promotions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stat returns the detail of the blob from the tier holding it
+func (ts *tierStore) Stat(ctx context.Context, key string) (blobstore.BlobInfo, error) {
+	info, err := ts.hot.Stat(ctx, key)
+	if !errors.Is(err, blobstore.ErrorNotFound) {
+		return info, err
+	}
+	return ts.cold.Stat(ctx, key)
+}
+
+// Delete removes the blob from both tiers
+func (ts *tierStore) Delete(ctx context.Context, key string) error {
+	unlock := ts.locks.lock(key)
+	defer unlock()
+
+	hotErr := ts.hot.Delete(ctx, key)
+	if hotErr != nil && !errors.Is(hotErr, blobstore.ErrorNotFound) {
+		return hotErr
+	}
+	coldErr := ts.cold.Delete(ctx, key)
+	if coldErr != nil && !errors.Is(coldErr, blobstore.ErrorNotFound) {
+		return coldErr
+	}
+	if hotErr != nil && coldErr != nil {
+		return hotErr
+	}
+	return nil
+}
+
+// List returns the detail of the blobs of both tiers
+func (ts *tierStore) List(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	hotBlobs, err := ts.hot.List(ctx)
+	if err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+	coldBlobs, err := ts.cold.List(ctx)
+	if err != nil {
+		return []blobstore.BlobInfo{}, err
+	}
+
+	listed := make(map[string]bool)
+	result := make([]blobstore.BlobInfo, 0, len(hotBlobs)+len(coldBlobs))
+	for _, blob := range append(hotBlobs, coldBlobs...) {
+		if listed[blob.Key] {
+			continue
+		}
+		listed[blob.Key] = true
+		result = append(result, blob)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// Path returns the path of the blob on the hot store
+func (ts *tierStore) Path(key string) string {
+	return ts.hot.Path(key)
+}
+
+// ReplicaStates returns the state of the copies of the blob kept by the tier holding it
+func (ts *tierStore) ReplicaStates(ctx context.Context, key string, size int64) ([]blobstore.ReplicaState, error) {
+	replicator, err := ts.replicator(ctx, key)
+	if err != nil || replicator == nil {
+		return nil, err
+	}
+	return replicator.ReplicaStates(ctx, key, size)
+}
+
+// Repair repairs the copies of the blob kept by the tier holding it
+func (ts *tierStore) Repair(ctx context.Context, key string, size int64) (int, error) {
+	unlock := ts.locks.lock(key)
+	defer unlock()
+
+	replicator, err := ts.replicator(ctx, key)
+	if err != nil || replicator == nil {
+		return 0, err
+	}
+	return replicator.Repair(ctx, key, size)
+}
+
+// replicator returns the tier holding the blob when it keeps several copies of its blobs, or nil otherwise
+func (ts *tierStore) replicator(ctx context.Context, key string) (blobstore.Replicator, error) {
+	// a blob missing from every copy is reported by the hot tier, where it is written
+	store := ts.hot
+	tier, err := ts.Tier(ctx, key)
+	if err == nil && tier == blobstore.TierCold {
+		store = ts.cold
+	} else if err != nil && !errors.Is(err, blobstore.ErrorNotFound) {
+		return nil, err
+	}
+	replicator, ok := store.(blobstore.Replicator)
+	if !ok {
+		return nil, nil
+	}
+	return replicator, nil
+}
+
+// MigrateLayout migrates the layout of the tiers supporting it
+func (ts *tierStore) MigrateLayout(ctx context.Context) ([]blobstore.BlobInfo, error) {
+	moved := make([]blobstore.BlobInfo, 0)
+	for _, store := range []blobstore.BlobStore{ts.hot, ts.cold} {
+		migrator, ok := store.(blobstore.LayoutMigrator)
+		if !ok {
+			continue
+		}
+		storeMoved, err := migrator.MigrateLayout(ctx)
+		moved = append(moved, storeMoved...)
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// RotateKeys rotates the data keys of the encrypted tiers
+func (ts *tierStore) RotateKeys(ctx context.Context) (int, error) {
+	rotated := 0
+	for _, store := range []blobstore.BlobStore{ts.hot, ts.cold} {
+		rotator, ok := store.(blobstore.KeyRotator)
+		if !ok {
+			continue
+		}
+		storeRotated, err := rotator.RotateKeys(ctx)
+		rotated += storeRotated
+		if err != nil {
+			return rotated, err
+		}
+	}
+	return rotated, nil
+}
+
+// DiskUsages returns the usage of the disks of both tiers
+func (ts *tierStore) DiskUsages(ctx context.Context, probe bool) ([]blobstore.DiskUsage, error) {
+	usages := make([]blobstore.DiskUsage, 0)
+	for _, store := range []blobstore.BlobStore{ts.hot, ts.cold} {
+		diskUser, ok := store.(blobstore.DiskUser)
+		if !ok {
+			continue
+		}
+		storeUsages, err := diskUser.DiskUsages(ctx, probe)
+		usages = append(usages, storeUsages...)
+		if err != nil {
+			return usages, err
+		}
+	}
+	return usages, nil
+}
+
+// CleanTemp removes the temporary content of both tiers
+func (ts *tierStore) CleanTemp(ctx context.Context, before time.Time, dryRun bool) ([]blobstore.BlobInfo, error) {
+	removed := make([]blobstore.BlobInfo, 0)
+	for _, store := range []blobstore.BlobStore{ts.hot, ts.cold} {
+		cleaner, ok := store.(blobstore.TempCleaner)
+		if !ok {
+			continue
+		}
+		storeRemoved, err := cleaner.CleanTemp(ctx, before, dryRun)
+		removed = append(removed, storeRemoved...)
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Tier returns the tier currently holding the blob
+func (ts *tierStore) Tier(ctx context.Context, key string) (string, error) {
+	_, err := ts.hot.Stat(ctx, key)
+	if err == nil {
+		return blobstore.TierHot, nil
+	}
+	if !errors.Is(err, blobstore.ErrorNotFound) {
+		return "", err
+	}
+	if _, err := ts.cold.Stat(ctx, key); err != nil {
+		return "", err
+	}
+	return blobstore.TierCold, nil
+}
+
+// Demote moves the blob to the cold store, demoting a cold blob is a no-op
+func (ts *tierStore) Demote(ctx context.Context, key string) error {
+	unlock := ts.locks.lock(key)
+	defer unlock()
+
+	_, err := ts.hot.Stat(ctx, key)
+	if errors.Is(err, blobstore.ErrorNotFound) {
+		if _, coldErr := ts.cold.Stat(ctx, key); coldErr == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return moveBlob(ctx, ts.hot, ts.cold, key)
+}
+
+// moveBlob copies the blob to the target store and only then removes it from the source store
+func moveBlob(ctx context.Context, source, target blobstore.BlobStore, key string) error {
+	content, err := source.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = target.Put(ctx, key, content)
+	_ = content.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy blob: %s, err: %w", key, err)
+	}
+	if err := source.Delete(ctx, key); err != nil && !errors.Is(err, blobstore.ErrorNotFound) {
+		return fmt.Errorf("failed to remove moved blob: %s, err: %w", key, err)
+	}
+	return nil
+}
+
+// keyLocks serializes the tier changes of every key, the lock of a key is dropped once nobody holds it
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu      sync.Mutex
+	holders int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+func (kl *keyLocks) lock(key string) func() {
+	kl.mu.Lock()
+	lock, ok := kl.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		kl.locks[key] = lock
+	}
+	lock.holders++
+	kl.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		kl.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(kl.locks, key)
+		}
+		kl.mu.Unlock()
+	}
+}
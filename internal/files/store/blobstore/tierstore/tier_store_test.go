@@ -0,0 +1,239 @@
+package tierstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/memstore"
+	"github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/blobstore/mirrorstore"
+)
+
+// blockingStore holds every Put until release is closed and counts them
+type blockingStore struct {
+	blobstore.BlobStore
+	release chan struct{}
+	mu      sync.Mutex
+	puts    int
+}
+
+func (bs *blockingStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	bs.mu.Lock()
+	bs.puts++
+	bs.mu.Unlock()
+	<-bs.release
+	return bs.BlobStore.Put(ctx, key, r)
+}
+
+func assertTier(t *testing.T, store blobstore.BlobStore, key, want string) {
+	t.Helper()
+	got, err := store.(blobstore.Tierer).Tier(context.Background(), key)
+	if err != nil || got != want {
+		t.Errorf("Tier() got = %s, err = %v, want %s", got, err, want)
+	}
+}
+
+func Test_tierStore_DemoteAndPromote(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := memstore.NewMemoryStore(), memstore.NewMemoryStore()
+	store := NewTierStore(hot, cold)
+
+	if _, err := store.Put(ctx, "sample", strings.NewReader("sample string")); err != nil {
+		t.Fatal(err)
+	}
+	assertTier(t, store, "sample", blobstore.TierHot)
+
+	tierer := store.(blobstore.Tierer)
+	if err := tierer.Demote(ctx, "sample"); err != nil {
+		t.Fatalf("Demote() error = %v", err)
+	}
+	assertTier(t, store, "sample", blobstore.TierCold)
+	if _, err := hot.Stat(ctx, "sample"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Demote() blob is left on the hot store, err = %v", err)
+	}
+	if err := tierer.Demote(ctx, "sample"); err != nil {
+		t.Errorf("Demote() of cold blob error = %v", err)
+	}
+	if info, err := store.Stat(ctx, "sample"); err != nil || info.Size != 13 {
+		t.Errorf("Stat() of cold blob got = %+v, err = %v", info, err)
+	}
+	if blobs, err := store.List(ctx); err != nil || len(blobs) != 1 {
+		t.Errorf("List() got = %+v, err = %v", blobs, err)
+	}
+
+	content, err := store.Get(ctx, "sample")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(content)
+	_ = content.Close()
+	if string(got) != "sample string" {
+		t.Errorf("Get() got = %s", got)
+	}
+	if err := store.(blobstore.Drainer).Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	assertTier(t, store, "sample", blobstore.TierHot)
+	if _, err := cold.Stat(ctx, "sample"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Get() blob is left on the cold store, err = %v", err)
+	}
+
+	if err := tierer.Demote(ctx, "missing"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Demote() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_tierStore_Delete(t *testing.T) {
+	ctx := context.Background()
+	store := NewTierStore(memstore.NewMemoryStore(), memstore.NewMemoryStore())
+	_, _ = store.Put(ctx, "sample", strings.NewReader("sample string"))
+	_ = store.(blobstore.Tierer).Demote(ctx, "sample")
+
+	if err := store.Delete(ctx, "sample"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "sample"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+	if err := store.Delete(ctx, "sample"); !errors.Is(err, blobstore.ErrorNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, blobstore.ErrorNotFound)
+	}
+}
+
+func Test_tierStore_concurrentDemoteAndPromote(t *testing.T) {
+	ctx := context.Background()
+	store := NewTierStore(memstore.NewMemoryStore(), memstore.NewMemoryStore())
+	_, _ = store.Put(ctx, "sample", strings.NewReader("sample string"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = store.(blobstore.Tierer).Demote(ctx, "sample")
+		}()
+		go func() {
+			defer wg.Done()
+			content, err := store.Get(ctx, "sample")
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+				return
+			}
+			got, _ := io.ReadAll(content)
+			_ = content.Close()
+			if string(got) != "sample string" {
+				t.Errorf("Get() got = %s", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := store.Stat(ctx, "sample"); err != nil {
+		t.Errorf("Stat() blob is lost, err = %v", err)
+	}
+}
+
+func Test_tierStore_GetServesColdBlobWhilePromoting(t *testing.T) {
+	ctx := context.Background()
+	hot := &blockingStore{BlobStore: memstore.NewMemoryStore(), release: make(chan struct{})}
+	cold := memstore.NewMemoryStore()
+	store := NewTierStore(hot, cold)
+	_, _ = cold.Put(ctx, "sample", strings.NewReader("sample string"))
+
+	// the promotion is held by the hot store, the reads must neither wait for it nor start another one
+	for i := 0; i < 5; i++ {
+		content, err := store.Get(ctx, "sample")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		got, _ := io.ReadAll(content)
+		_ = content.Close()
+		if string(got) != "sample string" {
+			t.Errorf("Get() got = %s", got)
+		}
+	}
+	assertTier(t, store, "sample", blobstore.TierCold)
+
+	close(hot.release)
+	if err := store.(blobstore.Drainer).Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	assertTier(t, store, "sample", blobstore.TierHot)
+	if hot.puts != 1 {
+		t.Errorf("Get() promoted the blob %d times, want 1", hot.puts)
+	}
+}
+
+func Test_tierStore_Drain(t *testing.T) {
+	ctx := context.Background()
+	hot := &blockingStore{BlobStore: memstore.NewMemoryStore(), release: make(chan struct{})}
+	store := NewTierStore(hot, memstore.NewMemoryStore())
+	_, _ = store.(*tierStore).cold.Put(ctx, "sample", strings.NewReader("sample string"))
+
+	read := func() {
+		content, err := store.Get(ctx, "sample")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		_ = content.Close()
+	}
+	read()
+
+	// the promotion is held by the hot store, draining gives up once the context is done
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := store.(blobstore.Drainer).Drain(timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(hot.release)
+	if err := store.(blobstore.Drainer).Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	assertTier(t, store, "sample", blobstore.TierHot)
+
+	// no promotion is started once drained
+	if err := store.(blobstore.Tierer).Demote(ctx, "sample"); err != nil {
+		t.Fatal(err)
+	}
+	read()
+	assertTier(t, store, "sample", blobstore.TierCold)
+}
+
+func Test_tierStore_Replicator(t *testing.T) {
+	ctx := context.Background()
+	first, second := memstore.NewMemoryStore(), memstore.NewMemoryStore()
+	hot, err := mirrorstore.NewMirrorStore([]mirrorstore.Replica{{Name: "first", Store: first}, {Name: "second", Store: second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewTierStore(hot, memstore.NewMemoryStore())
+	_, _ = store.Put(ctx, "sample", strings.NewReader("sample string"))
+	_ = second.Delete(ctx, "sample")
+
+	replicator, ok := store.(blobstore.Replicator)
+	if !ok {
+		t.Fatal("tier store does not forward the replicas of the hot store")
+	}
+	states, err := replicator.ReplicaStates(ctx, "sample", 13)
+	if err != nil || len(states) != 2 || states[1].State != blobstore.ReplicaStateMissing {
+		t.Errorf("ReplicaStates() got = %+v, err = %v", states, err)
+	}
+	if restored, err := replicator.Repair(ctx, "sample", 13); err != nil || restored != 1 {
+		t.Errorf("Repair() got = %d, err = %v, want 1", restored, err)
+	}
+	if _, err := second.Stat(ctx, "sample"); err != nil {
+		t.Errorf("Repair() blob is not restored, err = %v", err)
+	}
+
+	// the cold tier keeps a single copy
+	_ = store.(blobstore.Tierer).Demote(ctx, "sample")
+	if states, err := replicator.ReplicaStates(ctx, "sample", 13); err != nil || states != nil {
+		t.Errorf("ReplicaStates() of cold blob got = %+v, err = %v", states, err)
+	}
+}
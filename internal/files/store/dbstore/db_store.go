@@ -2,22 +2,140 @@ package dbstore
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// Statuses of a file, a file is only visible once it is active, a trashed file is kept until it is restored or purged
+const (
+	FileStatusPending  = "pending"
+	FileStatusActive   = "active"
+	FileStatusDeleting = "deleting"
+	FileStatusTrashed  = "trashed"
+)
+
+// GlobalOwner is the owner under which the quota and the usage of the whole storage are kept
+const GlobalOwner = "*"
+
+// Errors represent custom error that will be verified by the caller
+var (
+	ErrorQuotaExceeded = errors.New("storage quota exceeded")
+	ErrorLocked        = errors.New("lock is held by another session")
+)
+
 // FileDetail represent the detail of the file that will be stored on database
 type FileDetail struct {
-	ID        string
+	// ID is generated when the file is uploaded, Name is the file name it was uploaded with
+	ID   string
+	Name string
+	// FileID is the id of the file the record is a version of, Version counts the versions of that file from 1.
+	// A record without FileID is the first version of a new file, a record with FileID but without Version is its next version.
+	FileID    string
+	Version   int
 	Size      int64
 	Path      string
+	Digest    string
+	Owner     string
+	Status    string
+	CreatedAt time.Time
+	// Broken is set when the content of the file was found missing or damaged on the blob storage
+	Broken bool
+	// TrashedAt is only set while the file is trashed
+	TrashedAt time.Time
+	// ExpiresAt is the time after which the file is deleted, zero when the file never expires
+	ExpiresAt time.Time
+	// StatusChangedAt is the time the file entered its current status, it is only set by GetFilesByStatus
+	StatusChangedAt time.Time
+}
+
+// Quota represents the storage limits of an owner, a zero limit means unlimited
+type Quota struct {
+	MaxBytes int64
+	MaxFiles int64
+}
+
+// Usage represents the storage consumed by an owner and its quota
+type Usage struct {
+	UsedBytes int64
+	UsedFiles int64
+	Quota     Quota
+}
+
+// Upload represents a resumable upload, its content is received in chunks and kept on the storage until it is complete
+type Upload struct {
+	ID    string
+	Name  string
+	Owner string
+	// Length is the size of the complete file, Offset is the number of bytes received so far
+	Length int64
+	Offset int64
+	// Metadata is the metadata the upload was created with, kept as sent by the client
+	Metadata  string
+	CreatedAt time.Time
+	// ExpiresAt is the time after which the unfinished upload is removed, it is pushed back by every chunk
+	ExpiresAt time.Time
+}
+
+// MultipartUpload represents an upload session, its parts are uploaded separately and assembled once it is completed
+type MultipartUpload struct {
+	ID        string
+	Name      string
+	Owner     string
 	CreatedAt time.Time
 }
 
+// MultipartPart represents an uploaded part of a multipart upload, Checksum is the hex encoded SHA-256 of its content
+type MultipartPart struct {
+	UploadID   string
+	PartNumber int
+	Size       int64
+	Checksum   string
+	CreatedAt  time.Time
+}
+
+// BlobFunc is called within the DB transaction with the changed file and the reference count of its blob after the change.
+// The blob record stays locked until the transaction ends, so the blob storage must be updated within the BlobFunc:
+// concurrent changes of the same blob wait for it and see its outcome. Returning an error rolls the change back.
+type BlobFunc func(ctx context.Context, file FileDetail, refCount int64) error
+
 // DBStore provides file-related mechanism to interact with the database
 //
 //go:generate mockgen -destination mocks/mock_db_store.go github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore DBStore
 type DBStore interface {
-	InsertNewFile(ctx context.Context, file FileDetail) error
-	DeleteFileByID(ctx context.Context, id string) (FileDetail, error)
+	InsertNewFile(ctx context.Context, file FileDetail, blobFunc BlobFunc) error
+	DeleteFileByID(ctx context.Context, id string, blobFunc BlobFunc) (FileDetail, error)
+	GetFileByID(ctx context.Context, id string) (FileDetail, error)
+	GetFileByName(ctx context.Context, name string) (FileDetail, error)
+	GetFileVersions(ctx context.Context, fileID string) ([]FileDetail, error)
+	GetFileVersion(ctx context.Context, fileID string, version int) (FileDetail, error)
 	GetAllFiles(ctx context.Context) ([]FileDetail, error)
+	UpdateFilePath(ctx context.Context, id, path string) error
+	TouchFile(ctx context.Context, id string, accessedAt time.Time) error
+	GetColdFiles(ctx context.Context, before time.Time) ([]FileDetail, error)
+	GetUsage(ctx context.Context, owner string) (Usage, error)
+	SetQuota(ctx context.Context, owner string, quota Quota) error
+	SetFileBroken(ctx context.Context, id string, broken bool) error
+	SetFileStatus(ctx context.Context, id, from, to string) error
+	GetFilesByStatus(ctx context.Context, status string) ([]FileDetail, error)
+	TrashFile(ctx context.Context, fileID string, trashedAt time.Time) error
+	RestoreFile(ctx context.Context, fileID string) error
+	GetTrashedFiles(ctx context.Context) ([]FileDetail, error)
+	GetTrashedFileVersions(ctx context.Context, fileID string) ([]FileDetail, error)
+	GetTrashedFilesBefore(ctx context.Context, before time.Time) ([]FileDetail, error)
+	SetFileExpiry(ctx context.Context, fileID string, expiresAt time.Time) error
+	GetExpiredFiles(ctx context.Context, before time.Time) ([]FileDetail, error)
+	GetExpiredTrashedFiles(ctx context.Context, before time.Time) ([]FileDetail, error)
+	DeleteUnreferencedBlob(ctx context.Context, key string, blobFunc BlobFunc) (bool, error)
+	InsertUpload(ctx context.Context, upload Upload) error
+	GetUpload(ctx context.Context, id string) (Upload, error)
+	SetUploadOffset(ctx context.Context, id string, from, to int64, expiresAt time.Time) error
+	DeleteUpload(ctx context.Context, id string) error
+	GetExpiredUploads(ctx context.Context, before time.Time) ([]Upload, error)
+	TryLock(ctx context.Context, key string) (func(), error)
+	InsertMultipartUpload(ctx context.Context, upload MultipartUpload) error
+	GetMultipartUpload(ctx context.Context, id string) (MultipartUpload, error)
+	GetMultipartUploadsBefore(ctx context.Context, before time.Time) ([]MultipartUpload, error)
+	DeleteMultipartUpload(ctx context.Context, id string) error
+	PutMultipartPart(ctx context.Context, part MultipartPart) error
+	GetMultipartParts(ctx context.Context, uploadID string) ([]MultipartPart, error)
 }
@@ -7,6 +7,7 @@ package mock_dbstore
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	dbstore "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/store/dbstore"
 	gomock "github.com/golang/mock/gomock"
@@ -36,18 +37,61 @@ func (m *MockDBStore) EXPECT() *MockDBStoreMockRecorder {
 }
 
 // DeleteFileByID mocks base method.
-func (m *MockDBStore) DeleteFileByID(arg0 context.Context, arg1 string) (dbstore.FileDetail, error) {
+func (m *MockDBStore) DeleteFileByID(arg0 context.Context, arg1 string, arg2 dbstore.BlobFunc) (dbstore.FileDetail, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteFileByID", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeleteFileByID", arg0, arg1, arg2)
 	ret0, _ := ret[0].(dbstore.FileDetail)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DeleteFileByID indicates an expected call of DeleteFileByID.
-func (mr *MockDBStoreMockRecorder) DeleteFileByID(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDBStoreMockRecorder) DeleteFileByID(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileByID", reflect.TypeOf((*MockDBStore)(nil).DeleteFileByID), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFileByID", reflect.TypeOf((*MockDBStore)(nil).DeleteFileByID), arg0, arg1, arg2)
+}
+
+// DeleteMultipartUpload mocks base method.
+func (m *MockDBStore) DeleteMultipartUpload(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMultipartUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMultipartUpload indicates an expected call of DeleteMultipartUpload.
+func (mr *MockDBStoreMockRecorder) DeleteMultipartUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMultipartUpload", reflect.TypeOf((*MockDBStore)(nil).DeleteMultipartUpload), arg0, arg1)
+}
+
+// DeleteUnreferencedBlob mocks base method.
+func (m *MockDBStore) DeleteUnreferencedBlob(arg0 context.Context, arg1 string, arg2 dbstore.BlobFunc) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUnreferencedBlob", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUnreferencedBlob indicates an expected call of DeleteUnreferencedBlob.
+func (mr *MockDBStoreMockRecorder) DeleteUnreferencedBlob(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUnreferencedBlob", reflect.TypeOf((*MockDBStore)(nil).DeleteUnreferencedBlob), arg0, arg1, arg2)
+}
+
+// DeleteUpload mocks base method.
+func (m *MockDBStore) DeleteUpload(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUpload indicates an expected call of DeleteUpload.
+func (mr *MockDBStoreMockRecorder) DeleteUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUpload", reflect.TypeOf((*MockDBStore)(nil).DeleteUpload), arg0, arg1)
 }
 
 // GetAllFiles mocks base method.
@@ -65,16 +109,454 @@ func (mr *MockDBStoreMockRecorder) GetAllFiles(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllFiles", reflect.TypeOf((*MockDBStore)(nil).GetAllFiles), arg0)
 }
 
+// GetColdFiles mocks base method.
+func (m *MockDBStore) GetColdFiles(arg0 context.Context, arg1 time.Time) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetColdFiles", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetColdFiles indicates an expected call of GetColdFiles.
+func (mr *MockDBStoreMockRecorder) GetColdFiles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetColdFiles", reflect.TypeOf((*MockDBStore)(nil).GetColdFiles), arg0, arg1)
+}
+
+// GetExpiredFiles mocks base method.
+func (m *MockDBStore) GetExpiredFiles(arg0 context.Context, arg1 time.Time) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredFiles", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredFiles indicates an expected call of GetExpiredFiles.
+func (mr *MockDBStoreMockRecorder) GetExpiredFiles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredFiles", reflect.TypeOf((*MockDBStore)(nil).GetExpiredFiles), arg0, arg1)
+}
+
+// GetExpiredTrashedFiles mocks base method.
+func (m *MockDBStore) GetExpiredTrashedFiles(arg0 context.Context, arg1 time.Time) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredTrashedFiles", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredTrashedFiles indicates an expected call of GetExpiredTrashedFiles.
+func (mr *MockDBStoreMockRecorder) GetExpiredTrashedFiles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredTrashedFiles", reflect.TypeOf((*MockDBStore)(nil).GetExpiredTrashedFiles), arg0, arg1)
+}
+
+// GetExpiredUploads mocks base method.
+func (m *MockDBStore) GetExpiredUploads(arg0 context.Context, arg1 time.Time) ([]dbstore.Upload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredUploads", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.Upload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredUploads indicates an expected call of GetExpiredUploads.
+func (mr *MockDBStoreMockRecorder) GetExpiredUploads(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredUploads", reflect.TypeOf((*MockDBStore)(nil).GetExpiredUploads), arg0, arg1)
+}
+
+// GetFileByID mocks base method.
+func (m *MockDBStore) GetFileByID(arg0 context.Context, arg1 string) (dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileByID", arg0, arg1)
+	ret0, _ := ret[0].(dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileByID indicates an expected call of GetFileByID.
+func (mr *MockDBStoreMockRecorder) GetFileByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileByID", reflect.TypeOf((*MockDBStore)(nil).GetFileByID), arg0, arg1)
+}
+
+// GetFileByName mocks base method.
+func (m *MockDBStore) GetFileByName(arg0 context.Context, arg1 string) (dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileByName", arg0, arg1)
+	ret0, _ := ret[0].(dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileByName indicates an expected call of GetFileByName.
+func (mr *MockDBStoreMockRecorder) GetFileByName(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileByName", reflect.TypeOf((*MockDBStore)(nil).GetFileByName), arg0, arg1)
+}
+
+// GetFileVersion mocks base method.
+func (m *MockDBStore) GetFileVersion(arg0 context.Context, arg1 string, arg2 int) (dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileVersion", arg0, arg1, arg2)
+	ret0, _ := ret[0].(dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileVersion indicates an expected call of GetFileVersion.
+func (mr *MockDBStoreMockRecorder) GetFileVersion(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileVersion", reflect.TypeOf((*MockDBStore)(nil).GetFileVersion), arg0, arg1, arg2)
+}
+
+// GetFileVersions mocks base method.
+func (m *MockDBStore) GetFileVersions(arg0 context.Context, arg1 string) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileVersions", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileVersions indicates an expected call of GetFileVersions.
+func (mr *MockDBStoreMockRecorder) GetFileVersions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileVersions", reflect.TypeOf((*MockDBStore)(nil).GetFileVersions), arg0, arg1)
+}
+
+// GetFilesByStatus mocks base method.
+func (m *MockDBStore) GetFilesByStatus(arg0 context.Context, arg1 string) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFilesByStatus", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFilesByStatus indicates an expected call of GetFilesByStatus.
+func (mr *MockDBStoreMockRecorder) GetFilesByStatus(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFilesByStatus", reflect.TypeOf((*MockDBStore)(nil).GetFilesByStatus), arg0, arg1)
+}
+
+// GetMultipartParts mocks base method.
+func (m *MockDBStore) GetMultipartParts(arg0 context.Context, arg1 string) ([]dbstore.MultipartPart, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMultipartParts", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.MultipartPart)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMultipartParts indicates an expected call of GetMultipartParts.
+func (mr *MockDBStoreMockRecorder) GetMultipartParts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMultipartParts", reflect.TypeOf((*MockDBStore)(nil).GetMultipartParts), arg0, arg1)
+}
+
+// GetMultipartUpload mocks base method.
+func (m *MockDBStore) GetMultipartUpload(arg0 context.Context, arg1 string) (dbstore.MultipartUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMultipartUpload", arg0, arg1)
+	ret0, _ := ret[0].(dbstore.MultipartUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMultipartUpload indicates an expected call of GetMultipartUpload.
+func (mr *MockDBStoreMockRecorder) GetMultipartUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMultipartUpload", reflect.TypeOf((*MockDBStore)(nil).GetMultipartUpload), arg0, arg1)
+}
+
+// GetMultipartUploadsBefore mocks base method.
+func (m *MockDBStore) GetMultipartUploadsBefore(arg0 context.Context, arg1 time.Time) ([]dbstore.MultipartUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMultipartUploadsBefore", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.MultipartUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMultipartUploadsBefore indicates an expected call of GetMultipartUploadsBefore.
+func (mr *MockDBStoreMockRecorder) GetMultipartUploadsBefore(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMultipartUploadsBefore", reflect.TypeOf((*MockDBStore)(nil).GetMultipartUploadsBefore), arg0, arg1)
+}
+
+// GetTrashedFileVersions mocks base method.
+func (m *MockDBStore) GetTrashedFileVersions(arg0 context.Context, arg1 string) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrashedFileVersions", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrashedFileVersions indicates an expected call of GetTrashedFileVersions.
+func (mr *MockDBStoreMockRecorder) GetTrashedFileVersions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrashedFileVersions", reflect.TypeOf((*MockDBStore)(nil).GetTrashedFileVersions), arg0, arg1)
+}
+
+// GetTrashedFiles mocks base method.
+func (m *MockDBStore) GetTrashedFiles(arg0 context.Context) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrashedFiles", arg0)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrashedFiles indicates an expected call of GetTrashedFiles.
+func (mr *MockDBStoreMockRecorder) GetTrashedFiles(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrashedFiles", reflect.TypeOf((*MockDBStore)(nil).GetTrashedFiles), arg0)
+}
+
+// GetTrashedFilesBefore mocks base method.
+func (m *MockDBStore) GetTrashedFilesBefore(arg0 context.Context, arg1 time.Time) ([]dbstore.FileDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrashedFilesBefore", arg0, arg1)
+	ret0, _ := ret[0].([]dbstore.FileDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrashedFilesBefore indicates an expected call of GetTrashedFilesBefore.
+func (mr *MockDBStoreMockRecorder) GetTrashedFilesBefore(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrashedFilesBefore", reflect.TypeOf((*MockDBStore)(nil).GetTrashedFilesBefore), arg0, arg1)
+}
+
+// GetUpload mocks base method.
+func (m *MockDBStore) GetUpload(arg0 context.Context, arg1 string) (dbstore.Upload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUpload", arg0, arg1)
+	ret0, _ := ret[0].(dbstore.Upload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUpload indicates an expected call of GetUpload.
+func (mr *MockDBStoreMockRecorder) GetUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpload", reflect.TypeOf((*MockDBStore)(nil).GetUpload), arg0, arg1)
+}
+
+// GetUsage mocks base method.
+func (m *MockDBStore) GetUsage(arg0 context.Context, arg1 string) (dbstore.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsage", arg0, arg1)
+	ret0, _ := ret[0].(dbstore.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsage indicates an expected call of GetUsage.
+func (mr *MockDBStoreMockRecorder) GetUsage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsage", reflect.TypeOf((*MockDBStore)(nil).GetUsage), arg0, arg1)
+}
+
+// InsertMultipartUpload mocks base method.
+func (m *MockDBStore) InsertMultipartUpload(arg0 context.Context, arg1 dbstore.MultipartUpload) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertMultipartUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertMultipartUpload indicates an expected call of InsertMultipartUpload.
+func (mr *MockDBStoreMockRecorder) InsertMultipartUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertMultipartUpload", reflect.TypeOf((*MockDBStore)(nil).InsertMultipartUpload), arg0, arg1)
+}
+
 // InsertNewFile mocks base method.
-func (m *MockDBStore) InsertNewFile(arg0 context.Context, arg1 dbstore.FileDetail) error {
+func (m *MockDBStore) InsertNewFile(arg0 context.Context, arg1 dbstore.FileDetail, arg2 dbstore.BlobFunc) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InsertNewFile", arg0, arg1)
+	ret := m.ctrl.Call(m, "InsertNewFile", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // InsertNewFile indicates an expected call of InsertNewFile.
-func (mr *MockDBStoreMockRecorder) InsertNewFile(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDBStoreMockRecorder) InsertNewFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertNewFile", reflect.TypeOf((*MockDBStore)(nil).InsertNewFile), arg0, arg1, arg2)
+}
+
+// InsertUpload mocks base method.
+func (m *MockDBStore) InsertUpload(arg0 context.Context, arg1 dbstore.Upload) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertUpload", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertUpload indicates an expected call of InsertUpload.
+func (mr *MockDBStoreMockRecorder) InsertUpload(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUpload", reflect.TypeOf((*MockDBStore)(nil).InsertUpload), arg0, arg1)
+}
+
+// PutMultipartPart mocks base method.
+func (m *MockDBStore) PutMultipartPart(arg0 context.Context, arg1 dbstore.MultipartPart) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutMultipartPart", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutMultipartPart indicates an expected call of PutMultipartPart.
+func (mr *MockDBStoreMockRecorder) PutMultipartPart(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutMultipartPart", reflect.TypeOf((*MockDBStore)(nil).PutMultipartPart), arg0, arg1)
+}
+
+// RestoreFile mocks base method.
+func (m *MockDBStore) RestoreFile(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreFile", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreFile indicates an expected call of RestoreFile.
+func (mr *MockDBStoreMockRecorder) RestoreFile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreFile", reflect.TypeOf((*MockDBStore)(nil).RestoreFile), arg0, arg1)
+}
+
+// SetFileBroken mocks base method.
+func (m *MockDBStore) SetFileBroken(arg0 context.Context, arg1 string, arg2 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFileBroken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFileBroken indicates an expected call of SetFileBroken.
+func (mr *MockDBStoreMockRecorder) SetFileBroken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFileBroken", reflect.TypeOf((*MockDBStore)(nil).SetFileBroken), arg0, arg1, arg2)
+}
+
+// SetFileExpiry mocks base method.
+func (m *MockDBStore) SetFileExpiry(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFileExpiry", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFileExpiry indicates an expected call of SetFileExpiry.
+func (mr *MockDBStoreMockRecorder) SetFileExpiry(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFileExpiry", reflect.TypeOf((*MockDBStore)(nil).SetFileExpiry), arg0, arg1, arg2)
+}
+
+// SetFileStatus mocks base method.
+func (m *MockDBStore) SetFileStatus(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFileStatus", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFileStatus indicates an expected call of SetFileStatus.
+func (mr *MockDBStoreMockRecorder) SetFileStatus(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFileStatus", reflect.TypeOf((*MockDBStore)(nil).SetFileStatus), arg0, arg1, arg2, arg3)
+}
+
+// SetQuota mocks base method.
+func (m *MockDBStore) SetQuota(arg0 context.Context, arg1 string, arg2 dbstore.Quota) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetQuota", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuota indicates an expected call of SetQuota.
+func (mr *MockDBStoreMockRecorder) SetQuota(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuota", reflect.TypeOf((*MockDBStore)(nil).SetQuota), arg0, arg1, arg2)
+}
+
+// SetUploadOffset mocks base method.
+func (m *MockDBStore) SetUploadOffset(arg0 context.Context, arg1 string, arg2, arg3 int64, arg4 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUploadOffset", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUploadOffset indicates an expected call of SetUploadOffset.
+func (mr *MockDBStoreMockRecorder) SetUploadOffset(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUploadOffset", reflect.TypeOf((*MockDBStore)(nil).SetUploadOffset), arg0, arg1, arg2, arg3, arg4)
+}
+
+// TouchFile mocks base method.
+func (m *MockDBStore) TouchFile(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchFile", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchFile indicates an expected call of TouchFile.
+func (mr *MockDBStoreMockRecorder) TouchFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchFile", reflect.TypeOf((*MockDBStore)(nil).TouchFile), arg0, arg1, arg2)
+}
+
+// TrashFile mocks base method.
+func (m *MockDBStore) TrashFile(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrashFile", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrashFile indicates an expected call of TrashFile.
+func (mr *MockDBStoreMockRecorder) TrashFile(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrashFile", reflect.TypeOf((*MockDBStore)(nil).TrashFile), arg0, arg1, arg2)
+}
+
+// TryLock mocks base method.
+func (m *MockDBStore) TryLock(arg0 context.Context, arg1 string) (func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TryLock", arg0, arg1)
+	ret0, _ := ret[0].(func())
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TryLock indicates an expected call of TryLock.
+func (mr *MockDBStoreMockRecorder) TryLock(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryLock", reflect.TypeOf((*MockDBStore)(nil).TryLock), arg0, arg1)
+}
+
+// UpdateFilePath mocks base method.
+func (m *MockDBStore) UpdateFilePath(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateFilePath", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateFilePath indicates an expected call of UpdateFilePath.
+func (mr *MockDBStoreMockRecorder) UpdateFilePath(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertNewFile", reflect.TypeOf((*MockDBStore)(nil).InsertNewFile), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFilePath", reflect.TypeOf((*MockDBStore)(nil).UpdateFilePath), arg0, arg1, arg2)
 }
@@ -3,6 +3,7 @@ package pgstore
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"time"
 
@@ -24,23 +25,50 @@ func NewPostgresStore(dbConn *sqlx.DB) dbstore.DBStore {
 
 // fileDetail is the internal db structure for dbstore.FileDetail
 type fileDetail struct {
-	ID        string    `db:"id,omitempty"`
-	Size      int64     `db:"size,omitempty"`
-	Path      string    `db:"path,omitempty"`
-	CreatedAt time.Time `db:"created_at"`
+	ID        string       `db:"id,omitempty"`
+	FileID    string       `db:"file_id"`
+	Version   int          `db:"version"`
+	Name      string       `db:"name"`
+	Size      int64        `db:"size,omitempty"`
+	Path      string       `db:"path,omitempty"`
+	Digest    string       `db:"digest,omitempty"`
+	Owner     string       `db:"owner"`
+	Status    string       `db:"status"`
+	CreatedAt time.Time    `db:"created_at"`
+	Broken    bool         `db:"broken"`
+	TrashedAt sql.NullTime `db:"trashed_at"`
+	ExpiresAt sql.NullTime `db:"expires_at"`
+	// StatusChangedAt is only selected by GetFilesByStatus, it is set by the DB whenever the status changes
+	StatusChangedAt sql.NullTime `db:"status_changed_at"`
 }
 
-// InsertNewFile inserts new record to DB with specified detail
-func (ps *postgresStore) InsertNewFile(ctx context.Context, file dbstore.FileDetail) error {
+// InsertNewFile inserts new record to DB with specified detail and increments the reference count of its blob.
+// The file is accounted to the usage of its owner, ErrorQuotaExceeded is returned when it does not fit the quota.
+// A record with FileID but without Version gets the next version of that file, blobFunc is called with the assigned version.
+func (ps *postgresStore) InsertNewFile(ctx context.Context, file dbstore.FileDetail, blobFunc dbstore.BlobFunc) error {
 	query := `
 		INSERT INTO files (
 			id,
+		   	file_id,
+		   	version,
+		   	name,
 		   	size,
-		   	path%s
+		   	path,
+		   	digest,
+		   	owner,
+		   	status,
+		   	expires_at%s
 		) VALUES (
 			:id,
+			:file_id,
+			:version,
+			:name,
 			:size,
-			:path%s
+			:path,
+			NULLIF(:digest, ''),
+			:owner,
+			:status,
+			:expires_at%s
 		)`
 
 	if !file.CreatedAt.IsZero() {
@@ -49,25 +77,78 @@ func (ps *postgresStore) InsertNewFile(ctx context.Context, file dbstore.FileDet
 		query = fmt.Sprintf(query, "", "")
 	}
 
+	if file.FileID == "" {
+		file.FileID = file.ID
+		file.Version = 1
+	}
+
+	tx, err := ps.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if file.Version == 0 {
+		file.Version, err = nextVersion(ctx, tx, file.FileID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var refCount int64
+	if file.Digest != "" {
+		refCount, err = referenceBlob(ctx, tx, file.Digest, file.Size)
+		if err != nil {
+			return err
+		}
+	}
+
 	internalFile := mapFileDetail(file)
-	_, err := ps.dbConn.NamedExecContext(ctx, query, &internalFile)
+	_, err = tx.NamedExecContext(ctx, query, &internalFile)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if err := consumeQuota(ctx, tx, file.Owner, file.Size); err != nil {
+		return err
+	}
+
+	if blobFunc != nil {
+		if err := blobFunc(ctx, file, refCount); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// DeleteFileByID remove file record from DB with specified id
-func (ps *postgresStore) DeleteFileByID(ctx context.Context, id string) (dbstore.FileDetail, error) {
+// DeleteFileByID remove file record from DB with specified id and decrements the reference count of its blob,
+// the blob record is removed once it is no longer referenced and the file is no longer accounted to its owner
+func (ps *postgresStore) DeleteFileByID(ctx context.Context, id string, blobFunc dbstore.BlobFunc) (dbstore.FileDetail, error) {
 	query := `
 		DELETE FROM 
 		    files
 		WHERE
 			id = $1
-		RETURNING *`
+		RETURNING
+			id,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			created_at`
+
+	tx, err := ps.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return dbstore.FileDetail{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
 	var files []fileDetail
-	err := ps.dbConn.SelectContext(ctx, &files, query, id)
+	err = tx.SelectContext(ctx, &files, query, id)
 	if err != nil {
 		return dbstore.FileDetail{}, err
 	}
@@ -76,46 +157,1229 @@ func (ps *postgresStore) DeleteFileByID(ctx context.Context, id string) (dbstore
 		return dbstore.FileDetail{}, sql.ErrNoRows
 	}
 
-	return reverseMapFileDetail(files[0]), nil
+	var refCount int64
+	if files[0].Digest != "" {
+		refCount, err = releaseBlob(ctx, tx, files[0].Digest)
+		if err != nil {
+			return dbstore.FileDetail{}, err
+		}
+	}
+
+	if err := releaseQuota(ctx, tx, files[0].Owner, files[0].Size); err != nil {
+		return dbstore.FileDetail{}, err
+	}
+
+	deletedFile := reverseMapFileDetail(files[0])
+	if blobFunc != nil {
+		if err := blobFunc(ctx, deletedFile, refCount); err != nil {
+			return dbstore.FileDetail{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return dbstore.FileDetail{}, err
+	}
+
+	return deletedFile, nil
 }
 
-// GetAllFiles returns a list of files in the DB
-func (ps *postgresStore) GetAllFiles(ctx context.Context) ([]dbstore.FileDetail, error) {
+// UpdateFilePath updates the blob storage path of the file with specified id
+func (ps *postgresStore) UpdateFilePath(ctx context.Context, id, path string) error {
+	query := `
+		UPDATE
+			files
+		SET
+			path = $2
+		WHERE
+			id = $1`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id, path)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetFileStatus moves the file with specified id from status to another status,
+// sql.ErrNoRows is returned when the file does not exist or is not in the from status
+func (ps *postgresStore) SetFileStatus(ctx context.Context, id, from, to string) error {
+	query := `
+		UPDATE
+			files
+		SET
+			status = $3,
+			status_changed_at = NOW()
+		WHERE
+			id = $1
+			AND status = $2`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id, from, to)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetFilesByStatus returns the files in specified status, with the time they entered it
+func (ps *postgresStore) GetFilesByStatus(ctx context.Context, status string) ([]dbstore.FileDetail, error) {
 	query := `
 		SELECT
 			id,
 			size,
 			path,
-			created_at
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			status_changed_at
+		FROM
+			files
+		WHERE
+			status = $1`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, status)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// TrashFile moves the active versions of the file with specified id to the trash,
+// sql.ErrNoRows is returned when the file has no active version
+func (ps *postgresStore) TrashFile(ctx context.Context, fileID string, trashedAt time.Time) error {
+	query := `
+		UPDATE
+			files
+		SET
+			status = 'trashed',
+			status_changed_at = NOW(),
+			trashed_at = $2
+		WHERE
+			file_id = $1
+			AND status = 'active'`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, fileID, trashedAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RestoreFile moves the trashed versions of the file with specified id back to active, the versions which expired are not restored
+// as they are due to be deleted permanently. sql.ErrNoRows is returned when the file has no trashed version left to restore
+func (ps *postgresStore) RestoreFile(ctx context.Context, fileID string) error {
+	query := `
+		UPDATE
+			files
+		SET
+			status = 'active',
+			status_changed_at = NOW(),
+			trashed_at = NULL
+		WHERE
+			file_id = $1
+			AND status = 'trashed'
+			AND (expires_at IS NULL OR expires_at > NOW())`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, fileID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetTrashedFiles returns every trashed version of the files, the earliest trashed first
+func (ps *postgresStore) GetTrashedFiles(ctx context.Context) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			trashed_at
 		FROM
-			files`
+			files
+		WHERE
+			status = 'trashed'
+		ORDER BY
+			trashed_at,
+			file_id,
+			version`
 
 	var files []fileDetail
 	err := ps.dbConn.SelectContext(ctx, &files, query)
 	if err != nil {
 		return []dbstore.FileDetail{}, err
 	}
-	var result []dbstore.FileDetail
+	result := make([]dbstore.FileDetail, 0, len(files))
 	for _, file := range files {
 		result = append(result, reverseMapFileDetail(file))
 	}
 	return result, nil
 }
 
-func mapFileDetail(file dbstore.FileDetail) fileDetail {
-	return fileDetail{
-		ID:        file.ID,
-		Size:      file.Size,
-		Path:      file.Path,
-		CreatedAt: file.CreatedAt,
+// GetTrashedFileVersions returns the trashed versions of the file with specified file id, the oldest version first
+func (ps *postgresStore) GetTrashedFileVersions(ctx context.Context, fileID string) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			trashed_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+			AND file_id = $1
+		ORDER BY
+			version`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, fileID)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
 	}
+	return result, nil
 }
 
-func reverseMapFileDetail(file fileDetail) dbstore.FileDetail {
-	return dbstore.FileDetail{
-		ID:        file.ID,
-		Size:      file.Size,
-		Path:      file.Path,
-		CreatedAt: file.CreatedAt,
+// GetTrashedFilesBefore returns the versions of the files trashed before the specified time, the earliest trashed first
+func (ps *postgresStore) GetTrashedFilesBefore(ctx context.Context, before time.Time) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			trashed_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+			AND trashed_at < $1
+		ORDER BY
+			trashed_at,
+			file_id,
+			version`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, before)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// SetFileExpiry sets the time after which the active versions of the file with specified id are deleted,
+// sql.ErrNoRows is returned when the file has no active version
+func (ps *postgresStore) SetFileExpiry(ctx context.Context, fileID string, expiresAt time.Time) error {
+	query := `
+		UPDATE
+			files
+		SET
+			expires_at = $2
+		WHERE
+			file_id = $1
+			AND status = 'active'`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, fileID, expiresAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetExpiredFiles returns the latest active version of the files which expired before, a file expires with its latest version
+func (ps *postgresStore) GetExpiredFiles(ctx context.Context, before time.Time) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			f.id,
+			f.file_id,
+			f.version,
+			f.name,
+			f.size,
+			f.path,
+			COALESCE(f.digest, '') AS digest,
+			f.created_at,
+			f.expires_at
+		FROM
+			files f
+		WHERE
+			f.status = 'active'
+			AND f.expires_at < $1
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					files g
+				WHERE
+					g.file_id = f.file_id
+					AND g.status = 'active'
+					AND g.version > f.version
+			)
+		ORDER BY
+			f.expires_at`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, before)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// GetExpiredTrashedFiles returns the trashed versions of the files which expired before, the earliest expired first
+func (ps *postgresStore) GetExpiredTrashedFiles(ctx context.Context, before time.Time) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			trashed_at,
+			expires_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+			AND expires_at < $1
+		ORDER BY
+			expires_at`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, before)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// SetFileBroken marks or unmarks the file with specified id as having a missing or damaged content
+func (ps *postgresStore) SetFileBroken(ctx context.Context, id string, broken bool) error {
+	query := `
+		UPDATE
+			files
+		SET
+			broken = $2
+		WHERE
+			id = $1`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id, broken)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchFile records the last access time of the file with specified id
+func (ps *postgresStore) TouchFile(ctx context.Context, id string, accessedAt time.Time) error {
+	query := `
+		UPDATE
+			files
+		SET
+			last_accessed_at = $2
+		WHERE
+			id = $1`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id, accessedAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetColdFiles returns the files not accessed since before, files never accessed count from their creation.
+// A file sharing its blob with a file accessed since then is not returned, since the blob is still in use.
+func (ps *postgresStore) GetColdFiles(ctx context.Context, before time.Time) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			f.id,
+			f.size,
+			f.path,
+			COALESCE(f.digest, '') AS digest,
+			f.created_at
+		FROM
+			files f
+		WHERE
+			COALESCE(f.last_accessed_at, f.created_at) < $1
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					files g
+				WHERE
+					g.digest = f.digest
+					AND COALESCE(g.last_accessed_at, g.created_at) >= $1
+			)`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, before)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// DeleteUnreferencedBlob calls blobFunc while the record of the blob with specified key is locked, when no file references the blob.
+// Uploads referencing the blob meanwhile wait for the lock, false is returned without calling blobFunc when the blob is referenced.
+func (ps *postgresStore) DeleteUnreferencedBlob(ctx context.Context, key string, blobFunc dbstore.BlobFunc) (bool, error) {
+	// the record is created when missing, so it can be locked until the transaction ends
+	lockQuery := `
+		INSERT INTO blobs (
+			digest,
+			size,
+			ref_count
+		) VALUES (
+			$1,
+			0,
+			0
+		)
+		ON CONFLICT (digest) DO UPDATE SET
+			ref_count = blobs.ref_count
+		RETURNING
+			ref_count`
+
+	// files stored before content addressing reference their blob by their id
+	legacyQuery := `
+		SELECT
+			COUNT(*)
+		FROM
+			files
+		WHERE
+			id = $1
+			AND digest IS NULL`
+
+	deleteQuery := `
+		DELETE FROM
+			blobs
+		WHERE
+			digest = $1`
+
+	tx, err := ps.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var refCount int64
+	if err := tx.GetContext(ctx, &refCount, lockQuery, key); err != nil {
+		return false, err
+	}
+	if refCount > 0 {
+		return false, nil
+	}
+	var legacyCount int64
+	if err := tx.GetContext(ctx, &legacyCount, legacyQuery, key); err != nil {
+		return false, err
+	}
+	if legacyCount > 0 {
+		return false, nil
+	}
+
+	if err := blobFunc(ctx, dbstore.FileDetail{Digest: key}, 0); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, deleteQuery, key); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// nextVersion returns the next version of the file, concurrent transactions adding a version of the same file
+// wait for each other until the transaction ends so each of them gets its own version
+func nextVersion(ctx context.Context, tx *sqlx.Tx, fileID string) (int, error) {
+	lockQuery := `
+		SELECT
+			pg_advisory_xact_lock(hashtext($1))`
+
+	versionQuery := `
+		SELECT
+			COALESCE(MAX(version), 0) + 1
+		FROM
+			files
+		WHERE
+			file_id = $1`
+
+	if _, err := tx.ExecContext(ctx, lockQuery, fileID); err != nil {
+		return 0, err
+	}
+	var version int
+	err := tx.GetContext(ctx, &version, versionQuery, fileID)
+	return version, err
+}
+
+// referenceBlob registers a new reference to the blob and returns its reference count
+func referenceBlob(ctx context.Context, tx *sqlx.Tx, digest string, size int64) (int64, error) {
+	query := `
+		INSERT INTO blobs (
+			digest,
+			size,
+			ref_count
+		) VALUES (
+			$1,
+			$2,
+			1
+		)
+		ON CONFLICT (digest) DO UPDATE SET
+			ref_count = blobs.ref_count + 1
+		RETURNING
+			ref_count`
+
+	var refCount int64
+	err := tx.GetContext(ctx, &refCount, query, digest, size)
+	return refCount, err
+}
+
+// releaseBlob removes a reference to the blob and returns the remaining reference count,
+// the blob record is deleted when no reference remains
+func releaseBlob(ctx context.Context, tx *sqlx.Tx, digest string) (int64, error) {
+	query := `
+		UPDATE
+			blobs
+		SET
+			ref_count = ref_count - 1
+		WHERE
+			digest = $1
+		RETURNING
+			ref_count`
+
+	var refCount int64
+	err := tx.GetContext(ctx, &refCount, query, digest)
+	if err != nil {
+		return 0, err
+	}
+
+	if refCount <= 0 {
+		query = `
+			DELETE FROM
+				blobs
+			WHERE
+				digest = $1`
+		_, err = tx.ExecContext(ctx, query, digest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return refCount, nil
+}
+
+// consumeQuota accounts the file size to the usage of the owner and of the whole storage within the transaction,
+// the usage records stay locked until the transaction ends so concurrent uploads cannot exceed the quota together
+func consumeQuota(ctx context.Context, tx *sqlx.Tx, owner string, size int64) error {
+	query := `
+		WITH usage AS (
+			INSERT INTO usages (
+				owner,
+				used_bytes,
+				used_files
+			) VALUES
+				($1, $3, 1),
+				($2, $3, 1)
+			ON CONFLICT (owner) DO UPDATE SET
+				used_bytes = usages.used_bytes + EXCLUDED.used_bytes,
+				used_files = usages.used_files + 1
+			RETURNING
+				owner,
+				used_bytes,
+				used_files
+		)
+		SELECT
+			COUNT(*)
+		FROM
+			usage u
+			JOIN quotas q ON q.owner = u.owner
+		WHERE
+			(q.max_bytes > 0 AND u.used_bytes > q.max_bytes)
+			OR (q.max_files > 0 AND u.used_files > q.max_files)`
+
+	var exceeded int64
+	err := tx.GetContext(ctx, &exceeded, query, owner, dbstore.GlobalOwner, size)
+	if err != nil {
+		return err
+	}
+	if exceeded > 0 {
+		return dbstore.ErrorQuotaExceeded
+	}
+	return nil
+}
+
+// releaseQuota removes the file size from the usage of the owner and of the whole storage
+func releaseQuota(ctx context.Context, tx *sqlx.Tx, owner string, size int64) error {
+	query := `
+		UPDATE
+			usages
+		SET
+			used_bytes = used_bytes - $3,
+			used_files = used_files - 1
+		WHERE
+			owner IN ($1, $2)`
+
+	_, err := tx.ExecContext(ctx, query, owner, dbstore.GlobalOwner, size)
+	return err
+}
+
+// GetUsage returns the storage consumed by the owner and its quota, use dbstore.GlobalOwner for the whole storage
+func (ps *postgresStore) GetUsage(ctx context.Context, owner string) (dbstore.Usage, error) {
+	query := `
+		SELECT
+			COALESCE(u.used_bytes, 0) AS used_bytes,
+			COALESCE(u.used_files, 0) AS used_files,
+			COALESCE(q.max_bytes, 0) AS max_bytes,
+			COALESCE(q.max_files, 0) AS max_files
+		FROM
+			(SELECT $1::VARCHAR AS owner) o
+			LEFT JOIN usages u ON u.owner = o.owner
+			LEFT JOIN quotas q ON q.owner = o.owner`
+
+	var usage struct {
+		UsedBytes int64 `db:"used_bytes"`
+		UsedFiles int64 `db:"used_files"`
+		MaxBytes  int64 `db:"max_bytes"`
+		MaxFiles  int64 `db:"max_files"`
+	}
+	err := ps.dbConn.GetContext(ctx, &usage, query, owner)
+	if err != nil {
+		return dbstore.Usage{}, err
+	}
+	return dbstore.Usage{
+		UsedBytes: usage.UsedBytes,
+		UsedFiles: usage.UsedFiles,
+		Quota: dbstore.Quota{
+			MaxBytes: usage.MaxBytes,
+			MaxFiles: usage.MaxFiles,
+		},
+	}, nil
+}
+
+// SetQuota creates or replaces the quota of the owner, use dbstore.GlobalOwner for the whole storage
+func (ps *postgresStore) SetQuota(ctx context.Context, owner string, quota dbstore.Quota) error {
+	query := `
+		INSERT INTO quotas (
+			owner,
+			max_bytes,
+			max_files
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)
+		ON CONFLICT (owner) DO UPDATE SET
+			max_bytes = EXCLUDED.max_bytes,
+			max_files = EXCLUDED.max_files`
+
+	_, err := ps.dbConn.ExecContext(ctx, query, owner, quota.MaxBytes, quota.MaxFiles)
+	return err
+}
+
+// GetFileByID returns the latest active version of the file with specified id
+func (ps *postgresStore) GetFileByID(ctx context.Context, id string) (dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			expires_at
+		FROM
+			files
+		WHERE
+			file_id = $1
+			AND status = 'active'
+		ORDER BY
+			version DESC
+		LIMIT 1`
+
+	var file fileDetail
+	err := ps.dbConn.GetContext(ctx, &file, query, id)
+	if err != nil {
+		return dbstore.FileDetail{}, err
+	}
+	return reverseMapFileDetail(file), nil
+}
+
+// GetFileByName returns the latest active version of the file with specified name,
+// the most recently uploaded one when several files have the same name
+func (ps *postgresStore) GetFileByName(ctx context.Context, name string) (dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at
+		FROM
+			files
+		WHERE
+			name = $1
+			AND status = 'active'
+		ORDER BY
+			created_at DESC,
+			version DESC
+		LIMIT 1`
+
+	var file fileDetail
+	err := ps.dbConn.GetContext(ctx, &file, query, name)
+	if err != nil {
+		return dbstore.FileDetail{}, err
+	}
+	return reverseMapFileDetail(file), nil
+}
+
+// GetFileVersions returns the active versions of the file with specified id, oldest first
+func (ps *postgresStore) GetFileVersions(ctx context.Context, fileID string) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			broken,
+			expires_at
+		FROM
+			files
+		WHERE
+			file_id = $1
+			AND status = 'active'
+		ORDER BY
+			version`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query, fileID)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	result := make([]dbstore.FileDetail, 0, len(files))
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// GetFileVersion returns the specified active version of the file with specified id
+func (ps *postgresStore) GetFileVersion(ctx context.Context, fileID string, version int) (dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			expires_at
+		FROM
+			files
+		WHERE
+			file_id = $1
+			AND version = $2
+			AND status = 'active'`
+
+	var file fileDetail
+	err := ps.dbConn.GetContext(ctx, &file, query, fileID, version)
+	if err != nil {
+		return dbstore.FileDetail{}, err
+	}
+	return reverseMapFileDetail(file), nil
+}
+
+// GetAllFiles returns a list of active files in the DB, every version of a file is listed
+func (ps *postgresStore) GetAllFiles(ctx context.Context) ([]dbstore.FileDetail, error) {
+	query := `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			broken,
+			expires_at
+		FROM
+			files
+		WHERE
+			status = 'active'`
+
+	var files []fileDetail
+	err := ps.dbConn.SelectContext(ctx, &files, query)
+	if err != nil {
+		return []dbstore.FileDetail{}, err
+	}
+	var result []dbstore.FileDetail
+	for _, file := range files {
+		result = append(result, reverseMapFileDetail(file))
+	}
+	return result, nil
+}
+
+// upload is the internal db structure for dbstore.Upload
+type upload struct {
+	ID        string    `db:"id"`
+	Name      string    `db:"name"`
+	Owner     string    `db:"owner"`
+	Length    int64     `db:"upload_length"`
+	Offset    int64     `db:"upload_offset"`
+	Metadata  string    `db:"metadata"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// InsertUpload inserts new resumable upload with specified detail
+func (ps *postgresStore) InsertUpload(ctx context.Context, upload dbstore.Upload) error {
+	query := `
+		INSERT INTO uploads (
+			id,
+			name,
+			owner,
+			upload_length,
+			upload_offset,
+			metadata,
+			expires_at
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7
+		)`
+
+	_, err := ps.dbConn.ExecContext(ctx, query, upload.ID, upload.Name, upload.Owner, upload.Length, upload.Offset, upload.Metadata, upload.ExpiresAt)
+	return err
+}
+
+// GetUpload returns the resumable upload with specified id
+func (ps *postgresStore) GetUpload(ctx context.Context, id string) (dbstore.Upload, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			owner,
+			upload_length,
+			upload_offset,
+			metadata,
+			created_at,
+			expires_at
+		FROM
+			uploads
+		WHERE
+			id = $1`
+
+	var result upload
+	err := ps.dbConn.GetContext(ctx, &result, query, id)
+	if err != nil {
+		return dbstore.Upload{}, err
+	}
+	return dbstore.Upload(result), nil
+}
+
+// SetUploadOffset moves the offset of the resumable upload with specified id from one value to another and sets its new expiry,
+// sql.ErrNoRows is returned when the upload is not found or its offset is not from
+func (ps *postgresStore) SetUploadOffset(ctx context.Context, id string, from, to int64, expiresAt time.Time) error {
+	query := `
+		UPDATE
+			uploads
+		SET
+			upload_offset = $3,
+			expires_at = $4
+		WHERE
+			id = $1
+			AND upload_offset = $2`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id, from, to, expiresAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUpload deletes the resumable upload with specified id, sql.ErrNoRows is returned when the upload is not found
+func (ps *postgresStore) DeleteUpload(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM
+			uploads
+		WHERE
+			id = $1`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetExpiredUploads returns the resumable uploads which expired before the specified time, the earliest expired first
+func (ps *postgresStore) GetExpiredUploads(ctx context.Context, before time.Time) ([]dbstore.Upload, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			owner,
+			upload_length,
+			upload_offset,
+			metadata,
+			created_at,
+			expires_at
+		FROM
+			uploads
+		WHERE
+			expires_at < $1
+		ORDER BY
+			expires_at`
+
+	var uploads []upload
+	err := ps.dbConn.SelectContext(ctx, &uploads, query, before)
+	if err != nil {
+		return []dbstore.Upload{}, err
+	}
+	result := make([]dbstore.Upload, 0, len(uploads))
+	for _, upload := range uploads {
+		result = append(result, dbstore.Upload(upload))
+	}
+	return result, nil
+}
+
+// TryLock takes the advisory lock of the key, so the instances sharing the DB exclude each other until the returned func is called.
+// The lock is held by a connection of its own, ErrorLocked is returned right away when another session holds it.
+func (ps *postgresStore) TryLock(ctx context.Context, key string) (func(), error) {
+	conn, err := ps.dbConn.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	err = conn.QueryRowxContext(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`, key).Scan(&locked)
+	if err != nil || !locked {
+		_ = conn.Close()
+		if err != nil {
+			return nil, err
+		}
+		return nil, dbstore.ErrorLocked
+	}
+	return func() {
+		// the lock is released with the session when unlocking fails, so the connection is dropped rather than reused
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtextextended($1, 0))`, key)
+		if err != nil {
+			_ = conn.Raw(func(interface{}) error {
+				return driver.ErrBadConn
+			})
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// multipartUpload is the internal db structure for dbstore.MultipartUpload
+type multipartUpload struct {
+	ID        string    `db:"id"`
+	Name      string    `db:"name"`
+	Owner     string    `db:"owner"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// multipartPart is the internal db structure for dbstore.MultipartPart
+type multipartPart struct {
+	UploadID   string    `db:"upload_id"`
+	PartNumber int       `db:"part_number"`
+	Size       int64     `db:"size"`
+	Checksum   string    `db:"checksum"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// InsertMultipartUpload inserts new multipart upload with specified detail
+func (ps *postgresStore) InsertMultipartUpload(ctx context.Context, upload dbstore.MultipartUpload) error {
+	query := `
+		INSERT INTO multipart_uploads (
+			id,
+			name,
+			owner
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)`
+
+	_, err := ps.dbConn.ExecContext(ctx, query, upload.ID, upload.Name, upload.Owner)
+	return err
+}
+
+// GetMultipartUpload returns the multipart upload with specified id
+func (ps *postgresStore) GetMultipartUpload(ctx context.Context, id string) (dbstore.MultipartUpload, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			owner,
+			created_at
+		FROM
+			multipart_uploads
+		WHERE
+			id = $1`
+
+	var upload multipartUpload
+	err := ps.dbConn.GetContext(ctx, &upload, query, id)
+	if err != nil {
+		return dbstore.MultipartUpload{}, err
+	}
+	return dbstore.MultipartUpload(upload), nil
+}
+
+// GetMultipartUploadsBefore returns the multipart uploads created before the specified time, the oldest first
+func (ps *postgresStore) GetMultipartUploadsBefore(ctx context.Context, before time.Time) ([]dbstore.MultipartUpload, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			owner,
+			created_at
+		FROM
+			multipart_uploads
+		WHERE
+			created_at < $1
+		ORDER BY
+			created_at`
+
+	var uploads []multipartUpload
+	err := ps.dbConn.SelectContext(ctx, &uploads, query, before)
+	if err != nil {
+		return []dbstore.MultipartUpload{}, err
+	}
+	result := make([]dbstore.MultipartUpload, 0, len(uploads))
+	for _, upload := range uploads {
+		result = append(result, dbstore.MultipartUpload(upload))
+	}
+	return result, nil
+}
+
+// DeleteMultipartUpload deletes the multipart upload with specified id together with its parts,
+// sql.ErrNoRows is returned when the upload is not found
+func (ps *postgresStore) DeleteMultipartUpload(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM
+			multipart_uploads
+		WHERE
+			id = $1`
+
+	result, err := ps.dbConn.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PutMultipartPart inserts the part of a multipart upload, a part uploaded again with the same number replaces the previous one
+func (ps *postgresStore) PutMultipartPart(ctx context.Context, part dbstore.MultipartPart) error {
+	query := `
+		INSERT INTO multipart_parts (
+			upload_id,
+			part_number,
+			size,
+			checksum
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+		ON CONFLICT (upload_id, part_number) DO UPDATE SET
+			size = EXCLUDED.size,
+			checksum = EXCLUDED.checksum,
+			created_at = CURRENT_TIMESTAMP`
+
+	_, err := ps.dbConn.ExecContext(ctx, query, part.UploadID, part.PartNumber, part.Size, part.Checksum)
+	return err
+}
+
+// GetMultipartParts returns the parts of the multipart upload, ordered by part number
+func (ps *postgresStore) GetMultipartParts(ctx context.Context, uploadID string) ([]dbstore.MultipartPart, error) {
+	query := `
+		SELECT
+			upload_id,
+			part_number,
+			size,
+			checksum,
+			created_at
+		FROM
+			multipart_parts
+		WHERE
+			upload_id = $1
+		ORDER BY
+			part_number`
+
+	var parts []multipartPart
+	err := ps.dbConn.SelectContext(ctx, &parts, query, uploadID)
+	if err != nil {
+		return []dbstore.MultipartPart{}, err
+	}
+	result := make([]dbstore.MultipartPart, 0, len(parts))
+	for _, part := range parts {
+		result = append(result, dbstore.MultipartPart(part))
+	}
+	return result, nil
+}
+
+func mapFileDetail(file dbstore.FileDetail) fileDetail {
+	return fileDetail{
+		ID:        file.ID,
+		FileID:    file.FileID,
+		Version:   file.Version,
+		Name:      file.Name,
+		Size:      file.Size,
+		Path:      file.Path,
+		Digest:    file.Digest,
+		Owner:     file.Owner,
+		Status:    file.Status,
+		CreatedAt: file.CreatedAt,
+		Broken:    file.Broken,
+		TrashedAt: sql.NullTime{Time: file.TrashedAt, Valid: !file.TrashedAt.IsZero()},
+		ExpiresAt: sql.NullTime{Time: file.ExpiresAt, Valid: !file.ExpiresAt.IsZero()},
+	}
+}
+
+func reverseMapFileDetail(file fileDetail) dbstore.FileDetail {
+	return dbstore.FileDetail{
+		ID:              file.ID,
+		FileID:          file.FileID,
+		Version:         file.Version,
+		Name:            file.Name,
+		Size:            file.Size,
+		Path:            file.Path,
+		Digest:          file.Digest,
+		Owner:           file.Owner,
+		Status:          file.Status,
+		CreatedAt:       file.CreatedAt,
+		Broken:          file.Broken,
+		TrashedAt:       file.TrashedAt.Time,
+		ExpiresAt:       file.ExpiresAt.Time,
+		StatusChangedAt: file.StatusChangedAt.Time,
 	}
 }
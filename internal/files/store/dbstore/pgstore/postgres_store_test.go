@@ -17,29 +17,628 @@ const (
 	queryInsertNewFile = `
 		INSERT INTO files (
 			id,
+		   	file_id,
+		   	version,
+		   	name,
 		   	size,
-		   	path%s
+		   	path,
+		   	digest,
+		   	owner,
+		   	status,
+		   	expires_at%s
 		) VALUES (
 			$1,
 			$2,
-			$3%s
+			$3,
+			$4,
+			$5,
+			$6,
+			NULLIF($7, ''),
+			$8,
+			$9,
+			$10%s
 		)`
 
+	queryLockFileVersions = `
+		SELECT
+			pg_advisory_xact_lock(hashtext($1))`
+
+	queryNextVersion = `
+		SELECT
+			COALESCE(MAX(version), 0) + 1
+		FROM
+			files
+		WHERE
+			file_id = $1`
+
+	queryReferenceBlob = `
+		INSERT INTO blobs (
+			digest,
+			size,
+			ref_count
+		) VALUES (
+			$1,
+			$2,
+			1
+		)
+		ON CONFLICT (digest) DO UPDATE SET
+			ref_count = blobs.ref_count + 1
+		RETURNING
+			ref_count`
+
 	queryDeleteFileByID = `
 		DELETE FROM 
 		    files
 		WHERE
 			id = $1
-		RETURNING *`
+		RETURNING
+			id,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			created_at`
+
+	queryReleaseBlob = `
+		UPDATE
+			blobs
+		SET
+			ref_count = ref_count - 1
+		WHERE
+			digest = $1
+		RETURNING
+			ref_count`
+
+	queryDeleteBlob = `
+			DELETE FROM
+				blobs
+			WHERE
+				digest = $1`
+
+	queryLockBlob = `
+		INSERT INTO blobs (
+			digest,
+			size,
+			ref_count
+		) VALUES (
+			$1,
+			0,
+			0
+		)
+		ON CONFLICT (digest) DO UPDATE SET
+			ref_count = blobs.ref_count
+		RETURNING
+			ref_count`
+
+	queryCountLegacyFiles = `
+		SELECT
+			COUNT(*)
+		FROM
+			files
+		WHERE
+			id = $1
+			AND digest IS NULL`
+
+	queryDeleteUnreferencedBlob = `
+		DELETE FROM
+			blobs
+		WHERE
+			digest = $1`
+
+	queryConsumeQuota = `
+		WITH usage AS (
+			INSERT INTO usages (
+				owner,
+				used_bytes,
+				used_files
+			) VALUES
+				($1, $3, 1),
+				($2, $3, 1)
+			ON CONFLICT (owner) DO UPDATE SET
+				used_bytes = usages.used_bytes + EXCLUDED.used_bytes,
+				used_files = usages.used_files + 1
+			RETURNING
+				owner,
+				used_bytes,
+				used_files
+		)
+		SELECT
+			COUNT(*)
+		FROM
+			usage u
+			JOIN quotas q ON q.owner = u.owner
+		WHERE
+			(q.max_bytes > 0 AND u.used_bytes > q.max_bytes)
+			OR (q.max_files > 0 AND u.used_files > q.max_files)`
+
+	queryReleaseQuota = `
+		UPDATE
+			usages
+		SET
+			used_bytes = used_bytes - $3,
+			used_files = used_files - 1
+		WHERE
+			owner IN ($1, $2)`
+
+	queryGetUsage = `
+		SELECT
+			COALESCE(u.used_bytes, 0) AS used_bytes,
+			COALESCE(u.used_files, 0) AS used_files,
+			COALESCE(q.max_bytes, 0) AS max_bytes,
+			COALESCE(q.max_files, 0) AS max_files
+		FROM
+			(SELECT $1::VARCHAR AS owner) o
+			LEFT JOIN usages u ON u.owner = o.owner
+			LEFT JOIN quotas q ON q.owner = o.owner`
+
+	querySetQuota = `
+		INSERT INTO quotas (
+			owner,
+			max_bytes,
+			max_files
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)
+		ON CONFLICT (owner) DO UPDATE SET
+			max_bytes = EXCLUDED.max_bytes,
+			max_files = EXCLUDED.max_files`
+
+	queryGetFileByID = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			expires_at
+		FROM
+			files
+		WHERE
+			file_id = $1
+			AND status = 'active'
+		ORDER BY
+			version DESC
+		LIMIT 1`
+
+	queryGetFileByName = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at
+		FROM
+			files
+		WHERE
+			name = $1
+			AND status = 'active'
+		ORDER BY
+			created_at DESC,
+			version DESC
+		LIMIT 1`
+
+	queryGetFileVersions = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			broken,
+			expires_at
+		FROM
+			files
+		WHERE
+			file_id = $1
+			AND status = 'active'
+		ORDER BY
+			version`
+
+	queryGetFileVersion = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			expires_at
+		FROM
+			files
+		WHERE
+			file_id = $1
+			AND version = $2
+			AND status = 'active'`
+
+	queryUpdateFilePath = `
+		UPDATE
+			files
+		SET
+			path = $2
+		WHERE
+			id = $1`
 
 	queryGetAllFiles = `
 		SELECT
 			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			broken,
+			expires_at
+		FROM
+			files
+		WHERE
+			status = 'active'`
+
+	querySetFileStatus = `
+		UPDATE
+			files
+		SET
+			status = $3,
+			status_changed_at = NOW()
+		WHERE
+			id = $1
+			AND status = $2`
+
+	queryGetFilesByStatus = `
+		SELECT
+			id,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			status_changed_at
+		FROM
+			files
+		WHERE
+			status = $1`
+
+	queryTrashFile = `
+		UPDATE
+			files
+		SET
+			status = 'trashed',
+			status_changed_at = NOW(),
+			trashed_at = $2
+		WHERE
+			file_id = $1
+			AND status = 'active'`
+
+	queryRestoreFile = `
+		UPDATE
+			files
+		SET
+			status = 'active',
+			status_changed_at = NOW(),
+			trashed_at = NULL
+		WHERE
+			file_id = $1
+			AND status = 'trashed'
+			AND (expires_at IS NULL OR expires_at > NOW())`
+
+	queryGetTrashedFiles = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			trashed_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+		ORDER BY
+			trashed_at,
+			file_id,
+			version`
+
+	queryGetTrashedFileVersions = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			trashed_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+			AND file_id = $1
+		ORDER BY
+			version`
+
+	queryGetTrashedFilesBefore = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
+			size,
+			path,
+			COALESCE(digest, '') AS digest,
+			owner,
+			status,
+			created_at,
+			trashed_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+			AND trashed_at < $1
+		ORDER BY
+			trashed_at,
+			file_id,
+			version`
+
+	querySetFileExpiry = `
+		UPDATE
+			files
+		SET
+			expires_at = $2
+		WHERE
+			file_id = $1
+			AND status = 'active'`
+
+	queryGetExpiredFiles = `
+		SELECT
+			f.id,
+			f.file_id,
+			f.version,
+			f.name,
+			f.size,
+			f.path,
+			COALESCE(f.digest, '') AS digest,
+			f.created_at,
+			f.expires_at
+		FROM
+			files f
+		WHERE
+			f.status = 'active'
+			AND f.expires_at < $1
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					files g
+				WHERE
+					g.file_id = f.file_id
+					AND g.status = 'active'
+					AND g.version > f.version
+			)
+		ORDER BY
+			f.expires_at`
+
+	queryGetExpiredTrashedFiles = `
+		SELECT
+			id,
+			file_id,
+			version,
+			name,
 			size,
 			path,
+			COALESCE(digest, '') AS digest,
+			created_at,
+			trashed_at,
+			expires_at
+		FROM
+			files
+		WHERE
+			status = 'trashed'
+			AND expires_at < $1
+		ORDER BY
+			expires_at`
+
+	querySetFileBroken = `
+		UPDATE
+			files
+		SET
+			broken = $2
+		WHERE
+			id = $1`
+
+	queryTouchFile = `
+		UPDATE
+			files
+		SET
+			last_accessed_at = $2
+		WHERE
+			id = $1`
+
+	queryGetColdFiles = `
+		SELECT
+			f.id,
+			f.size,
+			f.path,
+			COALESCE(f.digest, '') AS digest,
+			f.created_at
+		FROM
+			files f
+		WHERE
+			COALESCE(f.last_accessed_at, f.created_at) < $1
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					files g
+				WHERE
+					g.digest = f.digest
+					AND COALESCE(g.last_accessed_at, g.created_at) >= $1
+			)`
+
+	queryInsertUpload = `
+		INSERT INTO uploads (
+			id,
+			name,
+			owner,
+			upload_length,
+			upload_offset,
+			metadata,
+			expires_at
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7
+		)`
+
+	queryGetUpload = `
+		SELECT
+			id,
+			name,
+			owner,
+			upload_length,
+			upload_offset,
+			metadata,
+			created_at,
+			expires_at
+		FROM
+			uploads
+		WHERE
+			id = $1`
+
+	querySetUploadOffset = `
+		UPDATE
+			uploads
+		SET
+			upload_offset = $3,
+			expires_at = $4
+		WHERE
+			id = $1
+			AND upload_offset = $2`
+
+	queryDeleteUpload = `
+		DELETE FROM
+			uploads
+		WHERE
+			id = $1`
+
+	queryGetExpiredUploads = `
+		SELECT
+			id,
+			name,
+			owner,
+			upload_length,
+			upload_offset,
+			metadata,
+			created_at,
+			expires_at
+		FROM
+			uploads
+		WHERE
+			expires_at < $1
+		ORDER BY
+			expires_at`
+
+	queryTryLock = `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`
+
+	queryUnlock = `SELECT pg_advisory_unlock(hashtextextended($1, 0))`
+
+	queryInsertMultipartUpload = `
+		INSERT INTO multipart_uploads (
+			id,
+			name,
+			owner
+		) VALUES (
+			$1,
+			$2,
+			$3
+		)`
+
+	queryGetMultipartUpload = `
+		SELECT
+			id,
+			name,
+			owner,
+			created_at
+		FROM
+			multipart_uploads
+		WHERE
+			id = $1`
+
+	queryGetMultipartUploadsBefore = `
+		SELECT
+			id,
+			name,
+			owner,
+			created_at
+		FROM
+			multipart_uploads
+		WHERE
+			created_at < $1
+		ORDER BY
+			created_at`
+
+	queryDeleteMultipartUpload = `
+		DELETE FROM
+			multipart_uploads
+		WHERE
+			id = $1`
+
+	queryPutMultipartPart = `
+		INSERT INTO multipart_parts (
+			upload_id,
+			part_number,
+			size,
+			checksum
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+		ON CONFLICT (upload_id, part_number) DO UPDATE SET
+			size = EXCLUDED.size,
+			checksum = EXCLUDED.checksum,
+			created_at = CURRENT_TIMESTAMP`
+
+	queryGetMultipartParts = `
+		SELECT
+			upload_id,
+			part_number,
+			size,
+			checksum,
 			created_at
 		FROM
-			files`
+			multipart_parts
+		WHERE
+			upload_id = $1
+		ORDER BY
+			part_number`
 )
 
 func TestNewPostgresStore(t *testing.T) {
@@ -76,26 +675,81 @@ func Test_postgresStore_InsertNewFile(t *testing.T) {
 		file dbstore.FileDetail
 	}
 	tests := []struct {
-		name     string
-		args     args
-		mockFunc func(sqlMock sqlmock.Sqlmock)
-		wantErr  bool
+		name         string
+		args         args
+		mockFunc     func(sqlMock sqlmock.Sqlmock)
+		blobFuncErr  error
+		wantRefCount int64
+		wantVersion  int
+		wantErr      bool
 	}{
 		{
 			name: "successfully inserting new file",
 			args: args{
 				ctx: context.Background(),
 				file: dbstore.FileDetail{
-					ID:   "sample-id",
-					Size: 12345,
-					Path: "filepath/sample-id",
+					ID:     "sample-id",
+					Size:   12345,
+					Path:   "filepath/sample-id",
+					Digest: "sample-digest",
 				},
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryReferenceBlob).WithArgs("sample-digest", 12345).WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(2))
 				query := fmt.Sprintf(queryInsertNewFile, "", "")
 				sqlMock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0)).WillReturnError(nil)
+				sqlMock.ExpectQuery(queryConsumeQuota).WithArgs("", dbstore.GlobalOwner, 12345).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				sqlMock.ExpectCommit()
 			},
-			wantErr: false,
+			wantRefCount: 2,
+			wantVersion:  1,
+			wantErr:      false,
+		},
+		{
+			name: "successfully inserting next version of a file",
+			args: args{
+				ctx: context.Background(),
+				file: dbstore.FileDetail{
+					ID:     "sample-version-id",
+					FileID: "sample-id",
+					Size:   12345,
+					Path:   "filepath/sample-id",
+					Digest: "sample-digest",
+				},
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectExec(queryLockFileVersions).WithArgs("sample-id").WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectQuery(queryNextVersion).WithArgs("sample-id").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+				sqlMock.ExpectQuery(queryReferenceBlob).WithArgs("sample-digest", 12345).WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(2))
+				query := fmt.Sprintf(queryInsertNewFile, "", "")
+				sqlMock.ExpectExec(query).WithArgs("sample-version-id", "sample-id", 3, "", 12345, "filepath/sample-id", "sample-digest", "", "", nil).WillReturnResult(sqlmock.NewResult(0, 0))
+				sqlMock.ExpectQuery(queryConsumeQuota).WithArgs("", dbstore.GlobalOwner, 12345).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				sqlMock.ExpectCommit()
+			},
+			wantRefCount: 2,
+			wantVersion:  3,
+			wantErr:      false,
+		},
+		{
+			name: "failed to get the next version of a file",
+			args: args{
+				ctx: context.Background(),
+				file: dbstore.FileDetail{
+					ID:     "sample-version-id",
+					FileID: "sample-id",
+					Size:   12345,
+					Path:   "filepath/sample-id",
+					Digest: "sample-digest",
+				},
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectExec(queryLockFileVersions).WithArgs("sample-id").WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectRollback()
+			},
+			wantErr: true,
 		},
 		{
 			name: "successfully re-inserting file",
@@ -109,27 +763,82 @@ func Test_postgresStore_InsertNewFile(t *testing.T) {
 				},
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
-				query := fmt.Sprintf(queryInsertNewFile, ", created_at", ", $4")
+				sqlMock.ExpectBegin()
+				query := fmt.Sprintf(queryInsertNewFile, ", created_at", ", $11")
 				sqlMock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0)).WillReturnError(nil)
+				sqlMock.ExpectQuery(queryConsumeQuota).WithArgs("", dbstore.GlobalOwner, 12345).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				sqlMock.ExpectCommit()
 			},
-			wantErr: false,
+			wantRefCount: 0,
+			wantVersion:  1,
+			wantErr:      false,
 		},
 		{
 			name: "failed to insert record to DB",
 			args: args{
 				ctx: context.Background(),
 				file: dbstore.FileDetail{
-					ID:   "sample-id",
-					Size: 12345,
-					Path: "filepath/sample-id",
+					ID:     "sample-id",
+					Size:   12345,
+					Path:   "filepath/sample-id",
+					Digest: "sample-digest",
 				},
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryReferenceBlob).WithArgs("sample-digest", 12345).WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
 				query := fmt.Sprintf(queryInsertNewFile, "", "")
 				sqlMock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0)).WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectRollback()
 			},
 			wantErr: true,
 		},
+		{
+			name: "quota of the owner is exceeded",
+			args: args{
+				ctx: context.Background(),
+				file: dbstore.FileDetail{
+					ID:     "sample-id",
+					Size:   12345,
+					Path:   "filepath/sample-id",
+					Digest: "sample-digest",
+					Owner:  "camera-1",
+				},
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryReferenceBlob).WithArgs("sample-digest", 12345).WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
+				query := fmt.Sprintf(queryInsertNewFile, "", "")
+				sqlMock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0)).WillReturnError(nil)
+				sqlMock.ExpectQuery(queryConsumeQuota).WithArgs("camera-1", dbstore.GlobalOwner, 12345).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				sqlMock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to store the blob",
+			args: args{
+				ctx: context.Background(),
+				file: dbstore.FileDetail{
+					ID:     "sample-id",
+					Size:   12345,
+					Path:   "filepath/sample-id",
+					Digest: "sample-digest",
+				},
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryReferenceBlob).WithArgs("sample-digest", 12345).WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
+				query := fmt.Sprintf(queryInsertNewFile, "", "")
+				sqlMock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0)).WillReturnError(nil)
+				sqlMock.ExpectQuery(queryConsumeQuota).WithArgs("", dbstore.GlobalOwner, 12345).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				sqlMock.ExpectRollback()
+			},
+			blobFuncErr:  fmt.Errorf("some-error"),
+			wantRefCount: 1,
+			wantVersion:  1,
+			wantErr:      true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -143,9 +852,21 @@ func Test_postgresStore_InsertNewFile(t *testing.T) {
 			ps := &postgresStore{
 				dbConn: sqlx.NewDb(mockDB, "postgres"),
 			}
-			if err := ps.InsertNewFile(tt.args.ctx, tt.args.file); (err != nil) != tt.wantErr {
+			err = ps.InsertNewFile(tt.args.ctx, tt.args.file, func(ctx context.Context, file dbstore.FileDetail, refCount int64) error {
+				if refCount != tt.wantRefCount {
+					t.Errorf("InsertNewFile() refCount got = %d, want %d", refCount, tt.wantRefCount)
+				}
+				if file.Version != tt.wantVersion {
+					t.Errorf("InsertNewFile() version got = %d, want %d", file.Version, tt.wantVersion)
+				}
+				return tt.blobFuncErr
+			})
+			if (err != nil) != tt.wantErr {
 				t.Errorf("InsertNewFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("InsertNewFile() unmet expectation: %v", err)
+			}
 		})
 	}
 }
@@ -156,27 +877,63 @@ func Test_postgresStore_DeleteFileByID(t *testing.T) {
 		id  string
 	}
 	tests := []struct {
-		name     string
-		args     args
-		mockFunc func(sqlMock sqlmock.Sqlmock)
-		want     dbstore.FileDetail
-		wantErr  bool
+		name         string
+		args         args
+		mockFunc     func(sqlMock sqlmock.Sqlmock)
+		blobFuncErr  error
+		wantRefCount int64
+		want         dbstore.FileDetail
+		wantErr      bool
 	}{
 		{
-			name: "successfully delete the file",
+			name: "successfully delete the last reference of a blob",
+			args: args{
+				ctx: context.Background(),
+				id:  "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "size", "path", "digest", "owner", "created_at"})
+				rows.AddRow("sample-id", 123, "storage/sample-id", "sample-digest", "camera-1", time.Time{})
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteFileByID).WithArgs("sample-id").WillReturnRows(rows)
+				sqlMock.ExpectQuery(queryReleaseBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+				sqlMock.ExpectExec(queryDeleteBlob).WithArgs("sample-digest").WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(queryReleaseQuota).WithArgs("camera-1", dbstore.GlobalOwner, 123).WillReturnResult(sqlmock.NewResult(0, 2))
+				sqlMock.ExpectCommit()
+			},
+			wantRefCount: 0,
+			want: dbstore.FileDetail{
+				ID:        "sample-id",
+				Size:      123,
+				Path:      "storage/sample-id",
+				Digest:    "sample-digest",
+				Owner:     "camera-1",
+				CreatedAt: time.Time{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "successfully delete a file which blob is still referenced",
 			args: args{
 				ctx: context.Background(),
 				id:  "sample-id",
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "size", "path", "created_at"})
-				rows.AddRow("sample-id", 123, "storage/sample-id", time.Time{})
-				sqlMock.ExpectQuery(queryDeleteFileByID).WillReturnRows(rows)
+				rows := sqlmock.NewRows([]string{"id", "size", "path", "digest", "owner", "created_at"})
+				rows.AddRow("sample-id", 123, "storage/sample-id", "sample-digest", "camera-1", time.Time{})
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteFileByID).WithArgs("sample-id").WillReturnRows(rows)
+				sqlMock.ExpectQuery(queryReleaseBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
+				sqlMock.ExpectExec(queryReleaseQuota).WithArgs("camera-1", dbstore.GlobalOwner, 123).WillReturnResult(sqlmock.NewResult(0, 2))
+				sqlMock.ExpectCommit()
 			},
+			wantRefCount: 1,
 			want: dbstore.FileDetail{
 				ID:        "sample-id",
 				Size:      123,
 				Path:      "storage/sample-id",
+				Digest:    "sample-digest",
+				Owner:     "camera-1",
 				CreatedAt: time.Time{},
 			},
 			wantErr: false,
@@ -188,8 +945,10 @@ func Test_postgresStore_DeleteFileByID(t *testing.T) {
 				id:  "sample-id",
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "size", "path", "created_at"})
-				sqlMock.ExpectQuery(queryDeleteFileByID).WillReturnRows(rows)
+				rows := sqlmock.NewRows([]string{"id", "size", "path", "digest", "owner", "created_at"})
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteFileByID).WithArgs("sample-id").WillReturnRows(rows)
+				sqlMock.ExpectRollback()
 			},
 			want:    dbstore.FileDetail{},
 			wantErr: true,
@@ -201,14 +960,37 @@ func Test_postgresStore_DeleteFileByID(t *testing.T) {
 				id:  "sample-id",
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
-				sqlMock.ExpectQuery(queryDeleteFileByID).WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteFileByID).WithArgs("sample-id").WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectRollback()
 			},
 			want:    dbstore.FileDetail{},
 			wantErr: true,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
+		{
+			name: "failed to delete the blob",
+			args: args{
+				ctx: context.Background(),
+				id:  "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "size", "path", "digest", "owner", "created_at"})
+				rows.AddRow("sample-id", 123, "storage/sample-id", "sample-digest", "camera-1", time.Time{})
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryDeleteFileByID).WithArgs("sample-id").WillReturnRows(rows)
+				sqlMock.ExpectQuery(queryReleaseBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+				sqlMock.ExpectExec(queryDeleteBlob).WithArgs("sample-digest").WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(queryReleaseQuota).WithArgs("camera-1", dbstore.GlobalOwner, 123).WillReturnResult(sqlmock.NewResult(0, 2))
+				sqlMock.ExpectRollback()
+			},
+			blobFuncErr:  fmt.Errorf("some-error"),
+			wantRefCount: 0,
+			want:         dbstore.FileDetail{},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
 			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 			if err != nil {
 				t.Errorf("error when opening a database connection: %v\n", err)
@@ -219,7 +1001,12 @@ func Test_postgresStore_DeleteFileByID(t *testing.T) {
 			ps := &postgresStore{
 				dbConn: sqlx.NewDb(mockDB, "postgres"),
 			}
-			got, err := ps.DeleteFileByID(tt.args.ctx, tt.args.id)
+			got, err := ps.DeleteFileByID(tt.args.ctx, tt.args.id, func(ctx context.Context, file dbstore.FileDetail, refCount int64) error {
+				if refCount != tt.wantRefCount {
+					t.Errorf("DeleteFileByID() refCount got = %d, want %d", refCount, tt.wantRefCount)
+				}
+				return tt.blobFuncErr
+			})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteFileByID() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -227,6 +1014,327 @@ func Test_postgresStore_DeleteFileByID(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("DeleteFileByID() got = %v, want %v", got, tt.want)
 			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("DeleteFileByID() unmet expectation: %v", err)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetFileByID(t *testing.T) {
+	type args struct {
+		ctx context.Context
+		id  string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the file",
+			args: args{
+				ctx: context.Background(),
+				id:  "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at", "expires_at"})
+				rows.AddRow("sample-version-id", "sample-id", 2, "sample.mp4", 123, "storage/sample-id", "", time.Time{}, time.Date(2026, 11, 18, 0, 0, 0, 0, time.UTC))
+				sqlMock.ExpectQuery(queryGetFileByID).WithArgs("sample-id").WillReturnRows(rows)
+			},
+			want: dbstore.FileDetail{
+				ID:        "sample-version-id",
+				FileID:    "sample-id",
+				Version:   2,
+				Name:      "sample.mp4",
+				Size:      123,
+				Path:      "storage/sample-id",
+				CreatedAt: time.Time{},
+				ExpiresAt: time.Date(2026, 11, 18, 0, 0, 0, 0, time.UTC),
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found",
+			args: args{
+				ctx: context.Background(),
+				id:  "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at"})
+				sqlMock.ExpectQuery(queryGetFileByID).WithArgs("sample-id").WillReturnRows(rows)
+			},
+			want:    dbstore.FileDetail{},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			args: args{
+				ctx: context.Background(),
+				id:  "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetFileByID).WithArgs("sample-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetFileByID(tt.args.ctx, tt.args.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFileByID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileByID() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetFileByName(t *testing.T) {
+	type args struct {
+		ctx  context.Context
+		name string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the file",
+			args: args{
+				ctx:  context.Background(),
+				name: "sample.mp4",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at"})
+				rows.AddRow("sample-version-id", "sample-id", 2, "sample.mp4", 123, "storage/sample-id", "", time.Time{})
+				sqlMock.ExpectQuery(queryGetFileByName).WithArgs("sample.mp4").WillReturnRows(rows)
+			},
+			want: dbstore.FileDetail{
+				ID:        "sample-version-id",
+				FileID:    "sample-id",
+				Version:   2,
+				Name:      "sample.mp4",
+				Size:      123,
+				Path:      "storage/sample-id",
+				CreatedAt: time.Time{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found",
+			args: args{
+				ctx:  context.Background(),
+				name: "sample.mp4",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at"})
+				sqlMock.ExpectQuery(queryGetFileByName).WithArgs("sample.mp4").WillReturnRows(rows)
+			},
+			want:    dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetFileByName(tt.args.ctx, tt.args.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFileByName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileByName() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetFileVersions(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		fileID string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the versions",
+			args: args{
+				ctx:    context.Background(),
+				fileID: "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at", "broken"})
+				rows.AddRow("sample-id", "sample-id", 1, "sample.mp4", 111, "storage/sample-id", "", time.Time{}, false)
+				rows.AddRow("sample-version-id", "sample-id", 3, "sample.mp4", 333, "storage/sample-version-id", "sample-digest", time.Time{}, true)
+				sqlMock.ExpectQuery(queryGetFileVersions).WithArgs("sample-id").WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:        "sample-id",
+					FileID:    "sample-id",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      111,
+					Path:      "storage/sample-id",
+					CreatedAt: time.Time{},
+				},
+				{
+					ID:        "sample-version-id",
+					FileID:    "sample-id",
+					Version:   3,
+					Name:      "sample.mp4",
+					Size:      333,
+					Path:      "storage/sample-version-id",
+					Digest:    "sample-digest",
+					CreatedAt: time.Time{},
+					Broken:    true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			args: args{
+				ctx:    context.Background(),
+				fileID: "sample-id",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetFileVersions).WithArgs("sample-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetFileVersions(tt.args.ctx, tt.args.fileID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFileVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileVersions() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetFileVersion(t *testing.T) {
+	type args struct {
+		ctx     context.Context
+		fileID  string
+		version int
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the version",
+			args: args{
+				ctx:     context.Background(),
+				fileID:  "sample-id",
+				version: 3,
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at"})
+				rows.AddRow("sample-version-id", "sample-id", 3, "sample.mp4", 333, "storage/sample-version-id", "sample-digest", time.Time{})
+				sqlMock.ExpectQuery(queryGetFileVersion).WithArgs("sample-id", 3).WillReturnRows(rows)
+			},
+			want: dbstore.FileDetail{
+				ID:        "sample-version-id",
+				FileID:    "sample-id",
+				Version:   3,
+				Name:      "sample.mp4",
+				Size:      333,
+				Path:      "storage/sample-version-id",
+				Digest:    "sample-digest",
+				CreatedAt: time.Time{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "version not found",
+			args: args{
+				ctx:     context.Background(),
+				fileID:  "sample-id",
+				version: 2,
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at"})
+				sqlMock.ExpectQuery(queryGetFileVersion).WithArgs("sample-id", 2).WillReturnRows(rows)
+			},
+			want:    dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetFileVersion(tt.args.ctx, tt.args.fileID, tt.args.version)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFileVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFileVersion() got = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -248,30 +1356,40 @@ func Test_postgresStore_GetAllFiles(t *testing.T) {
 				ctx: context.Background(),
 			},
 			mockFunc: func(sqlMock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "size", "path", "created_at"})
-				rows.AddRow("sample-id-1", 111, "storage/sample-id-1", time.Time{})
-				rows.AddRow("sample-id-2", 222, "storage/sample-id-2", time.Time{})
-				rows.AddRow("sample-id-3", 333, "storage/sample-id-3", time.Time{})
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at", "broken"})
+				rows.AddRow("sample-id-1", "sample-id-1", 1, "sample-1.mp4", 111, "storage/sample-id-1", "", time.Time{}, false)
+				rows.AddRow("sample-id-2", "sample-id-2", 1, "sample-2.mp4", 222, "storage/sample-id-2", "", time.Time{}, false)
+				rows.AddRow("sample-id-3", "sample-id-2", 2, "sample-3.mp4", 333, "storage/sample-id-3", "", time.Time{}, true)
 				sqlMock.ExpectQuery(queryGetAllFiles).WillReturnRows(rows)
 			},
 			want: []dbstore.FileDetail{
 				{
 					ID:        "sample-id-1",
+					FileID:    "sample-id-1",
+					Version:   1,
+					Name:      "sample-1.mp4",
 					Size:      111,
 					Path:      "storage/sample-id-1",
 					CreatedAt: time.Time{},
 				},
 				{
 					ID:        "sample-id-2",
+					FileID:    "sample-id-2",
+					Version:   1,
+					Name:      "sample-2.mp4",
 					Size:      222,
 					Path:      "storage/sample-id-2",
 					CreatedAt: time.Time{},
 				},
 				{
 					ID:        "sample-id-3",
+					FileID:    "sample-id-2",
+					Version:   2,
+					Name:      "sample-3.mp4",
 					Size:      333,
 					Path:      "storage/sample-id-3",
 					CreatedAt: time.Time{},
+					Broken:    true,
 				},
 			},
 			wantErr: false,
@@ -311,3 +1429,1660 @@ func Test_postgresStore_GetAllFiles(t *testing.T) {
 		})
 	}
 }
+
+func Test_postgresStore_UpdateFilePath(t *testing.T) {
+	type args struct {
+		ctx  context.Context
+		id   string
+		path string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully update the path",
+			args: args{
+				ctx:  context.Background(),
+				id:   "sample-id",
+				path: "ab/cd/sample-digest",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryUpdateFilePath).WithArgs("sample-id", "ab/cd/sample-digest").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found",
+			args: args{
+				ctx:  context.Background(),
+				id:   "sample-id",
+				path: "ab/cd/sample-digest",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryUpdateFilePath).WithArgs("sample-id", "ab/cd/sample-digest").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			args: args{
+				ctx:  context.Background(),
+				id:   "sample-id",
+				path: "ab/cd/sample-digest",
+			},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryUpdateFilePath).WithArgs("sample-id", "ab/cd/sample-digest").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			if err := ps.UpdateFilePath(tt.args.ctx, tt.args.id, tt.args.path); (err != nil) != tt.wantErr {
+				t.Errorf("UpdateFilePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_SetFileStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully move the file to deleting status",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileStatus).WithArgs("sample-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found or not active",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileStatus).WithArgs("sample-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileStatus).WithArgs("sample-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.SetFileStatus(context.Background(), "sample-id", dbstore.FileStatusActive, dbstore.FileStatusDeleting)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetFileStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetFilesByStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the pending files",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "size", "path", "digest", "owner", "status", "created_at", "status_changed_at"})
+				rows.AddRow("sample-id", 123, "storage/sample-digest", "sample-digest", "camera-1", dbstore.FileStatusPending, time.Time{}, time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC))
+				sqlMock.ExpectQuery(queryGetFilesByStatus).WithArgs(dbstore.FileStatusPending).WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:              "sample-id",
+					Size:            123,
+					Path:            "storage/sample-digest",
+					Digest:          "sample-digest",
+					Owner:           "camera-1",
+					Status:          dbstore.FileStatusPending,
+					StatusChangedAt: time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetFilesByStatus).WithArgs(dbstore.FileStatusPending).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetFilesByStatus(context.Background(), dbstore.FileStatusPending)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFilesByStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFilesByStatus() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_TrashFile(t *testing.T) {
+	trashedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully trash every version of the file",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryTrashFile).WithArgs("sample-id", trashedAt).WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found or already trashed",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryTrashFile).WithArgs("sample-id", trashedAt).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryTrashFile).WithArgs("sample-id", trashedAt).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.TrashFile(context.Background(), "sample-id", trashedAt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TrashFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_RestoreFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully restore every version of the file",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryRestoreFile).WithArgs("sample-id").WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found in the trash or expired",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryRestoreFile).WithArgs("sample-id").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryRestoreFile).WithArgs("sample-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.RestoreFile(context.Background(), "sample-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RestoreFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetTrashedFiles(t *testing.T) {
+	trashedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the trashed files",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "owner", "status", "created_at", "trashed_at"})
+				rows.AddRow("sample-id", "sample-id", 1, "sample.mp4", 123, "storage/sample-digest", "sample-digest", "camera-1", dbstore.FileStatusTrashed, time.Time{}, trashedAt)
+				sqlMock.ExpectQuery(queryGetTrashedFiles).WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:        "sample-id",
+					FileID:    "sample-id",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      123,
+					Path:      "storage/sample-digest",
+					Digest:    "sample-digest",
+					Owner:     "camera-1",
+					Status:    dbstore.FileStatusTrashed,
+					TrashedAt: trashedAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetTrashedFiles).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetTrashedFiles(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTrashedFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTrashedFiles() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetTrashedFileVersions(t *testing.T) {
+	trashedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the trashed versions of the file",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "owner", "status", "created_at", "trashed_at"})
+				rows.AddRow("sample-id", "sample-id", 1, "sample.mp4", 123, "storage/sample-digest", "sample-digest", "camera-1", dbstore.FileStatusTrashed, time.Time{}, trashedAt)
+				sqlMock.ExpectQuery(queryGetTrashedFileVersions).WithArgs("sample-id").WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:        "sample-id",
+					FileID:    "sample-id",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      123,
+					Path:      "storage/sample-digest",
+					Digest:    "sample-digest",
+					Owner:     "camera-1",
+					Status:    dbstore.FileStatusTrashed,
+					TrashedAt: trashedAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetTrashedFileVersions).WithArgs("sample-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetTrashedFileVersions(context.Background(), "sample-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTrashedFileVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTrashedFileVersions() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetTrashedFilesBefore(t *testing.T) {
+	trashedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	before := trashedAt.Add(time.Hour)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the files trashed before",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "owner", "status", "created_at", "trashed_at"})
+				rows.AddRow("sample-id", "sample-id", 1, "sample.mp4", 123, "storage/sample-digest", "sample-digest", "camera-1", dbstore.FileStatusTrashed, time.Time{}, trashedAt)
+				sqlMock.ExpectQuery(queryGetTrashedFilesBefore).WithArgs(before).WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:        "sample-id",
+					FileID:    "sample-id",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      123,
+					Path:      "storage/sample-digest",
+					Digest:    "sample-digest",
+					Owner:     "camera-1",
+					Status:    dbstore.FileStatusTrashed,
+					TrashedAt: trashedAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetTrashedFilesBefore).WithArgs(before).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetTrashedFilesBefore(context.Background(), before)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTrashedFilesBefore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTrashedFilesBefore() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_SetFileExpiry(t *testing.T) {
+	expiresAt := time.Date(2026, 11, 18, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully set the expiry of every version of the file",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileExpiry).WithArgs("sample-id", expiresAt).WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileExpiry).WithArgs("sample-id", expiresAt).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileExpiry).WithArgs("sample-id", expiresAt).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.SetFileExpiry(context.Background(), "sample-id", expiresAt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetFileExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetExpiredFiles(t *testing.T) {
+	before := time.Date(2026, 11, 18, 0, 0, 0, 0, time.UTC)
+	expiresAt := before.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the expired files",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at", "expires_at"})
+				rows.AddRow("sample-version-id", "sample-id", 2, "sample.mp4", 123, "storage/sample-digest", "sample-digest", time.Time{}, expiresAt)
+				sqlMock.ExpectQuery(queryGetExpiredFiles).WithArgs(before).WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:        "sample-version-id",
+					FileID:    "sample-id",
+					Version:   2,
+					Name:      "sample.mp4",
+					Size:      123,
+					Path:      "storage/sample-digest",
+					Digest:    "sample-digest",
+					ExpiresAt: expiresAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetExpiredFiles).WithArgs(before).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetExpiredFiles(context.Background(), before)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetExpiredFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetExpiredFiles() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetExpiredTrashedFiles(t *testing.T) {
+	before := time.Date(2026, 11, 18, 0, 0, 0, 0, time.UTC)
+	trashedAt := before.Add(-2 * time.Hour)
+	expiresAt := before.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the expired trashed files",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "file_id", "version", "name", "size", "path", "digest", "created_at", "trashed_at", "expires_at"})
+				rows.AddRow("sample-version-id", "sample-id", 1, "sample.mp4", 123, "storage/sample-digest", "sample-digest", time.Time{}, trashedAt, expiresAt)
+				sqlMock.ExpectQuery(queryGetExpiredTrashedFiles).WithArgs(before).WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:        "sample-version-id",
+					FileID:    "sample-id",
+					Version:   1,
+					Name:      "sample.mp4",
+					Size:      123,
+					Path:      "storage/sample-digest",
+					Digest:    "sample-digest",
+					TrashedAt: trashedAt,
+					ExpiresAt: expiresAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetExpiredTrashedFiles).WithArgs(before).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetExpiredTrashedFiles(context.Background(), before)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetExpiredTrashedFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetExpiredTrashedFiles() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_SetFileBroken(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		broken   bool
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name:   "successfully mark the file broken",
+			id:     "sample-id",
+			broken: true,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileBroken).WithArgs("sample-id", true).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name:   "file not found",
+			id:     "sample-id",
+			broken: false,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileBroken).WithArgs("sample-id", false).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "failed to do DB query",
+			id:     "sample-id",
+			broken: true,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetFileBroken).WithArgs("sample-id", true).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			if err := ps.SetFileBroken(context.Background(), tt.id, tt.broken); (err != nil) != tt.wantErr {
+				t.Errorf("SetFileBroken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_TouchFile(t *testing.T) {
+	accessedAt := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		id       string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully record the access time",
+			id:   "sample-id",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryTouchFile).WithArgs("sample-id", accessedAt).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "file not found",
+			id:   "sample-id",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryTouchFile).WithArgs("sample-id", accessedAt).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			id:   "sample-id",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryTouchFile).WithArgs("sample-id", accessedAt).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			if err := ps.TouchFile(context.Background(), tt.id, accessedAt); (err != nil) != tt.wantErr {
+				t.Errorf("TouchFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetColdFiles(t *testing.T) {
+	before := time.Date(2026, 10, 11, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.FileDetail
+		wantErr  bool
+	}{
+		{
+			name: "successfully get cold files",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "size", "path", "digest", "created_at"})
+				rows.AddRow("sample-id-1", 111, "ab/cd/sample-digest", "sample-digest", time.Time{})
+				sqlMock.ExpectQuery(queryGetColdFiles).WithArgs(before).WillReturnRows(rows)
+			},
+			want: []dbstore.FileDetail{
+				{
+					ID:     "sample-id-1",
+					Size:   111,
+					Path:   "ab/cd/sample-digest",
+					Digest: "sample-digest",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetColdFiles).WithArgs(before).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.FileDetail{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetColdFiles(context.Background(), before)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetColdFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetColdFiles() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		owner    string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     dbstore.Usage
+		wantErr  bool
+	}{
+		{
+			name:  "successfully get the usage of an owner",
+			owner: "camera-1",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"used_bytes", "used_files", "max_bytes", "max_files"})
+				rows.AddRow(1024, 2, 4096, 0)
+				sqlMock.ExpectQuery(queryGetUsage).WithArgs("camera-1").WillReturnRows(rows)
+			},
+			want: dbstore.Usage{
+				UsedBytes: 1024,
+				UsedFiles: 2,
+				Quota: dbstore.Quota{
+					MaxBytes: 4096,
+					MaxFiles: 0,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:  "failed to do DB query",
+			owner: dbstore.GlobalOwner,
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetUsage).WithArgs(dbstore.GlobalOwner).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    dbstore.Usage{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetUsage(context.Background(), tt.owner)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetUsage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUsage() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_SetQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		owner    string
+		quota    dbstore.Quota
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name:  "successfully set the quota",
+			owner: dbstore.GlobalOwner,
+			quota: dbstore.Quota{MaxBytes: 1 << 40, MaxFiles: 10000},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetQuota).WithArgs(dbstore.GlobalOwner, int64(1<<40), 10000).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name:  "failed to do DB query",
+			owner: "camera-1",
+			quota: dbstore.Quota{MaxBytes: 1024},
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetQuota).WithArgs("camera-1", 1024, 0).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			if err := ps.SetQuota(context.Background(), tt.owner, tt.quota); (err != nil) != tt.wantErr {
+				t.Errorf("SetQuota() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("SetQuota() unmet expectation: %v", err)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_DeleteUnreferencedBlob(t *testing.T) {
+	tests := []struct {
+		name        string
+		mockFunc    func(sqlMock sqlmock.Sqlmock)
+		blobFuncErr error
+		want        bool
+		wantCalled  bool
+		wantErr     bool
+	}{
+		{
+			name: "successfully delete the unreferenced blob",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryLockBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+				sqlMock.ExpectQuery(queryCountLegacyFiles).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				sqlMock.ExpectExec(queryDeleteUnreferencedBlob).WithArgs("sample-digest").WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectCommit()
+			},
+			want:       true,
+			wantCalled: true,
+			wantErr:    false,
+		},
+		{
+			name: "blob is referenced by a file",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryLockBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
+				sqlMock.ExpectRollback()
+			},
+			want:       false,
+			wantCalled: false,
+			wantErr:    false,
+		},
+		{
+			name: "blob is referenced by a legacy file",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryLockBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+				sqlMock.ExpectQuery(queryCountLegacyFiles).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				sqlMock.ExpectRollback()
+			},
+			want:       false,
+			wantCalled: false,
+			wantErr:    false,
+		},
+		{
+			name: "failed to delete the blob from blob storage",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryLockBlob).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+				sqlMock.ExpectQuery(queryCountLegacyFiles).WithArgs("sample-digest").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				sqlMock.ExpectRollback()
+			},
+			blobFuncErr: fmt.Errorf("some-error"),
+			want:        false,
+			wantCalled:  true,
+			wantErr:     true,
+		},
+		{
+			name: "failed to lock the blob",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectQuery(queryLockBlob).WithArgs("sample-digest").WillReturnError(fmt.Errorf("some-error"))
+				sqlMock.ExpectRollback()
+			},
+			want:       false,
+			wantCalled: false,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			called := false
+			got, err := ps.DeleteUnreferencedBlob(context.Background(), "sample-digest", func(_ context.Context, file dbstore.FileDetail, refCount int64) error {
+				called = true
+				if file.Digest != "sample-digest" || refCount != 0 {
+					t.Errorf("DeleteUnreferencedBlob() blobFunc got = %+v, %d", file, refCount)
+				}
+				return tt.blobFuncErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteUnreferencedBlob() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || called != tt.wantCalled {
+				t.Errorf("DeleteUnreferencedBlob() got = %v, called = %v, want %v, called %v", got, called, tt.want, tt.wantCalled)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("DeleteUnreferencedBlob() unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_InsertUpload(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	upload := dbstore.Upload{
+		ID:        "sample-upload-id",
+		Name:      "sample.mp4",
+		Owner:     "sample-owner",
+		Length:    123,
+		Metadata:  "filename c2FtcGxlLm1wNA==",
+		ExpiresAt: expiresAt,
+	}
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully insert the upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryInsertUpload).WithArgs("sample-upload-id", "sample.mp4", "sample-owner", int64(123), int64(0), "filename c2FtcGxlLm1wNA==", expiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryInsertUpload).WithArgs("sample-upload-id", "sample.mp4", "sample-owner", int64(123), int64(0), "filename c2FtcGxlLm1wNA==", expiresAt).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.InsertUpload(context.Background(), upload)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("InsertUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetUpload(t *testing.T) {
+	createdAt := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     dbstore.Upload
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "name", "owner", "upload_length", "upload_offset", "metadata", "created_at", "expires_at"})
+				rows.AddRow("sample-upload-id", "sample.mp4", "sample-owner", 123, 45, "filename c2FtcGxlLm1wNA==", createdAt, expiresAt)
+				sqlMock.ExpectQuery(queryGetUpload).WithArgs("sample-upload-id").WillReturnRows(rows)
+			},
+			want: dbstore.Upload{
+				ID:        "sample-upload-id",
+				Name:      "sample.mp4",
+				Owner:     "sample-owner",
+				Length:    123,
+				Offset:    45,
+				Metadata:  "filename c2FtcGxlLm1wNA==",
+				CreatedAt: createdAt,
+				ExpiresAt: expiresAt,
+			},
+			wantErr: false,
+		},
+		{
+			name: "upload not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "name", "owner", "upload_length", "upload_offset", "metadata", "created_at", "expires_at"})
+				sqlMock.ExpectQuery(queryGetUpload).WithArgs("sample-upload-id").WillReturnRows(rows)
+			},
+			want:    dbstore.Upload{},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetUpload).WithArgs("sample-upload-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    dbstore.Upload{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetUpload(context.Background(), "sample-upload-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUpload() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_SetUploadOffset(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully move the offset of the upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetUploadOffset).WithArgs("sample-upload-id", int64(45), int64(100), expiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "upload not found or moved meanwhile",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetUploadOffset).WithArgs("sample-upload-id", int64(45), int64(100), expiresAt).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(querySetUploadOffset).WithArgs("sample-upload-id", int64(45), int64(100), expiresAt).WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.SetUploadOffset(context.Background(), "sample-upload-id", 45, 100, expiresAt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetUploadOffset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_DeleteUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully delete the upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryDeleteUpload).WithArgs("sample-upload-id").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "upload not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryDeleteUpload).WithArgs("sample-upload-id").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryDeleteUpload).WithArgs("sample-upload-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.DeleteUpload(context.Background(), "sample-upload-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetExpiredUploads(t *testing.T) {
+	before := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	createdAt := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.Upload
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the expired uploads",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "name", "owner", "upload_length", "upload_offset", "metadata", "created_at", "expires_at"})
+				rows.AddRow("sample-upload-id", "sample.mp4", "sample-owner", 123, 45, "", createdAt, expiresAt)
+				sqlMock.ExpectQuery(queryGetExpiredUploads).WithArgs(before).WillReturnRows(rows)
+			},
+			want: []dbstore.Upload{
+				{
+					ID:        "sample-upload-id",
+					Name:      "sample.mp4",
+					Owner:     "sample-owner",
+					Length:    123,
+					Offset:    45,
+					CreatedAt: createdAt,
+					ExpiresAt: expiresAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetExpiredUploads).WithArgs(before).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.Upload{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetExpiredUploads(context.Background(), before)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetExpiredUploads() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetExpiredUploads() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_TryLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  error
+	}{
+		{
+			name: "successfully take and release the lock",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryTryLock).WithArgs("sample-key").WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+				sqlMock.ExpectExec(queryUnlock).WithArgs("sample-key").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "lock held by another session",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryTryLock).WithArgs("sample-key").WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+			},
+			wantErr: dbstore.ErrorLocked,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryTryLock).WithArgs("sample-key").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: fmt.Errorf("some-error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			unlock, err := ps.TryLock(context.Background(), "sample-key")
+			if (err != nil) != (tt.wantErr != nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+				t.Errorf("TryLock() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if unlock != nil {
+				unlock()
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("TryLock() unmet expectations, err = %v", err)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_InsertMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully insert the multipart upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryInsertMultipartUpload).WithArgs("sample-upload-id", "sample.mp4", "sample-owner").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryInsertMultipartUpload).WithArgs("sample-upload-id", "sample.mp4", "sample-owner").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.InsertMultipartUpload(context.Background(), dbstore.MultipartUpload{ID: "sample-upload-id", Name: "sample.mp4", Owner: "sample-owner"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("InsertMultipartUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetMultipartUpload(t *testing.T) {
+	createdAt := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     dbstore.MultipartUpload
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the multipart upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "name", "owner", "created_at"})
+				rows.AddRow("sample-upload-id", "sample.mp4", "sample-owner", createdAt)
+				sqlMock.ExpectQuery(queryGetMultipartUpload).WithArgs("sample-upload-id").WillReturnRows(rows)
+			},
+			want: dbstore.MultipartUpload{
+				ID:        "sample-upload-id",
+				Name:      "sample.mp4",
+				Owner:     "sample-owner",
+				CreatedAt: createdAt,
+			},
+			wantErr: false,
+		},
+		{
+			name: "multipart upload not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "name", "owner", "created_at"})
+				sqlMock.ExpectQuery(queryGetMultipartUpload).WithArgs("sample-upload-id").WillReturnRows(rows)
+			},
+			want:    dbstore.MultipartUpload{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetMultipartUpload(context.Background(), "sample-upload-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetMultipartUpload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMultipartUpload() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetMultipartUploadsBefore(t *testing.T) {
+	before := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	createdAt := before.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.MultipartUpload
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the multipart uploads",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "name", "owner", "created_at"})
+				rows.AddRow("sample-upload-id", "sample.mp4", "sample-owner", createdAt)
+				sqlMock.ExpectQuery(queryGetMultipartUploadsBefore).WithArgs(before).WillReturnRows(rows)
+			},
+			want: []dbstore.MultipartUpload{
+				{
+					ID:        "sample-upload-id",
+					Name:      "sample.mp4",
+					Owner:     "sample-owner",
+					CreatedAt: createdAt,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetMultipartUploadsBefore).WithArgs(before).WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.MultipartUpload{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetMultipartUploadsBefore(context.Background(), before)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetMultipartUploadsBefore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMultipartUploadsBefore() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_DeleteMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully delete the multipart upload",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryDeleteMultipartUpload).WithArgs("sample-upload-id").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "multipart upload not found",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryDeleteMultipartUpload).WithArgs("sample-upload-id").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryDeleteMultipartUpload).WithArgs("sample-upload-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.DeleteMultipartUpload(context.Background(), "sample-upload-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteMultipartUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_PutMultipartPart(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		wantErr  bool
+	}{
+		{
+			name: "successfully put the part",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryPutMultipartPart).WithArgs("sample-upload-id", 2, int64(123), "sample-checksum").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectExec(queryPutMultipartPart).WithArgs("sample-upload-id", 2, int64(123), "sample-checksum").WillReturnError(fmt.Errorf("some-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			err = ps.PutMultipartPart(context.Background(), dbstore.MultipartPart{UploadID: "sample-upload-id", PartNumber: 2, Size: 123, Checksum: "sample-checksum"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PutMultipartPart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_postgresStore_GetMultipartParts(t *testing.T) {
+	createdAt := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mockFunc func(sqlMock sqlmock.Sqlmock)
+		want     []dbstore.MultipartPart
+		wantErr  bool
+	}{
+		{
+			name: "successfully get the parts",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"upload_id", "part_number", "size", "checksum", "created_at"})
+				rows.AddRow("sample-upload-id", 1, 100, "sample-checksum-1", createdAt)
+				rows.AddRow("sample-upload-id", 2, 23, "sample-checksum-2", createdAt)
+				sqlMock.ExpectQuery(queryGetMultipartParts).WithArgs("sample-upload-id").WillReturnRows(rows)
+			},
+			want: []dbstore.MultipartPart{
+				{UploadID: "sample-upload-id", PartNumber: 1, Size: 100, Checksum: "sample-checksum-1", CreatedAt: createdAt},
+				{UploadID: "sample-upload-id", PartNumber: 2, Size: 23, Checksum: "sample-checksum-2", CreatedAt: createdAt},
+			},
+			wantErr: false,
+		},
+		{
+			name: "failed to do DB query",
+			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+				sqlMock.ExpectQuery(queryGetMultipartParts).WithArgs("sample-upload-id").WillReturnError(fmt.Errorf("some-error"))
+			},
+			want:    []dbstore.MultipartPart{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Errorf("error when opening a database connection: %v\n", err)
+			}
+			defer mockDB.Close()
+			tt.mockFunc(sqlMock)
+
+			ps := &postgresStore{
+				dbConn: sqlx.NewDb(mockDB, "postgres"),
+			}
+			got, err := ps.GetMultipartParts(context.Background(), "sample-upload-id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetMultipartParts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMultipartParts() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
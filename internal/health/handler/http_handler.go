@@ -22,9 +22,10 @@ func New(healthSvc service.Service) healthHTTPHandler {
 
 // GetHealth handles HTTP request for getting the service's health
 func (h *healthHTTPHandler) GetHealth(ctx echo.Context) error {
-	if err := h.healthSvc.GetServiceHealth(ctx.Request().Context()); err != nil {
+	health, err := h.healthSvc.GetServiceHealth(ctx.Request().Context())
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, httpHelper.NewErrorMessage("service is not healthy", err))
 	}
 
-	return ctx.String(http.StatusOK, "OK")
+	return ctx.JSON(http.StatusOK, health)
 }
@@ -14,6 +14,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
 	"github.com/cityos-dev/Cornelius-David-Herianto/internal/health/service"
 	healthSvcMock "github.com/cityos-dev/Cornelius-David-Herianto/internal/health/service/mocks"
 )
@@ -70,12 +71,18 @@ func Test_healthHTTPHandler_GetHealth(t *testing.T) {
 				url:    "http://localhost/v1/health",
 			},
 			mockFunc: func(mockService *healthSvcMock.MockService) {
-				mockService.EXPECT().GetServiceHealth(context.Background()).Return(nil)
+				mockService.EXPECT().GetServiceHealth(context.Background()).Return(service.Health{
+					Status: "OK",
+					Storage: filesSvc.StorageReport{
+						Disks:            []filesSvc.DiskReport{{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 10, TotalInodes: 100}},
+						AcceptingUploads: true,
+					},
+				}, nil)
 			},
 			want: want{
-				body:        `OK`,
+				body:        `{"status":"OK","storage":{"disks":[{"path":"storage/videos","free_bytes":2048,"total_bytes":4096,"free_inodes":10,"total_inodes":100}],"accepting_uploads":true}}`,
 				code:        http.StatusOK,
-				contentType: "text/plain; charset=UTF-8",
+				contentType: "application/json; charset=UTF-8",
 			},
 			wantErr: false,
 		},
@@ -86,7 +93,7 @@ func Test_healthHTTPHandler_GetHealth(t *testing.T) {
 				url:    "http://localhost/v1/health",
 			},
 			mockFunc: func(mockService *healthSvcMock.MockService) {
-				mockService.EXPECT().GetServiceHealth(context.Background()).Return(fmt.Errorf("some-error"))
+				mockService.EXPECT().GetServiceHealth(context.Background()).Return(service.Health{}, fmt.Errorf("some-error"))
 			},
 			want: want{
 				body:        `{"message":"service is not healthy","dev_message":"some-error"}`,
@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	service "github.com/cityos-dev/Cornelius-David-Herianto/internal/health/service"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,11 +36,12 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 }
 
 // GetServiceHealth mocks base method.
-func (m *MockService) GetServiceHealth(arg0 context.Context) error {
+func (m *MockService) GetServiceHealth(arg0 context.Context) (service.Health, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetServiceHealth", arg0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(service.Health)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // GetServiceHealth indicates an expected call of GetServiceHealth.
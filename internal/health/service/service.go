@@ -5,32 +5,56 @@ import (
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
 )
 
+// Health represents the health of the service and the state of the storage keeping the files
+type Health struct {
+	Status  string                 `json:"status"`
+	Storage filesSvc.StorageReport `json:"storage"`
+}
+
+// StorageChecker checks the storage keeping the files, it is implemented by the files service
+type StorageChecker interface {
+	CheckStorage(ctx context.Context) (filesSvc.StorageReport, error)
+}
+
 // Service provides mechanism to check Service's health
 //
 //go:generate mockgen -destination mocks/mock_service.go github.com/cityos-dev/Cornelius-David-Herianto/internal/health/service Service
 type Service interface {
-	GetServiceHealth(ctx context.Context) error
+	GetServiceHealth(ctx context.Context) (Health, error)
 }
 
 type service struct {
-	dbConn *sqlx.DB
+	dbConn         *sqlx.DB
+	storageChecker StorageChecker
 }
 
 // New returns a new Service instance
-func New(dbConn *sqlx.DB) Service {
+func New(dbConn *sqlx.DB, storageChecker StorageChecker) Service {
 	return &service{
-		dbConn: dbConn,
+		dbConn:         dbConn,
+		storageChecker: storageChecker,
 	}
 }
 
-// GetServiceHealth checks all connection-related functionality and returned the error if any
-func (s *service) GetServiceHealth(ctx context.Context) error {
+// GetServiceHealth checks all connection-related functionality and the storage, and returned the error if any
+func (s *service) GetServiceHealth(ctx context.Context) (Health, error) {
 	// Test sql connection
 	err := s.dbConn.PingContext(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to connect to sql DB: %v", err)
+		return Health{}, fmt.Errorf("failed to connect to sql DB: %v", err)
+	}
+
+	// Test the storage is writable
+	storage, err := s.storageChecker.CheckStorage(ctx)
+	if err != nil {
+		return Health{}, fmt.Errorf("failed to check storage: %v", err)
 	}
-	return nil
+	return Health{
+		Status:  "OK",
+		Storage: storage,
+	}, nil
 }
@@ -7,27 +7,51 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
 	"github.com/jmoiron/sqlx"
+
+	filesSvc "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service"
+	filesSvcMock "github.com/cityos-dev/Cornelius-David-Herianto/internal/files/service/mocks"
 )
 
 func Test_service_GetServiceHealth(t *testing.T) {
+	storage := filesSvc.StorageReport{
+		Disks:            []filesSvc.DiskReport{{Path: "storage/videos", FreeBytes: 2048, TotalBytes: 4096, FreeInodes: 10, TotalInodes: 100}},
+		AcceptingUploads: true,
+	}
 	tests := []struct {
 		name     string
-		mockFunc func(sqlMock sqlmock.Sqlmock)
+		mockFunc func(sqlMock sqlmock.Sqlmock, mockFilesSvc *filesSvcMock.MockService)
+		want     Health
 		wantErr  bool
 	}{
 		{
 			name: "all goes well",
-			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+			mockFunc: func(sqlMock sqlmock.Sqlmock, mockFilesSvc *filesSvcMock.MockService) {
 				sqlMock.ExpectPing().WillReturnError(nil)
+				mockFilesSvc.EXPECT().CheckStorage(context.Background()).Return(storage, nil)
+			},
+			want: Health{
+				Status:  "OK",
+				Storage: storage,
 			},
 			wantErr: false,
 		},
 		{
 			name: "failed get health",
-			mockFunc: func(sqlMock sqlmock.Sqlmock) {
+			mockFunc: func(sqlMock sqlmock.Sqlmock, mockFilesSvc *filesSvcMock.MockService) {
 				sqlMock.ExpectPing().WillReturnError(fmt.Errorf("some-error"))
 			},
+			want:    Health{},
+			wantErr: true,
+		},
+		{
+			name: "storage is not writable",
+			mockFunc: func(sqlMock sqlmock.Sqlmock, mockFilesSvc *filesSvcMock.MockService) {
+				sqlMock.ExpectPing().WillReturnError(nil)
+				mockFilesSvc.EXPECT().CheckStorage(context.Background()).Return(filesSvc.StorageReport{}, fmt.Errorf("some-error"))
+			},
+			want:    Health{},
 			wantErr: true,
 		},
 	}
@@ -38,20 +62,29 @@ func Test_service_GetServiceHealth(t *testing.T) {
 				t.Errorf("error when opening a database connection: %v\n", err)
 			}
 			defer mockDB.Close()
-			tt.mockFunc(sqlMock)
+			ctrl := gomock.NewController(t)
+			mockFilesSvc := filesSvcMock.NewMockService(ctrl)
+			tt.mockFunc(sqlMock, mockFilesSvc)
+
 			s := &service{
-				dbConn: sqlx.NewDb(mockDB, "postgres"),
+				dbConn:         sqlx.NewDb(mockDB, "postgres"),
+				storageChecker: mockFilesSvc,
 			}
-			if err := s.GetServiceHealth(context.Background()); (err != nil) != tt.wantErr {
+			got, err := s.GetServiceHealth(context.Background())
+			if (err != nil) != tt.wantErr {
 				t.Errorf("GetServiceHealth() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetServiceHealth() got = %+v, want %+v", got, tt.want)
+			}
 		})
 	}
 }
 
 func TestNew(t *testing.T) {
 	type args struct {
-		dbConn *sqlx.DB
+		dbConn         *sqlx.DB
+		storageChecker StorageChecker
 	}
 	tests := []struct {
 		name string
@@ -61,16 +94,18 @@ func TestNew(t *testing.T) {
 		{
 			name: "success get new Service instance",
 			args: args{
-				dbConn: nil,
+				dbConn:         nil,
+				storageChecker: nil,
 			},
 			want: &service{
-				dbConn: nil,
+				dbConn:         nil,
+				storageChecker: nil,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := New(tt.args.dbConn); !reflect.DeepEqual(got, tt.want) {
+			if got := New(tt.args.dbConn, tt.args.storageChecker); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})